@@ -0,0 +1,76 @@
+package sentrydsn
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// protocol version and client name SetAuth sends unless told otherwise
+const (
+	defaultAuthVersion = "7"
+	defaultAuthClient  = "sentrydsn/1.0"
+)
+
+// AuthOption adjusts the X-Sentry-Auth header written by SetAuth.
+type AuthOption func(*authHeader)
+
+type authHeader struct {
+	version   string
+	client    string
+	timestamp time.Time
+	stamped   bool  //timestamp set by WithTimestamp
+	clock     Clock //tells the time otherwise
+	secret    bool
+}
+
+// WithClient sets sentry_client, e.g. to the name and version of the SDK a forwarded request came from.
+func WithClient(client string) AuthOption {
+	return func(a *authHeader) { a.client = client }
+}
+
+// WithVersion sets sentry_version, the ingest protocol version.
+func WithVersion(version string) AuthOption {
+	return func(a *authHeader) { a.version = version }
+}
+
+// WithTimestamp sets sentry_timestamp; the zero time leaves it out.
+func WithTimestamp(t time.Time) AuthOption {
+	return func(a *authHeader) { a.timestamp, a.stamped = t, true }
+}
+
+// WithClock takes sentry_timestamp from c rather than the system clock, unless WithTimestamp sets it.
+func WithClock(c Clock) AuthOption {
+	return func(a *authHeader) { a.clock = c }
+}
+
+// WithoutSecret leaves sentry_secret out even when the DSN has a secret key.
+func WithoutSecret() AuthOption {
+	return func(a *authHeader) { a.secret = false }
+}
+
+// SetAuth writes an X-Sentry-Auth header for d onto an outgoing request, the counterpart of what FromRequest reads:
+// protocol version 7, a sentry_client, the current time by the system clock or WithClock, the public key and the
+// secret key if d has one.
+func (d *DSN) SetAuth(r *http.Request, opts ...AuthOption) {
+
+	a := authHeader{version: defaultAuthVersion, client: defaultAuthClient, secret: true}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	if !a.stamped {
+		a.timestamp = Now(a.clock)
+	}
+	h := "Sentry sentry_version=" + a.version
+	if len(a.client) > 0 {
+		h += ", sentry_client=" + a.client
+	}
+	if !a.timestamp.IsZero() {
+		h += ", sentry_timestamp=" + strconv.FormatInt(a.timestamp.Unix(), 10)
+	}
+	h += ", sentry_key=" + d.PublicKey
+	if a.secret && len(d.SecretKey) > 0 {
+		h += ", sentry_secret=" + d.SecretKey
+	}
+	r.Header.Set(http_x_sentry_auth, h)
+}
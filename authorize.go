@@ -0,0 +1,230 @@
+package sentrydsn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnauthorized Thrown if an Authorizer refuses a DSN, e.g. because its key was revoked or has expired
+	ErrUnauthorized = errors.New("sentry:  key not authorized")
+	// ErrAuthorizerUnavailable Thrown if an Authorizer cannot reach a decision, e.g. because its service is down
+	ErrAuthorizerUnavailable = errors.New("sentry:  authorizer unavailable")
+)
+
+// RequestMeta describes the request a DSN was derived from, for Authorizers.
+type RequestMeta struct {
+	ClientAddr netip.Addr `json:"client_addr"` //invalid if unknown
+	Method     string     `json:"method"`
+	Path       string     `json:"path"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+}
+
+// NewRequestMeta describes r, with the client address taken as ClientAddr does.
+func NewRequestMeta(r *http.Request, trustedProxies ...netip.Prefix) RequestMeta {
+
+	ip, _ := ClientAddr(r, trustedProxies...)
+	return RequestMeta{ClientAddr: ip, Method: r.Method, Path: r.URL.Path, UserAgent: r.UserAgent()}
+}
+
+// Authorizer decides, after parsing, whether a DSN may be used, so keys can be revoked or time-limited
+// centrally without redeploying allowlists. Refusals should wrap ErrUnauthorized. Authorize is called from
+// concurrent requests; errors other than refusals should wrap ErrAuthorizerUnavailable.
+type Authorizer interface {
+	Authorize(ctx context.Context, dsn *DSN, meta RequestMeta) error
+}
+
+// AuthorizerFunc adapts an ordinary function to the Authorizer interface.
+type AuthorizerFunc func(ctx context.Context, dsn *DSN, meta RequestMeta) error
+
+// Authorize calls f(ctx, dsn, meta).
+func (f AuthorizerFunc) Authorize(ctx context.Context, dsn *DSN, meta RequestMeta) error {
+	return f(ctx, dsn, meta)
+}
+
+// defaults applied when the HTTPAuthorizer fields are unset
+const (
+	defaultAuthorizeTTL        = time.Minute
+	defaultAuthorizeFailureTTL = 5 * time.Second
+	defaultAuthorizeTimeout    = 5 * time.Second
+)
+
+// HTTPAuthorizer is an Authorizer asking a central service. It POSTs
+//
+//	{"project_id": "1234", "public_key": "...", "host": "...", "endpoint": "envelope", "request": {...}}
+//
+// to URL; a 2xx answer allows the key, 401, 403 and 404 refuse it with ErrUnauthorized and anything else,
+// including an unreachable service, fails with ErrAuthorizerUnavailable unless FailOpen is set. Decisions are
+// remembered per project and key for TTL, so the service sees one call per key and minute rather than one per
+// event, and concurrent requests for a key share one call. The shared call outlives a request whose client goes
+// away, so that request's cancellation never becomes everyone's answer. Undecided answers are remembered for
+// FailureTTL, so a failing service is not asked again by every request; calls that timed out are not
+// remembered. Projects and keys are client supplied, so at most MaxEntries answers are remembered.
+type HTTPAuthorizer struct {
+	URL        string
+	Client     *http.Client  //http.DefaultClient when nil
+	Timeout    time.Duration //bounds each call to the service, 5 seconds when unset
+	TTL        time.Duration //how long decisions are remembered, one minute when unset
+	FailureTTL time.Duration //how long undecided answers are remembered, 5 seconds when unset
+	MaxEntries int           //answers remembered, 10000 when unset
+	FailOpen   bool          //allow keys while the service cannot answer
+
+	Clock Clock //tells the time for remembered decisions; the system clock when nil
+
+	mu        sync.Mutex
+	decisions map[authorizeKey]authorizeDecision
+	calls     map[authorizeKey]*authorizeCall
+}
+
+type authorizeKey struct {
+	projectID string
+	publicKey string
+}
+
+type authorizeDecision struct {
+	err     error
+	final   bool //the service decided, rather than failed to answer
+	expires time.Time
+}
+
+// authorizeCall is a call to the service in flight; callers for the same key wait for it
+type authorizeCall struct {
+	done  chan struct{} //closed once err and final are set
+	err   error
+	final bool
+}
+
+// Authorize implements Authorizer.
+func (a *HTTPAuthorizer) Authorize(ctx context.Context, dsn *DSN, meta RequestMeta) error {
+
+	key := authorizeKey{dsn.ProjectID, dsn.PublicKey}
+	a.mu.Lock()
+	if d, ok := a.decisions[key]; ok && Now(a.Clock).Before(d.expires) {
+		a.mu.Unlock()
+		return a.answer(d.err, d.final)
+	}
+	c, ok := a.calls[key]
+	if !ok {
+		if a.calls == nil {
+			a.calls = map[authorizeKey]*authorizeCall{}
+		}
+		c = &authorizeCall{done: make(chan struct{})}
+		a.calls[key] = c
+		go a.call(context.WithoutCancel(ctx), key, c, dsn, meta)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return a.answer(c.err, c.final)
+	case <-ctx.Done():
+		return a.answer(fmt.Errorf("%w: %w", ErrAuthorizerUnavailable, ctx.Err()), false)
+	}
+}
+
+// call asks the service on behalf of every caller for key and remembers the answer.
+func (a *HTTPAuthorizer) call(ctx context.Context, key authorizeKey, c *authorizeCall, dsn *DSN, meta RequestMeta) {
+
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = defaultAuthorizeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c.err, c.final = a.ask(ctx, dsn, meta)
+
+	a.mu.Lock()
+	delete(a.calls, key)
+	//a timeout says nothing about the key, and the next request may well get an answer
+	if !errors.Is(c.err, context.Canceled) && !errors.Is(c.err, context.DeadlineExceeded) {
+		a.remember(key, c.err, c.final)
+	}
+	a.mu.Unlock()
+	close(c.done)
+}
+
+// answer returns err, or nil for undecided answers when FailOpen is set.
+func (a *HTTPAuthorizer) answer(err error, final bool) error {
+
+	if !final && a.FailOpen {
+		return nil
+	}
+	return err
+}
+
+// remember records an answer for its TTL; a.mu must be held.
+func (a *HTTPAuthorizer) remember(key authorizeKey, err error, final bool) {
+
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = defaultAuthorizeTTL
+	}
+	if !final {
+		ttl = a.FailureTTL
+		if ttl <= 0 {
+			ttl = defaultAuthorizeFailureTTL
+		}
+	}
+	maxEntries := a.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+	now := Now(a.Clock)
+	if a.decisions == nil {
+		a.decisions = map[authorizeKey]authorizeDecision{}
+	}
+	//random keys must not grow the map without bound
+	if _, ok := a.decisions[key]; !ok && len(a.decisions) >= maxEntries {
+		for k, d := range a.decisions {
+			if !now.Before(d.expires) {
+				delete(a.decisions, k)
+			}
+		}
+		if len(a.decisions) >= maxEntries {
+			return
+		}
+	}
+	a.decisions[key] = authorizeDecision{err: err, final: final, expires: now.Add(ttl)}
+}
+
+// ask calls the service and reports whether its answer is a decision worth remembering.
+func (a *HTTPAuthorizer) ask(ctx context.Context, dsn *DSN, meta RequestMeta) (error, bool) {
+
+	body, _ := json.Marshal(struct {
+		ProjectID string       `json:"project_id"`
+		PublicKey string       `json:"public_key"`
+		Host      string       `json:"host"`
+		Endpoint  EndpointType `json:"endpoint,omitempty"`
+		Request   RequestMeta  `json:"request"`
+	}{dsn.ProjectID, dsn.PublicKey, dsn.Host, dsn.Endpoint, meta})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAuthorizerUnavailable, err), false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAuthorizerUnavailable, err), false
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil, true
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound:
+		return ErrUnauthorized, true
+	}
+	return fmt.Errorf("%w: responded %d", ErrAuthorizerUnavailable, resp.StatusCode), false
+}
@@ -0,0 +1,207 @@
+package sentrydsn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testTableHTTPAuthorizer = []struct {
+	status      int
+	failOpen    bool
+	description string
+	expected    error
+}{
+	{http.StatusNoContent, false, "allowed", nil},
+	{http.StatusForbidden, false, "revoked", ErrUnauthorized},
+	{http.StatusNotFound, false, "unknown key", ErrUnauthorized},
+	{http.StatusInternalServerError, false, "service failing", ErrAuthorizerUnavailable},
+	{http.StatusInternalServerError, true, "service failing, fail open", nil},
+}
+
+func TestHTTPAuthorizer(t *testing.T) {
+	for _, test := range testTableHTTPAuthorizer {
+		//setup
+		var got map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			w.WriteHeader(test.status)
+		}))
+		a := &HTTPAuthorizer{URL: srv.URL, FailOpen: test.failOpen}
+		r := httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/", nil)
+		r.RemoteAddr = "203.0.113.7:4711"
+		dsn := &DSN{PublicKey: "4784fbc50de2473f9977cfce8a9adce5", ProjectID: "1234", Host: "relay.example.com", Endpoint: EndpointEnvelope}
+
+		//tests
+		if err := a.Authorize(context.Background(), dsn, NewRequestMeta(r)); !errors.Is(err, test.expected) || (test.expected == nil) != (err == nil) {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, err)
+		}
+		req, _ := got["request"].(map[string]any)
+		if got["project_id"] != "1234" || got["public_key"] != dsn.PublicKey || got["endpoint"] != "envelope" || req["client_addr"] != "203.0.113.7" {
+			t.Errorf("%s: Expected -- the DSN and request described -- Got %v", test.description, got)
+		}
+		srv.Close()
+	}
+}
+
+func TestHTTPAuthorizerCache(t *testing.T) {
+	//setup
+	var calls atomic.Int64
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &HTTPAuthorizer{URL: srv.URL, TTL: time.Minute, Clock: ClockFunc(func() time.Time { return now })}
+	dsn := &DSN{PublicKey: "4784fbc50de2473f9977cfce8a9adce5", ProjectID: "1234"}
+	authorize := func() error {
+		return a.Authorize(context.Background(), dsn, RequestMeta{})
+	}
+
+	//tests
+	authorize()
+	status.Store(http.StatusForbidden)
+	if err := authorize(); err != nil || calls.Load() != 1 {
+		t.Errorf("Expected -- the allowed decision remembered -- Got %v after %d calls", err, calls.Load())
+	}
+	now = now.Add(2 * time.Minute)
+	if err := authorize(); !errors.Is(err, ErrUnauthorized) || calls.Load() != 2 {
+		t.Errorf("Expected -- %v after the TTL -- Got %v after %d calls", ErrUnauthorized, err, calls.Load())
+	}
+	status.Store(http.StatusBadGateway)
+	now = now.Add(2 * time.Minute)
+	authorize()
+	if err := authorize(); !errors.Is(err, ErrAuthorizerUnavailable) || calls.Load() != 3 {
+		t.Errorf("Expected -- the undecided answer remembered -- Got %v after %d calls", err, calls.Load())
+	}
+	//briefly
+	now = now.Add(10 * time.Second)
+	authorize()
+	if calls.Load() != 4 {
+		t.Errorf("Expected -- asked again after the FailureTTL -- Got %d calls", calls.Load())
+	}
+}
+
+func TestHTTPAuthorizerConcurrent(t *testing.T) {
+	//setup
+	var calls atomic.Int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+	}))
+	defer srv.Close()
+	a := &HTTPAuthorizer{URL: srv.URL}
+	dsn := &DSN{PublicKey: "4784fbc50de2473f9977cfce8a9adce5", ProjectID: "1234"}
+
+	//tests
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.Authorize(context.Background(), dsn, RequestMeta{}); err != nil {
+				t.Errorf("Expected -- <nil> -- Got %v", err)
+			}
+		}()
+	}
+	//let the waiting requests line up behind the first call
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("Expected -- one call for concurrent requests -- Got %d", calls.Load())
+	}
+}
+
+func TestHTTPAuthorizerMaxEntries(t *testing.T) {
+	//setup
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+	a := &HTTPAuthorizer{URL: srv.URL, MaxEntries: 2}
+
+	//tests
+	for _, key := range []string{"a", "b", "c"} {
+		a.Authorize(context.Background(), &DSN{PublicKey: key, ProjectID: "1234"}, RequestMeta{})
+	}
+	if len(a.decisions) != 2 {
+		t.Errorf("Expected -- 2 decisions remembered -- Got %d", len(a.decisions))
+	}
+	//keys that did not fit are asked again
+	a.Authorize(context.Background(), &DSN{PublicKey: "c", ProjectID: "1234"}, RequestMeta{})
+	if calls.Load() != 4 {
+		t.Errorf("Expected -- 4 calls -- Got %d", calls.Load())
+	}
+}
+
+func TestHTTPAuthorizerCanceled(t *testing.T) {
+	//setup
+	var calls atomic.Int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-release
+		}
+	}))
+	defer srv.Close()
+	a := &HTTPAuthorizer{URL: srv.URL}
+	dsn := &DSN{PublicKey: "4784fbc50de2473f9977cfce8a9adce5", ProjectID: "1234"}
+
+	//tests
+	//the first client goes away while the call it started is in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { errs <- a.Authorize(ctx, dsn, RequestMeta{}) }()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() { errs <- a.Authorize(context.Background(), dsn, RequestMeta{}) }()
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected -- %v -- Got %v", context.Canceled, err)
+	}
+	close(release)
+	if err := <-errs; err != nil {
+		t.Errorf("Expected -- the shared call to finish for the other request -- Got %v", err)
+	}
+	if err := a.Authorize(context.Background(), dsn, RequestMeta{}); err != nil || calls.Load() != 1 {
+		t.Errorf("Expected -- <nil> from the remembered decision -- Got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestHTTPAuthorizerTimeout(t *testing.T) {
+	//setup
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	a := &HTTPAuthorizer{URL: srv.URL, Timeout: 10 * time.Millisecond}
+	dsn := &DSN{PublicKey: "4784fbc50de2473f9977cfce8a9adce5", ProjectID: "1234"}
+
+	//tests
+	if err := a.Authorize(context.Background(), dsn, RequestMeta{}); !errors.Is(err, ErrAuthorizerUnavailable) {
+		t.Errorf("Expected -- %v -- Got %v", ErrAuthorizerUnavailable, err)
+	}
+	//the timeout is not remembered as a failure
+	if err := a.Authorize(context.Background(), dsn, RequestMeta{}); err != nil || calls.Load() != 2 {
+		t.Errorf("Expected -- <nil> from a second call -- Got %v after %d calls", err, calls.Load())
+	}
+}
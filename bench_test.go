@@ -0,0 +1,60 @@
+package sentrydsn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//setup
+
+func benchRequests() []struct {
+	name    string
+	request *http.Request
+	budget  float64 //allocations allowed per FromRequest
+} {
+	header := httptest.NewRequest("POST", "https://sentry.io/api/1234/store/", nil)
+	header.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=raven-python/5.27.0, sentry_timestamp=1614144877.269, sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+	query := httptest.NewRequest("POST", "https://sentry.io/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5&sentry_version=7", nil)
+	envelope := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5&sentry_version=7&sentry_client=sentry.javascript.browser%2F7.0.0", nil)
+
+	return []struct {
+		name    string
+		request *http.Request
+		budget  float64
+	}{
+		{"Header", header, 8},
+		{"Query", query, 12},
+		{"Envelope", envelope, 14},
+	}
+}
+
+//tests
+
+func BenchmarkFromRequest(b *testing.B) {
+	for _, bench := range benchRequests() {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := FromRequest(bench.request); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestFromRequestAllocs keeps the happy path within its allocation budget; raise a budget only deliberately.
+func TestFromRequestAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are inflated under the race detector")
+	}
+	for _, test := range benchRequests() {
+		got := testing.AllocsPerRun(100, func() {
+			FromRequest(test.request)
+		})
+		if got > test.budget {
+			t.Errorf("%s: Expected -- at most %v allocations -- Got %v", test.name, test.budget, got)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package sentrydsn
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrBodyUnavailable Thrown if a request announced a body that can no longer be read, usually because
+	// middleware ahead of the extractor consumed or closed it; see BufferBody
+	ErrBodyUnavailable = errors.New("sentry:  request body unavailable")
+	// ErrBodyTooLarge Thrown if a request body exceeds the limit it is read with
+	ErrBodyTooLarge = errors.New("sentry:  request body too large")
+)
+
+// ReadBody reads all of r.Body, at most max bytes, and returns ErrBodyTooLarge for longer bodies, including
+// bodies cut short by an http.MaxBytesReader. A body that announced a Content-Length but yields nothing fails
+// with ErrBodyUnavailable. r.Body is consumed.
+func ReadBody(r *http.Request, max int64) ([]byte, error) {
+
+	if r.Body == nil || r.Body == http.NoBody {
+		if r.ContentLength > 0 {
+			return nil, ErrBodyUnavailable
+		}
+		return nil, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	if int64(len(b)) > max {
+		return nil, ErrBodyTooLarge
+	}
+	if len(b) == 0 && r.ContentLength > 0 {
+		return nil, ErrBodyUnavailable
+	}
+	return b, nil
+}
+
+// BufferBody reads r.Body, at most max bytes, into memory and replaces it with a copy that GetBody can hand out
+// again, so body-dependent extraction (BodyDSN, relay signatures) still works behind middleware that reads the
+// body itself. Install it ahead of such middleware. Errors are those of ReadBody.
+func BufferBody(r *http.Request, max int64) error {
+
+	b, err := ReadBody(r, max)
+	if err != nil {
+		return err
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	r.Body.Close()
+	r.ContentLength = int64(len(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return nil
+}
+
+// bodyError maps the errors of reading a consumed or capped body onto ErrBodyUnavailable and ErrBodyTooLarge.
+func bodyError(err error) error {
+
+	var mb *http.MaxBytesError
+	switch {
+	case errors.As(err, &mb):
+		return ErrBodyTooLarge
+	case errors.Is(err, http.ErrBodyReadAfterClose):
+		return ErrBodyUnavailable
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package sentrydsn
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//setup
+
+// consumedRequest is a request whose body was read by middleware before the extractor ran
+func consumedRequest(body string) *http.Request {
+	r := httptest.NewRequest("POST", "https://tunnel.example.com/tunnel", strings.NewReader(body))
+	io.ReadAll(r.Body)
+	return r
+}
+
+var testTableReadBody = []struct {
+	request     func() *http.Request
+	max         int64
+	description string
+	expected    string
+	err         error
+}{
+	{func() *http.Request { return httptest.NewRequest("POST", "/", strings.NewReader("{}")) }, 10, "whole body", "{}", nil},
+	{func() *http.Request { return httptest.NewRequest("POST", "/", strings.NewReader("0123456789ab")) }, 10, "too large", "", ErrBodyTooLarge},
+	{func() *http.Request { return httptest.NewRequest("GET", "/", nil) }, 10, "no body", "", nil},
+	{func() *http.Request { return consumedRequest("{}") }, 10, "consumed body", "", ErrBodyUnavailable},
+	{func() *http.Request {
+		r := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		r.Body = http.NoBody
+		return r
+	}, 10, "body replaced by NoBody", "", ErrBodyUnavailable},
+	{func() *http.Request {
+		r := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, 1)
+		return r
+	}, 10, "MaxBytesReader limit", "", ErrBodyTooLarge},
+}
+
+//tests
+
+func TestReadBody(t *testing.T) {
+	for _, test := range testTableReadBody {
+		got, err := ReadBody(test.request(), test.max)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if string(got) != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	body := `{"dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234"}`
+	r := httptest.NewRequest("POST", "https://tunnel.example.com/tunnel", strings.NewReader(body))
+	if err := BufferBody(r, 1<<10); err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	//middleware reading the body leaves GetBody for the extractor
+	io.ReadAll(r.Body)
+	r.Body, _ = r.GetBody()
+	dsn, err := BodyDSN(0).Extract(r)
+	if err != nil || dsn.ProjectID != "1234" {
+		t.Errorf("Expected -- 1234 -- Got %v %v", dsn, err)
+	}
+	if err := BufferBody(consumedRequest(body), 1<<10); err != ErrBodyUnavailable {
+		t.Errorf("Expected -- %v -- Got %v", ErrBodyUnavailable, err)
+	}
+}
+
+func TestBodyDSNConsumed(t *testing.T) {
+	if _, err := BodyDSN(0).Extract(consumedRequest(`{"dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234"}`)); err != ErrBodyUnavailable {
+		t.Errorf("Expected -- %v -- Got %v", ErrBodyUnavailable, err)
+	}
+	if got := ErrorKind(ErrBodyUnavailable); got != "body_unavailable" {
+		t.Errorf("Expected -- body_unavailable -- Got %v", got)
+	}
+}
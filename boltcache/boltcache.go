@@ -0,0 +1,159 @@
+// Package boltcache stores sentrydsn cache entries in a local bbolt file, so parsed DSNs and resolved legacy
+// project IDs survive tunnel restarts in deployments without Redis:
+//
+//	store, err := boltcache.Open("/var/lib/relay/cache.db")
+//	defer store.Close()
+//	cache := &sentrydsn.Cache{Shared: store}
+//	parser := &sentrydsn.Parser{ResolveProject: lookup, ResolveCache: store}
+//
+// It lives in its own module so sentrydsn itself does not depend on bbolt.
+package boltcache
+
+import (
+	"context"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucket the entries are kept in
+var bucket = []byte("sentrydsn")
+
+// defaults applied when the Store fields are unset
+const (
+	defaultOpenTimeout = time.Second //time Open waits for another process holding the file
+	defaultMaxEntries  = 100000
+)
+
+// Store is a sentrydsn.SharedCache backed by a bbolt file. bbolt locks the file, so one Store per file and
+// process; a Store is safe for concurrent use. Expired entries are not returned and are removed by Sweep.
+// Cache keys are derived from client requests, so at most MaxEntries are stored; Set skips new keys beyond
+// that until Sweep frees room.
+type Store struct {
+	db         *bolt.DB
+	entries    atomic.Int64
+	MaxEntries int             //entries stored, 100000 when unset
+	Clock      sentrydsn.Clock //tells the time for expiry, the system clock when nil
+}
+
+// Open opens or creates the bbolt file at path.
+func Open(path string) (*Store, error) {
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: defaultOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		s.entries.Store(int64(b.Stats().KeyN))
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get implements sentrydsn.SharedCache.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+
+	var value []byte
+	now := sentrydsn.Now(s.Clock)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v, ok := decode(tx.Bucket(bucket).Get([]byte(key)), now); ok {
+			//bbolt values are only valid inside the transaction
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Set implements sentrydsn.SharedCache. Concurrent calls are batched into one bbolt write transaction and
+// file sync, so a burst of cache misses does not sync once per entry.
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+
+	maxEntries := int64(s.MaxEntries)
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	expires := sentrydsn.Now(s.Clock).Add(ttl)
+	var added bool
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		//Batch may run this again on its own, so added is set afresh
+		added = false
+		b := tx.Bucket(bucket)
+		if b.Get([]byte(key)) == nil {
+			if s.entries.Load() >= maxEntries {
+				return nil
+			}
+			added = true
+		}
+		return b.Put([]byte(key), encode(value, expires))
+	})
+	if err == nil && added {
+		s.entries.Add(1)
+	}
+	return err
+}
+
+// Sweep removes expired entries and returns how many, e.g. from a ticker, since bbolt files only grow.
+func (s *Store) Sweep() (int, error) {
+
+	var expired [][]byte
+	now := sentrydsn.Now(s.Clock)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		//deleting while iterating skips entries, so collect the keys first
+		b.ForEach(func(k, v []byte) error {
+			if _, ok := decode(v, now); !ok {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.entries.Add(-int64(len(expired)))
+	return len(expired), nil
+}
+
+// encode prefixes value with its expiry in Unix nanoseconds
+func encode(value []byte, expires time.Time) []byte {
+
+	b := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(b, uint64(expires.UnixNano()))
+	return append(b, value...)
+}
+
+// decode returns the value of an entry still valid at now
+func decode(b []byte, now time.Time) ([]byte, bool) {
+
+	if len(b) < 8 {
+		return nil, false
+	}
+	if !now.Before(time.Unix(0, int64(binary.BigEndian.Uint64(b)))) {
+		return nil, false
+	}
+	return b[8:], true
+}
@@ -0,0 +1,125 @@
+package boltcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func TestStore(t *testing.T) {
+	//setup
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := sentrydsn.ClockFunc(func() time.Time { return now })
+	path := filepath.Join(t.TempDir(), "cache.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Clock = clock
+	ctx := context.Background()
+
+	//tests
+	s.Set(ctx, "a", []byte("1234"), time.Minute)
+	s.Set(ctx, "b", []byte("42"), time.Hour)
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "1234" {
+		t.Errorf("Expected -- 1234 -- Got %q %v", v, err)
+	}
+	if v, err := s.Get(ctx, "missing"); err != nil || v != nil {
+		t.Errorf("Expected -- nil for a missing key -- Got %q %v", v, err)
+	}
+
+	//entries survive reopening
+	s.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Clock = clock
+	now = now.Add(2 * time.Minute)
+	if v, _ := s.Get(ctx, "a"); v != nil {
+		t.Errorf("Expected -- nil once expired -- Got %q", v)
+	}
+	if v, _ := s.Get(ctx, "b"); string(v) != "42" {
+		t.Errorf("Expected -- 42 after reopening -- Got %q", v)
+	}
+	if n, err := s.Sweep(); err != nil || n != 1 {
+		t.Errorf("Expected -- 1 entry swept -- Got %d %v", n, err)
+	}
+	if v, _ := s.Get(ctx, "b"); string(v) != "42" {
+		t.Errorf("Expected -- 42 kept by Sweep -- Got %q", v)
+	}
+}
+
+func TestStoreResolveProject(t *testing.T) {
+	//setup
+	path := filepath.Join(t.TempDir(), "cache.db")
+	calls := 0
+	resolve := func(publicKey string) (string, error) {
+		calls++
+		return "1234", nil
+	}
+	legacy := func() *sentrydsn.DSN {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		p := &sentrydsn.Parser{ResolveProject: resolve, ResolveCache: s}
+		dsn, _ := p.FromRequest(httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil))
+		return dsn
+	}
+
+	//tests
+	legacy()
+	if dsn := legacy(); dsn == nil || dsn.ProjectID != "1234" || calls != 1 {
+		t.Errorf("Expected -- 1234 resolved once across restarts -- Got %v after %d lookups", dsn, calls)
+	}
+}
+
+func TestStoreMaxEntries(t *testing.T) {
+	//setup
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cache.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxEntries = 2
+	s.Clock = sentrydsn.ClockFunc(func() time.Time { return now })
+	ctx := context.Background()
+
+	//tests
+	s.Set(ctx, "a", []byte("1"), time.Minute)
+	s.Set(ctx, "b", []byte("2"), time.Hour)
+	s.Set(ctx, "c", []byte("3"), time.Hour)
+	if v, _ := s.Get(ctx, "c"); v != nil {
+		t.Errorf("Expected -- nil beyond MaxEntries -- Got %q", v)
+	}
+	//existing keys are still updated
+	s.Set(ctx, "b", []byte("4"), time.Hour)
+	if v, _ := s.Get(ctx, "b"); string(v) != "4" {
+		t.Errorf("Expected -- 4 -- Got %q", v)
+	}
+	//the count survives reopening, and Sweep frees room
+	s.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.MaxEntries = 2
+	s.Clock = sentrydsn.ClockFunc(func() time.Time { return now })
+	s.Set(ctx, "c", []byte("3"), time.Hour)
+	if v, _ := s.Get(ctx, "c"); v != nil {
+		t.Errorf("Expected -- nil beyond MaxEntries after reopening -- Got %q", v)
+	}
+	now = now.Add(2 * time.Minute)
+	s.Sweep()
+	s.Set(ctx, "c", []byte("3"), time.Hour)
+	if v, _ := s.Get(ctx, "c"); string(v) != "3" {
+		t.Errorf("Expected -- 3 once swept -- Got %q", v)
+	}
+}
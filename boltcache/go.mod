@@ -0,0 +1,12 @@
+module github.com/sentry-demos/sentrydsn/boltcache
+
+go 1.24
+
+require (
+	github.com/sentry-demos/sentrydsn v0.0.0
+	go.etcd.io/bbolt v1.4.3
+)
+
+require golang.org/x/sys v0.29.0 // indirect
+
+replace github.com/sentry-demos/sentrydsn => ../
@@ -0,0 +1,228 @@
+package sentrydsn
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaults for a zero Cache
+const (
+	defaultCacheTTL     = time.Minute
+	defaultCacheEntries = 10000
+)
+
+// prefix of the keys Cache writes to a SharedCache
+const sharedCachePrefix = "sentrydsn:dsn:"
+
+// Cache remembers DSNs derived from requests, keyed on the auth headers, host, path and query string, so busy
+// tunnels skip re-parsing the same SDK traffic. Entries expire after TTL and the least recently used entry is
+// evicted beyond MaxEntries. Only successful results are cached.
+// One Cache may be shared by several middleware instances as long as they wrap identically configured
+// extractors, and it should not wrap extractors whose result depends on anything else in the request, such as
+// Parser.MaxAuthAge, relay signatures, TrustedProxies or BodyDSN. A Cache is safe for concurrent use.
+//
+// With Shared set, local misses are looked up in, and results written through to, a cache shared by a fleet
+// of tunnels, so each request shape is parsed once per fleet rather than once per instance.
+type Cache struct {
+	TTL        time.Duration //how long an entry stays valid, one minute when unset
+	MaxEntries int           //entries kept before the least recently used is evicted, 10000 when unset
+	Shared     SharedCache   //second tier shared between instances, e.g. Redis, when set
+	Clock      Clock         //tells the time for TTLs, the system clock when nil
+
+	mu        sync.Mutex
+	ll        *list.List //most recently used at the front
+	items     map[string]*list.Element
+	hits      int64
+	shared    int64
+	misses    int64
+	evictions int64
+}
+
+// CacheStats are a Cache's counters since it was created.
+type CacheStats struct {
+	Hits       int64 `json:"hits"`
+	SharedHits int64 `json:"shared_hits"` //misses answered by Cache.Shared
+	Misses     int64 `json:"misses"`      //lookups that found nothing or an expired entry
+	Evictions  int64 `json:"evictions"`
+	Entries    int   `json:"entries"`
+}
+
+// SharedCache is a cache tier outside the process, shared by several tunnel instances or kept across restarts,
+// used by Cache and by Parser.ResolveCache. The redisstore module implements it with go-redis, kept apart so
+// this module does not pin a client library; the boltcache module stores entries in a local bbolt file for
+// deployments without Redis. Get returns nil and no error for missing or expired keys. Values are JSON encoded
+// DSNs, including secret keys, or project IDs, stored under hashed keys.
+type SharedCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type cacheEntry struct {
+	key     string
+	dsn     *DSN
+	expires time.Time
+}
+
+// Extractor returns an Extractor that answers from the cache and falls back to e.
+func (c *Cache) Extractor(e Extractor) Extractor {
+
+	return ExtractorFunc(func(r *http.Request) (*DSN, error) {
+		key := cacheKey(r)
+		if dsn, ok := c.get(key); ok {
+			return dsn, nil
+		}
+		if dsn, ok := c.getShared(r.Context(), key); ok {
+			c.put(key, dsn)
+			return dsn, nil
+		}
+		dsn, err := e.Extract(r)
+		if err != nil {
+			return nil, err
+		}
+		c.put(key, dsn)
+		c.putShared(r.Context(), key, dsn)
+		return copyDSN(dsn), nil
+	})
+}
+
+// Stats returns the cache's counters.
+func (c *Cache) Stats() CacheStats {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := CacheStats{Hits: c.hits, SharedHits: c.shared, Misses: c.misses, Evictions: c.evictions}
+	if c.ll != nil {
+		s.Entries = c.ll.Len()
+	}
+	return s
+}
+
+func (c *Cache) get(key string) (*DSN, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if Now(c.Clock).After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits++
+	return copyDSN(entry.dsn), true
+}
+
+func (c *Cache) put(key string, dsn *DSN) {
+
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	max := c.MaxEntries
+	if max <= 0 {
+		max = defaultCacheEntries
+	}
+	entry := &cacheEntry{key: key, dsn: copyDSN(dsn), expires: Now(c.Clock).Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ll == nil {
+		c.ll = list.New()
+		c.items = map[string]*list.Element{}
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	for c.ll.Len() > max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+}
+
+// getShared looks key up in the shared tier. Its failures count as misses, the request is then parsed.
+func (c *Cache) getShared(ctx context.Context, key string) (*DSN, bool) {
+
+	if c.Shared == nil {
+		return nil, false
+	}
+	b, err := c.Shared.Get(ctx, sharedCacheKey(key))
+	if err != nil || b == nil {
+		return nil, false
+	}
+	dsn := &DSN{}
+	if err := json.Unmarshal(b, dsn); err != nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	c.shared++
+	c.mu.Unlock()
+	return dsn, true
+}
+
+// putShared writes dsn through to the shared tier, ignoring failures.
+func (c *Cache) putShared(ctx context.Context, key string, dsn *DSN) {
+
+	if c.Shared == nil {
+		return
+	}
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	b, err := json.Marshal(dsn)
+	if err != nil {
+		return
+	}
+	c.Shared.Set(ctx, sharedCacheKey(key), b, ttl)
+}
+
+// sharedCacheKey hashes key, which holds auth headers, before it leaves the process.
+func sharedCacheKey(key string) string {
+
+	sum := sha256.Sum256([]byte(key))
+	return sharedCachePrefix + hex.EncodeToString(sum[:])
+}
+
+// cacheKey joins the parts of r a header- or query-authenticated DSN is derived from and checked against.
+func cacheKey(r *http.Request) string {
+
+	host := r.URL.Host
+	if len(host) == 0 {
+		host = r.Host
+	}
+	return r.Method + "\x00" + mediaType(r) + "\x00" + r.Header.Get(http_x_sentry_auth) + "\x00" + r.Header.Get("Authorization") + "\x00" + host + "\x00" + r.URL.Path + "?" + r.URL.RawQuery
+}
+
+// copyDSN keeps callers from mutating cached results.
+func copyDSN(d *DSN) *DSN {
+
+	c := *d
+	c.Warnings = append([]Warning(nil), d.Warnings...)
+	if d.Geo != nil {
+		geo := *d.Geo
+		c.Geo = &geo
+	}
+	c.Metadata = maps.Clone(d.Metadata)
+	return &c
+}
@@ -0,0 +1,170 @@
+package sentrydsn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//setup
+
+// countingExtractor counts how often the wrapped parser actually runs
+type countingExtractor struct {
+	calls int
+}
+
+func (c *countingExtractor) Extract(r *http.Request) (*DSN, error) {
+	c.calls++
+	return FromRequest(r)
+}
+
+func cacheRequest(project string) *http.Request {
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/"+project+"/envelope/", nil)
+	r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+	return r
+}
+
+// memoryShared is a SharedCache standing in for Redis
+type memoryShared struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+	down   bool
+}
+
+func (m *memoryShared) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return nil, errors.New("connection refused")
+	}
+	return m.values[key], nil
+}
+
+func (m *memoryShared) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return errors.New("connection refused")
+	}
+	if m.values == nil {
+		m.values, m.ttls = map[string][]byte{}, map[string]time.Duration{}
+	}
+	m.values[key], m.ttls[key] = value, ttl
+	return nil
+}
+
+//tests
+
+func TestCacheHits(t *testing.T) {
+	c := &Cache{}
+	inner := &countingExtractor{}
+	e := c.Extractor(inner)
+
+	for i := 0; i < 3; i++ {
+		got, err := e.Extract(cacheRequest("1234"))
+		if err != nil || got.URL != "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234" {
+			t.Fatalf("Expected -- cached dsn -- Got %v %v", got, err)
+		}
+		got.ProjectID = "mutated"
+	}
+	e.Extract(cacheRequest("5678"))
+	if inner.calls != 2 {
+		t.Errorf("Expected -- 2 parses -- Got %v", inner.calls)
+	}
+	expected := CacheStats{Hits: 2, Misses: 2, Entries: 2}
+	if got := c.Stats(); got != expected {
+		t.Errorf("Expected -- %+v -- Got %+v", expected, got)
+	}
+
+	//errors are not cached
+	bad := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/", nil)
+	e.Extract(bad)
+	e.Extract(bad)
+	if inner.calls != 4 {
+		t.Errorf("Expected -- 4 parses -- Got %v", inner.calls)
+	}
+}
+
+func TestCacheContentType(t *testing.T) {
+	e := (&Cache{}).Extractor(&Parser{StrictContentType: true})
+	r := cacheRequest("1234")
+	r.Header.Set("Content-Type", "application/x-sentry-envelope")
+	if _, err := e.Extract(r); err != nil {
+		t.Fatalf("Expected -- envelope accepted -- Got %v", err)
+	}
+	r = cacheRequest("1234")
+	r.Header.Set("Content-Type", "image/png")
+	if dsn, err := e.Extract(r); err != ErrContentType {
+		t.Errorf("Expected -- %v -- Got %+v %v", ErrContentType, dsn, err)
+	}
+}
+
+func TestCacheExpiryAndEviction(t *testing.T) {
+	inner := &countingExtractor{}
+	expiring := (&Cache{TTL: time.Nanosecond}).Extractor(inner)
+	expiring.Extract(cacheRequest("1234"))
+	time.Sleep(time.Millisecond)
+	expiring.Extract(cacheRequest("1234"))
+	if inner.calls != 2 {
+		t.Errorf("Expected -- expired entry parsed again -- Got %v parses", inner.calls)
+	}
+
+	c := &Cache{MaxEntries: 2}
+	inner = &countingExtractor{}
+	e := c.Extractor(inner)
+	e.Extract(cacheRequest("1"))
+	e.Extract(cacheRequest("2"))
+	e.Extract(cacheRequest("1")) //2 is now least recently used
+	e.Extract(cacheRequest("3"))
+	e.Extract(cacheRequest("1"))
+	if inner.calls != 3 {
+		t.Errorf("Expected -- 3 parses -- Got %v", inner.calls)
+	}
+	if s := c.Stats(); s.Evictions != 1 || s.Entries != 2 {
+		t.Errorf("Expected -- 1 eviction, 2 entries -- Got %+v", s)
+	}
+}
+
+func TestCacheShared(t *testing.T) {
+	c := &Cache{}
+	first, second := &countingExtractor{}, &countingExtractor{}
+	c.Extractor(first).Extract(cacheRequest("1234"))
+	c.Extractor(second).Extract(cacheRequest("1234"))
+	if first.calls != 1 || second.calls != 0 {
+		t.Errorf("Expected -- second middleware served from cache -- Got %v %v", first.calls, second.calls)
+	}
+}
+
+func TestCacheSharedTier(t *testing.T) {
+	shared := &memoryShared{}
+	//two instances of a fleet
+	a, b := &Cache{Shared: shared, TTL: time.Hour}, &Cache{Shared: shared}
+	first, second := &countingExtractor{}, &countingExtractor{}
+
+	expected, _ := a.Extractor(first).Extract(cacheRequest("1234"))
+	got, err := b.Extractor(second).Extract(cacheRequest("1234"))
+	if err != nil || first.calls != 1 || second.calls != 0 || got.URL != expected.URL || got.Endpoint != EndpointEnvelope {
+		t.Errorf("Expected -- second instance served by the shared tier -- Got %v %v %v %v", first.calls, second.calls, got, err)
+	}
+	b.Extractor(second).Extract(cacheRequest("1234"))
+	if s := b.Stats(); s.Hits != 1 || s.SharedHits != 1 || s.Misses != 1 || s.Entries != 1 {
+		t.Errorf("Expected -- 1 hit 1 shared hit -- Got %+v", s)
+	}
+	for key, ttl := range shared.ttls {
+		if !strings.HasPrefix(key, sharedCachePrefix) || strings.Contains(key, "4784fbc50de2473f9977cfce8a9adce5") || ttl != time.Hour {
+			t.Errorf("Expected -- hashed key with the cache TTL -- Got %s %v", key, ttl)
+		}
+	}
+
+	//an unreachable shared tier falls back to parsing
+	shared.down = true
+	if _, err := (&Cache{Shared: shared}).Extractor(second).Extract(cacheRequest("1234")); err != nil || second.calls != 1 {
+		t.Errorf("Expected -- parsed -- Got %v %v", second.calls, err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package sentrytunnel is a Caddy HTTP handler module serving a Sentry tunnel, so sites already behind Caddy
+// can deploy one from the Caddyfile alone:
+//
+//	{
+//		order sentry_tunnel before respond
+//	}
+//
+//	example.com {
+//		sentry_tunnel /tunnel {
+//			upstream      https://o1.ingest.sentry.io
+//			allowed_hosts *.ingest.sentry.io
+//			dsn_body
+//		}
+//	}
+//
+// Build Caddy with it using xcaddy build --with github.com/sentry-demos/sentrydsn/caddy.
+// It lives in its own module so the parser does not depend on Caddy.
+package sentrytunnel
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+	httpcaddyfile.RegisterHandlerDirective("sentry_tunnel", parseCaddyfile)
+}
+
+// Handler forwards Sentry ingest requests upstream through a proxy.Tunnel. It terminates the request;
+// handlers after it in the route are not called.
+type Handler struct {
+	Upstream     string   `json:"upstream,omitempty"`      //base url requests are forwarded to; the DSN host when empty, given AllowedHosts
+	AllowedHosts []string `json:"allowed_hosts,omitempty"` //hosts DSNs may point at, see sentrydsn.HostAllowlist
+	MaxBodySize  int64    `json:"max_body_size,omitempty"` //largest request body in bytes, 40MB when unset
+	DSNHeader    string   `json:"dsn_header,omitempty"`    //read a full DSN from this header instead of path and auth
+	DSNBody      bool     `json:"dsn_body,omitempty"`      //read a full DSN from the JSON body, as browser SDK tunnels send it
+
+	tunnel *proxy.Tunnel
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.sentry_tunnel",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision builds the tunnel. Without upstream requests go to the host of their DSN, which with dsn_header
+// or dsn_body the client names, so allowed_hosts is then required.
+func (h *Handler) Provision(ctx caddy.Context) error {
+
+	if len(h.Upstream) == 0 && len(h.AllowedHosts) == 0 {
+		return errors.New("sentry_tunnel: upstream or allowed_hosts required, or any client chooses where requests are forwarded")
+	}
+	h.tunnel = &proxy.Tunnel{
+		Upstream:     h.Upstream,
+		AllowedHosts: sentrydsn.HostAllowlist(h.AllowedHosts),
+		MaxBodySize:  h.MaxBodySize,
+	}
+	switch {
+	case len(h.DSNHeader) > 0:
+		h.tunnel.Extractor = sentrydsn.HeaderDSN(h.DSNHeader)
+	case h.DSNBody:
+		h.tunnel.Extractor = sentrydsn.BodyDSN(0)
+	}
+	return nil
+}
+
+// Validate rejects conflicting options.
+func (h *Handler) Validate() error {
+
+	if len(h.DSNHeader) > 0 && h.DSNBody {
+		return errors.New("sentry_tunnel: dsn_header and dsn_body are exclusive")
+	}
+	return nil
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+
+	h.tunnel.ServeHTTP(w, r)
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens:
+//
+//	sentry_tunnel [<matcher>] {
+//		upstream      <url>
+//		allowed_hosts <host...>
+//		max_body_size <bytes>
+//		dsn_header    [<name>]
+//		dsn_body
+//	}
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+
+	d.Next() // directive name
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for d.NextBlock(0) {
+		switch d.Val() {
+		case "upstream":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			h.Upstream = d.Val()
+		case "allowed_hosts":
+			hosts := d.RemainingArgs()
+			if len(hosts) == 0 {
+				return d.ArgErr()
+			}
+			h.AllowedHosts = append(h.AllowedHosts, hosts...)
+		case "max_body_size":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := strconv.ParseInt(d.Val(), 10, 64)
+			if err != nil {
+				return d.Errf("max_body_size: %v", err)
+			}
+			h.MaxBodySize = n
+		case "dsn_header":
+			h.DSNHeader = "X-Sentry-DSN"
+			if d.NextArg() {
+				h.DSNHeader = d.Val()
+			}
+		case "dsn_body":
+			h.DSNBody = true
+		default:
+			return d.Errf("unrecognized subdirective %s", d.Val())
+		}
+	}
+	return nil
+}
+
+func parseCaddyfile(helper httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+
+	h := new(Handler)
+	err := h.UnmarshalCaddyfile(helper.Dispenser)
+	return h, err
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.Validator             = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
@@ -0,0 +1,70 @@
+package sentrytunnel
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+var testTableCaddyfile = []struct {
+	input       string
+	description string
+	expected    Handler
+	fails       bool
+}{
+	{`sentry_tunnel`, "defaults", Handler{}, false},
+	{`sentry_tunnel {
+		upstream https://o1.ingest.sentry.io
+		allowed_hosts *.ingest.sentry.io sentry.example.com
+		max_body_size 1048576
+		dsn_header
+	}`, "all options", Handler{
+		Upstream:     "https://o1.ingest.sentry.io",
+		AllowedHosts: []string{"*.ingest.sentry.io", "sentry.example.com"},
+		MaxBodySize:  1048576,
+		DSNHeader:    "X-Sentry-DSN",
+	}, false},
+	{`sentry_tunnel {
+		dsn_body
+	}`, "dsn body", Handler{DSNBody: true}, false},
+	{`sentry_tunnel {
+		upstream
+	}`, "missing upstream", Handler{}, true},
+	{`sentry_tunnel {
+		forward_to somewhere
+	}`, "unknown subdirective", Handler{}, true},
+}
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	for _, test := range testTableCaddyfile {
+		var h Handler
+		err := h.UnmarshalCaddyfile(caddyfile.NewTestDispenser(test.input))
+		if (err != nil) != test.fails {
+			t.Errorf("%s: Expected -- error %v -- Got %v", test.description, test.fails, err)
+		} else if !test.fails && !reflect.DeepEqual(h, test.expected) {
+			t.Errorf("%s: Expected -- %+v -- Got %+v", test.description, test.expected, h)
+		}
+	}
+}
+
+var testTableProvision = []struct {
+	handler     Handler
+	description string
+	fails       bool
+}{
+	{Handler{Upstream: "https://o1.ingest.sentry.io", DSNBody: true}, "upstream", false},
+	{Handler{AllowedHosts: []string{"*.ingest.sentry.io"}, DSNHeader: "X-Sentry-DSN"}, "allowed hosts", false},
+	{Handler{DSNBody: true}, "open forwarder", true},
+	{Handler{}, "defaults", true},
+}
+
+func TestProvision(t *testing.T) {
+	for _, test := range testTableProvision {
+		h := test.handler
+		if err := h.Provision(caddy.Context{}); (err != nil) != test.fails {
+			t.Errorf("%s: Expected -- error %v -- Got %v", test.description, test.fails, err)
+		}
+	}
+}
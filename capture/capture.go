@@ -0,0 +1,269 @@
+// Package capture records sanitized copies of incoming ingest requests to disk and replays them, so parser
+// regressions can be debugged with production traffic.
+//
+//	rec := &capture.Recorder{Dir: "/var/lib/sentrydsn/capture", Next: tunnel, Extractor: parser}
+//	http.Handle("/api/", rec)
+//
+//	//later, against a new build
+//	capture.Replay(dir, func(c *capture.Request) error {
+//		dsn, err := parser.Extract(c.HTTPRequest())
+//		//compare with c.DSN and c.Error
+//	})
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/envelope"
+	"github.com/sentry-demos/sentrydsn/scrub"
+)
+
+const captureExt = ".capture"
+
+// default largest body captured when Recorder.MaxBodySize is unset
+const defaultMaxBodySize = 1 << 20
+
+// headers never written to disk
+var droppedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Forwarded-For", "X-Real-Ip"}
+
+var secret_re = regexp.MustCompile(`,?\s*sentry_secret=[^,\s]*`)
+
+// Request is a captured ingest request.
+type Request struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"` //request URI, path and query string
+	Host     string      `json:"host"`
+	Header   http.Header `json:"header"`
+	Captured time.Time   `json:"captured"`
+	DSN      string      `json:"dsn,omitempty"`   //what Recorder.Extractor derived at capture time
+	Error    string      `json:"error,omitempty"` //sentrydsn.ErrorKind of the extractor's error at capture time
+	Body     []byte      `json:"-"`
+}
+
+// HTTPRequest rebuilds an incoming server request from c.
+func (c *Request) HTTPRequest() *http.Request {
+
+	r, err := http.NewRequest(c.Method, c.URL, bytes.NewReader(c.Body))
+	if err != nil {
+		r, _ = http.NewRequest(c.Method, "/", bytes.NewReader(c.Body))
+	}
+	r.Host = c.Host
+	r.Header = c.Header.Clone()
+	r.RequestURI = c.URL
+	return r
+}
+
+// Recorder is a middleware writing a sanitized copy of every request to Dir before passing it to Next.
+// Secret keys are removed from the auth header and query string, credential headers are dropped, and store
+// and envelope bodies are scrubbed with Scrubber. Other bodies, such as minidumps, are not kept.
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	Dir         string
+	Next        http.Handler
+	Extractor   sentrydsn.Extractor //when set, its result is recorded for comparison on replay
+	Scrubber    scrub.Scrubber      //scrubs captured bodies, scrub.Default when nil
+	MaxBodySize int64               //bodies larger than this, before or after decompression, are not captured, 1MB when unset
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+// ServeHTTP implements http.Handler.
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if c, err := rec.capture(r); err == nil {
+		rec.write(c)
+	}
+	rec.Next.ServeHTTP(w, r)
+}
+
+// capture builds the sanitized copy of r, restoring r.Body for Next.
+func (rec *Recorder) capture(r *http.Request) (*Request, error) {
+
+	max := rec.MaxBodySize
+	if max <= 0 {
+		max = defaultMaxBodySize
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		b, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	c := &Request{Method: r.Method, URL: sanitizeURL(r.URL), Host: r.Host, Header: r.Header.Clone(), Captured: time.Now().UTC()}
+	for _, k := range droppedHeaders {
+		c.Header.Del(k)
+	}
+	if h := c.Header.Get("X-Sentry-Auth"); len(h) > 0 {
+		c.Header.Set("X-Sentry-Auth", secret_re.ReplaceAllString(h, ""))
+	}
+	if int64(len(body)) <= max {
+		c.Body = rec.scrub(c, body, max)
+	}
+	if rec.Extractor != nil {
+		dsn, err := rec.Extractor.Extract(c.HTTPRequest())
+		if err != nil {
+			c.Error = sentrydsn.ErrorKind(err)
+		} else {
+			c.DSN = dsn.URL
+		}
+	}
+	return c, nil
+}
+
+// scrub returns the scrubbed body of a store or envelope request, or nil for bodies it cannot scrub or that
+// decompress to more than max bytes.
+func (rec *Recorder) scrub(c *Request, body []byte, max int64) []byte {
+
+	s := rec.Scrubber
+	if s == nil {
+		s = scrub.Default
+	}
+	if c.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil
+		}
+		//a small body can inflate to gigabytes; only read what a capture may hold
+		if body, err = io.ReadAll(io.LimitReader(zr, max+1)); err != nil || int64(len(body)) > max {
+			return nil
+		}
+		//the capture is stored decompressed
+		c.Header.Del("Content-Encoding")
+	}
+	path := c.URL
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	switch {
+	case strings.HasSuffix(path, "/envelope/"):
+		var b bytes.Buffer
+		if err := scrub.Envelope(s, &b, bytes.NewReader(body), envelope.Limits{}); err != nil {
+			return nil
+		}
+		return b.Bytes()
+	case strings.HasSuffix(path, "/store/"):
+		b, err := scrub.Payload(s, body)
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	return nil
+}
+
+// write stores c in Dir; captures that cannot be written are dropped rather than failing the request.
+func (rec *Recorder) write(c *Request) error {
+
+	meta, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	rec.mu.Lock()
+	rec.seq++
+	name := fmt.Sprintf("%020d-%010d%s", c.Captured.UnixNano(), rec.seq, captureExt)
+	rec.mu.Unlock()
+
+	if err := os.MkdirAll(rec.Dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(rec.Dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	w.Write(meta)
+	w.WriteByte('\n')
+	w.Write(c.Body)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(rec.Dir, name))
+}
+
+// Replay hands the captures in dir to fn oldest first, stopping at the first error, and returns the number replayed.
+// Captures are left on disk so they can be replayed again.
+func Replay(dir string, fn func(c *Request) error) (int, error) {
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+captureExt))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(names)
+	replayed := 0
+	for _, name := range names {
+		c, err := readRequest(name)
+		if err != nil {
+			return replayed, err
+		}
+		if err := fn(c); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func readRequest(path string) (*Request, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	meta, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	c := &Request{}
+	if err := json.Unmarshal(meta, c); err != nil {
+		return nil, err
+	}
+	if c.Body, err = io.ReadAll(r); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sanitizeURL returns the request URI of u without a sentry_secret query parameter.
+func sanitizeURL(u *url.URL) string {
+
+	q := u.Query()
+	if !q.Has("sentry_secret") {
+		return u.RequestURI()
+	}
+	q.Del("sentry_secret")
+	s := *u
+	s.RawQuery = q.Encode()
+	return s.RequestURI()
+}
@@ -0,0 +1,94 @@
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+//setup
+
+const testKey = "4784fbc50de2473f9977cfce8a9adce5"
+
+func gzipped(s string) string {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(s))
+	zw.Close()
+	return b.String()
+}
+
+var testTableCapture = []struct {
+	url          string
+	auth         string
+	encoding     string
+	body         string
+	description  string
+	dsn          string
+	errKind      string
+	capturedURL  string
+	capturedBody string
+}{
+	{"https://o1.ingest.sentry.io/api/1234/store/", "Sentry sentry_key=" + testKey + ", sentry_secret=" + testKey, "", `{"user":{"email":"jane@example.com"}}`,
+		"store with secret", "https://" + testKey + "@o1.ingest.sentry.io/1234", "", "/api/1234/store/", `{"user":{"email":"[email]"}}`},
+	{"https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=" + testKey + "&sentry_secret=" + testKey, "", "gzip", gzipped("{}\n{\"type\":\"event\"}\n{\"message\":\"from 10.1.2.3\"}\n"),
+		"gzipped envelope with query auth", "https://" + testKey + "@o1.ingest.sentry.io/1234", "", "/api/1234/envelope/?sentry_key=" + testKey, "{}\n{\"length\":23,\"type\":\"event\"}\n{\"message\":\"from [ip]\"}\n"},
+	{"https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=" + testKey, "", "gzip", gzipped("{}\n{\"type\":\"event\"}\n" + strings.Repeat("a", 2<<20) + "\n"),
+		"envelope inflating past the limit not captured", "https://" + testKey + "@o1.ingest.sentry.io/1234", "", "/api/1234/envelope/?sentry_key=" + testKey, ""},
+	{"https://o1.ingest.sentry.io/api/1234/minidump/", "Sentry sentry_key=" + testKey, "", "MDMP",
+		"minidump body dropped", "", "missing_project_id", "/api/1234/minidump/", ""},
+}
+
+//tests
+
+func TestCaptureReplay(t *testing.T) {
+	dir := t.TempDir()
+	var forwarded []string
+	rec := &Recorder{Dir: dir, Extractor: &sentrydsn.Parser{}, Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, string(b))
+	})}
+	for _, test := range testTableCapture {
+		r := httptest.NewRequest("POST", test.url, strings.NewReader(test.body))
+		r.Header.Set("Cookie", "session=1")
+		if len(test.auth) > 0 {
+			r.Header.Set("X-Sentry-Auth", test.auth)
+		}
+		if len(test.encoding) > 0 {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		rec.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	for i, test := range testTableCapture {
+		if forwarded[i] != test.body {
+			t.Errorf("%s: Expected -- original body forwarded -- Got %q", test.description, forwarded[i])
+		}
+	}
+
+	i := 0
+	n, err := Replay(dir, func(c *Request) error {
+		test := testTableCapture[i]
+		i++
+		if c.URL != test.capturedURL || c.DSN != test.dsn || c.Error != test.errKind || string(c.Body) != test.capturedBody {
+			t.Errorf("%s: Expected -- %v %v %v %q -- Got %v %v %v %q", test.description, test.capturedURL, test.dsn, test.errKind, test.capturedBody, c.URL, c.DSN, c.Error, c.Body)
+		}
+		if len(c.Header.Get("Cookie")) > 0 || strings.Contains(c.Header.Get("X-Sentry-Auth"), "sentry_secret") {
+			t.Errorf("%s: Expected -- credentials removed -- Got %v", test.description, c.Header)
+		}
+		//replayed requests parse the same way
+		dsn, err := sentrydsn.FromRequest(c.HTTPRequest())
+		if (err == nil && dsn.URL != c.DSN) || sentrydsn.ErrorKind(err) != c.Error {
+			t.Errorf("%s: Expected -- %v %v -- Got %v %v", test.description, c.DSN, c.Error, dsn, err)
+		}
+		return nil
+	})
+	if n != len(testTableCapture) || err != nil {
+		t.Errorf("Expected -- %v replayed -- Got %v %v", len(testTableCapture), n, err)
+	}
+}
@@ -0,0 +1,80 @@
+package sentrydsn
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validate reports allowlist entries that can never match: entries must be "*", "*." followed by a domain,
+// or a host with an optional port.
+func (a HostAllowlist) Validate() error {
+
+	var errs []error
+	for _, entry := range a {
+		host := strings.TrimPrefix(entry, "*.")
+		if entry == "*" {
+			continue
+		}
+		if len(host) == 0 || strings.ContainsAny(host, "*/") || !validHost(CanonicalHost(host)) {
+			errs = append(errs, fmt.Errorf("sentry:  invalid allowed host %q", entry))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check validates the parser's configuration, e.g. at startup before taking traffic, and returns every
+// problem found joined with errors.Join, or nil. Settings Check rejects would otherwise fail or be ignored
+// per request: allowlist entries that never match, unknown endpoint types, malformed relay keys.
+func (p *Parser) Check() error {
+
+	errs := []error{p.AllowedHosts.Validate()}
+	if len(p.IngestHost) > 0 {
+		if _, err := ParseHost(p.IngestHost); err != nil {
+			errs = append(errs, fmt.Errorf("sentry:  ingest host: %w", err))
+		}
+	}
+	for _, prefix := range p.TrustedProxies {
+		if !prefix.IsValid() {
+			errs = append(errs, errors.New("sentry:  invalid trusted proxy prefix"))
+		}
+	}
+	if !p.AcceptAnyProjectEndpoint {
+		for _, e := range p.AllowedEndpoints {
+			if _, ok := endpointMethods[e]; !ok {
+				errs = append(errs, fmt.Errorf("sentry:  unknown allowed endpoint %q", e))
+			}
+		}
+	}
+	endpoints := make([]string, 0, len(p.Methods))
+	for e := range p.Methods {
+		endpoints = append(endpoints, string(e))
+	}
+	sort.Strings(endpoints)
+	for _, e := range endpoints {
+		for _, m := range p.Methods[EndpointType(e)] {
+			if len(m) == 0 || strings.ToUpper(m) != m || strings.ContainsAny(m, " \t/") {
+				errs = append(errs, fmt.Errorf("sentry:  invalid method %q for endpoint %q", m, e))
+			}
+		}
+	}
+	relays := make([]string, 0, len(p.TrustedRelays))
+	for id := range p.TrustedRelays {
+		relays = append(relays, id)
+	}
+	sort.Strings(relays)
+	for _, id := range relays {
+		if len(p.TrustedRelays[id]) != ed25519.PublicKeySize {
+			errs = append(errs, fmt.Errorf("sentry:  malformed public key for relay %q", id))
+		}
+	}
+	if p.RequireRelaySignature && len(p.TrustedRelays) == 0 && p.RelayKeys == nil {
+		errs = append(errs, errors.New("sentry:  relay signatures required but no relays trusted"))
+	}
+	if p.ErrorRateThreshold < 0 || p.ErrorRateThreshold > 1 {
+		errs = append(errs, fmt.Errorf("sentry:  error rate threshold %v outside 0 to 1", p.ErrorRateThreshold))
+	}
+	return errors.Join(errs...)
+}
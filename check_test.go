@@ -0,0 +1,50 @@
+package sentrydsn
+
+import (
+	"crypto/ed25519"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+//setup
+
+var testTableCheck = []struct {
+	parser      *Parser
+	description string
+	expected    []string //substrings of the error, none when valid
+}{
+	{&Parser{}, "zero value", nil},
+	{&Parser{AllowedHosts: HostAllowlist{"*", "*.sentry.io", "sentry.example.com:9000", "[::1]"}, IngestHost: "o1.ingest.sentry.io"}, "valid hosts", nil},
+	{&Parser{AllowedHosts: HostAllowlist{"sentry.io/", "*.", "o*.ingest.sentry.io"}}, "invalid hosts",
+		[]string{`"sentry.io/"`, `"*."`, `"o*.ingest.sentry.io"`}},
+	{&Parser{IngestHost: "https://o1.ingest.sentry.io"}, "ingest host is a url", []string{"ingest host"}},
+	{&Parser{AllowedEndpoints: []EndpointType{EndpointEnvelope, "envelopes"}}, "unknown endpoint", []string{`"envelopes"`}},
+	{&Parser{AllowedEndpoints: []EndpointType{"uploads"}, AcceptAnyProjectEndpoint: true}, "any endpoint", nil},
+	{&Parser{Methods: map[EndpointType][]string{EndpointStore: {"get", "POST"}}}, "lowercase method", []string{`"get"`}},
+	{&Parser{TrustedProxies: []netip.Prefix{{}}}, "zero prefix", []string{"trusted proxy"}},
+	{&Parser{TrustedRelays: map[string]ed25519.PublicKey{"relay": make([]byte, 16)}, RequireRelaySignature: true}, "short relay key", []string{`relay "relay"`}},
+	{&Parser{RequireRelaySignature: true}, "no relays", []string{"no relays trusted"}},
+	{&Parser{ErrorRateThreshold: 20}, "threshold as percent", []string{"threshold"}},
+	{&Parser{IngestHost: "a b", ErrorRateThreshold: -1}, "aggregated", []string{"ingest host", "threshold"}},
+}
+
+//tests
+
+func TestParserCheck(t *testing.T) {
+	for _, test := range testTableCheck {
+		err := test.parser.Check()
+		if len(test.expected) == 0 && err != nil {
+			t.Errorf("%s: Expected -- nil -- Got %v", test.description, err)
+		}
+		if len(test.expected) > 0 && err == nil {
+			t.Errorf("%s: Expected -- %v -- Got nil", test.description, test.expected)
+			continue
+		}
+		for _, e := range test.expected {
+			if !strings.Contains(err.Error(), e) {
+				t.Errorf("%s: Expected -- %s -- Got %v", test.description, e, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package sentrydsn
+
+import (
+	"time"
+)
+
+// Clock tells the time. Parsers, caches and the proxy components take one so tests, and replays of
+// captured traffic, control time instead of waiting on it; nil means the system clock.
+// See sentrydsntest.Clock for one that is set and advanced by hand.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to Clock, e.g. ClockFunc(func() time.Time { return captured.Captured }).
+type ClockFunc func() time.Time
+
+// Now implements Clock.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// Now returns c's time, or the system time when c is nil.
+func Now(c Clock) time.Time {
+
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
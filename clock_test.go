@@ -0,0 +1,73 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//setup
+
+// testClock is a Clock moved by hand; sentrydsntest.Clock is the exported equivalent
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+//tests
+
+func TestClockFreshness(t *testing.T) {
+	clock := &testClock{time.Unix(1614144877, 0)}
+	p := &Parser{MaxAuthAge: 5 * time.Minute, Clock: clock}
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/", nil)
+	r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5, sentry_timestamp=1614144877.269")
+
+	if _, err := p.FromRequest(r); err != nil {
+		t.Errorf("Expected -- nil -- Got %v", err)
+	}
+	clock.now = clock.now.Add(6 * time.Minute)
+	if _, err := p.FromRequest(r); err != ErrStaleAuth {
+		t.Errorf("Expected -- %v -- Got %v", ErrStaleAuth, err)
+	}
+}
+
+func TestClockCache(t *testing.T) {
+	clock := &testClock{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	c := &Cache{TTL: time.Minute, Clock: clock}
+	e := c.Extractor(ExtractorFunc(FromRequest))
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+
+	e.Extract(r)
+	clock.now = clock.now.Add(59 * time.Second)
+	e.Extract(r)
+	clock.now = clock.now.Add(2 * time.Second)
+	e.Extract(r)
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 2 {
+		t.Errorf("Expected -- 1 hit 2 misses -- Got %+v", s)
+	}
+}
+
+func TestClockResolver(t *testing.T) {
+	clock := &testClock{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	calls := 0
+	p := &Parser{Clock: clock, ResolveNegativeTTL: time.Minute, ResolveProject: func(string) (string, error) {
+		calls++
+		return "", errors.New("backend down")
+	}}
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+
+	p.FromRequest(r)
+	p.FromRequest(r)
+	clock.now = clock.now.Add(2 * time.Minute)
+	p.FromRequest(r)
+	if calls != 2 {
+		t.Errorf("Expected -- 2 lookups -- Got %d", calls)
+	}
+	if got := Now(nil); time.Since(got) > time.Minute {
+		t.Errorf("Expected -- system time -- Got %v", got)
+	}
+}
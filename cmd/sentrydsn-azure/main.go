@@ -0,0 +1,38 @@
+// Command sentrydsn-azure runs the tunnel as an Azure Functions custom handler, configured through the
+// environment (see proxy.TunnelFromEnv). Ingest paths (/api/...) are served directly for function apps with
+// enableForwardingHttpRequest; anything else is treated as a custom handler invocation.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+func main() {
+
+	port := os.Getenv("FUNCTIONS_CUSTOMHANDLER_PORT")
+	if len(port) == 0 {
+		port = "8080"
+	}
+	t, err := proxy.TunnelFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err = t.Check(ctx)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tunnel := proxy.BehindPlatformProxy(t)
+	mux := http.NewServeMux()
+	mux.Handle("/api/", tunnel)
+	mux.Handle("/", &proxy.AzureHandler{Handler: tunnel})
+
+	log.Fatal(http.ListenAndServe(":"+port, mux))
+}
@@ -0,0 +1,47 @@
+// Command sentrydsn-cloudrun runs the tunnel as a Cloud Run service, configured through the environment
+// (see proxy.TunnelFromEnv). It listens on $PORT and drains in-flight requests on SIGTERM.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+func main() {
+
+	port := os.Getenv("PORT")
+	if len(port) == 0 {
+		port = "8080"
+	}
+	tunnel, err := proxy.TunnelFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err = tunnel.Check(ctx)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &proxy.Server{Addr: ":" + port, Tunnel: proxy.BehindPlatformProxy(tunnel)}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+		<-stop
+		//Cloud Run allows 10 seconds between SIGTERM and SIGKILL
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build js && wasm
+
+// Command sentrydsn-wasm exposes the DSN parser to JavaScript, so browser tooling classifies Sentry requests
+// with exactly the logic the relay uses. It registers a global sentrydsn object:
+//
+//	sentrydsn.fromRequest(url, headers) // headers is an object of header name to value
+//	sentrydsn.parseDSN(dsn)
+//
+// Both return {url, host, projectId, publicKey, endpoint, warnings} or {error, kind}.
+//
+// Build with GOOS=js GOARCH=wasm go build -o sentrydsn.wasm ./cmd/sentrydsn-wasm and load it with
+// the wasm_exec.js shipped in $(go env GOROOT)/lib/wasm.
+package main
+
+import (
+	"net/http"
+	"syscall/js"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func main() {
+
+	js.Global().Set("sentrydsn", js.ValueOf(map[string]interface{}{
+		"fromRequest": js.FuncOf(fromRequest),
+		"parseDSN":    js.FuncOf(parseDSN),
+	}))
+	select {}
+}
+
+func fromRequest(this js.Value, args []js.Value) interface{} {
+
+	if len(args) < 1 {
+		return result(nil, sentrydsn.ErrMissingDSN)
+	}
+	r, err := http.NewRequest(http.MethodPost, args[0].String(), nil)
+	if err != nil {
+		return result(nil, err)
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		keys := js.Global().Get("Object").Call("keys", args[1])
+		for i := 0; i < keys.Length(); i++ {
+			k := keys.Index(i).String()
+			r.Header.Set(k, args[1].Get(k).String())
+		}
+	}
+	return result(sentrydsn.FromRequest(r))
+}
+
+func parseDSN(this js.Value, args []js.Value) interface{} {
+
+	if len(args) < 1 {
+		return result(nil, sentrydsn.ErrMissingDSN)
+	}
+	return result(sentrydsn.ParseDSN(args[0].String()))
+}
+
+// result converts a parse result to a plain object js.ValueOf accepts.
+func result(dsn *sentrydsn.DSN, err error) interface{} {
+
+	if err != nil {
+		return map[string]interface{}{"error": err.Error(), "kind": sentrydsn.ErrorKind(err)}
+	}
+	warnings := []interface{}{}
+	for _, w := range dsn.Warnings {
+		warnings = append(warnings, w.Code)
+	}
+	return map[string]interface{}{
+		"url":       dsn.URL,
+		"host":      dsn.Host,
+		"projectId": dsn.ProjectID,
+		"publicKey": dsn.PublicKey,
+		"endpoint":  string(dsn.Endpoint),
+		"warnings":  warnings,
+	}
+}
@@ -0,0 +1,85 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrMultipleAuth Thrown under Parser.CompatRelay if a request authenticates both in a header and in the query string
+var ErrMultipleAuth = errors.New("sentry:  multiple authorization payloads")
+
+// ingest routes Relay serves, trailing slash optional
+var relay_path_re = regexp.MustCompile(`^/api/(\d+)/(store|envelope|security|csp-report|nel|minidump)/?$`)
+var relay_unreal_re = regexp.MustCompile(`^/api/(\d+)/unreal/([^/]+)/?$`)
+var relay_attachment_re = regexp.MustCompile(`^/api/(\d+)/events/[^/]+/attachments/?$`)
+var relay_otlp_re = regexp.MustCompile(`^/api/(\d+)/integration/otlp/v1/(traces|logs)/?$`)
+var relay_legacy_re = regexp.MustCompile(`^/api/store/?$`)
+
+var relayEndpoints = map[string]EndpointType{
+	"store":      EndpointStore,
+	"envelope":   EndpointEnvelope,
+	"security":   EndpointReport,
+	"csp-report": EndpointReport,
+	"nel":        EndpointNEL,
+	"minidump":   EndpointMinidump,
+}
+
+// relayAuth reads the client's keys the way Relay does: from X-Sentry-Auth, else from an Authorization header
+// using the Sentry scheme, else from the query string. Authenticating in a header and in the query string at
+// once is an error rather than one silently winning. Unreal crash reporters put the key in the path instead.
+// Keys from the query string raise WarnQueryAuth, repeated with different values WarnDuplicateKey too.
+func relayAuth(r *http.Request, kf KeyFormat, dp DuplicatePolicy) (user *User, warnings []Warning, err error) {
+
+	if m := relay_unreal_re.FindStringSubmatch(r.URL.Path); m != nil {
+		pk, ok := canonicalKey(kf, m[2])
+		if !ok {
+			return nil, nil, ErrMissingUser
+		}
+		return &User{PublicKey: pk}, nil, nil
+	}
+	h := r.Header.Get(http_x_sentry_auth)
+	if len(h) == 0 {
+		if a := r.Header.Get("Authorization"); len(a) > 6 && strings.EqualFold(a[:7], "sentry ") {
+			h = a
+		}
+	}
+	q := r.URL.Query()
+	if len(h) > 0 {
+		if len(q.Get("sentry_key")) > 0 {
+			return nil, nil, ErrMultipleAuth
+		}
+		user, err = parseHeaders(h, kf)
+		return user, nil, err
+	}
+	user, warnings, err = parseQueryString(r.URL, kf, dp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, append([]Warning{WarnQueryAuth}, warnings...), nil
+}
+
+// relayCheckPath is checkPath for the routes Relay accepts: anchored, with or without a trailing slash,
+// and including native crash and attachment uploads.
+func relayCheckPath(u *url.URL) (string, EndpointType, error) {
+
+	path := u.Path
+	if m := relay_path_re.FindStringSubmatch(path); m != nil {
+		return m[1], relayEndpoints[m[2]], nil
+	}
+	if m := relay_unreal_re.FindStringSubmatch(path); m != nil {
+		return m[1], EndpointUnreal, nil
+	}
+	if m := relay_attachment_re.FindStringSubmatch(path); m != nil {
+		return m[1], EndpointAttachment, nil
+	}
+	if m := relay_otlp_re.FindStringSubmatch(path); m != nil {
+		return m[1], EndpointOTLP, nil
+	}
+	if relay_legacy_re.MatchString(path) {
+		return "", EndpointStore, nil
+	}
+	return "", "", ErrMissingProjectID
+}
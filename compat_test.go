@@ -0,0 +1,65 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const compatKey = "4784fbc50de2473f9977cfce8a9adce5"
+
+// outcome is the DSN URL, or the error kind prefixed with !
+func outcome(p *Parser, url string, header map[string]string) string {
+	r := httptest.NewRequest("POST", url, strings.NewReader("{}"))
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	dsn, err := p.FromRequest(r)
+	if err != nil {
+		return "!" + ErrorKind(err)
+	}
+	return dsn.URL + " " + string(dsn.Endpoint)
+}
+
+// each row is a documented Relay decision next to the default parser's
+var testTableCompatRelay = []struct {
+	url         string
+	header      map[string]string
+	description string
+	parser      string //default Parser
+	relay       string //Parser{CompatRelay: true}
+}{
+	{"https://sentry.io/api/1234/store/", map[string]string{"X-Sentry-Auth": "Sentry sentry_key=" + compatKey},
+		"header auth", "https://" + compatKey + "@sentry.io/1234 store", "https://" + compatKey + "@sentry.io/1234 store"},
+	{"https://sentry.io/api/1234/store/?sentry_key=" + compatKey, map[string]string{"X-Sentry-Auth": "Sentry sentry_key=" + compatKey},
+		"header and query auth", "https://" + compatKey + "@sentry.io/1234 store", "!multiple_auth"},
+	{"https://sentry.io/api/1234/store/", map[string]string{"Authorization": "Sentry sentry_key=" + compatKey},
+		"authorization header", "!missing_user", "https://" + compatKey + "@sentry.io/1234 store"},
+	{"https://sentry.io/api/1234/store/", map[string]string{"X-Sentry-Auth": "Sentry sentry_key=" + compatKey + ", sentry_secret=" + compatKey},
+		"secret key ignored", "https://" + compatKey + ":" + compatKey + "@sentry.io/1234 store", "https://" + compatKey + "@sentry.io/1234 store"},
+	{"https://sentry.io/api/1234/envelope?sentry_key=" + compatKey, nil,
+		"no trailing slash", "!missing_project_id", "https://" + compatKey + "@sentry.io/1234 envelope"},
+	{"https://sentry.io/api/1234/minidump/?sentry_key=" + compatKey, nil,
+		"minidump upload", "!missing_project_id", "https://" + compatKey + "@sentry.io/1234 minidump"},
+	{"https://sentry.io/api/1234/unreal/" + compatKey + "/", nil,
+		"unreal key in path", "!missing_user", "https://" + compatKey + "@sentry.io/1234 unreal"},
+	{"https://sentry.io/api/1234/events/9ec79c33ec9942ab8353589fcb2e04dc/attachments/?sentry_key=" + compatKey, nil,
+		"attachment upload", "!missing_project_id", "https://" + compatKey + "@sentry.io/1234 attachment"},
+	{"https://sentry.io/prefix/api/1234/store/?sentry_key=" + compatKey, nil,
+		"path prefix", "https://" + compatKey + "@sentry.io/prefix/1234 store", "!missing_project_id"},
+	{"https://sentry.io/api/1234/csp-report/?sentry_key=" + compatKey, nil,
+		"csp report", "!missing_project_id", "https://" + compatKey + "@sentry.io/1234 report"},
+	{"https://sentry.io/api/1234/integration/otlp/v1/traces", map[string]string{"X-Sentry-Auth": "sentry sentry_key=" + compatKey},
+		"otlp traces", "https://" + compatKey + "@sentry.io/1234 otlp", "https://" + compatKey + "@sentry.io/1234 otlp"},
+}
+
+func TestCompatRelay(t *testing.T) {
+	for _, test := range testTableCompatRelay {
+		if got := outcome(&Parser{}, test.url, test.header); got != test.parser {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.parser, got)
+		}
+		if got := outcome(&Parser{CompatRelay: true}, test.url, test.header); got != test.relay {
+			t.Errorf("%s (relay): Expected -- %v -- Got %v", test.description, test.relay, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sentrydsn
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// goroutines sharing one Parser in the stress tests
+const stressGoroutines = 2000
+
+func TestParserConcurrent(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	p := &Parser{
+		AllowedHosts:   HostAllowlist{"sentry.io", "*.ingest.sentry.io"},
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		IngestHost:     "o1.ingest.sentry.io",
+		SecretPolicy:   DropSecret,
+		TrustedRelays:  map[string]ed25519.PublicKey{testRelayID: pub},
+	}
+	body := "{}\n{\"type\":\"event\"}\n{}\n"
+
+	var testTableConcurrent = []struct {
+		request     func() *http.Request
+		description string
+		expected    string
+	}{
+		{func() *http.Request {
+			r := httptest.NewRequest("POST", "/api/1234/store/", strings.NewReader("{}"))
+			r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5, sentry_secret=4784fbc50de2473f9977cfce8a9adce5")
+			return r
+		}, "header auth from untrusted peer", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234"},
+		{func() *http.Request {
+			r := httptest.NewRequest("POST", "/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", strings.NewReader(body))
+			r.RemoteAddr = "10.0.0.1:1234"
+			r.Header.Set("X-Forwarded-Host", "sentry.io")
+			return r
+		}, "query auth from trusted proxy", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234"},
+		{func() *http.Request {
+			r := httptest.NewRequest("POST", "/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", strings.NewReader(body))
+			signRelay(r, priv, body, time.Now())
+			return r
+		}, "signed by a relay", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234"},
+		{func() *http.Request {
+			return httptest.NewRequest("GET", "/api/embed/error-page/?dsn=https%3A%2F%2F4784fbc50de2473f9977cfce8a9adce5%40o1.ingest.sentry.io%2F1234", nil)
+		}, "feedback embed", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234"},
+		{func() *http.Request {
+			return httptest.NewRequest("POST", "/api/1234/store/", strings.NewReader("{}"))
+		}, "missing user", ""},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, stressGoroutines)
+	for i := 0; i < stressGoroutines; i++ {
+		test := testTableConcurrent[i%len(testTableConcurrent)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := p.FromRequest(test.request())
+			url := ""
+			if err == nil {
+				url = got.URL
+			}
+			if url != test.expected {
+				errs <- test.description + ": Expected -- " + test.expected + " -- Got " + url
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+		break
+	}
+}
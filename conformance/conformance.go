@@ -0,0 +1,102 @@
+// Package conformance checks that an Extractor derives DSNs exactly like sentrydsn.FromRequest does,
+// against a corpus of real ingest requests recorded per SDK and endpoint. Custom extractors and forks
+// run it from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.RunConformance(t, myExtractor)
+//	}
+package conformance
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+//go:embed corpus/*.json
+var corpus embed.FS
+
+// Fixture is one recorded ingest request and the DSN it must produce.
+type Fixture struct {
+	Name     string            `json:"name"`
+	SDK      string            `json:"sdk"` //client that sent the request, empty for synthetic cases
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Body     string            `json:"body"`
+	Expected Expected          `json:"expected"`
+}
+
+// Expected is the outcome of a fixture. Error holds the sentrydsn.ErrorKind of a failed extraction.
+type Expected struct {
+	URL       string `json:"url"`
+	ProjectID string `json:"project_id"`
+	PublicKey string `json:"public_key"`
+	Host      string `json:"host"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Fixtures returns the corpus keyed by file, e.g. "python" or "browser-reports".
+func Fixtures() (map[string][]Fixture, error) {
+
+	entries, err := corpus.ReadDir("corpus")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]Fixture{}
+	for _, e := range entries {
+		b, err := corpus.ReadFile(path.Join("corpus", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var fixtures []Fixture
+		if err := json.Unmarshal(b, &fixtures); err != nil {
+			return nil, err
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = fixtures
+	}
+	return out, nil
+}
+
+// Request builds the fixture's request.
+func (f *Fixture) Request() *http.Request {
+
+	r := httptest.NewRequest(f.Method, f.URL, strings.NewReader(f.Body))
+	for k, v := range f.Headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+// RunConformance runs every fixture against e as a subtest named <file>/<fixture>.
+func RunConformance(t *testing.T, e sentrydsn.Extractor) {
+
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("conformance: reading corpus: %v", err)
+	}
+	for file, list := range fixtures {
+		for _, f := range list {
+			f := f
+			t.Run(file+"/"+f.Name, func(t *testing.T) {
+				dsn, err := e.Extract(f.Request())
+				if kind := sentrydsn.ErrorKind(err); kind != f.Expected.Error {
+					t.Fatalf("Expected -- error %q -- Got %q (%v)", f.Expected.Error, kind, err)
+				}
+				if err != nil {
+					return
+				}
+				got := Expected{URL: dsn.URL, ProjectID: dsn.ProjectID, PublicKey: dsn.PublicKey, Host: dsn.Host}
+				if got != f.Expected {
+					t.Errorf("Expected -- %+v -- Got %+v", f.Expected, got)
+				}
+			})
+		}
+	}
+}
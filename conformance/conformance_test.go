@@ -0,0 +1,25 @@
+package conformance
+
+import (
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func TestFromRequestConforms(t *testing.T) {
+	RunConformance(t, sentrydsn.ExtractorFunc(sentrydsn.FromRequest))
+}
+
+func TestParserConforms(t *testing.T) {
+	RunConformance(t, &sentrydsn.Parser{})
+}
+
+func TestFixtures(t *testing.T) {
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	if len(fixtures["python"]) == 0 || len(fixtures["browser-reports"]) == 0 {
+		t.Errorf("Expected -- fixtures per sdk -- Got %v files", len(fixtures))
+	}
+}
@@ -0,0 +1,47 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrContentType Thrown under Parser.StrictContentType if a request's Content-Type does not suit its endpoint
+var ErrContentType = errors.New("sentry:  unexpected content type")
+
+// media types each endpoint accepts. Browser SDKs send text/plain to avoid CORS preflights.
+// Endpoints not listed accept any type.
+var endpointContentTypes = map[EndpointType][]string{
+	EndpointEnvelope: {"application/x-sentry-envelope", "text/plain"},
+	EndpointStore:    {"application/json", "application/octet-stream", "text/plain"},
+	EndpointMinidump: {"multipart/form-data", "application/octet-stream"},
+	EndpointNEL:      {"application/reports+json", "application/json"},
+	EndpointReport:   {"application/csp-report", "application/reports+json", "application/expect-ct-report+json", "application/json"},
+	EndpointOTLP:     {"application/x-protobuf", "application/json"},
+	EndpointProfile:  {"application/json", "application/octet-stream"},
+}
+
+// mediaType returns r's Content-Type without parameters, lowercased.
+func mediaType(r *http.Request) string {
+
+	ct := r.Header.Get("Content-Type")
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// checkContentType returns ErrContentType if StrictContentType is set and ct does not suit endpoint.
+func (p *Parser) checkContentType(endpoint EndpointType, ct string) error {
+
+	allowed, ok := endpointContentTypes[endpoint]
+	if !p.StrictContentType || !ok {
+		return nil
+	}
+	for _, a := range allowed {
+		if a == ct {
+			return nil
+		}
+	}
+	return ErrContentType
+}
@@ -0,0 +1,43 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+var testTableContentType = []struct {
+	path        string
+	contentType string
+	description string
+	expected    string
+	err         error
+}{
+	{"/api/1234/envelope/", "application/x-sentry-envelope", "envelope", "application/x-sentry-envelope", nil},
+	{"/api/1234/envelope/", "text/plain;charset=UTF-8", "browser envelope with parameters", "text/plain", nil},
+	{"/api/1234/envelope/", "application/json", "envelope sent as json", "", ErrContentType},
+	{"/api/1234/store/", "Application/JSON", "store is case insensitive", "application/json", nil},
+	{"/api/1234/store/", "application/octet-stream", "compressed store", "application/octet-stream", nil},
+	{"/api/1234/store/", "", "missing content type", "", ErrContentType},
+	{"/api/1234/security/", "application/csp-report", "csp report", "application/csp-report", nil},
+	{"/api/1234/nel/", "application/x-sentry-envelope", "nel sent as envelope", "", ErrContentType},
+}
+
+func TestContentType(t *testing.T) {
+	strict := &Parser{StrictContentType: true}
+	for _, test := range testTableContentType {
+		r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io"+test.path+"?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+		if len(test.contentType) > 0 {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		got, err := strict.FromRequest(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if err == nil && got.ContentType != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got.ContentType)
+		}
+		//without the option mismatches are only reported
+		if _, err := FromRequest(r); err != nil {
+			t.Errorf("%s: Expected -- nil -- Got %v", test.description, err)
+		}
+	}
+}
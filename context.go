@@ -0,0 +1,32 @@
+package sentrydsn
+
+import (
+	"context"
+)
+
+// contextKey is unexported so only this package can store a DSN under it
+type contextKey struct{}
+
+// ContextWithDSN returns a copy of ctx carrying d. Middleware stores the DSN it derived this way so the
+// handlers behind it, whatever framework adapter they run in, find it with DSNFromContext.
+func ContextWithDSN(ctx context.Context, d *DSN) context.Context {
+	return context.WithValue(ctx, contextKey{}, d)
+}
+
+// DSNFromContext returns the DSN stored by ContextWithDSN and whether there was one.
+func DSNFromContext(ctx context.Context) (*DSN, bool) {
+
+	d, ok := ctx.Value(contextKey{}).(*DSN)
+	return d, ok && d != nil
+}
+
+// DSNFromContextErr is DSNFromContext for handlers that treat a missing DSN as an error: it returns
+// ErrMissingDSN when ctx carries none, e.g. because the handler was mounted without the middleware.
+func DSNFromContextErr(ctx context.Context) (*DSN, error) {
+
+	d, ok := DSNFromContext(ctx)
+	if !ok {
+		return nil, ErrMissingDSN
+	}
+	return d, nil
+}
@@ -0,0 +1,26 @@
+package sentrydsn
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContextDSN(t *testing.T) {
+	d, _ := ParseDSN("https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234")
+	ctx := ContextWithDSN(context.Background(), d)
+
+	if got, ok := DSNFromContext(ctx); !ok || got != d {
+		t.Errorf("Expected -- %v -- Got %v %v", d, got, ok)
+	}
+	if got, err := DSNFromContextErr(ctx); err != nil || got != d {
+		t.Errorf("Expected -- %v -- Got %v %v", d, got, err)
+	}
+	//other packages' values under a look-alike key are not mistaken for a DSN
+	ctx = context.WithValue(context.Background(), struct{}{}, d)
+	if got, ok := DSNFromContext(ctx); ok {
+		t.Errorf("Expected -- no dsn -- Got %v", got)
+	}
+	if _, err := DSNFromContextErr(ContextWithDSN(context.Background(), nil)); err != ErrMissingDSN {
+		t.Errorf("Expected -- %v -- Got %v", ErrMissingDSN, err)
+	}
+}
@@ -0,0 +1,79 @@
+package sentrydsn
+
+import (
+	"fmt"
+)
+
+// kinds of Change
+const (
+	ChangeScheme        = "scheme_changed"
+	ChangeHost          = "host_changed"
+	ChangePathPrefix    = "path_prefix_changed"
+	ChangeProject       = "project_moved"
+	ChangeKey           = "key_rotated"
+	ChangeSecret        = "secret_rotated"
+	ChangeSecretAdded   = "secret_added"
+	ChangeSecretRemoved = "secret_removed"
+)
+
+// Change is one field-level difference between two DSNs.
+type Change struct {
+	Kind  string `json:"kind"`  //one of the Change constants
+	Field string `json:"field"` //DSN field name, e.g. "Host"
+	From  string `json:"from"`  //secret keys are never reported, only whether they changed
+	To    string `json:"to"`
+}
+
+// String describes the change, e.g. "Host: o1.ingest.sentry.io -> o2.ingest.sentry.io".
+func (c Change) String() string {
+
+	if c.Field == "SecretKey" {
+		return "SecretKey: " + c.Kind
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.From, c.To)
+}
+
+// Diff lists what differs between the addresses of a and b, in DSN field order, e.g. for a migration tool
+// reporting what remapping inbound DSNs to a new Sentry org would change. Only the fields that make up the DSN
+// URL are compared: scheme (https when empty), host and port (canonically), path prefix, project and keys.
+// Request details such as Endpoint or Timestamp are not. Equal DSNs give no changes.
+func Diff(a, b *DSN) []Change {
+
+	var changes []Change
+	add := func(kind string, field string, from string, to string) {
+		changes = append(changes, Change{Kind: kind, Field: field, From: from, To: to})
+	}
+	if from, to := diffScheme(a.Scheme), diffScheme(b.Scheme); from != to {
+		add(ChangeScheme, "Scheme", from, to)
+	}
+	if CanonicalHost(a.Host) != CanonicalHost(b.Host) {
+		add(ChangeHost, "Host", a.Host, b.Host)
+	}
+	if a.PathPrefix != b.PathPrefix {
+		add(ChangePathPrefix, "PathPrefix", a.PathPrefix, b.PathPrefix)
+	}
+	if a.ProjectID != b.ProjectID {
+		add(ChangeProject, "ProjectID", a.ProjectID, b.ProjectID)
+	}
+	if a.PublicKey != b.PublicKey {
+		add(ChangeKey, "PublicKey", a.PublicKey, b.PublicKey)
+	}
+	switch {
+	case a.SecretKey == b.SecretKey:
+	case len(a.SecretKey) == 0:
+		add(ChangeSecretAdded, "SecretKey", "", "")
+	case len(b.SecretKey) == 0:
+		add(ChangeSecretRemoved, "SecretKey", "", "")
+	default:
+		add(ChangeSecret, "SecretKey", "", "")
+	}
+	return changes
+}
+
+func diffScheme(scheme string) string {
+
+	if len(scheme) == 0 {
+		return "https"
+	}
+	return scheme
+}
@@ -0,0 +1,47 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrConflictingKeys Thrown under ErrorOnConflict if sentry_key or sentry_secret is repeated in the query string with different values
+var ErrConflictingKeys = errors.New("sentry:  conflicting keys")
+
+// DuplicatePolicy decides which value wins when sentry_key or sentry_secret is repeated in the query string.
+// Different values usually mean a proxy appended its own key or someone is tampering with requests, so they
+// raise WarnDuplicateKey whichever wins; repeating the same value is harmless and ignored.
+type DuplicatePolicy int
+
+const (
+	// FirstValue takes the first value, as url.Values.Get does.
+	FirstValue DuplicatePolicy = iota
+	// LastValue takes the last value, as a proxy appending parameters intends.
+	LastValue
+	// ErrorOnConflict fails with ErrConflictingKeys.
+	ErrorOnConflict
+)
+
+// queryValue returns the value of the query parameter name under dp and whether repeated values differed.
+func queryValue(q url.Values, name string, dp DuplicatePolicy) (string, bool, error) {
+
+	values := q[name]
+	if len(values) == 0 {
+		return "", false, nil
+	}
+	conflict := false
+	for _, v := range values[1:] {
+		if !strings.EqualFold(v, values[0]) {
+			conflict = true
+			break
+		}
+	}
+	switch {
+	case conflict && dp == ErrorOnConflict:
+		return "", true, ErrConflictingKeys
+	case dp == LastValue:
+		return values[len(values)-1], conflict, nil
+	}
+	return values[0], conflict, nil
+}
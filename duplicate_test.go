@@ -0,0 +1,55 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+//setup
+
+const (
+	dupKeyA = "4784fbc50de2473f9977cfce8a9adce5"
+	dupKeyB = "0123456789abcdef0123456789abcdef"
+)
+
+var testTableDuplicateParams = []struct {
+	query       string
+	policy      DuplicatePolicy
+	compat      bool
+	description string
+	expected    string //public key
+	warned      bool
+	err         error
+}{
+	{"sentry_key=" + dupKeyA, FirstValue, false, "single key", dupKeyA, false, nil},
+	{"sentry_key=" + dupKeyA + "&sentry_key=" + dupKeyA, ErrorOnConflict, false, "repeated identical key", dupKeyA, false, nil},
+	{"sentry_key=" + dupKeyA + "&sentry_key=" + dupKeyB, FirstValue, false, "first wins", dupKeyA, true, nil},
+	{"sentry_key=" + dupKeyA + "&sentry_key=" + dupKeyB, LastValue, false, "last wins", dupKeyB, true, nil},
+	{"sentry_key=" + dupKeyA + "&sentry_key=" + dupKeyB, ErrorOnConflict, false, "conflict", "", false, ErrConflictingKeys},
+	{"sentry_key=" + dupKeyA + "&sentry_secret=" + dupKeyA + "&sentry_secret=" + dupKeyB, ErrorOnConflict, false, "conflicting secret", "", false, ErrConflictingKeys},
+	{"sentry_key=" + dupKeyA + "&sentry_key=" + dupKeyB, LastValue, true, "compat relay last wins", dupKeyB, true, nil},
+	{"sentry_key=" + dupKeyA + "&sentry_key=" + dupKeyB, ErrorOnConflict, true, "compat relay conflict", "", false, ErrConflictingKeys},
+}
+
+//tests
+
+func TestDuplicateParams(t *testing.T) {
+	for _, test := range testTableDuplicateParams {
+		p := &Parser{DuplicateParams: test.policy, CompatRelay: test.compat}
+		got, err := p.FromRequest(httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/?"+test.query, nil))
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		warned := false
+		for _, w := range got.Warnings {
+			warned = warned || w == WarnDuplicateKey
+		}
+		if got.PublicKey != test.expected || warned != test.warned {
+			t.Errorf("%s: Expected -- %v warned %v -- Got %v warned %v", test.description, test.expected, test.warned, got.PublicKey, warned)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sentrydsn
+
+import (
+	"errors"
+)
+
+// ErrEndpointNotAllowed Thrown if a request is addressed to an endpoint type outside Parser.AllowedEndpoints
+var ErrEndpointNotAllowed = errors.New("sentry:  endpoint not allowed")
+
+// EndpointType classifies the ingest endpoint a request was addressed to, so routing and sampling
+// can treat e.g. browser reports differently from events.
+type EndpointType string
+
+const (
+	EndpointStore    EndpointType = "store"    //  /api/<project_id>/store/ and the legacy /api/store/
+	EndpointEnvelope EndpointType = "envelope" //  /api/<project_id>/envelope/
+	EndpointNEL      EndpointType = "nel"      //  /api/<project_id>/nel/ Network Error Logging reports
+	EndpointReport   EndpointType = "report"   //  /api/<project_id>/security/ browser Reporting API (csp, crash, deprecation, intervention)
+	EndpointFeedback EndpointType = "feedback" //  /api/embed/error-page/ user feedback dialog, DSN in the dsn query parameter
+	EndpointOTLP     EndpointType = "otlp"     //  /api/<project_id>/integration/otlp/v1/traces and /v1/logs OpenTelemetry protocol exports
+	EndpointProfile  EndpointType = "profile"  //  /api/<project_id>/profile/ profiles posted outside an envelope, e.g. by profiler agents
+
+	// accepted with Parser.CompatRelay only
+	EndpointMinidump   EndpointType = "minidump"   //  /api/<project_id>/minidump/ native crash uploads
+	EndpointUnreal     EndpointType = "unreal"     //  /api/<project_id>/unreal/<key>/ Unreal Engine crash reports
+	EndpointAttachment EndpointType = "attachment" //  /api/<project_id>/events/<event_id>/attachments/
+)
+
+// checkEndpoint returns ErrEndpointNotAllowed unless AllowedEndpoints is empty or lists e.
+func (p *Parser) checkEndpoint(e EndpointType) error {
+
+	if len(p.AllowedEndpoints) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedEndpoints {
+		if allowed == e {
+			return nil
+		}
+	}
+	return ErrEndpointNotAllowed
+}
@@ -0,0 +1,41 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+//setup
+
+var testTableAllowedEndpoints = []struct {
+	url         string
+	description string
+	err         error
+}{
+	{"https://o1.ingest.sentry.io/api/1234/envelope/", "allowed endpoint", nil},
+	{"https://o1.ingest.sentry.io/api/1234/store/", "store refused", ErrEndpointNotAllowed},
+	{"https://o1.ingest.sentry.io/api/1234/security/", "reporting api refused", ErrEndpointNotAllowed},
+	{"https://o1.ingest.sentry.io/api/embed/error-page/?dsn=https%3A%2F%2F4784fbc50de2473f9977cfce8a9adce5%40o1.ingest.sentry.io%2F1234", "feedback refused", ErrEndpointNotAllowed},
+	{"https://o1.ingest.sentry.io/api/1234/unknown/", "unknown path still missing project", ErrMissingProjectID},
+}
+
+//tests
+
+func TestAllowedEndpoints(t *testing.T) {
+	p := &Parser{AllowedEndpoints: []EndpointType{EndpointEnvelope}}
+	for _, test := range testTableAllowedEndpoints {
+		r := httptest.NewRequest("POST", test.url, nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		if _, err := p.FromRequest(r); err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		}
+	}
+	if kind := ErrorKind(ErrEndpointNotAllowed); kind != "endpoint_not_allowed" {
+		t.Errorf("Expected -- endpoint_not_allowed -- Got %v", kind)
+	}
+	//the zero value accepts every endpoint
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+	if _, err := (&Parser{}).FromRequest(r); err != nil {
+		t.Errorf("Expected -- nil -- Got %v", err)
+	}
+}
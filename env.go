@@ -0,0 +1,91 @@
+package sentrydsn
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvVar is the environment variable SDKs read their DSN from.
+const EnvVar = "SENTRY_DSN"
+
+// Env returns d as a dotenv line, SENTRY_DSN=https://<public_key>@host/1234, without the secret key and
+// without a trailing newline, e.g. for tooling provisioning per-service relay DSNs.
+func (d *DSN) Env() (string, error) {
+
+	dsn, err := d.ClientDSN()
+	if err != nil {
+		return "", err
+	}
+	return EnvVar + "=" + dsn, nil
+}
+
+// WriteEnvFile sets SENTRY_DSN to d in the dotenv file at path. An existing SENTRY_DSN line, exported or not,
+// is replaced and every other line kept; without one the line is appended. New files are created readable
+// by their owner only. The file is replaced atomically, so services never read a half-written one.
+func WriteEnvFile(path string, d *DSN) error {
+
+	line, err := d.Env()
+	if err != nil {
+		return err
+	}
+	mode := fs.FileMode(0o600)
+	old, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if fi, err := os.Stat(path); err == nil {
+			mode = fi.Mode().Perm()
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	var b bytes.Buffer
+	replaced := false
+	for _, l := range strings.SplitAfter(string(old), "\n") {
+		if len(l) == 0 {
+			continue
+		}
+		key, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(l), "export "), "=")
+		if strings.TrimSpace(key) != EnvVar {
+			b.WriteString(l)
+			if !strings.HasSuffix(l, "\n") {
+				b.WriteByte('\n')
+			}
+			continue
+		}
+		if !replaced {
+			if strings.HasPrefix(strings.TrimSpace(l), "export ") {
+				b.WriteString("export ")
+			}
+			b.WriteString(line + "\n")
+			replaced = true
+		}
+	}
+	if !replaced {
+		b.WriteString(line + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".env-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,230 @@
+// Package envelope provides a streaming reader for Sentry envelopes, the newline delimited format
+// sent to /api/<project_id>/envelope/.
+//
+//	{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","dsn":"https://<key>@sentry.io/42"}
+//	{"type":"attachment","length":10,"filename":"hello.txt"}
+//	\xef\xbb\xbfHello\r\n
+//	{"type":"event"}
+//	{"message":"hello world","level":"error"}
+//
+// Items are handed out one at a time as io.Readers over the underlying stream so large attachments
+// never have to be held in memory.
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// default cap on a single header line when Limits.MaxHeaderSize is unset
+const defaultMaxHeaderSize = 64 << 10
+
+var (
+	// ErrInvalidHeader Thrown if the envelope or an item header line is not a JSON object
+	ErrInvalidHeader = errors.New("sentry:  invalid envelope header")
+	// ErrItemTooLarge Thrown if a single item exceeds Limits.MaxItemSize
+	ErrItemTooLarge = errors.New("sentry:  envelope item too large")
+	// ErrEnvelopeTooLarge Thrown once more than Limits.MaxTotalSize bytes have been read from the envelope
+	ErrEnvelopeTooLarge = errors.New("sentry:  envelope too large")
+)
+
+// Limits bounds how much of an envelope a Reader will consume. Zero values mean no limit,
+// except MaxHeaderSize which defaults to 64KB.
+type Limits struct {
+	MaxHeaderSize int64 //longest accepted envelope or item header line
+	MaxItemSize   int64 //largest accepted item payload
+	MaxTotalSize  int64 //largest accepted envelope, headers included
+}
+
+// Header is the first line of an envelope.
+type Header struct {
+	EventID string          `json:"event_id,omitempty"`
+	DSN     string          `json:"dsn,omitempty"`
+	SentAt  string          `json:"sent_at,omitempty"`
+	Trace   *TraceContext   `json:"trace,omitempty"`
+	Raw     json.RawMessage `json:"-"` //the header line as sent, including fields not mapped above
+}
+
+// TraceContext is the dynamic sampling context SDKs attach to envelopes of traced events.
+type TraceContext struct {
+	TraceID     string `json:"trace_id"`
+	PublicKey   string `json:"public_key,omitempty"`
+	SampleRate  string `json:"sample_rate,omitempty"`
+	Sampled     string `json:"sampled,omitempty"`
+	Release     string `json:"release,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Transaction string `json:"transaction,omitempty"`
+}
+
+// ItemHeader precedes every item payload.
+// Length is -1 when the item was sent without one, in which case the payload runs to the next newline.
+type ItemHeader struct {
+	Type           string          `json:"type"`
+	Length         int64           `json:"length"`
+	ContentType    string          `json:"content_type,omitempty"`
+	Filename       string          `json:"filename,omitempty"`
+	AttachmentType string          `json:"attachment_type,omitempty"`
+	Raw            json.RawMessage `json:"-"` //the header line as sent
+}
+
+// Reader iterates over the items of an envelope.
+type Reader struct {
+	src    *bufio.Reader
+	limits Limits
+	header *Header
+	item   *io.LimitedReader //payload of the current length-prefixed item, drained on Next
+	err    error
+}
+
+// NewReader reads the envelope header from r and returns a Reader positioned before the first item.
+func NewReader(r io.Reader, limits Limits) (*Reader, error) {
+
+	if limits.MaxHeaderSize <= 0 {
+		limits.MaxHeaderSize = defaultMaxHeaderSize
+	}
+	if limits.MaxTotalSize > 0 {
+		r = &totalLimiter{r: r, remaining: limits.MaxTotalSize}
+	}
+	er := &Reader{src: bufio.NewReader(r), limits: limits}
+
+	line, err := er.readLine(limits.MaxHeaderSize, ErrInvalidHeader)
+	if err == io.EOF {
+		err = ErrInvalidHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	h := &Header{}
+	if err := json.Unmarshal(line, h); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	h.Raw = line
+	er.header = h
+
+	return er, nil
+}
+
+// Header returns the envelope header.
+func (er *Reader) Header() *Header {
+	return er.header
+}
+
+// Next advances to the next item and returns its header and payload.
+// The payload reader is only valid until the following call to Next; any unread part of it is skipped.
+// Returns io.EOF once the envelope is exhausted. Errors are sticky.
+func (er *Reader) Next() (*ItemHeader, io.Reader, error) {
+
+	if er.err != nil {
+		return nil, nil, er.err
+	}
+	ih, payload, err := er.next()
+	if err != nil {
+		er.err = err
+		return nil, nil, err
+	}
+	return ih, payload, nil
+}
+
+func (er *Reader) next() (*ItemHeader, io.Reader, error) {
+
+	if er.item != nil {
+		if _, err := io.Copy(io.Discard, er.item); err != nil {
+			return nil, nil, err
+		}
+		er.item = nil
+		//payloads with an explicit length may still be followed by a newline
+		if b, err := er.src.Peek(1); err == nil && b[0] == '\n' {
+			er.src.Discard(1)
+		}
+	}
+
+	var line []byte
+	for len(line) == 0 {
+		l, err := er.readLine(er.limits.MaxHeaderSize, ErrInvalidHeader)
+		if err != nil {
+			return nil, nil, err
+		}
+		line = l
+	}
+	ih := &ItemHeader{Length: -1}
+	if err := json.Unmarshal(line, ih); err != nil || len(ih.Type) == 0 {
+		return nil, nil, ErrInvalidHeader
+	}
+	ih.Raw = line
+
+	if ih.Length < 0 {
+		payload, err := er.readLine(er.limits.MaxItemSize, ErrItemTooLarge)
+		if err == io.EOF {
+			err = nil
+		}
+		return ih, bytes.NewReader(payload), err
+	}
+	if er.limits.MaxItemSize > 0 && ih.Length > er.limits.MaxItemSize {
+		return nil, nil, ErrItemTooLarge
+	}
+	er.item = &io.LimitedReader{R: er.src, N: ih.Length}
+	return ih, &itemReader{lr: er.item}, nil
+}
+
+// readLine returns the next line without its terminating newline, failing with tooLong if it exceeds max bytes.
+// max <= 0 means unbounded. io.EOF is only returned when nothing at all could be read.
+func (er *Reader) readLine(max int64, tooLong error) ([]byte, error) {
+
+	var line []byte
+	for {
+		chunk, err := er.src.ReadSlice('\n')
+		line = append(line, chunk...)
+		if max > 0 && int64(len(bytes.TrimRight(line, "\r\n"))) > max {
+			return nil, tooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
+
+// itemReader reports io.ErrUnexpectedEOF if the envelope ends before an item's declared length.
+type itemReader struct {
+	lr *io.LimitedReader
+}
+
+func (ir *itemReader) Read(p []byte) (int, error) {
+
+	n, err := ir.lr.Read(p)
+	if err == io.EOF && ir.lr.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// totalLimiter fails with ErrEnvelopeTooLarge once the source yields more than the allowed number of bytes.
+type totalLimiter struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (t *totalLimiter) Read(p []byte) (int, error) {
+
+	if t.remaining < 0 {
+		return 0, ErrEnvelopeTooLarge
+	}
+	if int64(len(p)) > t.remaining+1 {
+		p = p[:t.remaining+1]
+	}
+	n, err := t.r.Read(p)
+	t.remaining -= int64(n)
+	if t.remaining < 0 {
+		return n, ErrEnvelopeTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,109 @@
+package envelope
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+//setup
+
+const testEnvelope = `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42"}
+{"type":"attachment","length":10,"filename":"hello.txt"}
+helloworld
+{"type":"event"}
+{"message":"hello world","level":"error"}
+{"type":"attachment","length":4}
+abcd`
+
+type testItem struct {
+	itemType string
+	payload  string
+}
+
+//tests
+
+func TestReaderItems(t *testing.T) {
+	expected := []testItem{
+		{"attachment", "helloworld"},
+		{"event", `{"message":"hello world","level":"error"}`},
+		{"attachment", "abcd"},
+	}
+	er, err := NewReader(strings.NewReader(testEnvelope), Limits{})
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if er.Header().EventID != "9ec79c33ec9942ab8353589fcb2e04dc" {
+		t.Errorf("Expected -- 9ec79c33ec9942ab8353589fcb2e04dc -- Got %s", er.Header().EventID)
+	}
+	for _, test := range expected {
+		ih, payload, err := er.Next()
+		if err != nil {
+			t.Fatalf("Expected -- %s -- Got %s", test.itemType, err)
+		}
+		b, _ := io.ReadAll(payload)
+		if ih.Type != test.itemType || string(b) != test.payload {
+			t.Errorf("Expected -- %s %s -- Got %s %s", test.itemType, test.payload, ih.Type, b)
+		}
+	}
+	if _, _, err := er.Next(); err != io.EOF {
+		t.Errorf("Expected -- %s -- Got %v", io.EOF, err)
+	}
+}
+
+func TestReaderSkipsUnreadPayload(t *testing.T) {
+	er, _ := NewReader(strings.NewReader(testEnvelope), Limits{})
+	er.Next()
+	ih, _, err := er.Next()
+	if err != nil || ih.Type != "event" {
+		t.Errorf("Expected -- event -- Got %v %v", ih, err)
+	}
+}
+
+var testTableLimits = []struct {
+	limits      Limits
+	description string
+	expected    error
+}{
+	{Limits{MaxItemSize: 5}, "attachment over item limit", ErrItemTooLarge},
+	{Limits{MaxItemSize: 20}, "length-less event over item limit", ErrItemTooLarge},
+	{Limits{MaxTotalSize: 150}, "envelope over total limit", ErrEnvelopeTooLarge},
+	{Limits{MaxHeaderSize: 20}, "header over header limit", ErrInvalidHeader},
+	{Limits{MaxItemSize: 64, MaxTotalSize: int64(len(testEnvelope))}, "within limits", io.EOF},
+}
+
+func TestReaderLimits(t *testing.T) {
+	for _, test := range testTableLimits {
+		er, err := NewReader(strings.NewReader(testEnvelope), test.limits)
+		for err == nil {
+			var payload io.Reader
+			_, payload, err = er.Next()
+			if err == nil {
+				_, err = io.Copy(io.Discard, payload)
+			}
+		}
+		if err != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, err)
+		}
+	}
+}
+
+func TestReaderTruncatedItem(t *testing.T) {
+	er, _ := NewReader(strings.NewReader("{}\n{\"type\":\"attachment\",\"length\":10}\nshort"), Limits{})
+	_, payload, _ := er.Next()
+	if _, err := io.ReadAll(payload); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected -- %s -- Got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestReaderInvalidHeader(t *testing.T) {
+	for _, body := range []string{"", "not json\n", "{}\n{\"length\":2}\nab"} {
+		er, err := NewReader(strings.NewReader(body), Limits{})
+		if err == nil {
+			_, _, err = er.Next()
+		}
+		if err != ErrInvalidHeader {
+			t.Errorf("Expected -- %s -- Got %v", ErrInvalidHeader, err)
+		}
+	}
+}
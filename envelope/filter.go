@@ -0,0 +1,193 @@
+package envelope
+
+import (
+	"bytes"
+	"io"
+)
+
+// client report reasons recorded for items removed by a Filter
+const (
+	ReasonFiltered = "filtered"    //removed by a Rule
+	ReasonSampled  = "sample_rate" //rejected by Filter.Keep
+)
+
+// Rule drops or truncates items of one type.
+type Rule struct {
+	Type     string //item type the rule applies to, e.g. "attachment", "replay_recording", "profile"
+	Category string //data category the rule applies to when Type is empty, e.g. "replay" for all replay items
+	MaxSize  int64  //items larger than this are affected; 0 affects every item of Type
+	Truncate bool   //cut oversize items down to MaxSize instead of dropping them. Only sensible for attachments.
+}
+
+// DiscardedEvent mirrors an entry of the discarded_events list in a Sentry client report.
+type DiscardedEvent struct {
+	Reason   string `json:"reason"`
+	Category string `json:"category"`
+	Quantity int    `json:"quantity"`
+}
+
+// Outcomes counts what a Filter removed from an envelope.
+type Outcomes struct {
+	Discarded      []DiscardedEvent //quantities as Quantity counts them, so attachments in bytes
+	Dropped        int              //items dropped
+	DroppedBytes   int64            //payload bytes of dropped items
+	TruncatedBytes int64            //payload bytes cut from truncated items
+}
+
+// drop records an item of itemType with a payload of size bytes dropped for reason.
+func (o *Outcomes) drop(reason string, itemType string, size int64) {
+
+	o.Dropped++
+	o.DroppedBytes += size
+	category, quantity := Category(itemType), Quantity(itemType, size)
+	for i := range o.Discarded {
+		if o.Discarded[i].Reason == reason && o.Discarded[i].Category == category {
+			o.Discarded[i].Quantity += quantity
+			return
+		}
+	}
+	o.Discarded = append(o.Discarded, DiscardedEvent{Reason: reason, Category: category, Quantity: quantity})
+}
+
+// Filter rewrites envelopes, removing or truncating items according to Rules before they are forwarded.
+// The first rule matching an item's type applies; items without a matching rule pass through untouched.
+type Filter struct {
+	Rules  []Rule
+	Limits Limits //limits applied while reading the source envelope
+	// Keep, when set, is asked about every item before the rules; items it rejects are dropped, e.g. to sample
+	// replays by the replay ID in the envelope header so every segment of a replay shares one decision.
+	Keep func(h *Header, ih *ItemHeader) bool
+}
+
+// Apply copies the envelope read from src to dst, applying the filter rules, and reports what was removed.
+// Payloads are streamed; only length-less items (which are line delimited) are held in memory.
+func (f *Filter) Apply(dst io.Writer, src io.Reader) (*Outcomes, error) {
+
+	er, err := NewReader(src, f.Limits)
+	if err != nil {
+		return nil, err
+	}
+	ew, err := NewWriter(dst, er.Header())
+	if err != nil {
+		return nil, err
+	}
+	outcomes := &Outcomes{}
+	for {
+		ih, payload, err := er.Next()
+		if err == io.EOF {
+			return outcomes, nil
+		}
+		if err != nil {
+			return outcomes, err
+		}
+		size := ih.Length
+		if size < 0 {
+			size = int64(payload.(*bytes.Reader).Len())
+		}
+		rule := f.match(ih.Type)
+
+		switch {
+		case f.Keep != nil && !f.Keep(er.Header(), ih):
+			outcomes.drop(ReasonSampled, ih.Type, size)
+		case rule == nil || size <= rule.MaxSize:
+			err = ew.WriteItem(ih, payload)
+		case rule.Truncate:
+			var cut *ItemHeader
+			if cut, err = ih.WithLength(rule.MaxSize); err == nil {
+				outcomes.TruncatedBytes += size - rule.MaxSize
+				err = ew.WriteItem(cut, payload)
+			}
+		default:
+			outcomes.drop(ReasonFiltered, ih.Type, size)
+		}
+		if err != nil {
+			return outcomes, err
+		}
+	}
+}
+
+func (f *Filter) match(itemType string) *Rule {
+
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if r.Type == itemType || (len(r.Type) == 0 && len(r.Category) > 0 && r.Category == Category(itemType)) {
+			return r
+		}
+	}
+	return nil
+}
+
+// IsProfile reports whether itemType carries profiling data: a transaction profile or a chunk of a
+// continuous profile.
+func IsProfile(itemType string) bool {
+	return itemType == "profile" || itemType == "profile_chunk"
+}
+
+// ItemSize is the type and payload size of one envelope item.
+type ItemSize struct {
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+// Sizes reads the envelope from src and returns the size of every item in order, without holding payloads
+// in memory, e.g. to see how much of an envelope is replay data before deciding on it.
+func Sizes(src io.Reader, limits Limits) ([]ItemSize, error) {
+
+	er, err := NewReader(src, limits)
+	if err != nil {
+		return nil, err
+	}
+	var sizes []ItemSize
+	for {
+		ih, payload, err := er.Next()
+		if err == io.EOF {
+			return sizes, nil
+		}
+		if err != nil {
+			return sizes, err
+		}
+		size := ih.Length
+		if size < 0 {
+			size = int64(payload.(*bytes.Reader).Len())
+		}
+		sizes = append(sizes, ItemSize{ih.Type, size})
+	}
+}
+
+// Quantity is how much an item of itemType with a payload of size bytes counts for in its data category:
+// attachments count their bytes, every other item counts once.
+func Quantity(itemType string, size int64) int {
+
+	if Category(itemType) == "attachment" {
+		return int(size)
+	}
+	return 1
+}
+
+// Category maps an item type onto the data category Sentry uses for rate limits and client reports.
+func Category(itemType string) string {
+
+	switch itemType {
+	case "event":
+		return "error"
+	case "transaction":
+		return "transaction"
+	case "attachment":
+		return "attachment"
+	case "session", "sessions":
+		return "session"
+	case "replay_event", "replay_recording", "replay_video":
+		return "replay"
+	case "profile":
+		return "profile"
+	case "profile_chunk":
+		return "profile_chunk"
+	case "check_in":
+		return "monitor"
+	case "statsd", "metric_buckets":
+		return "metric_bucket"
+	case "user_report", "feedback":
+		return "user_report"
+	}
+	return "default"
+}
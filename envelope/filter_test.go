@@ -0,0 +1,119 @@
+package envelope
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+var testTableFilter = []struct {
+	rules       []Rule
+	description string
+	expected    []testItem
+	discarded   []DiscardedEvent
+	dropped     int
+}{
+	{nil, "no rules",
+		[]testItem{{"attachment", "helloworld"}, {"event", `{"message":"hello world","level":"error"}`}, {"attachment", "abcd"}},
+		nil, 0},
+	{[]Rule{{Type: "attachment", MaxSize: 5}}, "drop oversize attachments",
+		[]testItem{{"event", `{"message":"hello world","level":"error"}`}, {"attachment", "abcd"}},
+		[]DiscardedEvent{{ReasonFiltered, "attachment", 10}}, 1},
+	{[]Rule{{Type: "attachment", MaxSize: 3, Truncate: true}}, "truncate attachments",
+		[]testItem{{"attachment", "hel"}, {"event", `{"message":"hello world","level":"error"}`}, {"attachment", "abc"}},
+		nil, 0},
+	{[]Rule{{Type: "attachment"}, {Type: "event"}}, "drop everything",
+		nil,
+		[]DiscardedEvent{{ReasonFiltered, "attachment", 14}, {ReasonFiltered, "error", 1}}, 3},
+	{[]Rule{{Category: "attachment", MaxSize: 5}}, "drop oversize by category",
+		[]testItem{{"event", `{"message":"hello world","level":"error"}`}, {"attachment", "abcd"}},
+		[]DiscardedEvent{{ReasonFiltered, "attachment", 10}}, 1},
+}
+
+const testReplayEnvelope = `{"event_id":"36b75d9fa11f45459412a96c41bdf691"}
+{"type":"replay_event"}
+{"type":"replay_event","replay_id":"36b75d9fa11f45459412a96c41bdf691","segment_id":0}
+{"type":"replay_recording","length":19}
+{"segment_id":0}
+[]`
+
+func TestFilter(t *testing.T) {
+	for _, test := range testTableFilter {
+		var out bytes.Buffer
+		f := &Filter{Rules: test.rules}
+		outcomes, err := f.Apply(&out, strings.NewReader(testEnvelope))
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		if len(outcomes.Discarded) != len(test.discarded) {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.discarded, outcomes.Discarded)
+		}
+		for i := range test.discarded {
+			if i < len(outcomes.Discarded) && outcomes.Discarded[i] != test.discarded[i] {
+				t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.discarded[i], outcomes.Discarded[i])
+			}
+		}
+		if outcomes.Dropped != test.dropped {
+			t.Errorf("%s: Expected -- %d dropped -- Got %d", test.description, test.dropped, outcomes.Dropped)
+		}
+
+		//the filtered envelope must still parse
+		er, err := NewReader(&out, Limits{})
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		for _, item := range test.expected {
+			ih, payload, err := er.Next()
+			if err != nil {
+				t.Fatalf("%s: Expected -- %s -- Got %s", test.description, item.itemType, err)
+			}
+			b, _ := io.ReadAll(payload)
+			if ih.Type != item.itemType || string(b) != item.payload {
+				t.Errorf("%s: Expected -- %s %s -- Got %s %s", test.description, item.itemType, item.payload, ih.Type, b)
+			}
+		}
+		if _, _, err := er.Next(); err != io.EOF {
+			t.Errorf("%s: Expected -- %s -- Got %v", test.description, io.EOF, err)
+		}
+	}
+}
+
+func TestFilterReplay(t *testing.T) {
+	var asked []string
+	var out bytes.Buffer
+	f := &Filter{Keep: func(h *Header, ih *ItemHeader) bool {
+		asked = append(asked, h.EventID)
+		return Category(ih.Type) != "replay"
+	}}
+	outcomes, err := f.Apply(&out, strings.NewReader(testReplayEnvelope))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if len(asked) != 2 || asked[0] != "36b75d9fa11f45459412a96c41bdf691" {
+		t.Errorf("Expected -- 2 replay id -- Got %v", asked)
+	}
+	expected := DiscardedEvent{ReasonSampled, "replay", 2}
+	if len(outcomes.Discarded) != 1 || outcomes.Discarded[0] != expected {
+		t.Errorf("Expected -- %v -- Got %v", expected, outcomes.Discarded)
+	}
+	if outcomes.DroppedBytes != int64(len(`{"type":"replay_event","replay_id":"36b75d9fa11f45459412a96c41bdf691","segment_id":0}`))+19 {
+		t.Errorf("Expected -- both payloads -- Got %d", outcomes.DroppedBytes)
+	}
+}
+
+func TestSizes(t *testing.T) {
+	sizes, err := Sizes(strings.NewReader(testReplayEnvelope), Limits{})
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	expected := []ItemSize{{"replay_event", 85}, {"replay_recording", 19}}
+	if len(sizes) != len(expected) {
+		t.Fatalf("Expected -- %v -- Got %v", expected, sizes)
+	}
+	for i := range expected {
+		if sizes[i] != expected[i] {
+			t.Errorf("Expected -- %v -- Got %v", expected[i], sizes[i])
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package envelope
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func FuzzReader(f *testing.F) {
+	f.Add([]byte("{\"event_id\":\"9ec79c33ec9942ab8353589fcb2e04dc\",\"dsn\":\"https://e12d836b15bb49d7bbf99e64295d995b@sentry.io/42\"}\n{\"type\":\"event\",\"length\":2}\n{}\n"))
+	f.Add([]byte("{\"sent_at\":\"2021-02-24T05:34:37Z\",\"trace\":{\"trace_id\":\"771a43a4192642f0b136d5159a501700\"}}\n{\"type\":\"attachment\",\"length\":5,\"filename\":\"a.txt\"}\nhello\n{\"type\":\"session\"}\n{\"started\":\"2021-02-24T05:34:37Z\"}\n"))
+	f.Add([]byte("{}\n{\"type\":\"event\"}\n{}"))
+	f.Add([]byte("{}\n{\"type\":\"event\",\"length\":1000}\n{}"))
+	f.Add([]byte("not json\n"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		er, err := NewReader(bytes.NewReader(b), Limits{MaxItemSize: 1 << 16, MaxTotalSize: 1 << 20})
+		if err != nil {
+			return
+		}
+		//every iteration consumes input, so a finite envelope always ends
+		for i := 0; i <= len(b); i++ {
+			_, payload, err := er.Next()
+			if err != nil {
+				return
+			}
+			io.Copy(io.Discard, payload)
+		}
+		t.Errorf("Expected -- the reader to end -- Got more than %v items", len(b))
+	})
+}
@@ -0,0 +1,31 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ClientReport is the payload of a client_report item, telling Sentry about events discarded before they
+// reached it so project stats show them as filtered or rate limited instead of silently missing.
+type ClientReport struct {
+	Timestamp       float64          `json:"timestamp"` //unix seconds
+	DiscardedEvents []DiscardedEvent `json:"discarded_events"`
+}
+
+// WriteClientReport writes an envelope addressed to dsn holding report as its only item.
+func WriteClientReport(w io.Writer, dsn string, report *ClientReport) error {
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	sec := int64(report.Timestamp)
+	sentAt := time.Unix(sec, int64((report.Timestamp-float64(sec))*1e9)).UTC().Format(time.RFC3339)
+	ew, err := NewWriter(w, &Header{DSN: dsn, SentAt: sentAt})
+	if err != nil {
+		return err
+	}
+	return ew.WriteItem(&ItemHeader{Type: "client_report", Length: int64(len(payload))}, bytes.NewReader(payload))
+}
@@ -0,0 +1,39 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestWriteClientReport(t *testing.T) {
+	var out bytes.Buffer
+	report := &ClientReport{Timestamp: 1614144877.5, DiscardedEvents: []DiscardedEvent{{ReasonSampled, "replay", 2}}}
+	if err := WriteClientReport(&out, "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42", report); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+
+	er, err := NewReader(&out, Limits{})
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if h := er.Header(); h.DSN != "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42" || h.SentAt != "2021-02-24T05:34:37Z" {
+		t.Errorf("Expected -- dsn and sent_at -- Got %+v", h)
+	}
+	ih, payload, err := er.Next()
+	if err != nil || ih.Type != "client_report" {
+		t.Fatalf("Expected -- client_report -- Got %v %v", ih, err)
+	}
+	var got ClientReport
+	b, _ := io.ReadAll(payload)
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if got.Timestamp != report.Timestamp || len(got.DiscardedEvents) != 1 || got.DiscardedEvents[0] != report.DiscardedEvents[0] {
+		t.Errorf("Expected -- %+v -- Got %+v", report, got)
+	}
+	if _, _, err := er.Next(); err != io.EOF {
+		t.Errorf("Expected -- %s -- Got %v", io.EOF, err)
+	}
+}
@@ -0,0 +1,107 @@
+package envelope
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Writer serializes an envelope, e.g. to forward a filtered copy of one read with Reader.
+type Writer struct {
+	dst io.Writer
+}
+
+// NewWriter writes the envelope header to w. The header's Raw line is written as is when set.
+func NewWriter(w io.Writer, h *Header) (*Writer, error) {
+
+	line := []byte(h.Raw)
+	if len(line) == 0 {
+		b, err := json.Marshal(h)
+		if err != nil {
+			return nil, err
+		}
+		line = b
+	}
+	if err := writeLine(w, line); err != nil {
+		return nil, err
+	}
+	return &Writer{dst: w}, nil
+}
+
+// WriteItem writes an item header followed by its payload.
+// Items with a Length copy exactly that many bytes of payload; length-less items copy the payload up to EOF,
+// which must then not contain a newline.
+func (ew *Writer) WriteItem(ih *ItemHeader, payload io.Reader) error {
+
+	line := []byte(ih.Raw)
+	if len(line) == 0 {
+		b, err := marshalItemHeader(ih)
+		if err != nil {
+			return err
+		}
+		line = b
+	}
+	if err := writeLine(ew.dst, line); err != nil {
+		return err
+	}
+	if ih.Length >= 0 {
+		if _, err := io.CopyN(ew.dst, payload, ih.Length); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(ew.dst, payload); err != nil {
+		return err
+	}
+	_, err := ew.dst.Write([]byte{'\n'})
+	return err
+}
+
+// marshalItemHeader renders ih, omitting length when the item has none.
+func marshalItemHeader(ih *ItemHeader) ([]byte, error) {
+
+	if ih.Length >= 0 {
+		return json.Marshal(ih)
+	}
+	type noLength struct {
+		Type           string `json:"type"`
+		ContentType    string `json:"content_type,omitempty"`
+		Filename       string `json:"filename,omitempty"`
+		AttachmentType string `json:"attachment_type,omitempty"`
+	}
+	return json.Marshal(noLength{ih.Type, ih.ContentType, ih.Filename, ih.AttachmentType})
+}
+
+// WithLength returns a copy of the item header with its length field replaced, keeping any other fields of the raw line.
+// Used when a payload is rewritten before forwarding.
+func (ih *ItemHeader) WithLength(length int64) (*ItemHeader, error) {
+
+	fields := map[string]json.RawMessage{}
+	if len(ih.Raw) > 0 {
+		if err := json.Unmarshal(ih.Raw, &fields); err != nil {
+			return nil, err
+		}
+	} else {
+		b, err := json.Marshal(ih)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(b, &fields)
+	}
+	l, _ := json.Marshal(length)
+	fields["length"] = l
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	out := *ih
+	out.Length = length
+	out.Raw = raw
+	return &out, nil
+}
+
+func writeLine(w io.Writer, line []byte) error {
+
+	if _, err := w.Write(line); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
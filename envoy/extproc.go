@@ -0,0 +1,136 @@
+// Package extproc implements Envoy's external processing gRPC service, so Envoy can derive the DSN of each
+// request here and route or rate limit on the result. Configure the ext_proc filter to send request headers only:
+//
+//	processing_mode: {request_header_mode: SEND, response_header_mode: SKIP}
+//
+// The parsed DSN is returned as dynamic metadata under the envoy.filters.http.ext_proc namespace
+// (project_id, public_key, host, endpoint). It lives in its own module so the parser does not depend on gRPC.
+package extproc
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// MetadataNamespace is the dynamic metadata namespace the DSN is emitted under.
+const MetadataNamespace = "envoy.filters.http.ext_proc"
+
+// Server implements extprocv3.ExternalProcessorServer.
+type Server struct {
+	extprocv3.UnimplementedExternalProcessorServer
+
+	Parser *sentrydsn.Parser //zero Parser when nil
+	// RejectInvalid answers requests whose DSN cannot be derived directly, 403 for untrusted hosts and 400 otherwise.
+	// Without it they continue without metadata and Envoy's routes decide.
+	RejectInvalid bool
+}
+
+// Process implements extprocv3.ExternalProcessorServer.
+func (s *Server) Process(stream extprocv3.ExternalProcessor_ProcessServer) error {
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var resp *extprocv3.ProcessingResponse
+		switch v := req.Request.(type) {
+		case *extprocv3.ProcessingRequest_RequestHeaders:
+			resp = s.requestHeaders(v.RequestHeaders.GetHeaders())
+		case *extprocv3.ProcessingRequest_RequestBody:
+			resp = &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_RequestBody{RequestBody: &extprocv3.BodyResponse{}}}
+		case *extprocv3.ProcessingRequest_RequestTrailers:
+			resp = &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_RequestTrailers{RequestTrailers: &extprocv3.TrailersResponse{}}}
+		case *extprocv3.ProcessingRequest_ResponseHeaders:
+			resp = &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_ResponseHeaders{ResponseHeaders: &extprocv3.HeadersResponse{}}}
+		case *extprocv3.ProcessingRequest_ResponseBody:
+			resp = &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_ResponseBody{ResponseBody: &extprocv3.BodyResponse{}}}
+		case *extprocv3.ProcessingRequest_ResponseTrailers:
+			resp = &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_ResponseTrailers{ResponseTrailers: &extprocv3.TrailersResponse{}}}
+		default:
+			return errors.New("sentry:  unknown ext_proc request")
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) requestHeaders(headers *corev3.HeaderMap) *extprocv3.ProcessingResponse {
+
+	values := map[string]string{}
+	for _, h := range headers.GetHeaders() {
+		v := h.GetValue()
+		if len(h.GetRawValue()) > 0 {
+			v = string(h.GetRawValue())
+		}
+		values[h.GetKey()] = v
+	}
+	p := s.Parser
+	if p == nil {
+		p = &sentrydsn.Parser{}
+	}
+	r, err := requestFromHeaders(values)
+	var dsn *sentrydsn.DSN
+	if err == nil {
+		dsn, err = p.FromRequest(r)
+	}
+	if err != nil {
+		if !s.RejectInvalid {
+			return &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_RequestHeaders{RequestHeaders: &extprocv3.HeadersResponse{}}}
+		}
+		code := typev3.StatusCode_BadRequest
+		if errors.Is(err, sentrydsn.ErrUntrustedHost) {
+			code = typev3.StatusCode_Forbidden
+		}
+		return &extprocv3.ProcessingResponse{Response: &extprocv3.ProcessingResponse_ImmediateResponse{ImmediateResponse: &extprocv3.ImmediateResponse{
+			Status: &typev3.HttpStatus{Code: code},
+			Body:   []byte(err.Error()),
+		}}}
+	}
+
+	meta, _ := structpb.NewStruct(map[string]interface{}{
+		MetadataNamespace: map[string]interface{}{
+			"project_id": dsn.ProjectID,
+			"public_key": dsn.PublicKey,
+			"host":       dsn.Host,
+			"endpoint":   string(dsn.Endpoint),
+		},
+	})
+	return &extprocv3.ProcessingResponse{
+		Response:        &extprocv3.ProcessingResponse_RequestHeaders{RequestHeaders: &extprocv3.HeadersResponse{}},
+		DynamicMetadata: meta,
+	}
+}
+
+// requestFromHeaders rebuilds the request Envoy describes with HTTP/2 style pseudo headers.
+func requestFromHeaders(values map[string]string) (*http.Request, error) {
+
+	scheme := values[":scheme"]
+	if len(scheme) == 0 {
+		scheme = "https"
+	}
+	u, err := url.Parse(scheme + "://" + values[":authority"] + values[":path"])
+	if err != nil {
+		return nil, sentrydsn.ErrMissingProjectID
+	}
+	r := &http.Request{Method: values[":method"], URL: u, Host: u.Host, Header: http.Header{}, Body: http.NoBody}
+	for k, v := range values {
+		if len(k) > 0 && k[0] != ':' {
+			r.Header.Set(k, v)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,116 @@
+package extproc
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/grpc"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+var testTableHeaders = []struct {
+	headers     map[string]string
+	description string
+	expected    string
+}{
+	{map[string]string{":method": "POST", ":scheme": "https", ":authority": "o1.ingest.sentry.io", ":path": "/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5"},
+		"query auth", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234"},
+	{map[string]string{":method": "POST", ":authority": "sentry.example.com:9000", ":path": "/api/1234/store/", "x-sentry-auth": "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5"},
+		"header auth", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com:9000/1234"},
+}
+
+func TestRequestFromHeaders(t *testing.T) {
+	for _, test := range testTableHeaders {
+		r, err := requestFromHeaders(test.headers)
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %v", test.description, err)
+		}
+		dsn, err := sentrydsn.FromRequest(r)
+		if err != nil || dsn.URL != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v %v", test.description, test.expected, dsn, err)
+		}
+	}
+}
+
+// testStream feeds requests to Process and records its responses
+type testStream struct {
+	grpc.ServerStream
+	requests  []*extprocv3.ProcessingRequest
+	responses []*extprocv3.ProcessingResponse
+}
+
+func (s *testStream) Recv() (*extprocv3.ProcessingRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	r := s.requests[0]
+	s.requests = s.requests[1:]
+	return r, nil
+}
+
+func (s *testStream) Send(r *extprocv3.ProcessingResponse) error {
+	s.responses = append(s.responses, r)
+	return nil
+}
+
+func headersRequest(headers map[string]string) *extprocv3.ProcessingRequest {
+	hm := &corev3.HeaderMap{}
+	for k, v := range headers {
+		hm.Headers = append(hm.Headers, &corev3.HeaderValue{Key: k, RawValue: []byte(v)})
+	}
+	return &extprocv3.ProcessingRequest{Request: &extprocv3.ProcessingRequest_RequestHeaders{RequestHeaders: &extprocv3.HttpHeaders{Headers: hm}}}
+}
+
+func TestProcessMetadata(t *testing.T) {
+	stream := &testStream{requests: []*extprocv3.ProcessingRequest{
+		headersRequest(testTableHeaders[0].headers),
+		{Request: &extprocv3.ProcessingRequest_ResponseHeaders{ResponseHeaders: &extprocv3.HttpHeaders{}}},
+	}}
+	if err := (&Server{}).Process(stream); err != nil || len(stream.responses) != 2 {
+		t.Fatalf("Expected -- 2 responses -- Got %v %v", stream.responses, err)
+	}
+	meta := stream.responses[0].GetDynamicMetadata().AsMap()[MetadataNamespace]
+	expected := map[string]interface{}{"project_id": "1234", "public_key": "4784fbc50de2473f9977cfce8a9adce5", "host": "o1.ingest.sentry.io", "endpoint": "envelope"}
+	if !reflect.DeepEqual(meta, expected) || stream.responses[0].GetRequestHeaders() == nil {
+		t.Errorf("Expected -- %v -- Got %v", expected, meta)
+	}
+	if stream.responses[1].GetResponseHeaders() == nil {
+		t.Errorf("Expected -- response headers continued -- Got %v", stream.responses[1])
+	}
+}
+
+var testTableProcessInvalid = []struct {
+	server      *Server
+	headers     map[string]string
+	description string
+	expected    typev3.StatusCode //0 when the request continues
+}{
+	{&Server{RejectInvalid: true}, map[string]string{":method": "POST", ":authority": "o1.ingest.sentry.io", ":path": "/api/1234/envelope/"},
+		"missing key rejected", typev3.StatusCode_BadRequest},
+	{&Server{RejectInvalid: true, Parser: &sentrydsn.Parser{AllowedHosts: sentrydsn.HostAllowlist{"sentry.example.com"}}}, testTableHeaders[0].headers,
+		"untrusted host rejected", typev3.StatusCode_Forbidden},
+	{&Server{}, map[string]string{":method": "POST", ":authority": "o1.ingest.sentry.io", ":path": "/api/1234/envelope/"},
+		"missing key continued", 0},
+}
+
+func TestProcessInvalid(t *testing.T) {
+	for _, test := range testTableProcessInvalid {
+		stream := &testStream{requests: []*extprocv3.ProcessingRequest{headersRequest(test.headers)}}
+		if err := test.server.Process(stream); err != nil || len(stream.responses) != 1 {
+			t.Fatalf("%s: Expected -- 1 response -- Got %v %v", test.description, stream.responses, err)
+		}
+		resp := stream.responses[0]
+		got := resp.GetImmediateResponse().GetStatus().GetCode()
+		if got != test.expected || resp.GetDynamicMetadata() != nil {
+			t.Errorf("%s: Expected -- %v without metadata -- Got %v %v", test.description, test.expected, got, resp)
+		}
+		if test.expected == 0 && resp.GetRequestHeaders() == nil {
+			t.Errorf("%s: Expected -- the request continued -- Got %v", test.description, resp)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package sentrydsn
+
+import (
+	"sync"
+	"time"
+)
+
+// defaults applied when the Parser error rate fields are unset
+const (
+	defaultErrorRateThreshold = 0.2
+	defaultErrorRateWindow    = time.Minute
+	errorRateMinRequests      = 20 //fewer parses in the window never fire, so one bad request is not a 100% rate
+	errorRateBuckets          = 12 //the window slides in steps of Window/12
+)
+
+// errorRate is a sliding window of parse outcomes
+type errorRate struct {
+	mu      sync.Mutex
+	buckets [errorRateBuckets]rateBucket
+	firing  bool //the rate is above the threshold and OnErrorRate was called
+}
+
+type rateBucket struct {
+	slot     int64 //time slot the counts belong to
+	total    int64
+	failures int64
+}
+
+// record adds one parse outcome and returns the failure rate over the window when it just went above threshold.
+func (e *errorRate) record(now time.Time, failed bool, window time.Duration, threshold float64) (rate float64, failures, total int64, fire bool) {
+
+	step := int64(window / errorRateBuckets)
+	if step <= 0 {
+		step = 1
+	}
+	slot := now.UnixNano() / step
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b := &e.buckets[slot%errorRateBuckets]
+	if b.slot != slot {
+		*b = rateBucket{slot: slot}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+	for _, b := range e.buckets {
+		if b.slot > slot-errorRateBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	rate = float64(failures) / float64(total)
+	above := total >= errorRateMinRequests && rate > threshold
+	fire = above && !e.firing
+	e.firing = above
+	return rate, failures, total, fire
+}
+
+// countOutcome feeds err into the error rate and calls OnErrorRate when the rate crosses the threshold.
+func (p *Parser) countOutcome(err error) {
+
+	if p.OnErrorRate == nil || err == ErrPreflight {
+		return
+	}
+	window := p.ErrorRateWindow
+	if window <= 0 {
+		window = defaultErrorRateWindow
+	}
+	threshold := p.ErrorRateThreshold
+	if threshold <= 0 {
+		threshold = defaultErrorRateThreshold
+	}
+	if rate, failures, total, fire := p.errorRate.record(Now(p.Clock), err != nil, window, threshold); fire {
+		p.OnErrorRate(rate, failures, total)
+	}
+}
@@ -0,0 +1,76 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOnErrorRate(t *testing.T) {
+	type alert struct {
+		rate            float64
+		failures, total int64
+	}
+	var alerts []alert
+	p := &Parser{ErrorRateThreshold: 0.5, OnErrorRate: func(rate float64, failures, total int64) {
+		alerts = append(alerts, alert{rate, failures, total})
+	}}
+	good := func() { p.FromRequest(cacheRequest("1234")) }
+	bad := func() {
+		p.FromRequest(httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/", nil))
+	}
+	preflight := func() {
+		p.FromRequest(httptest.NewRequest("OPTIONS", "https://o1.ingest.sentry.io/api/1234/envelope/", nil))
+	}
+
+	//too few parses to judge
+	for i := 0; i < 10; i++ {
+		bad()
+	}
+	for i := 0; i < 25; i++ {
+		good()
+		preflight()
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("Expected -- no alert -- Got %v", alerts)
+	}
+	//10/35 failed, the 16th failure more crosses 50%
+	for i := 0; i < 20; i++ {
+		bad()
+	}
+	if len(alerts) != 1 || alerts[0] != (alert{26.0 / 51, 26, 51}) {
+		t.Fatalf("Expected -- one alert at 26/51 -- Got %v", alerts)
+	}
+
+	//back below the threshold re-arms the alert
+	for i := 0; i < 40; i++ {
+		good()
+	}
+	for i := 0; i < 40; i++ {
+		bad()
+	}
+	if len(alerts) != 2 {
+		t.Errorf("Expected -- 2 alerts -- Got %v", alerts)
+	}
+}
+
+func TestErrorRateWindow(t *testing.T) {
+	e := &errorRate{}
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 30; i++ {
+		e.record(now, true, time.Minute, 0.5)
+	}
+	//the failures have left the window
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 19; i++ {
+		if rate, _, _, fire := e.record(now, false, time.Minute, 0.5); fire || rate != 0 {
+			t.Fatalf("Expected -- 0 -- Got %v %v", rate, fire)
+		}
+	}
+	//the successes 5s ago are still in the window
+	now = now.Add(5 * time.Second)
+	e.record(now, true, time.Minute, 0.5)
+	if _, failures, total, _ := e.record(now, true, time.Minute, 0.5); failures != 2 || total != 21 {
+		t.Errorf("Expected -- 2/21 -- Got %d/%d", failures, total)
+	}
+}
@@ -0,0 +1,27 @@
+// Package cloudfunction is an example Google Cloud Functions entrypoint for the tunnel.
+// Deploy it with gcloud functions deploy sentry-tunnel --entry-point Tunnel --runtime go124 --trigger-http
+// and configure it through the environment, see proxy.TunnelFromEnv.
+package cloudfunction
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+var handler http.Handler
+
+func init() {
+
+	tunnel, err := proxy.TunnelFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler = proxy.BehindPlatformProxy(tunnel)
+}
+
+// Tunnel is the HTTP function.
+func Tunnel(w http.ResponseWriter, r *http.Request) {
+	handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,144 @@
+package sentrydsn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const http_x_sentry_dsn = "X-Sentry-DSN"
+
+// ErrMissingDSN Thrown when an extractor expecting a full client DSN finds nothing to parse
+var ErrMissingDSN = errors.New("sentry:  missing dsn")
+
+// Extractor derives a DSN from an incoming request.
+// FromRequest is the default strategy; tunnels that receive the DSN some other way plug in their own.
+type Extractor interface {
+	Extract(r *http.Request) (*DSN, error)
+}
+
+// ExtractorFunc adapts an ordinary function to the Extractor interface.
+type ExtractorFunc func(r *http.Request) (*DSN, error)
+
+// Extract calls f(r).
+func (f ExtractorFunc) Extract(r *http.Request) (*DSN, error) {
+	return f(r)
+}
+
+// HeaderDSN returns an Extractor that reads a full client DSN from the named request header and parses it via ParseDSN.
+// An empty name uses the X-Sentry-DSN convention shared by several community tunnel implementations.
+// Returns ErrMissingDSN if the header is absent.
+func HeaderDSN(name string) Extractor {
+
+	if len(name) == 0 {
+		name = http_x_sentry_dsn
+	}
+	return ExtractorFunc(func(r *http.Request) (*DSN, error) {
+		h := r.Header.Get(name)
+		if len(h) == 0 {
+			return nil, ErrMissingDSN
+		}
+		return ParseDSN(h)
+	})
+}
+
+// default number of body bytes BodyDSN will buffer while looking for a dsn field
+const defaultPeekLimit = 64 << 10
+
+// BodyDSN returns an opt-in Extractor that peeks a JSON request body for a top-level "dsn" field, as sent by many
+// hand-rolled tunnel payloads, and parses it via ParseDSN.
+// At most limit bytes are buffered (64KB when limit <= 0); the field must appear within them.
+// The body is read as it arrives, which also suits chunked uploads without a Content-Length, and reading
+// stops as soon as the field has been seen. The body is always restored so the request can still be forwarded.
+// A body consumed by earlier middleware fails with ErrBodyUnavailable rather than ErrMissingDSN.
+func BodyDSN(limit int64) Extractor {
+
+	if limit <= 0 {
+		limit = defaultPeekLimit
+	}
+	return ExtractorFunc(func(r *http.Request) (*DSN, error) {
+		var raw string
+		found := func(b []byte) bool {
+			var ok bool
+			raw, ok = jsonDSNField(b)
+			return ok
+		}
+		peeked, err := peekBody(r, limit, found)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 && !found(peeked) {
+			return nil, ErrMissingDSN
+		}
+		return ParseDSN(raw)
+	})
+}
+
+// peekBody reads up to limit bytes of r.Body and replaces r.Body with a reader that replays them ahead of the remainder.
+// Reading stops early once done, when not nil, reports the bytes read so far are enough.
+// A body announced by Content-Length that is gone, e.g. read by earlier middleware, fails with ErrBodyUnavailable.
+func peekBody(r *http.Request, limit int64, done func([]byte) bool) ([]byte, error) {
+
+	if r.Body == nil || r.Body == http.NoBody {
+		if r.ContentLength > 0 {
+			return nil, ErrBodyUnavailable
+		}
+		return nil, nil
+	}
+	lr := io.LimitReader(r.Body, limit)
+	peeked := make([]byte, 0, 512)
+	var err error
+	for {
+		if len(peeked) == cap(peeked) {
+			peeked = append(peeked, 0)[:len(peeked)]
+		}
+		n, rerr := lr.Read(peeked[len(peeked):cap(peeked)])
+		peeked = peeked[:len(peeked)+n]
+		if rerr != nil {
+			if rerr != io.EOF {
+				err = bodyError(rerr)
+			}
+			break
+		}
+		if n > 0 && done != nil && done(peeked) {
+			break
+		}
+	}
+	if err == nil && len(peeked) == 0 && r.ContentLength > 0 {
+		err = ErrBodyUnavailable
+	}
+	r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(peeked), r.Body), Closer: r.Body}
+	return peeked, err
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// jsonDSNField scans a (possibly truncated) JSON object for a top-level string "dsn" without decoding the rest of it.
+func jsonDSNField(b []byte) (string, bool) {
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", false
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		if key == "dsn" {
+			v, err := dec.Token()
+			s, ok := v.(string)
+			return s, err == nil && ok
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return "", false
+		}
+	}
+	return "", false
+}
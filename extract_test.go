@@ -0,0 +1,130 @@
+package sentrydsn
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testTableHeaderDSN = []struct {
+	header      string
+	value       string
+	description string
+	expected    string
+	err         error
+}{
+	{"", "https://4784fbc50de2473f9977cfce8a9adce5@o87286.ingest.sentry.io/1234", "default X-Sentry-DSN header", "https://4784fbc50de2473f9977cfce8a9adce5@o87286.ingest.sentry.io/1234", nil},
+	{"X-Tunnel-DSN", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234", "custom header", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234", nil},
+	{"", "", "missing header", "", ErrMissingDSN},
+	{"", "https://sentry.io/1234", "header without public key", "", ErrMissingUser},
+}
+
+func TestHeaderDSN(t *testing.T) {
+	for _, test := range testTableHeaderDSN {
+		r := httptest.NewRequest("POST", "https://tunnel.example.com/tunnel", nil)
+		name := test.header
+		if len(name) == 0 {
+			name = "X-Sentry-DSN"
+		}
+		if len(test.value) > 0 {
+			r.Header.Set(name, test.value)
+		}
+		got, err := HeaderDSN(test.header).Extract(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if got != nil && got.URL != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got.URL)
+		}
+	}
+}
+
+var testTableBodyDSN = []struct {
+	body        string
+	limit       int64
+	description string
+	expected    string
+	err         error
+}{
+	{`{"dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234","event":{"message":"hi"}}`, 0, "dsn first", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234", nil},
+	{`{"event":{"dsn":"nested is ignored","tags":[1,2]},"dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42"}`, 0, "dsn after nested object", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42", nil},
+	{`{"dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234","event":{"message":"truncated beyond the limit"}}`, 70, "truncated after dsn", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234", nil},
+	{`{"event":{"message":"hi"}}`, 0, "no dsn field", "", ErrMissingDSN},
+	{`not json`, 0, "not json", "", ErrMissingDSN},
+}
+
+func TestBodyDSN(t *testing.T) {
+	for _, test := range testTableBodyDSN {
+		r := httptest.NewRequest("POST", "https://tunnel.example.com/tunnel", strings.NewReader(test.body))
+		got, err := BodyDSN(test.limit).Extract(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if got != nil && got.URL != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got.URL)
+		}
+		//body must be intact for forwarding
+		restored, _ := io.ReadAll(r.Body)
+		if string(restored) != test.body {
+			t.Errorf("%s: Expected body -- %s -- Got %s", test.description, test.body, restored)
+		}
+	}
+}
+
+// TestBodyDSNChunked sends a chunked envelope from a real client and checks the DSN is found from the first chunk,
+// before the client has finished sending, and that the whole body is still readable afterwards.
+func TestBodyDSNChunked(t *testing.T) {
+	header := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","dsn":"https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42"}` + "\n"
+	rest := `{"type":"event"}` + "\n" + strings.Repeat(`{"message":"padding"}`, 1000) + "\n"
+
+	extracted := make(chan string, 1)
+	type result struct {
+		chunked bool
+		body    string
+	}
+	results := make(chan result, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dsn, err := BodyDSN(0).Extract(r)
+		if err != nil {
+			extracted <- err.Error()
+		} else {
+			extracted <- dsn.URL
+		}
+		b, _ := io.ReadAll(r.Body)
+		results <- result{len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked" && r.ContentLength == -1, string(b)}
+	}))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		resp, err := http.Post(srv.URL+"/tunnel", "application/x-sentry-envelope", pr)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	pw.Write([]byte(header))
+	expected := "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/42"
+	if got := <-extracted; got != expected {
+		t.Errorf("Expected -- %v -- Got %v", expected, got)
+	}
+	pw.Write([]byte(rest))
+	pw.Close()
+	got := <-results
+	if !got.chunked || got.body != header+rest {
+		t.Errorf("Expected -- chunked body restored -- Got %v %d bytes", got.chunked, len(got.body))
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	for err, expected := range map[error]string{
+		nil:                 "",
+		ErrMissingUser:      "missing_user",
+		ErrMissingProjectID: "missing_project_id",
+		ErrMissingDSN:       "missing_dsn",
+		io.EOF:              "other",
+	} {
+		if got := ErrorKind(err); got != expected {
+			t.Errorf("Expected -- %s -- Got %s", expected, got)
+		}
+	}
+}
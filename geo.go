@@ -0,0 +1,81 @@
+package sentrydsn
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Geo is where a client request came from.
+type Geo struct {
+	Country string `json:"country,omitempty"` //ISO 3166-1 alpha-2 code, e.g. DE
+	ASN     uint32 `json:"asn,omitempty"`     //autonomous system number of the client's network
+	ASOrg   string `json:"as_org,omitempty"`  //organization owning the autonomous system
+}
+
+// GeoLookup locates a client address, e.g. a thin wrapper around a MaxMind GeoIP2 or GeoLite2 reader
+// merging its Country and ASN records. Lookup is called from concurrent requests.
+type GeoLookup interface {
+	Lookup(ip netip.Addr) (Geo, error)
+}
+
+// GeoEnricher returns an Extractor that sets DSN.Geo on the results of e from the client address given by
+// ClientAddr. Failed lookups leave Geo nil rather than failing the request.
+func GeoEnricher(e Extractor, lookup GeoLookup, trustedProxies ...netip.Prefix) Extractor {
+
+	return ExtractorFunc(func(r *http.Request) (*DSN, error) {
+		dsn, err := e.Extract(r)
+		if err != nil {
+			return nil, err
+		}
+		ip, ok := ClientAddr(r, trustedProxies...)
+		if !ok {
+			return dsn, nil
+		}
+		if geo, err := lookup.Lookup(ip); err == nil {
+			dsn.Geo = &geo
+		}
+		return dsn, nil
+	})
+}
+
+// ClientAddr returns the address of the client that sent r: the peer, or the rightmost X-Forwarded-For entry
+// outside trustedProxies when the peer is one of them. It reports false if no address can be relied on.
+func ClientAddr(r *http.Request, trustedProxies ...netip.Prefix) (netip.Addr, bool) {
+
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip := ap.Addr().Unmap()
+	if !inPrefixes(ip, trustedProxies) {
+		return ip, true
+	}
+	fwd := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	if len(fwd) == 0 {
+		return ip, true
+	}
+	//each proxy appends the address it received the request from
+	hops := strings.Split(fwd, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		ip = hop.Unmap()
+		if !inPrefixes(ip, trustedProxies) {
+			break
+		}
+	}
+	return ip, true
+}
+
+func inPrefixes(ip netip.Addr, prefixes []netip.Prefix) bool {
+
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
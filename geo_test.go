@@ -0,0 +1,76 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+//setup
+
+// staticLookup locates addresses from a fixed table
+type staticLookup map[string]Geo
+
+func (l staticLookup) Lookup(ip netip.Addr) (Geo, error) {
+	geo, ok := l[ip.String()]
+	if !ok {
+		return Geo{}, errors.New("not found")
+	}
+	return geo, nil
+}
+
+var testLookup = staticLookup{
+	"203.0.113.7":  {Country: "DE", ASN: 3320, ASOrg: "Deutsche Telekom AG"},
+	"198.51.100.9": {Country: "US", ASN: 7922},
+	"10.0.0.2":     {Country: "ZZ"},
+}
+
+var testTableGeoEnricher = []struct {
+	remoteAddr  string
+	forwarded   string
+	description string
+	expected    string //country, empty for no Geo
+}{
+	{"203.0.113.7:5123", "", "direct client", "DE"},
+	{"203.0.113.7:5123", "198.51.100.9", "forwarded by untrusted peer", "DE"},
+	{"10.0.0.2:5123", "198.51.100.9", "trusted proxy", "US"},
+	{"10.0.0.2:5123", "198.51.100.9, 10.0.0.3", "chain of trusted proxies", "US"},
+	{"10.0.0.2:5123", "203.0.113.7, 198.51.100.9", "spoofed leftmost entry", "US"},
+	{"10.0.0.2:5123", "", "trusted proxy without header", "ZZ"},
+	{"10.0.0.2:5123", "unknown", "malformed header", ""},
+	{"192.0.2.1:5123", "", "unknown address", ""},
+	{"[::ffff:203.0.113.7]:5123", "", "ipv4 mapped", "DE"},
+}
+
+//tests
+
+func TestGeoEnricher(t *testing.T) {
+	e := GeoEnricher(ExtractorFunc(FromRequest), testLookup, netip.MustParsePrefix("10.0.0.0/8"))
+	for _, test := range testTableGeoEnricher {
+		r := cacheRequest("1234")
+		r.RemoteAddr = test.remoteAddr
+		if len(test.forwarded) > 0 {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		dsn, err := e.Extract(r)
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		got := ""
+		if dsn.Geo != nil {
+			got = dsn.Geo.Country
+		}
+		if got != test.expected {
+			t.Errorf("%s: Expected -- %q -- Got %q", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestGeoEnricherError(t *testing.T) {
+	e := GeoEnricher(ExtractorFunc(FromRequest), testLookup)
+	r := cacheRequest("1234")
+	r.Header.Del("X-Sentry-Auth")
+	if _, err := e.Extract(r); err != ErrMissingUser {
+		t.Errorf("Expected -- %v -- Got %v", ErrMissingUser, err)
+	}
+}
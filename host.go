@@ -0,0 +1,194 @@
+package sentrydsn
+
+import (
+	"net"
+	"strings"
+	"unicode/utf8"
+)
+
+// CanonicalHost normalizes a host, with or without port, so equal hosts compare equal:
+// lowercase, no trailing dot, internationalized labels in punycode (bücher.example becomes xn--bcher-kva.example)
+// and IPv6 literals in brackets (::1 becomes [::1]). Used for derived DSNs, allowlists and cache keys.
+func CanonicalHost(host string) string {
+
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.Trim(hostname, "[]")
+
+	if ip := net.ParseIP(hostname); ip != nil {
+		if strings.Contains(hostname, ":") {
+			hostname = "[" + strings.ToLower(hostname) + "]"
+		}
+	} else {
+		hostname = strings.TrimRight(strings.ToLower(hostname), ".")
+		//almost every host is plain ASCII, which needs no label by label work
+		if !isASCII(hostname) {
+			labels := strings.Split(hostname, ".")
+			for i, label := range labels {
+				if !isASCII(label) {
+					labels[i] = "xn--" + punycode(label)
+				}
+			}
+			hostname = strings.Join(labels, ".")
+		}
+	}
+	if len(port) > 0 {
+		return hostname + ":" + port
+	}
+	return hostname
+}
+
+// hostPort returns the port of a host, or "" if it has none.
+func hostPort(host string) string {
+
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		return port
+	}
+	return ""
+}
+
+// validHost reports whether a canonical host is a hostname or IP literal with an optional numeric port.
+// It runs on every parse, so it splits the port itself rather than allocate net.SplitHostPort's error.
+func validHost(host string) bool {
+
+	hostname, port, hasPort := host, "", false
+	if strings.HasPrefix(host, "[") {
+		end := strings.IndexByte(host, ']')
+		if end < 0 {
+			return false
+		}
+		hostname = host[1:end]
+		if rest := host[end+1:]; len(rest) > 0 {
+			if rest[0] != ':' {
+				return false
+			}
+			port, hasPort = rest[1:], true
+		}
+		if !strings.Contains(hostname, ":") || net.ParseIP(hostname) == nil {
+			return false
+		}
+	} else if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		hostname, port, hasPort = host[:i], host[i+1:], true
+	}
+	if hasPort && (len(port) == 0 || strings.Trim(port, "0123456789") != "") {
+		return false
+	}
+	if strings.HasPrefix(host, "[") {
+		return true
+	}
+	if len(hostname) == 0 {
+		return false
+	}
+	for i := 0; i < len(hostname); i++ {
+		c := hostname[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punycode parameters from RFC 3492 section 5
+const (
+	pcBase        = 36
+	pcTMin        = 1
+	pcTMax        = 26
+	pcSkew        = 38
+	pcDamp        = 700
+	pcInitialBias = 72
+	pcInitialN    = 128
+)
+
+// punycode encodes a single label as described in RFC 3492, without the xn-- prefix.
+func punycode(label string) string {
+
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(pcInitialN), 0, pcInitialBias
+	for handled < len(runes) {
+		m := rune(0x7fffffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := pcBase; ; k += pcBase {
+				t := k - bias
+				if t < pcTMin {
+					t = pcTMin
+				} else if t > pcTMax {
+					t = pcTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punycodeDigit(t+(q-t)%(pcBase-t)))
+				q = (q - t) / (pcBase - t)
+			}
+			out = append(out, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punycodeDigit(d int) byte {
+
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punycodeAdapt(delta int, numPoints int, first bool) int {
+
+	if first {
+		delta /= pcDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((pcBase-pcTMin)*pcTMax)/2 {
+		delta /= pcBase - pcTMin
+		k += pcBase
+	}
+	return k + (pcBase-pcTMin+1)*delta/(delta+pcSkew)
+}
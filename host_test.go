@@ -0,0 +1,71 @@
+package sentrydsn
+
+import (
+	"testing"
+)
+
+var testTableCanonicalHost = []struct {
+	host        string
+	description string
+	expected    string
+}{
+	{"Sentry.Example.COM", "lowercase", "sentry.example.com"},
+	{"sentry.example.com.", "trailing dot", "sentry.example.com"},
+	{"sentry.example.com.:9000", "trailing dot with port", "sentry.example.com:9000"},
+	{"bücher.example", "idn", "xn--bcher-kva.example"},
+	{"BÜCHER.example:443", "idn uppercase with port", "xn--bcher-kva.example:443"},
+	{"münchen.de", "idn", "xn--mnchen-3ya.de"},
+	{"例え.テスト", "idn without basic code points", "xn--r8jz45g.xn--zckzah"},
+	{"::1", "bare IPv6", "[::1]"},
+	{"[2001:DB8::1]:8000", "IPv6 with port", "[2001:db8::1]:8000"},
+	{"127.0.0.1:9000", "IPv4 with port", "127.0.0.1:9000"},
+	{"[::ffff:127.0.0.1]:8000", "IPv4-mapped IPv6 with port", "[::ffff:127.0.0.1]:8000"},
+	{"::FFFF:7F00:1", "bare IPv4-mapped IPv6", "[::ffff:7f00:1]"},
+}
+
+func TestCanonicalHost(t *testing.T) {
+	for _, test := range testTableCanonicalHost {
+		if got := CanonicalHost(test.host); got != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestCanonicalHostAllowlist(t *testing.T) {
+	a := HostAllowlist{"Bücher.example", "*.INGEST.sentry.io."}
+	for _, host := range []string{"xn--bcher-kva.example", "BÜCHER.example.:9000", "o1.ingest.sentry.io."} {
+		if !a.Allows(host) {
+			t.Errorf("Expected -- %s allowed -- Got false", host)
+		}
+	}
+}
+
+var testTableValidHost = []struct {
+	host        string
+	description string
+	expected    bool
+}{
+	{"o1.ingest.sentry.io", "hostname", true},
+	{"sentry.example.com:9000", "hostname with port", true},
+	{"10.0.0.1:9000", "IPv4 with port", true},
+	{"[2001:db8::1]", "IPv6", true},
+	{"[2001:db8::1]:8000", "IPv6 with port", true},
+	{CanonicalHost("[::ffff:127.0.0.1]:8000"), "canonical IPv4-mapped IPv6", true},
+	{"attacker.example.com@sentry.io", "userinfo", false},
+	{"sentry.io/evil", "path", false},
+	{"sentry.io\r\nX-Injected: 1", "crlf", false},
+	{"sentry io", "space", false},
+	{"sentry.io:", "empty port", false},
+	{"sentry.io:80a", "non-numeric port", false},
+	{"[2001:db8::1]x", "junk after IPv6", false},
+	{"[sentry.io]", "bracketed hostname", false},
+	{"[2001:db8::1", "unterminated IPv6", false},
+}
+
+func TestValidHost(t *testing.T) {
+	for _, test := range testTableValidHost {
+		if got := validHost(test.host); got != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//setup
+
+// anyKey is a KeyFormat accepting everything, standing in for a careless custom format
+type anyKey struct{}
+
+func (anyKey) Validate(key string) bool { return len(key) > 0 }
+func (anyKey) Extract(s string) (string, bool) {
+	k, _, _ := strings.Cut(s, ",")
+	return k, len(k) > 0
+}
+
+var testTableInjection = []struct {
+	host        string
+	header      string
+	description string
+	err         error
+}{
+	{"attacker.example.com@o1.ingest.sentry.io", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5", "userinfo in host", ErrInvalidHost},
+	{"attacker.example.com/o1.ingest.sentry.io", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5", "path in host", ErrInvalidHost},
+	{"o1.ingest.sentry.io\r\nX-Injected: 1", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5", "header in host", ErrInvalidHost},
+	{"o1.ingest.sentry.io", "Sentry sentry_key=pk@attacker.example.com/1#", "userinfo end in key", ErrMissingUser},
+	{"o1.ingest.sentry.io", "Sentry sentry_key=pk, sentry_secret=s/../x", "slash in secret", ErrMissingUser},
+	{"o1.ingest.sentry.io", "Sentry sentry_key=pk%0d%0aX-Injected:", "encoded crlf in key", ErrMissingUser},
+	{"o1.ingest.sentry.io", "Sentry sentry_key=pk_live", "plain custom key", nil},
+}
+
+//tests
+
+func TestDSNInjection(t *testing.T) {
+	p := &Parser{KeyFormat: anyKey{}}
+	for _, test := range testTableInjection {
+		r := httptest.NewRequest("POST", "/api/1234/envelope/", nil)
+		r.Host = test.host
+		r.Header.Set("X-Sentry-Auth", test.header)
+		got, err := p.FromRequest(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v %v", test.description, test.err, got, err)
+		} else if err == nil && got.URL != "https://pk_live@o1.ingest.sentry.io/1234" {
+			t.Errorf("%s: Expected -- https://pk_live@o1.ingest.sentry.io/1234 -- Got %v", test.description, got.URL)
+		}
+	}
+}
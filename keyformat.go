@@ -0,0 +1,125 @@
+package sentrydsn
+
+import (
+	"net/url"
+	"strings"
+)
+
+// KeyFormat recognizes public and secret keys. Deployments issuing keys that are not 32 hex characters
+// can set Parser.KeyFormat instead of patching the package.
+type KeyFormat interface {
+	Validate(key string) bool        //reports whether key is a whole, well formed key
+	Extract(s string) (string, bool) //finds the key at the start of s, e.g. the text after sentry_key= in X-Sentry-Auth
+}
+
+// Hex32 accepts the 32 hex character keys Sentry issues. It is the default KeyFormat.
+// Some older SDK builds send the key uppercased; Extract returns it lowercased so DSNs stay canonical.
+var Hex32 KeyFormat = hex32{}
+
+// Permissive accepts any non-empty key free of whitespace and the separators used in headers and DSNs,
+// except for trailing = padding of base64 keys.
+var Permissive KeyFormat = permissive{}
+
+type hex32 struct{}
+
+// hexDigits is 1 for the bytes allowed in a hex32 key
+var hexDigits = func() (t [256]uint8) {
+	for _, c := range "0123456789abcdefABCDEF" {
+		t[c] = 1
+	}
+	return t
+}()
+
+// isHex32 reports whether s is 32 hex characters, without a branch per character.
+func isHex32(s string) bool {
+
+	if len(s) != 32 {
+		return false
+	}
+	ok := uint8(1)
+	for i := 0; i < 32; i++ {
+		ok &= hexDigits[s[i]]
+	}
+	return ok == 1
+}
+
+func (hex32) Validate(key string) bool {
+	return isHex32(key)
+}
+
+func (hex32) Extract(s string) (string, bool) {
+
+	if len(s) < 32 || !isHex32(s[:32]) {
+		return "", false
+	}
+	return strings.ToLower(s[:32]), true
+}
+
+// characters ending a permissive key
+const keySeparators = " \t\r\n,:@/?#&="
+
+type permissive struct{}
+
+func (permissive) Validate(key string) bool {
+
+	key = strings.TrimRight(key, "=")
+	return len(key) > 0 && !strings.ContainsAny(key, keySeparators)
+}
+
+func (permissive) Extract(s string) (string, bool) {
+
+	end := strings.IndexAny(s, keySeparators)
+	if end < 0 {
+		return s, len(s) > 0
+	}
+	if end == 0 {
+		return "", false
+	}
+	//base64 padding
+	for end < len(s) && s[end] == '=' {
+		end++
+	}
+	return s[:end], true
+}
+
+// canonicalKey validates key with kf and returns it the way kf's Extract spells it, e.g. lowercased by Hex32.
+func canonicalKey(kf KeyFormat, key string) (string, bool) {
+
+	if !kf.Validate(key) {
+		return "", false
+	}
+	if k, ok := kf.Extract(key); ok && len(k) == len(key) {
+		return k, true
+	}
+	return key, true
+}
+
+// headerKey reads a key from an X-Sentry-Auth value. Percent-encoded values, e.g. base64 padding sent as %3D,
+// are decoded and must then be a whole key: the header is split on its delimiters before decoding, so an
+// encoded comma or = stays part of the value and cannot smuggle in another parameter.
+func headerKey(kf KeyFormat, val string) (string, bool) {
+
+	if !strings.Contains(val, "%") {
+		return kf.Extract(val)
+	}
+	if end := strings.IndexAny(val, " \t"); end >= 0 {
+		val = val[:end]
+	}
+	decoded, err := url.PathUnescape(val)
+	if err != nil {
+		return "", false
+	}
+	return canonicalKey(kf, decoded)
+}
+
+// urlSafeKey reports whether key can be put into a DSN's userinfo as is: printable ASCII without the
+// characters ending userinfo or separating its parts, which would let a key pick the DSN's host.
+func urlSafeKey(key string) bool {
+
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c >= 0x7f || strings.IndexByte("@/:?#%\\[]", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package sentrydsn
+
+import "strings"
+
+// DefaultKeyPrefix is the number of public key characters shown by logs, the admin API and sinks that
+// identify keys without exposing them: enough to tell a project's keys apart, too few to send events with.
+const DefaultKeyPrefix = 8
+
+// KeyPrefix returns the public key with all but its first n characters masked, e.g.
+// 4784fbc5************************ for n = 8, so operators can identify keys without full exposure.
+func (d *DSN) KeyPrefix(n int) string {
+	return MaskKey(d.PublicKey, n)
+}
+
+// MaskKey masks all but the first n characters of key with "*", keeping its length.
+// n is clamped to the key, so n <= 0 masks everything.
+func MaskKey(key string, n int) string {
+
+	n = min(max(n, 0), len(key))
+	return key[:n] + strings.Repeat("*", len(key)-n)
+}
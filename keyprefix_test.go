@@ -0,0 +1,25 @@
+package sentrydsn
+
+import "testing"
+
+var testTableKeyPrefix = []struct {
+	key         string
+	n           int
+	description string
+	expected    string
+}{
+	{"4784fbc50de2473f9977cfce8a9adce5", DefaultKeyPrefix, "default prefix", "4784fbc5************************"},
+	{"4784fbc50de2473f9977cfce8a9adce5", 0, "everything masked", "********************************"},
+	{"4784fbc50de2473f9977cfce8a9adce5", -1, "negative", "********************************"},
+	{"4784", 8, "short key", "4784"},
+	{"", 8, "no key", ""},
+}
+
+func TestKeyPrefix(t *testing.T) {
+	for _, test := range testTableKeyPrefix {
+		d := &DSN{PublicKey: test.key}
+		if got := d.KeyPrefix(test.n); got != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package sentrydsn
+
+import (
+	"errors"
+)
+
+// error kinds reported by ErrorKind, in the order they are checked
+var errorKinds = []struct {
+	err  error
+	kind string
+}{
+	{ErrMissingUser, "missing_user"},
+	{ErrMissingProjectID, "missing_project_id"},
+	{ErrInvalidDSN, "invalid_dsn"},
+	{ErrMissingDSN, "missing_dsn"},
+	{ErrMissingHost, "missing_host"},
+	{ErrInvalidHost, "invalid_host"},
+	{ErrAuthHeaderTooLarge, "auth_header_too_large"},
+	{ErrUntrustedHost, "untrusted_host"},
+	{ErrStaleAuth, "stale_auth"},
+	{ErrInvalidRelaySignature, "invalid_relay_signature"},
+	{ErrMissingRelaySignature, "missing_relay_signature"},
+	{ErrMissingSecret, "missing_secret"},
+	{ErrMultipleAuth, "multiple_auth"},
+	{ErrInvalidToken, "invalid_token"},
+	{ErrEndpointNotAllowed, "endpoint_not_allowed"},
+	{ErrContentType, "content_type"},
+	{ErrUnsupportedEndpoint, "unsupported_endpoint"},
+	{ErrMethodNotAllowed, "method_not_allowed"},
+	{ErrPreflight, "preflight"},
+	{ErrConflictingKeys, "conflicting_keys"},
+	{ErrBodyUnavailable, "body_unavailable"},
+	{ErrBodyTooLarge, "body_too_large"},
+	{ErrUnauthorized, "unauthorized"},
+	{ErrAuthorizerUnavailable, "authorizer_unavailable"},
+}
+
+// ErrorKind returns a short, stable label for errors returned by this package, suitable for metrics and logs.
+// nil yields "" and unrecognised errors yield "other".
+func ErrorKind(err error) string {
+
+	if err == nil {
+		return ""
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,36 @@
+package sentrydsn
+
+import (
+	"maps"
+	"net/http"
+)
+
+// ProjectMetadata maps project IDs to arbitrary metadata about the project, e.g. its owning team, environment
+// or cost center, so logging and chargeback systems downstream of a tunnel need no second lookup service.
+type ProjectMetadata map[string]map[string]string
+
+// Lookup returns a copy of the metadata of projectID, nil if there is none.
+func (m ProjectMetadata) Lookup(projectID string) map[string]string {
+
+	md, ok := m[projectID]
+	if !ok || len(md) == 0 {
+		return nil
+	}
+	return maps.Clone(md)
+}
+
+// MetadataEnricher returns an Extractor that sets DSN.Metadata on the results of e from md.
+// DSNs of projects md does not list, or without a project ID, are returned unchanged.
+func MetadataEnricher(e Extractor, md ProjectMetadata) Extractor {
+
+	return ExtractorFunc(func(r *http.Request) (*DSN, error) {
+		dsn, err := e.Extract(r)
+		if err != nil {
+			return nil, err
+		}
+		if m := md.Lookup(dsn.ProjectID); m != nil {
+			dsn.Metadata = m
+		}
+		return dsn, nil
+	})
+}
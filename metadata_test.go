@@ -0,0 +1,58 @@
+package sentrydsn
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+//setup
+
+var testMetadata = ProjectMetadata{
+	"1234": {"team": "payments", "environment": "production", "cost_center": "cc-410"},
+	"42":   {},
+}
+
+var testTableMetadataEnricher = []struct {
+	project     string
+	description string
+	expected    string //team, empty for no Metadata
+}{
+	{"1234", "listed project", "payments"},
+	{"42", "project without metadata", ""},
+	{"99", "unlisted project", ""},
+}
+
+//tests
+
+func TestMetadataEnricher(t *testing.T) {
+	e := MetadataEnricher(ExtractorFunc(FromRequest), testMetadata)
+	for _, test := range testTableMetadataEnricher {
+		dsn, err := e.Extract(cacheRequest(test.project))
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		if got := dsn.Metadata["team"]; got != test.expected || (len(test.expected) == 0 && dsn.Metadata != nil) {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, dsn.Metadata)
+		}
+	}
+}
+
+func TestMetadataEnricherCopies(t *testing.T) {
+	e := MetadataEnricher(ExtractorFunc(FromRequest), testMetadata)
+	dsn, _ := e.Extract(cacheRequest("1234"))
+	dsn.Metadata["team"] = "changed"
+	if got := testMetadata["1234"]["team"]; got != "payments" {
+		t.Errorf("Expected -- payments -- Got %v", got)
+	}
+}
+
+func TestMetadataRegistry(t *testing.T) {
+	e, err := NewExtractor("request", json.RawMessage(`{"project_metadata":{"1234":{"team":"payments"}}}`))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	dsn, err := e.Extract(cacheRequest("1234"))
+	if err != nil || dsn.Metadata["team"] != "payments" {
+		t.Errorf("Expected -- payments -- Got %v %v", dsn, err)
+	}
+}
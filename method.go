@@ -0,0 +1,56 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrMethodNotAllowed Thrown if the request method cannot carry events to its endpoint, see Parser.Methods
+	ErrMethodNotAllowed = errors.New("sentry:  method not allowed")
+	// ErrPreflight Thrown for HEAD and OPTIONS requests, e.g. CORS preflights and health probes, which carry no
+	// event and no key. Callers answer them directly instead of treating them as failed parses.
+	ErrPreflight = errors.New("sentry:  preflight request")
+)
+
+// methods each endpoint accepts unless Parser.Methods says otherwise. Store takes GET for image beacons
+// carrying the event in the sentry_data query parameter and the feedback dialog posts its form back.
+var endpointMethods = map[EndpointType][]string{
+	EndpointStore:      {http.MethodGet, http.MethodPost},
+	EndpointEnvelope:   {http.MethodPost},
+	EndpointNEL:        {http.MethodPost},
+	EndpointReport:     {http.MethodPost},
+	EndpointFeedback:   {http.MethodGet, http.MethodPost},
+	EndpointOTLP:       {http.MethodPost},
+	EndpointProfile:    {http.MethodPost},
+	EndpointMinidump:   {http.MethodPost},
+	EndpointUnreal:     {http.MethodPost},
+	EndpointAttachment: {http.MethodPost},
+}
+
+// preflight reports whether r is a HEAD or OPTIONS request.
+func preflight(r *http.Request) bool {
+	return r.Method == http.MethodHead || r.Method == http.MethodOptions
+}
+
+// checkMethod returns ErrMethodNotAllowed unless method is accepted for e. Endpoints without
+// a method list, such as those accepted by AcceptAnyProjectEndpoint, take any method.
+func (p *Parser) checkMethod(e EndpointType, method string) error {
+
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	methods, ok := p.Methods[e]
+	if !ok {
+		methods, ok = endpointMethods[e]
+	}
+	if !ok {
+		return nil
+	}
+	for _, m := range methods {
+		if m == method {
+			return nil
+		}
+	}
+	return ErrMethodNotAllowed
+}
@@ -0,0 +1,53 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+//setup
+
+var testTableMethods = []struct {
+	method      string
+	url         string
+	methods     map[EndpointType][]string
+	description string
+	err         error
+}{
+	{"POST", "https://o1.ingest.sentry.io/api/1234/envelope/", nil, "envelope post", nil},
+	{"GET", "https://o1.ingest.sentry.io/api/1234/envelope/", nil, "envelope get", ErrMethodNotAllowed},
+	{"PUT", "https://o1.ingest.sentry.io/api/1234/envelope/", nil, "envelope put", ErrMethodNotAllowed},
+	{"GET", "https://o1.ingest.sentry.io/api/1234/store/?sentry_data=e30", nil, "store image beacon", nil},
+	{"DELETE", "https://o1.ingest.sentry.io/api/1234/store/", nil, "store delete", ErrMethodNotAllowed},
+	{"GET", "https://o1.ingest.sentry.io/api/1234/security/", nil, "reporting api get", ErrMethodNotAllowed},
+	{"POST", "https://o1.ingest.sentry.io/api/1234/profile/", nil, "profile post", nil},
+	{"GET", "https://o1.ingest.sentry.io/api/1234/profile/", nil, "profile get", ErrMethodNotAllowed},
+	{"HEAD", "https://o1.ingest.sentry.io/api/1234/envelope/", nil, "head", ErrPreflight},
+	{"OPTIONS", "https://o1.ingest.sentry.io/api/1234/envelope/", nil, "cors preflight", ErrPreflight},
+	{"GET", "https://o1.ingest.sentry.io/api/embed/error-page/?dsn=https%3A%2F%2F4784fbc50de2473f9977cfce8a9adce5%40o1.ingest.sentry.io%2F1234", nil, "feedback dialog", nil},
+	{"PATCH", "https://o1.ingest.sentry.io/api/embed/error-page/?dsn=https%3A%2F%2F4784fbc50de2473f9977cfce8a9adce5%40o1.ingest.sentry.io%2F1234", nil, "feedback patch", ErrMethodNotAllowed},
+	{"GET", "https://o1.ingest.sentry.io/api/1234/envelope/", map[EndpointType][]string{EndpointEnvelope: {"GET", "POST"}}, "configured envelope get", nil},
+	{"GET", "https://o1.ingest.sentry.io/api/1234/store/?sentry_data=e30", map[EndpointType][]string{EndpointStore: {"POST"}}, "configured store post only", ErrMethodNotAllowed},
+}
+
+//tests
+
+func TestMethods(t *testing.T) {
+	for _, test := range testTableMethods {
+		p := &Parser{Methods: test.methods}
+		r := httptest.NewRequest(test.method, test.url, nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		if _, err := p.FromRequest(r); err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		}
+	}
+}
+
+func TestMethodsAnyEndpoint(t *testing.T) {
+	p := &Parser{AcceptAnyProjectEndpoint: true}
+	r := httptest.NewRequest("PUT", "https://o1.ingest.sentry.io/api/1234/uploads/", nil)
+	r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+	if _, err := p.FromRequest(r); err != nil {
+		t.Errorf("Expected -- nil -- Got %v", err)
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package sentrydsn
+
+const raceEnabled = false
@@ -0,0 +1,89 @@
+package sentrydsn
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// attribute prefix of captured request headers, e.g. http.request.header.x-sentry-auth
+const otel_header_prefix = "http.request.header."
+
+// FromOTelAttributes derives a DSN from the HTTP attributes of an OpenTelemetry span, e.g. the client span
+// of an SDK sending to ingest, so trace analysis can tell which spans were Sentry ingest calls and for which
+// project. Both the stable semantic conventions (url.full, http.request.method, server.address, ...) and
+// the older ones (http.url, http.method, http.host, http.target, ...) are read; captured headers such as
+// http.request.header.x-sentry-auth carry the keys when they are not in the query string.
+// FromOTelAttributes accepts any host; use a Parser to restrict them.
+func FromOTelAttributes(attrs map[string]string) (*DSN, error) {
+
+	var p Parser
+	return p.FromOTelAttributes(attrs)
+}
+
+// FromOTelAttributes is the package level FromOTelAttributes with the parser's restrictions applied.
+func (p *Parser) FromOTelAttributes(attrs map[string]string) (*DSN, error) {
+
+	r, err := otelRequest(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return p.FromRequest(r)
+}
+
+// otelRequest reconstructs the request a span describes.
+func otelRequest(attrs map[string]string) (*http.Request, error) {
+
+	method := firstAttr(attrs, "http.request.method", "http.method")
+	if len(method) == 0 || method == "_OTHER" {
+		method = http.MethodPost
+	}
+	raw := firstAttr(attrs, "url.full", "http.url")
+	if len(raw) == 0 {
+		host := firstAttr(attrs, "server.address", "http.host", "net.host.name", "net.peer.name")
+		if len(host) == 0 {
+			return nil, ErrMissingHost
+		}
+		if port := firstAttr(attrs, "server.port", "net.host.port", "net.peer.port"); len(port) > 0 && !strings.Contains(host, ":") {
+			host = net.JoinHostPort(host, port)
+		}
+		scheme := firstAttr(attrs, "url.scheme", "http.scheme")
+		if len(scheme) == 0 {
+			scheme = "https"
+		}
+		target := attrs["http.target"]
+		if len(target) == 0 {
+			target = attrs["url.path"]
+			if q := attrs["url.query"]; len(q) > 0 {
+				target += "?" + q
+			}
+		}
+		raw = scheme + "://" + host + target
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, ErrInvalidHost
+	}
+	if len(u.Host) == 0 {
+		return nil, ErrMissingHost
+	}
+	r := &http.Request{Method: method, URL: u, Host: u.Host, Header: http.Header{}, Body: http.NoBody}
+	for k, v := range attrs {
+		if name, ok := strings.CutPrefix(k, otel_header_prefix); ok {
+			r.Header.Set(name, v)
+		}
+	}
+	return r, nil
+}
+
+// firstAttr returns the first of keys set in attrs.
+func firstAttr(attrs map[string]string, keys ...string) string {
+
+	for _, k := range keys {
+		if v := attrs[k]; len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
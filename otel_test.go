@@ -0,0 +1,60 @@
+package sentrydsn
+
+import (
+	"testing"
+)
+
+//setup
+
+var testTableOTel = []struct {
+	attrs       map[string]string
+	description string
+	expected    string
+	endpoint    EndpointType
+	err         error
+}{
+	{map[string]string{
+		"http.request.method": "POST",
+		"url.full":            "https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5&sentry_version=7",
+	}, "stable conventions", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", EndpointEnvelope, nil},
+	{map[string]string{
+		"http.request.method":               "POST",
+		"url.scheme":                        "https",
+		"server.address":                    "sentry.example.com",
+		"server.port":                       "9000",
+		"url.path":                          "/api/42/store/",
+		"http.request.header.x-sentry-auth": "Sentry sentry_version=7, sentry_key=4784fbc50de2473f9977cfce8a9adce5",
+	}, "url parts and captured header", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com:9000/42", EndpointStore, nil},
+	{map[string]string{
+		"http.method": "POST",
+		"http.scheme": "https",
+		"http.host":   "o1.ingest.sentry.io",
+		"http.target": "/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5",
+	}, "older conventions", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", EndpointEnvelope, nil},
+	{map[string]string{
+		"http.method": "POST",
+		"http.url":    "https://api.example.com/v1/orders",
+	}, "not an ingest call", "", "", ErrMissingUser},
+	{map[string]string{"http.request.method": "POST", "url.path": "/api/1234/envelope/"}, "no host", "", "", ErrMissingHost},
+}
+
+//tests
+
+func TestFromOTelAttributes(t *testing.T) {
+	for _, test := range testTableOTel {
+		dsn, err := FromOTelAttributes(test.attrs)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if err == nil && (dsn.URL != test.expected || dsn.Endpoint != test.endpoint) {
+			t.Errorf("%s: Expected -- %s %s -- Got %s %s", test.description, test.expected, test.endpoint, dsn.URL, dsn.Endpoint)
+		}
+	}
+}
+
+func TestParserFromOTelAttributes(t *testing.T) {
+	p := &Parser{AllowedHosts: HostAllowlist{"*.ingest.sentry.io"}}
+	_, err := p.FromOTelAttributes(map[string]string{"url.full": "https://sentry.example.com/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5"})
+	if err != ErrUntrustedHost {
+		t.Errorf("Expected -- %v -- Got %v", ErrUntrustedHost, err)
+	}
+}
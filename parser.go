@@ -0,0 +1,254 @@
+package sentrydsn
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrUntrustedHost Thrown if the host a DSN points at is not in the configured allowlist
+	ErrUntrustedHost = errors.New("sentry:  untrusted host")
+	// ErrStaleAuth Thrown if sentry_timestamp is missing or further than Parser.MaxAuthAge from now
+	ErrStaleAuth = errors.New("sentry:  stale auth timestamp")
+)
+
+// default longest auth header accepted when Parser.MaxAuthHeaderSize is unset
+const defaultMaxAuthHeaderSize = 4 << 10
+
+// Parser derives DSNs from requests with optional restrictions. The zero value behaves like FromRequest.
+// A Parser is safe for concurrent use as long as its fields are not changed while requests are parsed.
+type Parser struct {
+	AllowedHosts HostAllowlist
+	KeyFormat    KeyFormat    //recognizes sentry_key and sentry_secret values, Hex32 when nil
+	SecretPolicy SecretPolicy //what to do with sentry_secret, KeepSecret by default
+	// DuplicateParams picks between repeated sentry_key and sentry_secret query parameters, FirstValue by default
+	DuplicateParams DuplicatePolicy
+	// CompatRelay makes parsing decisions the way official Sentry Relay does, for deployments migrating between
+	// the two: keys come from X-Sentry-Auth, then Authorization, then the query string, and sending both header
+	// and query string keys fails with ErrMultipleAuth; paths are matched exactly with an optional trailing slash and
+	// include minidump, unreal and attachment uploads; the secret key is never part of the DSN.
+	CompatRelay bool
+	// AcceptAnyProjectEndpoint accepts any /api/<project_id>/<endpoint>/ path the known routes do not match,
+	// with the endpoint name as the DSN's Endpoint, so new ingest routes work without a parser change.
+	AcceptAnyProjectEndpoint bool
+	// AllowedEndpoints restricts the endpoint types accepted, e.g. EndpointEnvelope only for a tunnel that should
+	// not proxy store, minidump or security traffic; others fail with ErrEndpointNotAllowed. Empty accepts all.
+	AllowedEndpoints []EndpointType
+	// Methods overrides the HTTP methods accepted per endpoint type; requests with others fail with
+	// ErrMethodNotAllowed. By default store takes GET and POST, the feedback dialog GET and POST and every other
+	// known endpoint POST only. HEAD and OPTIONS requests always fail early with ErrPreflight.
+	Methods map[EndpointType][]string
+	// StrictContentType rejects requests whose Content-Type does not suit their endpoint with ErrContentType,
+	// e.g. an envelope sent as application/json. The detected type is in DSN.ContentType either way.
+	StrictContentType bool
+	// ResolveProject looks up the project ID for legacy /api/store/ requests, which carry only the public key.
+	// Concurrent lookups of the same key share one call and failures are remembered for ResolveNegativeTTL,
+	// so a burst of legacy traffic does not stampede the backend. Without it legacy DSNs have no project ID.
+	ResolveProject     func(publicKey string) (projectID string, err error)
+	ResolveNegativeTTL time.Duration //how long a failed lookup is remembered, 30 seconds when unset
+	// ResolveCache, when set, remembers resolved project IDs for ResolveTTL, one hour when unset, and is asked
+	// before ResolveProject. A persistent SharedCache such as the boltcache module keeps resolutions across
+	// restarts; the redisstore module shares them across a fleet.
+	ResolveCache SharedCache
+	ResolveTTL   time.Duration
+	resolver     projectResolver
+
+	// Tokenizer pseudonymizes every returned DSN, see DSN.Pseudonymize. For parsers feeding analytics only;
+	// a tunnel needs the real DSN to forward.
+	Tokenizer Tokenizer
+
+	// TrustedProxies lists the networks of reverse proxies whose Host and X-Forwarded-Host headers are believed.
+	// Requests from any other address get IngestHost instead, since their Host header is attacker-controlled.
+	// Both empty keeps the old behavior of trusting every request's Host.
+	TrustedProxies []netip.Prefix
+	IngestHost     string //canonical ingest host for requests from untrusted peers; without it they fail with ErrUntrustedHost
+	// MaxAuthAge rejects requests whose sentry_timestamp is older, or further in the future, than this,
+	// as basic replay protection for public tunnel endpoints. Requests without a timestamp are rejected too.
+	// Zero disables the check; SDKs that omit the timestamp need it disabled.
+	MaxAuthAge time.Duration
+	// MaxAuthHeaderSize bounds X-Sentry-Auth, and Authorization when CompatRelay reads it; longer headers fail
+	// with ErrAuthHeaderTooLarge before they are tokenized. 4KB when unset, far above what any SDK sends.
+	MaxAuthHeaderSize int
+
+	// TrustedRelays maps relay IDs to the public keys of official Relays allowed to forward traffic here.
+	// Signed requests are verified against them and the result carries the relay's identity.
+	TrustedRelays map[string]ed25519.PublicKey
+	// RelayKeys is asked for relays not in TrustedRelays and may change while requests are parsed, e.g. a
+	// proxy.RelayRegistry that downstream Relays join at runtime.
+	RelayKeys             RelayKeys
+	RequireRelaySignature bool          //reject unsigned requests
+	MaxSignatureAge       time.Duration //reject signatures older, or further in the future, than this; zero disables
+	MaxSignedBodySize     int64         //largest body read to verify a signature, 40MB when unset
+
+	// BeforeParse, when set, runs before every parse and may inspect or change the request, e.g. to inject
+	// a tenant's host. AfterParse runs after every parse with its outcome and returns the result FromRequest
+	// gives, so DSNs can be enriched or errors replaced. Both may be called concurrently.
+	BeforeParse func(r *http.Request)
+	AfterParse  func(r *http.Request, dsn *DSN, err error) (*DSN, error)
+
+	// OnUnknownEndpoint is called with the path of /api/ requests that match no known ingest route, before
+	// they fail with ErrMissingProjectID, so new SDK endpoints are noticed instead of silently failing.
+	// It may be called concurrently. UnknownEndpoints counts these requests whether or not it is set.
+	OnUnknownEndpoint func(path string)
+	unknown           atomic.Int64
+
+	// OnErrorRate is called when the share of failed parses over the last ErrorRateWindow rises above
+	// ErrorRateThreshold, e.g. to page someone when a new SDK version sends requests the parser cannot handle.
+	// It fires once per excursion, from the request that crossed the threshold, and again only after the rate
+	// has dropped back. Windows with fewer than 20 parses never fire. Keep it quick or hand off.
+	OnErrorRate        func(rate float64, failures, total int64)
+	ErrorRateThreshold float64       //failure ratio, 0.2 when unset
+	ErrorRateWindow    time.Duration //one minute when unset
+	errorRate          errorRate
+
+	// Shadow evaluates the restrictions above, AllowedHosts, AllowedEndpoints, Methods, StrictContentType,
+	// MaxAuthAge and relay signatures, on ingest and feedback dialog requests alike, without enforcing them:
+	// requests they would refuse are accepted with a ShadowWarning in DSN.Warnings, so new policies can be
+	// dry-run against production traffic and their effect read from warning metrics first. Requests that cannot
+	// be parsed at all still fail.
+	Shadow bool
+
+	// Clock tells the time for auth and signature freshness, resolver failures and the error rate window.
+	// The system clock when nil.
+	Clock Clock
+}
+
+// Extract implements Extractor.
+func (p *Parser) Extract(r *http.Request) (*DSN, error) {
+	return p.FromRequest(r)
+}
+
+// UnknownEndpoints returns the number of /api/ requests that matched no known ingest route.
+func (p *Parser) UnknownEndpoints() int64 {
+	return p.unknown.Load()
+}
+
+// unknownEndpoint reports a /api/ path that matched no ingest route.
+func (p *Parser) unknownEndpoint(path string) {
+
+	if !strings.HasPrefix(path, "/api/") {
+		return
+	}
+	p.unknown.Add(1)
+	if p.OnUnknownEndpoint != nil {
+		p.OnUnknownEndpoint(path)
+	}
+}
+
+// checkAuthHeaderSize rejects auth headers longer than MaxAuthHeaderSize. Authorization is only read with
+// CompatRelay; otherwise it may carry anything, e.g. a large bearer token for a proxy in front.
+func (p *Parser) checkAuthHeaderSize(r *http.Request) error {
+
+	max := p.MaxAuthHeaderSize
+	if max <= 0 {
+		max = defaultMaxAuthHeaderSize
+	}
+	if len(r.Header.Get(http_x_sentry_auth)) > max {
+		return ErrAuthHeaderTooLarge
+	}
+	if p.CompatRelay && len(r.Header.Get("Authorization")) > max {
+		return ErrAuthHeaderTooLarge
+	}
+	return nil
+}
+
+func (p *Parser) checkFreshness(ts time.Time) error {
+
+	if p.MaxAuthAge <= 0 {
+		return nil
+	}
+	if ts.IsZero() {
+		return ErrStaleAuth
+	}
+	age := Now(p.Clock).Sub(ts)
+	if age > p.MaxAuthAge || age < -p.MaxAuthAge {
+		return ErrStaleAuth
+	}
+	return nil
+}
+
+// requestHost returns the host DSNs for r should point at under the trusted-proxy model.
+func (p *Parser) requestHost(r *http.Request) (string, error) {
+
+	host := r.URL.Host
+	if len(host) == 0 {
+		host = r.Host
+	}
+	//some routers/proxies may strip the host from http.Request.URL so http.Request.Host is useful.
+	if len(p.TrustedProxies) == 0 && len(p.IngestHost) == 0 {
+		return host, nil
+	}
+	if !p.trustedPeer(r.RemoteAddr) {
+		if len(p.IngestHost) == 0 {
+			return "", ErrUntrustedHost
+		}
+		return p.IngestHost, nil
+	}
+	//the first X-Forwarded-Host entry was set by the proxy facing the client
+	if fwd := r.Header.Get("X-Forwarded-Host"); len(fwd) > 0 {
+		host = strings.TrimSpace(strings.SplitN(fwd, ",", 2)[0])
+	}
+	if len(host) == 0 {
+		host = p.IngestHost
+	}
+	return host, nil
+}
+
+// trustedPeer reports whether remoteAddr, an ip:port as in http.Request.RemoteAddr, is inside TrustedProxies.
+func (p *Parser) trustedPeer(remoteAddr string) bool {
+
+	ap, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	return inPrefixes(ap.Addr().Unmap(), p.TrustedProxies)
+}
+
+// HostAllowlist lists the ingest hosts a DSN may point at. An empty list allows every host.
+// Entries are exact hosts ("sentry.example.com"), exact hosts with a port ("sentry.example.com:9000"),
+// suffix patterns ("*.ingest.sentry.io", which does not match ingest.sentry.io itself) or "*" for any host.
+// Entries without a port match the host on any port. Hosts and entries are compared in CanonicalHost form.
+type HostAllowlist []string
+
+// Allows reports whether host, which may carry a port, matches the allowlist.
+func (a HostAllowlist) Allows(host string) bool {
+
+	if len(a) == 0 {
+		return true
+	}
+	host = CanonicalHost(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = CanonicalHost(h)
+	}
+	for _, entry := range a {
+		switch {
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(hostname, "."+CanonicalHost(entry[2:])) {
+				return true
+			}
+		default:
+			if entry = CanonicalHost(entry); entry == host || entry == hostname {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check returns ErrUntrustedHost unless the allowlist allows host.
+func (a HostAllowlist) Check(host string) error {
+
+	if !a.Allows(host) {
+		return ErrUntrustedHost
+	}
+	return nil
+}
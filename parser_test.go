@@ -0,0 +1,321 @@
+package sentrydsn
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTableHostAllowlist = []struct {
+	allowlist   HostAllowlist
+	host        string
+	description string
+	expected    bool
+}{
+	{nil, "attacker.example.com", "empty allowlist allows everything", true},
+	{HostAllowlist{"*"}, "attacker.example.com", "wildcard", true},
+	{HostAllowlist{"sentry.example.com"}, "sentry.example.com", "exact host", true},
+	{HostAllowlist{"sentry.example.com"}, "SENTRY.example.com:9000", "exact host on any port, any case", true},
+	{HostAllowlist{"sentry.example.com:9000"}, "sentry.example.com:9000", "exact host and port", true},
+	{HostAllowlist{"sentry.example.com:9000"}, "sentry.example.com:8000", "wrong port", false},
+	{HostAllowlist{"*.ingest.sentry.io"}, "o87286.ingest.sentry.io", "suffix pattern", true},
+	{HostAllowlist{"*.ingest.sentry.io"}, "ingest.sentry.io", "suffix pattern excludes the apex", false},
+	{HostAllowlist{"*.ingest.sentry.io"}, "evilingest.sentry.io", "suffix pattern needs a dot", false},
+	{HostAllowlist{"sentry.example.com", "*.ingest.sentry.io"}, "attacker.example.com", "not listed", false},
+}
+
+func TestHostAllowlist(t *testing.T) {
+	for _, test := range testTableHostAllowlist {
+		if got := test.allowlist.Allows(test.host); got != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got)
+		}
+	}
+}
+
+var testTableSelfHosted = []testRequest{
+	{"http://sentry.example.com:9000/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5&sentry_version=7",
+		nil, nil, "self-hosted on port 9000",
+		"https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com:9000/1234"},
+	{"http://sentry.example.com/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5&sentry_version=7",
+		nil, nil, "self-hosted on the default port",
+		"https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com/1234"},
+}
+
+func TestParserSelfHosted(t *testing.T) {
+	p := &Parser{AllowedHosts: HostAllowlist{"sentry.example.com"}}
+	for _, test := range testTableSelfHosted {
+		got, err := p.FromRequest(httptest.NewRequest("POST", test.url, nil))
+		if err != nil {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, err)
+		} else if got.URL != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got.URL)
+		}
+	}
+
+	//server side requests carry the host only in r.Host
+	r := httptest.NewRequest("POST", "/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+	r.Host = "sentry.example.com:9000"
+	if got, err := p.FromRequest(r); err != nil || got.Host != "sentry.example.com:9000" {
+		t.Errorf("Expected -- sentry.example.com:9000 -- Got %v %v", got, err)
+	}
+}
+
+func TestParserUntrustedHost(t *testing.T) {
+	p := &Parser{AllowedHosts: HostAllowlist{"*.ingest.sentry.io"}}
+	r := httptest.NewRequest("POST", "https://attacker.example.com/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+	if got, err := p.FromRequest(r); err != ErrUntrustedHost {
+		t.Errorf("Expected -- %s -- Got %v %v", ErrUntrustedHost, got, err)
+	}
+}
+
+var testTableIPv6 = []struct {
+	url         string
+	host        string
+	description string
+	expected    string
+}{
+	{"http://[::1]:8000/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "", "bracketed with port in url",
+		"https://4784fbc50de2473f9977cfce8a9adce5@[::1]:8000/1234"},
+	{"http://[2001:db8::1]/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "", "bracketed without port in url",
+		"https://4784fbc50de2473f9977cfce8a9adce5@[2001:db8::1]/1234"},
+	{"/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "[::1]:8000", "bracketed with port in r.Host",
+		"https://4784fbc50de2473f9977cfce8a9adce5@[::1]:8000/1234"},
+	{"/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "2001:db8::1", "unbracketed in r.Host",
+		"https://4784fbc50de2473f9977cfce8a9adce5@[2001:db8::1]/1234"},
+	{"/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "127.0.0.1:9000", "IPv4 with port in r.Host",
+		"https://4784fbc50de2473f9977cfce8a9adce5@127.0.0.1:9000/1234"},
+}
+
+func TestIPv6Hosts(t *testing.T) {
+	for _, test := range testTableIPv6 {
+		r := httptest.NewRequest("POST", test.url, nil)
+		if len(test.host) > 0 {
+			r.Host = test.host
+		}
+		got, err := FromRequest(r)
+		if err != nil {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, err)
+			continue
+		}
+		if got.URL != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got.URL)
+		}
+		//derived DSNs must round trip
+		if parsed, err := ParseDSN(got.URL); err != nil || parsed.Host != got.Host {
+			t.Errorf("%s: Expected -- %s -- Got %v %v", test.description, got.Host, parsed, err)
+		}
+	}
+	if !(HostAllowlist{"::1"}).Allows("[::1]:8000") || !(HostAllowlist{"[::1]"}).Allows("[::1]") {
+		t.Errorf("Expected IPv6 allowlist entries to match with and without brackets")
+	}
+}
+
+func TestAuthTimestamp(t *testing.T) {
+	//taken from the shared test headers
+	r := httptest.NewRequest("POST", testTableLegacyUserInfo[1].url, nil)
+	r.Header.Set("X-Sentry-Auth", strings.Join(testTableLegacyUserInfo[1].header, ", "))
+	got, err := FromRequest(r)
+	expected := time.Date(2021, 2, 24, 5, 34, 37, 269000000, time.UTC)
+	if err != nil || got.Timestamp.Sub(expected).Abs() > time.Millisecond {
+		t.Errorf("Expected -- %s -- Got %v %v", expected, got, err)
+	}
+
+	p := &Parser{MaxAuthAge: 5 * time.Minute}
+	if _, err := p.FromRequest(r); err != ErrStaleAuth {
+		t.Errorf("Expected -- %s -- Got %v", ErrStaleAuth, err)
+	}
+}
+
+var testTableFreshness = []struct {
+	timestamp   func(now time.Time) string
+	description string
+	expected    error
+}{
+	{func(now time.Time) string { return "" }, "missing timestamp", ErrStaleAuth},
+	{func(now time.Time) string { return "sentry_timestamp=garbage, " }, "unreadable timestamp", ErrStaleAuth},
+	{func(now time.Time) string { return fmt.Sprintf("sentry_timestamp=%d, ", now.Unix()) }, "fresh unix timestamp", nil},
+	{func(now time.Time) string { return fmt.Sprintf("sentry_timestamp=%d.5, ", now.Unix()) }, "fresh fractional timestamp", nil},
+	{func(now time.Time) string { return "sentry_timestamp=" + now.UTC().Format(time.RFC3339) + ", " }, "fresh RFC 3339 timestamp", nil},
+	{func(now time.Time) string { return fmt.Sprintf("sentry_timestamp=%d, ", now.Add(-time.Hour).Unix()) }, "old timestamp", ErrStaleAuth},
+	{func(now time.Time) string { return fmt.Sprintf("sentry_timestamp=%d, ", now.Add(time.Hour).Unix()) }, "future timestamp", ErrStaleAuth},
+}
+
+func TestParserFreshness(t *testing.T) {
+	p := &Parser{MaxAuthAge: 5 * time.Minute}
+	for _, test := range testTableFreshness {
+		r := httptest.NewRequest("POST", "https://sentry.io/api/1234/store/", nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, "+test.timestamp(time.Now())+"sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		if _, err := p.FromRequest(r); err != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, err)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	p := &Parser{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}, IngestHost: "sentry.example.com"}
+	strict := &Parser{TrustedProxies: p.TrustedProxies}
+
+	var testTableTrustedProxies = []struct {
+		parser      *Parser
+		remoteAddr  string
+		forwarded   string
+		description string
+		expected    string
+		err         error
+	}{
+		{p, "10.1.2.3:4567", "", "trusted proxy keeps Host", "https://4784fbc50de2473f9977cfce8a9adce5@attacker.example.com/1234", nil},
+		{p, "10.1.2.3:4567", "o1.ingest.sentry.io, 10.9.9.9", "trusted proxy forwarded host", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", nil},
+		{p, "[fd00::1]:4567", "o1.ingest.sentry.io", "trusted ipv6 proxy", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", nil},
+		{p, "203.0.113.7:4567", "o1.ingest.sentry.io", "untrusted peer gets ingest host", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com/1234", nil},
+		{strict, "203.0.113.7:4567", "", "untrusted peer without ingest host", "", ErrUntrustedHost},
+		{&Parser{}, "203.0.113.7:4567", "o1.ingest.sentry.io", "zero parser trusts Host", "https://4784fbc50de2473f9977cfce8a9adce5@attacker.example.com/1234", nil},
+	}
+	for _, test := range testTableTrustedProxies {
+		r := httptest.NewRequest("POST", "/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", strings.NewReader("{}"))
+		r.Host = "attacker.example.com"
+		r.RemoteAddr = test.remoteAddr
+		if len(test.forwarded) > 0 {
+			r.Header.Set("X-Forwarded-Host", test.forwarded)
+		}
+		got, err := test.parser.FromRequest(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if err == nil && got.URL != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got.URL)
+		}
+	}
+}
+
+func TestOnUnknownEndpoint(t *testing.T) {
+	var seen []string
+	p := &Parser{OnUnknownEndpoint: func(path string) { seen = append(seen, path) }}
+
+	var testTableUnknownEndpoint = []struct {
+		url         string
+		description string
+		err         error
+	}{
+		{"/api/1234/envelope/", "known endpoint", nil},
+		{"/api/1234/profiling/", "unknown api endpoint", ErrMissingProjectID},
+		{"/healthz", "outside the api", ErrMissingProjectID},
+	}
+	for _, test := range testTableUnknownEndpoint {
+		r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io"+test.url, nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		if _, err := p.FromRequest(r); err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		}
+	}
+	if len(seen) != 1 || seen[0] != "/api/1234/profiling/" || p.UnknownEndpoints() != 1 {
+		t.Errorf("Expected -- [/api/1234/profiling/] counted once -- Got %v %v", seen, p.UnknownEndpoints())
+	}
+}
+
+func TestAcceptAnyProjectEndpoint(t *testing.T) {
+	p := &Parser{AcceptAnyProjectEndpoint: true}
+
+	var testTableAnyEndpoint = []struct {
+		url         string
+		description string
+		project     string
+		expected    EndpointType
+		err         error
+	}{
+		{"/api/1234/envelope/", "known endpoint keeps its type", "1234", EndpointEnvelope, nil},
+		{"/api/1234/profiling/", "new endpoint by name", "1234", "profiling", nil},
+		{"/api/1234/replay_video/", "underscore in name", "1234", "replay_video", nil},
+		{"/api/abc/profiling/", "non-numeric project", "", "", ErrMissingProjectID},
+		{"/api/1234/", "no endpoint", "", "", ErrMissingProjectID},
+	}
+	for _, test := range testTableAnyEndpoint {
+		r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io"+test.url, nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		got, err := p.FromRequest(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if err == nil && (got.ProjectID != test.project || got.Endpoint != test.expected) {
+			t.Errorf("%s: Expected -- %v %v -- Got %v %v", test.description, test.project, test.expected, got.ProjectID, got.Endpoint)
+		}
+	}
+	if p.UnknownEndpoints() != 2 {
+		t.Errorf("Expected -- 2 unknown endpoints -- Got %v", p.UnknownEndpoints())
+	}
+}
+
+func TestMaxAuthHeaderSize(t *testing.T) {
+	padding := ", sentry_client=" + strings.Repeat("x", 5000)
+
+	var testTableAuthHeaderSize = []struct {
+		parser      *Parser
+		header      string
+		description string
+		err         error
+	}{
+		{&Parser{}, "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5", "ordinary header", nil},
+		{&Parser{}, "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5" + padding, "over the default", ErrAuthHeaderTooLarge},
+		{&Parser{MaxAuthHeaderSize: 8 << 10}, "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5" + padding, "within a raised limit", nil},
+		{&Parser{MaxAuthHeaderSize: 16}, "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5", "over a lowered limit", ErrAuthHeaderTooLarge},
+		{&Parser{CompatRelay: true}, "", "authorization header over the default", ErrAuthHeaderTooLarge},
+		{&Parser{}, "", "authorization header not read", ErrMissingUser},
+	}
+	for _, test := range testTableAuthHeaderSize {
+		r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/", nil)
+		if len(test.header) > 0 {
+			r.Header.Set("X-Sentry-Auth", test.header)
+		} else {
+			r.Header.Set("Authorization", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5"+padding)
+		}
+		if _, err := test.parser.FromRequest(r); err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		}
+	}
+}
+
+func TestParseHooks(t *testing.T) {
+	p := &Parser{
+		//tenants reach the relay on their own subdomain and are pinned to their ingest host
+		BeforeParse: func(r *http.Request) {
+			if tenant, _, ok := strings.Cut(r.Host, ".relay.example.com"); ok && len(tenant) > 0 {
+				r.Host = tenant + ".ingest.sentry.io"
+			}
+		},
+		AfterParse: func(r *http.Request, dsn *DSN, err error) (*DSN, error) {
+			if err == ErrMissingUser {
+				return nil, ErrMissingDSN
+			}
+			if dsn != nil {
+				dsn.Warnings = append(dsn.Warnings, Warning{Code: "tenant", Message: dsn.Host})
+			}
+			return dsn, err
+		},
+	}
+
+	var testTableParseHooks = []struct {
+		host        string
+		auth        bool
+		description string
+		expected    string
+		err         error
+	}{
+		{"o1.relay.example.com", true, "tenant host injected", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", nil},
+		{"sentry.example.com", true, "other hosts untouched", "https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com/1234", nil},
+		{"o1.relay.example.com", false, "error replaced", "", ErrMissingDSN},
+	}
+	for _, test := range testTableParseHooks {
+		r := httptest.NewRequest("POST", "/api/1234/envelope/", nil)
+		r.Host = test.host
+		if test.auth {
+			r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		}
+		got, err := p.FromRequest(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if err == nil && (got.URL != test.expected || len(got.Warnings) != 1 || got.Warnings[0].Message != got.Host) {
+			t.Errorf("%s: Expected -- %v -- Got %+v", test.description, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// defaults applied when the AbuseGuard fields are unset
+const (
+	defaultAbuseThreshold  = 20
+	defaultAbuseWindow     = time.Minute
+	defaultAbuseIPv4Prefix = 32
+	defaultAbuseIPv6Prefix = 64
+	defaultAbuseClients    = 100000
+)
+
+// ErrBlocked Thrown if a client address is blocked by AbuseGuard
+var ErrBlocked = errors.New("sentry:  client blocked")
+
+// AbuseGuard watches for clients guessing keys: requests without a key or with a malformed one, and
+// requests a synchronous tunnel's upstream refuses with 401 or 403 because it does not know the key.
+// A client reaching Threshold such failures within Window is reported to OnSuspectedAbuse and, when Block
+// is set, refused with ErrBlocked for that long. The zero value only counts; it is safe for concurrent use.
+// A client is a network rather than an address, an IPv6 /64 by default, since one host commonly holds a whole
+// /64 to rotate through. At most MaxClients are tracked; failures of further clients are not counted until
+// tracked ones expire.
+type AbuseGuard struct {
+	Threshold      int            //failures within Window that mark a client, defaults to 20
+	Window         time.Duration  //defaults to a minute
+	Block          time.Duration  //how long marked clients are refused, never when zero
+	TrustedProxies []netip.Prefix //proxies whose X-Forwarded-For names the client, see sentrydsn.ClientAddr
+	IPv4Prefix     int            //bits of an IPv4 address naming a client, defaults to 32
+	IPv6Prefix     int            //bits of an IPv6 address naming a client, defaults to 64
+	MaxClients     int            //clients tracked, defaults to 100000
+
+	// OnSuspectedAbuse is called once each time a client reaches Threshold.
+	OnSuspectedAbuse func(ip netip.Addr, failures int)
+	Clock            sentrydsn.Clock //tells the time for windows and blocks, the system clock when nil
+
+	mu      sync.Mutex
+	clients map[netip.Prefix]*abuseClient
+	swept   time.Time
+}
+
+type abuseClient struct {
+	start        time.Time //start of the current window
+	failures     int
+	blockedUntil time.Time
+}
+
+// Blocked reports whether ip's network is currently refused.
+func (g *AbuseGuard) Blocked(ip netip.Addr) bool {
+
+	key := g.network(ip)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.clients[key]
+	return ok && sentrydsn.Now(g.Clock).Before(c.blockedUntil)
+}
+
+// network returns the network ip is counted under.
+func (g *AbuseGuard) network(ip netip.Addr) netip.Prefix {
+
+	ip = ip.Unmap()
+	bits := g.IPv4Prefix
+	if bits <= 0 || bits > 32 {
+		bits = defaultAbuseIPv4Prefix
+	}
+	if ip.Is6() {
+		bits = g.IPv6Prefix
+		if bits <= 0 || bits > 128 {
+			bits = defaultAbuseIPv6Prefix
+		}
+	}
+	p, _ := ip.Prefix(bits)
+	return p
+}
+
+// Fail counts a key failure for ip's network.
+func (g *AbuseGuard) Fail(ip netip.Addr) {
+
+	threshold := g.Threshold
+	if threshold <= 0 {
+		threshold = defaultAbuseThreshold
+	}
+	window := g.Window
+	if window <= 0 {
+		window = defaultAbuseWindow
+	}
+	maxClients := g.MaxClients
+	if maxClients <= 0 {
+		maxClients = defaultAbuseClients
+	}
+	key := g.network(ip)
+	now := sentrydsn.Now(g.Clock)
+
+	g.mu.Lock()
+	if g.clients == nil {
+		g.clients = map[netip.Prefix]*abuseClient{}
+	}
+	c, ok := g.clients[key]
+	if !ok {
+		g.sweep(now, window)
+		if len(g.clients) >= maxClients {
+			g.mu.Unlock()
+			return
+		}
+		c = &abuseClient{start: now}
+		g.clients[key] = c
+	}
+	if now.Sub(c.start) > window {
+		c.start, c.failures = now, 0
+	}
+	c.failures++
+	failures := c.failures
+	if failures == threshold && g.Block > 0 {
+		c.blockedUntil = now.Add(g.Block)
+	}
+	g.mu.Unlock()
+
+	if failures == threshold && g.OnSuspectedAbuse != nil {
+		g.OnSuspectedAbuse(ip, failures)
+	}
+}
+
+// sweep drops clients whose window and block are over, at most once a window; g.mu must be held.
+func (g *AbuseGuard) sweep(now time.Time, window time.Duration) {
+
+	if now.Sub(g.swept) < window {
+		return
+	}
+	g.swept = now
+	for key, c := range g.clients {
+		if now.Sub(c.start) > window && now.After(c.blockedUntil) {
+			delete(g.clients, key)
+		}
+	}
+}
+
+// check refuses blocked clients and returns the client address, if any.
+func (g *AbuseGuard) check(r *http.Request) (netip.Addr, error) {
+
+	if g == nil {
+		return netip.Addr{}, nil
+	}
+	ip, ok := sentrydsn.ClientAddr(r, g.TrustedProxies...)
+	if !ok {
+		return netip.Addr{}, nil
+	}
+	if g.Blocked(ip) {
+		return ip, ErrBlocked
+	}
+	return ip, nil
+}
+
+// parsed counts extraction errors meaning the client sent no usable key.
+func (g *AbuseGuard) parsed(ip netip.Addr, err error) {
+
+	if g == nil || !ip.IsValid() {
+		return
+	}
+	if errors.Is(err, sentrydsn.ErrMissingUser) || errors.Is(err, sentrydsn.ErrInvalidToken) {
+		g.Fail(ip)
+	}
+}
+
+// forwarded counts upstream refusals of the client's key.
+func (g *AbuseGuard) forwarded(ip netip.Addr, status int) {
+
+	if g == nil || !ip.IsValid() {
+		return
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		g.Fail(ip)
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func TestAbuseGuard(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	var suspected []netip.Addr
+	guard := &AbuseGuard{Threshold: 3, Block: time.Minute, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		OnSuspectedAbuse: func(ip netip.Addr, failures int) { suspected = append(suspected, ip) }}
+	tunnel := &Tunnel{Upstream: up.URL, Abuse: guard}
+
+	scan := func(client string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/", nil)
+		r.RemoteAddr = "10.0.0.2:4711"
+		r.Header.Set("X-Forwarded-For", client)
+		tunnel.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 3; i++ {
+		if got := scan("203.0.113.7"); got != http.StatusBadRequest {
+			t.Errorf("Expected -- %d -- Got %d", http.StatusBadRequest, got)
+		}
+	}
+	if got := scan("203.0.113.7"); got != http.StatusForbidden {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusForbidden, got)
+	}
+	if len(suspected) != 1 || suspected[0] != netip.MustParseAddr("203.0.113.7") {
+		t.Errorf("Expected -- [203.0.113.7] -- Got %v", suspected)
+	}
+
+	//other clients behind the same proxy are unaffected
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n")
+	r.RemoteAddr = "10.0.0.2:4711"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestAbuseGuardUpstreamRefusal(t *testing.T) {
+	up := newUpstream(http.StatusUnauthorized)
+	defer up.Close()
+	guard := &AbuseGuard{Threshold: 2}
+	tunnel := &Tunnel{Upstream: up.URL, Abuse: guard}
+	for i := 0; i < 2; i++ {
+		r := ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n")
+		r.RemoteAddr = "203.0.113.7:4711"
+		tunnel.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	ip := netip.MustParseAddr("203.0.113.7")
+	//without Block clients are only counted
+	if guard.Blocked(ip) {
+		t.Errorf("Expected -- not blocked -- Got blocked")
+	}
+	if c := guard.clients[netip.PrefixFrom(ip, 32)]; c == nil || c.failures != 2 {
+		t.Errorf("Expected -- 2 failures -- Got %+v", c)
+	}
+}
+
+func TestAbuseGuardWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	guard := &AbuseGuard{Threshold: 2, Window: time.Minute, Block: time.Minute, Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	ip := netip.MustParseAddr("203.0.113.7")
+	guard.Fail(ip)
+	now = now.Add(2 * time.Minute)
+	guard.Fail(ip)
+	if guard.Blocked(ip) {
+		t.Errorf("Expected -- failures in separate windows -- Got blocked")
+	}
+	guard.Fail(ip)
+	if !guard.Blocked(ip) {
+		t.Errorf("Expected -- blocked -- Got not blocked")
+	}
+	now = now.Add(2 * time.Minute)
+	if guard.Blocked(ip) {
+		t.Errorf("Expected -- block lifted -- Got blocked")
+	}
+}
+
+func TestAbuseGuardNetworks(t *testing.T) {
+	guard := &AbuseGuard{Threshold: 2, Block: time.Minute, MaxClients: 2}
+	//addresses of one IPv6 /64 are one client
+	guard.Fail(netip.MustParseAddr("2001:db8::1"))
+	guard.Fail(netip.MustParseAddr("2001:db8::ffff:2"))
+	if !guard.Blocked(netip.MustParseAddr("2001:db8::3")) {
+		t.Errorf("Expected -- the /64 blocked -- Got not blocked")
+	}
+	if guard.Blocked(netip.MustParseAddr("2001:db8:0:1::1")) {
+		t.Errorf("Expected -- the next /64 not blocked -- Got blocked")
+	}
+	//IPv4 addresses are clients of their own, mapped or not
+	guard.Fail(netip.MustParseAddr("::ffff:203.0.113.7"))
+	if c := guard.clients[netip.MustParsePrefix("203.0.113.7/32")]; c == nil || c.failures != 1 {
+		t.Errorf("Expected -- 1 failure for 203.0.113.7 -- Got %+v", c)
+	}
+	//beyond MaxClients new clients are not tracked
+	guard.Fail(netip.MustParseAddr("198.51.100.9"))
+	if len(guard.clients) != 2 {
+		t.Errorf("Expected -- 2 clients -- Got %d", len(guard.clients))
+	}
+}
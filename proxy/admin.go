@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// Admin is an http.Handler reporting live tunnel state as JSON, so operators can inspect the relay
+// without scraping metrics. Requests must carry "Authorization: Bearer <Token>"; an empty Token refuses everything.
+//
+//	{"projects": {"1234": {"received": 10, ...}}, "queue": {"depth": 0, "dropped": 0}, "spool": {"entries": 0, "bytes": 0}}
+type Admin struct {
+	Token  string
+	Tunnel *Tunnel
+	// Sections adds further top-level keys, e.g. cache or rate limiter state, computed per request.
+	Sections map[string]func() interface{}
+	// KeyPrefix is the number of public key characters shown before the rest is masked, so the admin API
+	// identifies keys without exposing them; 0 for sentrydsn.DefaultKeyPrefix, below 0 shows whole keys.
+	KeyPrefix int
+}
+
+// ServeHTTP implements http.Handler.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || len(a.Token) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	out := map[string]interface{}{}
+	if t := a.Tunnel; t != nil {
+		if t.Stats != nil {
+			out["projects"] = t.Stats.Snapshot()
+			out["warnings"] = t.Stats.Warnings()
+			locations := t.Stats.Locations()
+			if n := a.keyPrefix(); n >= 0 {
+				for i := range locations {
+					locations[i].PublicKey = sentrydsn.MaskKey(locations[i].PublicKey, n)
+				}
+			}
+			out["locations"] = locations
+		}
+		if t.Queue != nil {
+			out["queue"] = map[string]int64{"depth": int64(t.Queue.Len()), "dropped": t.Queue.Dropped()}
+		}
+		if t.Spool != nil {
+			entries, bytes := t.Spool.Stats()
+			out["spool"] = map[string]int64{"entries": int64(entries), "bytes": bytes}
+		}
+	}
+	for name, f := range a.Sections {
+		out[name] = f()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (a *Admin) keyPrefix() int {
+
+	if a.KeyPrefix == 0 {
+		return sentrydsn.DefaultKeyPrefix
+	}
+	return a.KeyPrefix
+}
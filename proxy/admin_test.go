@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/spool"
+)
+
+var testTableAdminAuth = []struct {
+	authorization string
+	description   string
+	expected      int
+}{
+	{"", "no credentials", http.StatusUnauthorized},
+	{"Bearer s3cret", "bearer token", http.StatusOK},
+	{"s3cret", "token without scheme", http.StatusUnauthorized},
+	{"Basic s3cret", "other scheme", http.StatusUnauthorized},
+	{"Bearer wrong", "wrong token", http.StatusUnauthorized},
+	{"Bearer ", "empty token", http.StatusUnauthorized},
+}
+
+func TestAdminAuth(t *testing.T) {
+	admin := &Admin{Token: "s3cret", Tunnel: &Tunnel{Stats: &Stats{}}}
+	for _, test := range testTableAdminAuth {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/admin", nil)
+		if len(test.authorization) > 0 {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		admin.ServeHTTP(w, r)
+		if w.Code != test.expected {
+			t.Errorf("%s: Expected -- %d -- Got %d", test.description, test.expected, w.Code)
+		}
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	s, _ := spool.Open(t.TempDir(), 0, 0)
+	tunnel := &Tunnel{Upstream: up.URL, Stats: &Stats{}, Spool: s}
+	for i := 0; i < 3; i++ {
+		tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	}
+	admin := &Admin{Token: "s3cret", Tunnel: tunnel, Sections: map[string]func() interface{}{
+		"cache": func() interface{} { return map[string]float64{"hit_ratio": 0.5} },
+	}}
+
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/admin", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	admin.ServeHTTP(w, r)
+	var got struct {
+		Projects map[string]ProjectStats `json:"projects"`
+		Spool    map[string]int64        `json:"spool"`
+		Cache    map[string]float64      `json:"cache"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if p := got.Projects["1234"]; p.Received != 3 || p.Forwarded != 3 {
+		t.Errorf("Expected -- 3 received 3 forwarded -- Got %+v", p)
+	}
+	if _, ok := got.Spool["entries"]; !ok || got.Cache["hit_ratio"] != 0.5 {
+		t.Errorf("Expected spool and cache sections -- Got %+v", got)
+	}
+}
+
+func TestAdminKeyPrefix(t *testing.T) {
+	stats := &Stats{}
+	stats.receive(&sentrydsn.DSN{ProjectID: "1234", PublicKey: testKey, Geo: &sentrydsn.Geo{Country: "DE"}})
+	admin := &Admin{Token: "s3cret", Tunnel: &Tunnel{Stats: stats}}
+
+	for _, expected := range []struct {
+		keyPrefix int
+		key       string
+	}{{0, "4784fbc5************************"}, {4, "4784****************************"}, {-1, testKey}} {
+		admin.KeyPrefix = expected.keyPrefix
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/admin", nil)
+		r.Header.Set("Authorization", "Bearer s3cret")
+		admin.ServeHTTP(w, r)
+		var got struct {
+			Locations []KeyLocation `json:"locations"`
+		}
+		json.NewDecoder(w.Body).Decode(&got)
+		if len(got.Locations) != 1 || got.Locations[0].PublicKey != expected.key {
+			t.Errorf("%d: Expected -- %s -- Got %+v", expected.keyPrefix, expected.key, got.Locations)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// AzureHandler adapts an http.Handler to the Azure Functions custom handler protocol, where the Functions host
+// posts each invocation as JSON and expects the HTTP response back as JSON output bindings.
+// Function apps with enableForwardingHttpRequest in host.json receive plain HTTP and need no adapter.
+type AzureHandler struct {
+	Handler  http.Handler
+	Request  string //name of the HTTP trigger binding, "req" when empty
+	Response string //name of the HTTP output binding, "res" when empty
+}
+
+// azureRequest is the HTTP trigger payload inside an invocation.
+type azureRequest struct {
+	URL     string              `json:"Url"`
+	Method  string              `json:"Method"`
+	Headers map[string][]string `json:"Headers"`
+	Body    json.RawMessage     `json:"Body"`
+}
+
+type azureResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// ServeHTTP implements http.Handler for invocation requests from the Functions host.
+func (a *AzureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	reqName, resName := a.Request, a.Response
+	if len(reqName) == 0 {
+		reqName = "req"
+	}
+	if len(resName) == 0 {
+		resName = "res"
+	}
+	var invocation struct {
+		Data map[string]json.RawMessage `json:"Data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&invocation); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var in azureRequest
+	if err := json.Unmarshal(invocation.Data[reqName], &in); err != nil {
+		http.Error(w, "sentry:  invocation without an http trigger "+reqName, http.StatusBadRequest)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), in.Method, in.URL, bytes.NewReader(azureBody(in.Body)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for k, v := range in.Headers {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	req.Host = req.URL.Host
+	req.RemoteAddr = r.RemoteAddr
+
+	rec := &bufferedResponse{header: http.Header{}}
+	a.Handler.ServeHTTP(rec, req)
+
+	out := azureResponse{StatusCode: rec.status, Headers: map[string]string{}, Body: rec.body.String()}
+	if out.StatusCode == 0 {
+		out.StatusCode = http.StatusOK
+	}
+	for k := range rec.header {
+		out.Headers[k] = rec.header.Get(k)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Outputs": map[string]interface{}{resName: out},
+	})
+}
+
+// azureBody returns the trigger body, which the host sends as a JSON string for text payloads
+// and as the JSON value itself for application/json ones.
+func azureBody(raw json.RawMessage) []byte {
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+	if string(raw) == "null" {
+		return nil
+	}
+	return raw
+}
+
+// bufferedResponse collects a handler's response for re-encoding.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAzureHandler(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	a := &AzureHandler{Handler: &Tunnel{Upstream: up.URL}}
+
+	invocation := `{"Data": {"req": {
+		"Url": "https://tunnel.azurewebsites.net/api/1234/envelope/?sentry_key=` + testKey + `",
+		"Method": "POST",
+		"Headers": {"Content-Type": ["application/x-sentry-envelope"]},
+		"Body": "{}\n{\"type\":\"event\"}\n{}\n"
+	}}, "Metadata": {}}`
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", "/tunnel", strings.NewReader(invocation)))
+
+	var got struct {
+		Outputs struct {
+			Res azureResponse `json:"res"`
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	if got.Outputs.Res.StatusCode != http.StatusOK || !strings.Contains(got.Outputs.Res.Body, "9ec79c33ec9942ab8353589fcb2e04dc") {
+		t.Errorf("Expected -- upstream response in the output binding -- Got %+v", got.Outputs.Res)
+	}
+	received := up.requests()
+	if len(received) != 1 || received[0].body != "{}\n{\"type\":\"event\"}\n{}\n" || received[0].url != "/api/1234/envelope/?sentry_key="+testKey {
+		t.Errorf("Expected -- the envelope forwarded -- Got %v", received)
+	}
+
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", "/tunnel", strings.NewReader(`{"Data": {}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected -- %v -- Got %v", http.StatusBadRequest, w.Code)
+	}
+}
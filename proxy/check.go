@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// Check validates the tunnel's configuration at startup, before it takes traffic, and returns every problem
+// found joined with errors.Join, or nil: upstreams must be http(s) URLs whose hosts resolve, allowlist
+// entries must be able to match, a tunnel without upstream needs AllowedHosts, and an extractor with a Check method, such as a sentrydsn.Parser, is checked too.
+func (t *Tunnel) Check(ctx context.Context) error {
+
+	errs := []error{t.AllowedHosts.Validate()}
+	if len(t.Upstream) == 0 && t.Upstreams == nil && t.Routes == nil && len(t.AllowedHosts) == 0 && !t.DisableForwarding {
+		errs = append(errs, ErrNoUpstream)
+	}
+	upstreams := []string{t.Upstream}
+	if t.Upstreams != nil {
+		upstreams = append(upstreams, t.Upstreams.Upstreams...)
+		if len(t.Upstreams.Upstreams) == 0 {
+			errs = append(errs, errors.New("sentry:  upstream ring without upstreams"))
+		}
+	}
+	if t.Routes != nil {
+		for _, route := range t.Routes.Routes {
+			if err := (sentrydsn.HostAllowlist{route.Host}).Validate(); err != nil || len(route.Host) == 0 {
+				errs = append(errs, fmt.Errorf("sentry:  invalid route host %q", route.Host))
+			}
+			if len(route.Upstream) == 0 {
+				errs = append(errs, fmt.Errorf("sentry:  route %q without upstream", route.Host))
+			}
+			upstreams = append(upstreams, route.Upstream)
+		}
+	}
+	for _, upstream := range upstreams {
+		if len(upstream) > 0 {
+			errs = append(errs, checkUpstream(ctx, upstream))
+		}
+	}
+	if c, ok := t.Extractor.(interface{ Check() error }); ok {
+		errs = append(errs, c.Check())
+	}
+	for endpoint, to := range t.Timeouts {
+		if to.Read < 0 || to.Forward < 0 {
+			errs = append(errs, fmt.Errorf("sentry:  negative timeout for endpoint %q", endpoint))
+		}
+	}
+	for category, p := range t.Policies {
+		if p == nil {
+			errs = append(errs, fmt.Errorf("sentry:  nil policy for %q", category))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkUpstream validates an upstream base URL with sentrydsn.ParseUpstream and resolves its host.
+// Upstreams are used as given at request time, so a full DSN, which ParseUpstream accepts, is refused here.
+func checkUpstream(ctx context.Context, upstream string) error {
+
+	base, err := sentrydsn.ParseUpstream(upstream)
+	if err != nil {
+		return err
+	}
+	if raw, _ := url.Parse(upstream); raw.User != nil {
+		return fmt.Errorf("sentry:  invalid upstream %q: a dsn, use %q", raw.Redacted(), base)
+	}
+	u, _ := url.Parse(base)
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return fmt.Errorf("sentry:  upstream %q does not resolve: %w", upstream, err)
+	}
+	return nil
+}
+
+// Check validates the server's configuration and its Tunnel's, if it is one, returning every problem found.
+// Certificate and key files must exist and hold a matching pair; an Admin needs a token, and Metrics and pprof an address.
+func (s *Server) Check(ctx context.Context) error {
+
+	var errs []error
+	if len(s.CertFile) > 0 || len(s.KeyFile) > 0 {
+		if _, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("sentry:  tls certificate: %w", err))
+		}
+	}
+	if s.Admin != nil && len(s.Admin.Token) == 0 {
+		errs = append(errs, errors.New("sentry:  admin token is empty, every admin request would be refused"))
+	}
+	if len(s.MetricsAddr) > 0 && s.Metrics == nil && !s.EnablePprof {
+		errs = append(errs, errors.New("sentry:  metrics address set without metrics"))
+	}
+	if s.EnablePprof && len(s.MetricsAddr) == 0 {
+		errs = append(errs, errors.New("sentry:  pprof is only served on MetricsAddr, which is unset"))
+	}
+	if s.Metrics != nil && len(s.MetricsAddr) == 0 && !s.MetricsOnIngest {
+		errs = append(errs, errors.New("sentry:  metrics without a metrics address would not be served, set MetricsAddr or MetricsOnIngest"))
+	}
+	if t, ok := s.Tunnel.(*Tunnel); ok {
+		errs = append(errs, t.Check(ctx))
+	}
+	return errors.Join(errs...)
+}
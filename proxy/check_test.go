@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+//setup
+
+var testTableTunnelCheck = []struct {
+	tunnel      *Tunnel
+	description string
+	expected    []string //substrings of the error, none when valid
+}{
+	{&Tunnel{}, "zero value", []string{"no upstream"}},
+	{&Tunnel{AllowedHosts: sentrydsn.HostAllowlist{"*.ingest.sentry.io"}}, "dsn host restricted", nil},
+	{&Tunnel{DisableForwarding: true}, "sinks only", nil},
+	{&Tunnel{Upstream: "http://127.0.0.1:9000", AllowedHosts: sentrydsn.HostAllowlist{"*.sentry.io"}}, "ip upstream", nil},
+	{&Tunnel{Upstream: "o1.ingest.sentry.io"}, "upstream without scheme", []string{`invalid upstream "o1.ingest.sentry.io"`, "e.g. https://o1.ingest.sentry.io"}},
+	{&Tunnel{Upstream: "https://4784fbc50de2473f9977cfce8a9adce5@127.0.0.1/1234"}, "dsn as upstream", []string{`use "https://127.0.0.1"`}},
+	{&Tunnel{Upstream: "https://sentry.invalid"}, "unresolvable upstream", []string{`"https://sentry.invalid" does not resolve`}},
+	{&Tunnel{Upstreams: &UpstreamRing{Upstreams: []string{"http://[::1]:9000", "ftp://10.0.0.1"}}}, "ring", []string{`"ftp://10.0.0.1"`}},
+	{&Tunnel{Upstreams: &UpstreamRing{}}, "empty ring", []string{"without upstreams"}},
+	{&Tunnel{Extractor: &sentrydsn.Parser{IngestHost: "a b"}, AllowedHosts: sentrydsn.HostAllowlist{"a/b"}}, "parser checked", []string{"ingest host", `"a/b"`}},
+	{&Tunnel{Policies: map[string]*ItemPolicy{"replay": nil}}, "nil policy", []string{`"replay"`}},
+	{&Tunnel{Timeouts: map[sentrydsn.EndpointType]Timeout{sentrydsn.EndpointStore: {Read: -time.Second}}}, "negative timeout", []string{`endpoint "store"`}},
+	{&Tunnel{Routes: &RoutingTable{Routes: []Route{{"relay.example.com", "http://10.0.0.1"}, {"a/b", "http://10.0.0.2"}, {"*.example.com", ""}}}}, "routes",
+		[]string{`route host "a/b"`, `route "*.example.com" without upstream`}},
+}
+
+//tests
+
+func TestTunnelCheck(t *testing.T) {
+	for _, test := range testTableTunnelCheck {
+		checkErrors(t, test.description, test.tunnel.Check(context.Background()), test.expected)
+	}
+}
+
+func TestServerCheck(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	os.WriteFile(cert, []byte("not a certificate"), 0o600)
+
+	var testTableServerCheck = []struct {
+		server      *Server
+		description string
+		expected    []string
+	}{
+		{&Server{Tunnel: &Tunnel{AllowedHosts: sentrydsn.HostAllowlist{"*.ingest.sentry.io"}}}, "minimal", nil},
+		{&Server{Tunnel: http.NotFoundHandler(), CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "key.pem")}, "missing files", []string{"tls certificate", "missing.pem"}},
+		{&Server{Tunnel: http.NotFoundHandler(), CertFile: cert, KeyFile: cert}, "malformed certificate", []string{"tls certificate"}},
+		{&Server{Tunnel: http.NotFoundHandler(), Admin: &Admin{}}, "admin without token", []string{"admin token"}},
+		{&Server{Tunnel: http.NotFoundHandler(), MetricsAddr: ":9090"}, "metrics address only", []string{"metrics address"}},
+		{&Server{Tunnel: http.NotFoundHandler(), Metrics: &Metrics{}}, "metrics without address", []string{"MetricsOnIngest"}},
+		{&Server{Tunnel: http.NotFoundHandler(), Metrics: &Metrics{}, MetricsOnIngest: true}, "metrics on ingest", nil},
+		{&Server{Tunnel: http.NotFoundHandler(), EnablePprof: true}, "pprof without address", []string{"MetricsAddr"}},
+		{&Server{Tunnel: http.NotFoundHandler(), EnablePprof: true, MetricsAddr: ":9090"}, "pprof on its own address", nil},
+		{&Server{Tunnel: &Tunnel{Upstream: "sentry.io"}}, "tunnel checked", []string{"invalid upstream"}},
+	}
+	for _, test := range testTableServerCheck {
+		checkErrors(t, test.description, test.server.Check(context.Background()), test.expected)
+	}
+}
+
+func checkErrors(t *testing.T, description string, err error, expected []string) {
+	if len(expected) == 0 && err != nil {
+		t.Errorf("%s: Expected -- nil -- Got %v", description, err)
+	}
+	if len(expected) > 0 && err == nil {
+		t.Errorf("%s: Expected -- %v -- Got nil", description, expected)
+		return
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("%s: Expected -- %s -- Got %v", description, e, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/envelope"
+)
+
+// defaults applied when the ClientReporter fields are unset
+const (
+	defaultReportInterval = 30 * time.Second //about what SDKs wait
+	defaultMaxReports     = 1000
+)
+
+// client report reasons for requests the tunnel drops whole after acknowledging them, as Sentry SDKs name them
+const (
+	reasonNetworkError  = "network_error"  //upstream unreachable and no spool
+	reasonSendError     = "send_error"     //upstream answered 500 and above and no spool
+	reasonQueueOverflow = "queue_overflow" //discarded by a full DropOldest queue
+)
+
+var errNoTunnel = errors.New("sentry:  client reporter without tunnel, use TunnelClientReporter")
+
+// ClientReporter tells upstream Sentry what the tunnel discarded, so project owners see filtered, sampled and
+// dropped events in their stats instead of missing ones. Discards are collected per DSN and sent every Interval
+// as client_report envelopes, the way SDKs report their own discards. Only discards of requests the client was
+// told arrived are reported; those answered with an error the SDK retries or reports itself.
+// The DSNs are client supplied and each is sent its own report, so at most MaxReports are collected per
+// Interval and discards for further DSNs dropped. It is safe for concurrent use.
+type ClientReporter struct {
+	Interval   time.Duration //how long discards are collected before they are sent, 30 seconds when unset
+	MaxReports int           //DSNs collected per Interval, 1000 when unset
+
+	tunnel  *Tunnel
+	mu      sync.Mutex
+	pending map[reportKey]*pendingReport
+	timer   *time.Timer
+}
+
+// discards are reported to the project and upstream they were bound for
+type reportKey struct {
+	projectID string
+	publicKey string
+	host      string
+	upstream  string
+}
+
+type pendingReport struct {
+	dsn       *sentrydsn.DSN
+	discarded []envelope.DiscardedEvent
+}
+
+// TunnelClientReporter returns a ClientReporter sending its reports through t's forwarder.
+func TunnelClientReporter(t *Tunnel, interval time.Duration) *ClientReporter {
+	return &ClientReporter{Interval: interval, tunnel: t}
+}
+
+// discard adds the events discarded from j to the next report.
+func (c *ClientReporter) discard(j *Job, discarded []envelope.DiscardedEvent) {
+
+	if c == nil || len(discarded) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == nil {
+		c.pending = map[reportKey]*pendingReport{}
+	}
+	k := reportKey{j.DSN.ProjectID, j.DSN.PublicKey, j.DSN.Host, j.Upstream}
+	p, ok := c.pending[k]
+	if !ok {
+		maxReports := c.MaxReports
+		if maxReports <= 0 {
+			maxReports = defaultMaxReports
+		}
+		if len(c.pending) >= maxReports {
+			return
+		}
+		p = &pendingReport{dsn: j.DSN}
+		c.pending[k] = p
+	}
+	for _, d := range discarded {
+		p.discarded = appendDiscard(p.discarded, d)
+	}
+	if c.timer == nil {
+		interval := c.Interval
+		if interval <= 0 {
+			interval = defaultReportInterval
+		}
+		c.timer = time.AfterFunc(interval, func() { c.Flush(context.Background()) })
+	}
+}
+
+// Flush sends the pending reports now, e.g. before shutting down, and returns the first error.
+// Reports that fail to send are not retried.
+func (c *ClientReporter) Flush(ctx context.Context) error {
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+
+	var first error
+	for k, p := range pending {
+		if err := c.send(ctx, k.upstream, p); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// send posts one client report envelope to the project's envelope endpoint, bypassing the spool and stats.
+func (c *ClientReporter) send(ctx context.Context, upstream string, p *pendingReport) error {
+
+	if c.tunnel == nil {
+		return errNoTunnel
+	}
+	dsn, err := p.dsn.ClientDSN()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	report := &envelope.ClientReport{Timestamp: float64(sentrydsn.Now(c.tunnel.Clock).UnixMilli()) / 1000, DiscardedEvents: p.discarded}
+	if err := envelope.WriteClientReport(&body, dsn, report); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-sentry-envelope")
+	j := &Job{DSN: p.dsn, Method: http.MethodPost, URL: c.tunnel.envelopeURL(p.dsn, upstream), Upstream: upstream, Header: header, Body: body.Bytes()}
+	f := c.tunnel.Forwarder
+	if f == nil {
+		f = &Forwarder{}
+	}
+	resp, err := f.Forward(ctx, j)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// requestDiscards counts the events of a request dropped whole for reason: each item of an envelope by its
+// data category, attachments by their bytes, other requests as one event of their endpoint's category.
+func requestDiscards(j *Job, reason string) []envelope.DiscardedEvent {
+
+	if isEnvelope(j) && len(j.Header.Get("Content-Encoding")) == 0 {
+		items, err := envelope.Sizes(bytes.NewReader(j.Body), envelope.Limits{})
+		if err == nil {
+			var discarded []envelope.DiscardedEvent
+			for _, item := range items {
+				discarded = appendDiscard(discarded, envelope.DiscardedEvent{Reason: reason, Category: envelope.Category(item.Type), Quantity: envelope.Quantity(item.Type, item.Size)})
+			}
+			return discarded
+		}
+	}
+	category := "default"
+	switch j.DSN.Endpoint {
+	case sentrydsn.EndpointStore:
+		category = "error"
+	case sentrydsn.EndpointProfile:
+		category = "profile"
+	case sentrydsn.EndpointNEL, sentrydsn.EndpointReport:
+		category = "security"
+	}
+	return []envelope.DiscardedEvent{{Reason: reason, Category: category, Quantity: 1}}
+}
+
+func appendDiscard(discarded []envelope.DiscardedEvent, d envelope.DiscardedEvent) []envelope.DiscardedEvent {
+
+	for i := range discarded {
+		if discarded[i].Reason == d.Reason && discarded[i].Category == d.Category {
+			discarded[i].Quantity += d.Quantity
+			return discarded
+		}
+	}
+	return append(discarded, d)
+}
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/envelope"
+)
+
+//setup
+
+// clientReport reads the client report out of a forwarded envelope
+func clientReport(t *testing.T, body string) *envelope.ClientReport {
+	er, err := envelope.NewReader(strings.NewReader(body), envelope.Limits{})
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	ih, payload, err := er.Next()
+	if err != nil || ih.Type != "client_report" {
+		t.Fatalf("Expected -- client_report -- Got %v %v", ih, err)
+	}
+	var report envelope.ClientReport
+	b, _ := io.ReadAll(payload)
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	return &report
+}
+
+const testAttachmentEnvelope = `{"event_id":"36b75d9fa11f45459412a96c41bdf691"}
+{"type":"event"}
+{"message":"hello world"}
+{"type":"attachment","length":10,"filename":"a.txt"}
+helloworld
+{"type":"attachment","length":5,"filename":"b.txt"}
+hello
+`
+
+//tests
+
+func TestClientReportsFiltered(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Policies: map[string]*ItemPolicy{"replay": {Drop: true}}}
+	tunnel.ClientReports = TunnelClientReporter(tunnel, time.Hour)
+
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", testReplayEnvelope))
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", testReplayEnvelope))
+	if got := up.requests(); len(got) != 2 {
+		t.Fatalf("Expected -- reports held until flushed -- Got %v", got)
+	}
+	if err := tunnel.ClientReports.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+
+	got := up.requests()
+	if len(got) != 3 || got[2].url != "/api/1234/envelope/?sentry_key="+testKey+"&sentry_version=7" {
+		t.Fatalf("Expected -- client report sent to the envelope endpoint -- Got %v", got)
+	}
+	report := clientReport(t, got[2].body)
+	expected := envelope.DiscardedEvent{Reason: envelope.ReasonFiltered, Category: "replay", Quantity: 4}
+	if len(report.DiscardedEvents) != 1 || report.DiscardedEvents[0] != expected || report.Timestamp == 0 {
+		t.Errorf("Expected -- %v -- Got %+v", expected, report)
+	}
+}
+
+func TestClientReportsAttachmentBytes(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	stats := &Stats{}
+	tunnel := &Tunnel{Upstream: up.URL, Policies: map[string]*ItemPolicy{"attachment": {MaxSize: 8}}, Stats: stats}
+	tunnel.ClientReports = TunnelClientReporter(tunnel, time.Hour)
+
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", testAttachmentEnvelope))
+	if err := tunnel.ClientReports.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	got := up.requests()
+	if len(got) != 2 {
+		t.Fatalf("Expected -- envelope and client report -- Got %v", got)
+	}
+	report := clientReport(t, got[1].body)
+	expected := envelope.DiscardedEvent{Reason: envelope.ReasonFiltered, Category: "attachment", Quantity: 10}
+	if len(report.DiscardedEvents) != 1 || report.DiscardedEvents[0] != expected {
+		t.Errorf("Expected -- %v -- Got %+v", expected, report)
+	}
+	//Stats count the item, not its bytes
+	if filtered := stats.Snapshot()["1234"].Filtered; filtered != 1 {
+		t.Errorf("Expected -- %d -- Got %d", 1, filtered)
+	}
+}
+
+func TestClientReportsInterval(t *testing.T) {
+	up := newUpstream(http.StatusServiceUnavailable)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL}
+	tunnel.ClientReports = TunnelClientReporter(tunnel, 10*time.Millisecond)
+	tunnel.Queue = TunnelQueue(tunnel, 1, 1, Reject)
+	defer tunnel.Queue.Close()
+
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/store/", `{"message":"hello world"}`))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(up.requests()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := up.requests()
+	if len(got) != 2 {
+		t.Fatalf("Expected -- event and client report -- Got %v", got)
+	}
+	report := clientReport(t, got[1].body)
+	expected := envelope.DiscardedEvent{Reason: reasonSendError, Category: "error", Quantity: 1}
+	if len(report.DiscardedEvents) != 1 || report.DiscardedEvents[0] != expected {
+		t.Errorf("Expected -- %v -- Got %+v", expected, report)
+	}
+}
+
+func TestClientReportsQueueOverflow(t *testing.T) {
+	release := make(chan struct{})
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer blocked.Close()
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: blocked.URL, Stats: &Stats{}}
+	tunnel.ClientReports = TunnelClientReporter(tunnel, time.Hour)
+	tunnel.Queue = TunnelQueue(tunnel, 1, 1, DropOldest)
+
+	//one forward in flight, one queued, and a third pushing the queued one out
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/store/", `{"message":"hello world"}`))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	tunnel.Queue.Close()
+	tunnel.Upstream = up.URL
+	if err := tunnel.ClientReports.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+
+	got := up.requests()
+	if len(got) != 1 {
+		t.Fatalf("Expected -- client report -- Got %v", got)
+	}
+	report := clientReport(t, got[0].body)
+	expected := envelope.DiscardedEvent{Reason: reasonQueueOverflow, Category: "error", Quantity: 1}
+	if len(report.DiscardedEvents) != 1 || report.DiscardedEvents[0] != expected {
+		t.Errorf("Expected -- %v -- Got %+v", expected, report)
+	}
+	if overflowed := tunnel.Stats.Snapshot()["1234"].Overflowed; overflowed != 1 {
+		t.Errorf("Expected -- %d overflowed -- Got %d", 1, overflowed)
+	}
+}
+
+func TestClientReportsSync(t *testing.T) {
+	up := newUpstream(http.StatusServiceUnavailable)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL}
+	tunnel.ClientReports = TunnelClientReporter(tunnel, time.Hour)
+
+	//the SDK gets the 503 and retries, so nothing is discarded
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/store/", `{"message":"hello world"}`))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	tunnel.ClientReports.Flush(context.Background())
+	if got := up.requests(); len(got) != 1 {
+		t.Errorf("Expected -- no client report -- Got %v", got)
+	}
+}
+
+func TestClientReportsMaxReports(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Policies: map[string]*ItemPolicy{"replay": {Drop: true}}}
+	tunnel.ClientReports = &ClientReporter{Interval: time.Hour, MaxReports: 2, tunnel: tunnel}
+
+	for _, project := range []string{"1", "2", "3"} {
+		tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/"+project+"/envelope/", testReplayEnvelope))
+	}
+	tunnel.ClientReports.Flush(context.Background())
+	if got := up.requests(); len(got) != 5 {
+		t.Errorf("Expected -- 3 envelopes and 2 client reports -- Got %d requests", len(got))
+	}
+}
+
+func TestRequestDiscards(t *testing.T) {
+	dsn := &sentrydsn.DSN{ProjectID: "1234", Endpoint: sentrydsn.EndpointEnvelope}
+	j := &Job{DSN: dsn, Header: http.Header{}, Body: []byte(testReplayEnvelope)}
+	discarded := requestDiscards(j, reasonNetworkError)
+	expected := []envelope.DiscardedEvent{{Reason: reasonNetworkError, Category: "error", Quantity: 1}, {Reason: reasonNetworkError, Category: "replay", Quantity: 2}}
+	if len(discarded) != 2 || discarded[0] != expected[0] || discarded[1] != expected[1] {
+		t.Errorf("Expected -- %v -- Got %v", expected, discarded)
+	}
+
+	//attachments count their bytes
+	j.Body = []byte(testAttachmentEnvelope)
+	discarded = requestDiscards(j, reasonNetworkError)
+	expected = []envelope.DiscardedEvent{{Reason: reasonNetworkError, Category: "error", Quantity: 1}, {Reason: reasonNetworkError, Category: "attachment", Quantity: 15}}
+	if len(discarded) != 2 || discarded[0] != expected[0] || discarded[1] != expected[1] {
+		t.Errorf("Expected -- %v -- Got %v", expected, discarded)
+	}
+
+	j.DSN = &sentrydsn.DSN{ProjectID: "1234", Endpoint: sentrydsn.EndpointReport}
+	discarded = requestDiscards(j, reasonNetworkError)
+	if len(discarded) != 1 || discarded[0].Category != "security" {
+		t.Errorf("Expected -- security -- Got %v", discarded)
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS answers for browser SDKs posting to a tunnel on another origin, the way Sentry's own ingest does.
+// Requests carry no cookies, so any origin is allowed.
+var (
+	corsMethods       = []string{http.MethodGet, http.MethodPost}
+	corsHeaders       = []string{"Content-Type", "Content-Encoding", "X-Sentry-Auth", "X-Sentry-DSN", "X-Requested-With", "sentry-trace", "baggage"}
+	corsExposeHeaders = []string{"X-Sentry-Error", "X-Sentry-Rate-Limits", "Retry-After"}
+)
+
+// how long browsers may cache a preflight answer, in seconds
+const corsMaxAge = "3600"
+
+// allowOrigin lets browsers on other origins read the response to r, so SDKs see rate limits.
+func allowOrigin(w http.ResponseWriter, r *http.Request) {
+
+	if len(r.Header.Get("Origin")) == 0 {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposeHeaders, ", "))
+}
+
+// writePreflight answers a HEAD request, e.g. a health probe, or an OPTIONS request, with the methods and
+// headers browser SDKs may send when it is a CORS preflight, the usual ones and extra.
+func writePreflight(w http.ResponseWriter, r *http.Request, extra []string) {
+
+	if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+		headers := append(append([]string(nil), corsHeaders...), extra...)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// status codes ingest answers with for the errors a tunnel runs into, in the order they are checked
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{sentrydsn.ErrMissingProjectID, http.StatusNotFound},
+	{ErrBodyTooLarge, http.StatusRequestEntityTooLarge},
+	{sentrydsn.ErrAuthHeaderTooLarge, http.StatusRequestHeaderFieldsTooLarge},
+	{sentrydsn.ErrContentType, http.StatusUnsupportedMediaType},
+	{sentrydsn.ErrMethodNotAllowed, http.StatusMethodNotAllowed},
+	{sentrydsn.ErrUntrustedHost, http.StatusForbidden},
+	{sentrydsn.ErrEndpointNotAllowed, http.StatusForbidden},
+	{ErrBlocked, http.StatusForbidden},
+	{sentrydsn.ErrUnauthorized, http.StatusForbidden},
+	{sentrydsn.ErrAuthorizerUnavailable, http.StatusServiceUnavailable},
+	{sentrydsn.ErrInvalidRelaySignature, http.StatusUnauthorized},
+	{sentrydsn.ErrMissingRelaySignature, http.StatusUnauthorized},
+	{sentrydsn.ErrBodyUnavailable, http.StatusInternalServerError},
+	{ErrReadTimeout, http.StatusRequestTimeout},
+	{ErrNoUpstream, http.StatusInternalServerError},
+}
+
+// ErrorStatus returns the status code Sentry ingest uses for err: 404 for paths without a project,
+// 413 for bodies and 431 for auth headers that are too large, 403 for refused hosts, endpoints, clients and keys,
+// 415 for mismatched content types, 405 for methods an endpoint does not take, 401 for bad relay signatures,
+// 500 for bodies consumed before the tunnel got to them and tunnels without upstream, 408 for bodies not sent in time, 503 while the
+// authorizer cannot decide and 400 for everything else, such as a missing or malformed key.
+func ErrorStatus(err error) int {
+
+	for _, s := range errorStatuses {
+		if errors.Is(err, s.err) {
+			return s.status
+		}
+	}
+	return http.StatusBadRequest
+}
+
+// WriteError answers with ErrorStatus(err) and the {"detail": ...} body SDKs expect from ingest.
+func WriteError(w http.ResponseWriter, err error) {
+	writeDetail(w, ErrorStatus(err), err.Error())
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+var testTableErrorStatus = []struct {
+	err         error
+	description string
+	expected    int
+}{
+	{sentrydsn.ErrMissingUser, "missing key", http.StatusBadRequest},
+	{sentrydsn.ErrMissingProjectID, "bad project path", http.StatusNotFound},
+	{ErrBodyTooLarge, "too large", http.StatusRequestEntityTooLarge},
+	{sentrydsn.ErrAuthHeaderTooLarge, "auth header too large", http.StatusRequestHeaderFieldsTooLarge},
+	{sentrydsn.ErrContentType, "content type", http.StatusUnsupportedMediaType},
+	{sentrydsn.ErrMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed},
+	{sentrydsn.ErrUntrustedHost, "untrusted host", http.StatusForbidden},
+	{sentrydsn.ErrEndpointNotAllowed, "endpoint not allowed", http.StatusForbidden},
+	{ErrBlocked, "blocked client", http.StatusForbidden},
+	{sentrydsn.ErrInvalidRelaySignature, "bad relay signature", http.StatusUnauthorized},
+	{sentrydsn.ErrBodyUnavailable, "consumed body", http.StatusInternalServerError},
+	{ErrReadTimeout, "slow client", http.StatusRequestTimeout},
+	{fmt.Errorf("wrapped: %w", sentrydsn.ErrMissingProjectID), "wrapped error", http.StatusNotFound},
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, test := range testTableErrorStatus {
+		w := httptest.NewRecorder()
+		WriteError(w, test.err)
+		var body map[string]string
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, w.Code)
+		}
+		if body["detail"] != test.err.Error() || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, body)
+		}
+	}
+}
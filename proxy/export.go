@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// ExportFormat is an encoding Stats.Export writes.
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportJSON ExportFormat = "json"
+)
+
+// Usage is the number of requests a project sent to an endpoint over an export range.
+type Usage struct {
+	ProjectID string                 `json:"project_id"`
+	Endpoint  sentrydsn.EndpointType `json:"endpoint"`
+	Received  int64                  `json:"received"`
+}
+
+// Usage returns the requests received per project and endpoint between from and to, sorted by project
+// then endpoint. Counts are kept by the hour for 31 days: a bucket is included when its hour starts in
+// [from, to), so a from inside an hour leaves that hour out, and a zero from or to leaves that side of the
+// range open.
+func (s *Stats) Usage(from, to time.Time) []Usage {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type key struct {
+		projectID string
+		endpoint  sentrydsn.EndpointType
+	}
+	sums := map[key]int64{}
+	for k, n := range s.usage {
+		if !from.IsZero() && k.hour < from.Unix() {
+			continue
+		}
+		if !to.IsZero() && k.hour >= to.Unix() {
+			continue
+		}
+		sums[key{k.projectID, k.endpoint}] += n
+	}
+
+	out := make([]Usage, 0, len(sums))
+	for k, n := range sums {
+		out = append(out, Usage{k.projectID, k.endpoint, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProjectID != out[j].ProjectID {
+			return out[i].ProjectID < out[j].ProjectID
+		}
+		return out[i].Endpoint < out[j].Endpoint
+	})
+	return out
+}
+
+// Export writes Usage(from, to) to w as a report: CSV with a project_id,endpoint,received header,
+// or a JSON object holding the range and the rows.
+func (s *Stats) Export(w io.Writer, format ExportFormat, from, to time.Time) error {
+
+	usage := s.Usage(from, to)
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"project_id", "endpoint", "received"})
+		for _, u := range usage {
+			cw.Write([]string{u.ProjectID, string(u.Endpoint), strconv.FormatInt(u.Received, 10)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case ExportJSON:
+		report := struct {
+			From  *time.Time `json:"from,omitempty"`
+			To    *time.Time `json:"to,omitempty"`
+			Usage []Usage    `json:"usage"`
+		}{Usage: usage}
+		if !from.IsZero() {
+			report.From = &from
+		}
+		if !to.IsZero() {
+			report.To = &to
+		}
+		return json.NewEncoder(w).Encode(report)
+	}
+	return fmt.Errorf("sentry:  unknown export format %q", format)
+}
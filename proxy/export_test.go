@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+//setup
+
+func exportStats() *Stats {
+
+	start := time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)
+	now := start
+	s := &Stats{Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	receive := func(projectID string, endpoint sentrydsn.EndpointType, n int) {
+		for i := 0; i < n; i++ {
+			s.receive(&sentrydsn.DSN{ProjectID: projectID, Endpoint: endpoint})
+		}
+	}
+	receive("1234", sentrydsn.EndpointEnvelope, 3)
+	receive("1234", sentrydsn.EndpointStore, 1)
+	now = start.Add(2 * time.Hour)
+	receive("1234", sentrydsn.EndpointEnvelope, 2)
+	receive("42", sentrydsn.EndpointMinidump, 1)
+	return s
+}
+
+var testTableExport = []struct {
+	from, to    time.Time
+	description string
+	expected    string
+}{
+	{time.Time{}, time.Time{}, "open range",
+		"project_id,endpoint,received\n1234,envelope,5\n1234,store,1\n42,minidump,1\n"},
+	{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC), "first hour",
+		"project_id,endpoint,received\n1234,envelope,3\n1234,store,1\n"},
+	{time.Date(2024, 5, 1, 11, 30, 0, 0, time.UTC), time.Time{}, "from mid hour",
+		"project_id,endpoint,received\n1234,envelope,2\n42,minidump,1\n"},
+	{time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), time.Time{}, "hour starting before from left out",
+		"project_id,endpoint,received\n1234,envelope,2\n42,minidump,1\n"},
+	{time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Time{}, "empty range",
+		"project_id,endpoint,received\n"},
+}
+
+//tests
+
+func TestExportCSV(t *testing.T) {
+	s := exportStats()
+	for _, test := range testTableExport {
+		var b bytes.Buffer
+		if err := s.Export(&b, ExportCSV, test.from, test.to); err != nil || b.String() != test.expected {
+			t.Errorf("%s: Expected -- %q -- Got %q %v", test.description, test.expected, b.String(), err)
+		}
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	s := exportStats()
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	if err := s.Export(&b, ExportJSON, from, time.Time{}); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	var got struct {
+		From  time.Time  `json:"from"`
+		To    *time.Time `json:"to"`
+		Usage []Usage    `json:"usage"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if !got.From.Equal(from) || got.To != nil || len(got.Usage) != 2 || got.Usage[0] != (Usage{"1234", sentrydsn.EndpointEnvelope, 2}) {
+		t.Errorf("Expected -- 2 rows from %v -- Got %s", from, b.String())
+	}
+
+	if err := s.Export(&b, "xml", time.Time{}, time.Time{}); err == nil {
+		t.Errorf("Expected -- unknown export format -- Got nil")
+	}
+}
+
+func TestUsageRetention(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := &Stats{Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	s.receive(&sentrydsn.DSN{ProjectID: "1234", Endpoint: sentrydsn.EndpointEnvelope})
+	now = now.Add(usageRetention + 2*time.Hour)
+	s.receive(&sentrydsn.DSN{ProjectID: "1234", Endpoint: sentrydsn.EndpointEnvelope})
+
+	if got := s.Usage(time.Time{}, time.Time{}); len(got) != 1 || got[0].Received != 1 {
+		t.Errorf("Expected -- 1 request kept -- Got %+v", got)
+	}
+	if got := s.Snapshot()["1234"].Received; got != 2 {
+		t.Errorf("Expected -- 2 -- Got %d", got)
+	}
+}
+
+func TestLocations(t *testing.T) {
+	s := &Stats{}
+	de := &sentrydsn.Geo{Country: "DE", ASN: 3320}
+	us := &sentrydsn.Geo{Country: "US", ASN: 7922}
+	for _, d := range []*sentrydsn.DSN{
+		{ProjectID: "1234", PublicKey: "a", Geo: us},
+		{ProjectID: "1234", PublicKey: "a", Geo: de},
+		{ProjectID: "1234", PublicKey: "a", Geo: de},
+		{ProjectID: "1234", PublicKey: "b", Geo: us},
+		{ProjectID: "1234", PublicKey: "b"},
+	} {
+		s.receive(d)
+	}
+	expected := []KeyLocation{{"a", "DE", 3320, 2}, {"a", "US", 7922, 1}, {"b", "US", 7922, 1}}
+	got := s.Locations()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected -- %v -- Got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected -- %v -- Got %v", expected, got)
+		}
+	}
+}
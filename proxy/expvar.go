@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"expvar"
+)
+
+// PublishExpvar publishes the tunnel's parse counts, parse errors by kind, deprecation warnings, per-project counters,
+// queue depth and spool depth under name, so monitoring that scrapes /debug/vars picks the relay up.
+// The values are computed on every read. Like expvar.Publish it panics if name is already in use.
+func PublishExpvar(name string, t *Tunnel) {
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		out := map[string]interface{}{}
+		if t.Stats != nil {
+			parsed, errs := t.Stats.Parses()
+			out["parsed"] = parsed
+			out["parse_errors"] = errs
+			out["warnings"] = t.Stats.Warnings()
+			out["locations"] = t.Stats.Locations()
+			out["projects"] = t.Stats.Snapshot()
+		}
+		if t.Queue != nil {
+			out["queue_depth"] = t.Queue.Len()
+			out["queue_dropped"] = t.Queue.Dropped()
+		}
+		if t.Spool != nil {
+			entries, bytes := t.Spool.Stats()
+			out["spool_entries"] = entries
+			out["spool_bytes"] = bytes
+		}
+		return out
+	}))
+}
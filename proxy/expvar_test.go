@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Stats: &Stats{}}
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	tunnel.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/", nil))
+	tunnel.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/?sentry_key="+testKey, nil))
+
+	PublishExpvar("sentrydsn_test", tunnel)
+	var got struct {
+		Parsed      int64            `json:"parsed"`
+		ParseErrors map[string]int64 `json:"parse_errors"`
+		Warnings    map[string]int64 `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("sentrydsn_test").String()), &got); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if got.Parsed != 3 || got.ParseErrors["missing_user"] != 1 || got.Warnings["query_string_auth"] != 1 {
+		t.Errorf("Expected -- 3 parsed 1 missing_user 1 query_string_auth -- Got %+v", got)
+	}
+	if p := tunnel.Stats.Snapshot()["1234"]; p.Deprecated != 1 {
+		t.Errorf("Expected -- 1 deprecated -- Got %+v", p)
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync/atomic"
+)
+
+// Integrity is the evidence Forwarder.Integrity collects about one forwarded body, for chasing events lost
+// between the tunnel and Sentry: a digest both sides can compare and the byte counts along the way.
+type Integrity struct {
+	SHA256        string `json:"sha256"`         //hex digest of the body handed to the forwarder
+	ContentLength int64  `json:"content_length"` //announced by the client, -1 if unknown, 0 for jobs not from a request
+	Received      int64  `json:"received"`       //body bytes read from the client
+	Body          int64  `json:"body"`           //body bytes to forward, fewer than Received when Policies removed items
+	Sent          int64  `json:"sent"`           //body bytes the transport read to send upstream
+}
+
+// Truncated reports whether bytes went missing: the client sent less than it announced, or the transport
+// sent less than the body to forward.
+func (i *Integrity) Truncated() bool {
+	return (i.ContentLength > 0 && i.Received != i.ContentLength) || i.Sent < i.Body
+}
+
+// newIntegrity digests the body of j.
+func newIntegrity(j *Job) *Integrity {
+
+	sum := sha256.Sum256(j.Body)
+	return &Integrity{SHA256: hex.EncodeToString(sum[:]), ContentLength: j.ContentLength, Received: j.Received, Body: int64(len(j.Body))}
+}
+
+// countingReader counts the bytes read through it; the transport reads from its own goroutine.
+type countingReader struct {
+	io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+
+	n, err := c.Reader.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//setup
+
+// halfTransport reads half of each request body, as a connection dropped midway would, and answers 200
+type halfTransport struct{}
+
+func (halfTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	io.CopyN(io.Discard, r.Body, r.ContentLength/2)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Request: r}, nil
+}
+
+const testIntegrityBody = `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc"}` + "\n"
+
+var testTableIntegrity = []struct {
+	job         *Job
+	client      *http.Client
+	description string
+	truncated   bool
+}{
+	{&Job{ContentLength: int64(len(testIntegrityBody)), Received: int64(len(testIntegrityBody))}, nil, "intact", false},
+	{&Job{ContentLength: 100, Received: int64(len(testIntegrityBody))}, nil, "client sent less than announced", true},
+	{&Job{ContentLength: -1, Received: int64(len(testIntegrityBody))}, nil, "chunked client request", false},
+	{&Job{}, &http.Client{Transport: halfTransport{}}, "transport sent half", true},
+}
+
+//tests
+
+func TestForwardIntegrity(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	sum := sha256.Sum256([]byte(testIntegrityBody))
+	for _, test := range testTableIntegrity {
+		var got *Integrity
+		f := &Forwarder{Client: test.client, Integrity: true, OnForwardResult: func(r ForwardResult) { got = r.Integrity }}
+		j := test.job
+		j.Method, j.URL, j.Body = http.MethodPost, up.URL+"/api/1234/envelope/", []byte(testIntegrityBody)
+		resp, err := f.Forward(context.Background(), j)
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %v", test.description, err)
+		}
+		resp.Body.Close()
+		if got == nil || got.SHA256 != hex.EncodeToString(sum[:]) || got.Body != int64(len(testIntegrityBody)) {
+			t.Errorf("%s: Expected -- digest of the body -- Got %+v", test.description, got)
+			continue
+		}
+		if got.Truncated() != test.truncated {
+			t.Errorf("%s: Expected -- %v -- Got %+v", test.description, test.truncated, got)
+		}
+	}
+}
+
+func TestTunnelIntegrity(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	var got *Integrity
+	tunnel := &Tunnel{Upstream: up.URL, Forwarder: &Forwarder{Integrity: true, OnForwardResult: func(r ForwardResult) { got = r.Integrity }}}
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", testIntegrityBody))
+	n := int64(len(testIntegrityBody))
+	if got == nil || got.ContentLength != n || got.Received != n || got.Sent != n || got.Truncated() {
+		t.Errorf("Expected -- %d bytes all the way -- Got %+v", n, got)
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/envelope"
+	"github.com/sentry-demos/sentrydsn/sample"
+)
+
+// ItemPolicy is what the tunnel does with the envelope items of one data category before forwarding them.
+// Replays are the usual candidate: their recordings dominate the bandwidth of most tunnels. The "profile"
+// policy covers continuous profiling chunks as well as transaction profiles, and also applies to whole
+// requests addressed to the profile endpoint.
+type ItemPolicy struct {
+	Drop bool //drop every item of the category
+	// Sampler keeps a share of the items by project. Decisions use the envelope event ID, which replay
+	// envelopes set to the replay ID, so all segments of a replay are kept or dropped together.
+	Sampler *sample.Sampler
+	MaxSize int64 //drop items whose payload is larger; 0 for no limit
+
+	paused atomic.Bool
+}
+
+// Pause drops every item of the category until Resume, whatever the other fields say. Unlike the fields it
+// may be called while the tunnel serves, e.g. to shed profiles during an incident without touching errors.
+func (p *ItemPolicy) Pause() {
+	p.paused.Store(true)
+}
+
+// Resume undoes Pause.
+func (p *ItemPolicy) Resume() {
+	p.paused.Store(false)
+}
+
+// Paused reports whether the category is paused.
+func (p *ItemPolicy) Paused() bool {
+	return p.paused.Load()
+}
+
+func (p *ItemPolicy) dropping() bool {
+	return p.Drop || p.Paused()
+}
+
+// filter applies Tunnel.Policies and Tunnel.Sampler to j and reports whether anything is left to forward. In
+// Shadow mode j is left as it is and only counted when they would have discarded part of it.
+func (t *Tunnel) filter(j *Job) bool {
+
+	if t.Shadow {
+		shadow := *j
+		if _, outcomes := t.applyPolicies(&shadow); outcomes != nil {
+			t.Stats.shadow(j.DSN, shadowFiltered)
+		}
+		return true
+	}
+	keep, outcomes := t.applyPolicies(j)
+	if outcomes == nil {
+		return keep
+	}
+	t.Stats.add(j.DSN.ProjectID, func(p *ProjectStats) { p.Filtered += int64(outcomes.Dropped) })
+	t.ClientReports.discard(j, outcomes.Discarded)
+	return keep
+}
+
+// applyPolicies rewrites the body of envelope jobs according to Tunnel.Policies and Tunnel.Sampler, reports
+// whether anything is left to forward and what was discarded, nil when nothing was. Compressed or unparsable
+// envelopes are forwarded untouched.
+func (t *Tunnel) applyPolicies(j *Job) (bool, *envelope.Outcomes) {
+
+	if len(t.Policies) == 0 && t.Sampler == nil {
+		return true, nil
+	}
+	if j.DSN.Endpoint == sentrydsn.EndpointProfile {
+		return t.applyProfilePolicy(j)
+	}
+	if !isEnvelope(j) || len(j.Header.Get("Content-Encoding")) > 0 {
+		return true, nil
+	}
+	f := &envelope.Filter{Keep: func(h *envelope.Header, ih *envelope.ItemHeader) bool {
+		category := policyCategory(ih.Type)
+		if p := t.Policies[category]; p != nil && p.Sampler != nil && !p.Sampler.Keep(j.DSN.ProjectID, category, h.EventID) {
+			return false
+		}
+		return t.Sampler == nil || t.Sampler.KeepTrace(j.DSN.ProjectID, envelope.Category(ih.Type), sample.TraceIDFromEnvelope(h), h.EventID)
+	}}
+	for category, p := range t.Policies {
+		if !p.dropping() && p.MaxSize <= 0 {
+			continue
+		}
+		var maxSize int64
+		if !p.dropping() {
+			maxSize = p.MaxSize
+		}
+		f.Rules = append(f.Rules, envelope.Rule{Category: category, MaxSize: maxSize})
+		if category == "profile" {
+			//profile chunks have a data category of their own
+			f.Rules = append(f.Rules, envelope.Rule{Type: "profile_chunk", MaxSize: maxSize})
+		}
+	}
+
+	var out bytes.Buffer
+	outcomes, err := f.Apply(&out, bytes.NewReader(j.Body))
+	if err != nil || outcomes.Dropped == 0 {
+		return true, nil
+	}
+	j.Body = out.Bytes()
+	items, err := envelope.Sizes(bytes.NewReader(j.Body), envelope.Limits{})
+	return err != nil || len(items) > 0, outcomes
+}
+
+// policyCategory returns the key of the policy in Tunnel.Policies applying to items of itemType.
+func policyCategory(itemType string) string {
+
+	if envelope.IsProfile(itemType) {
+		return "profile"
+	}
+	return envelope.Category(itemType)
+}
+
+// applyProfilePolicy applies the "profile" policy to a request addressed to the profile endpoint as a whole.
+// Such requests carry no event ID, so sampling them is random.
+func (t *Tunnel) applyProfilePolicy(j *Job) (bool, *envelope.Outcomes) {
+
+	p := t.Policies["profile"]
+	if p == nil {
+		return true, nil
+	}
+	reason := envelope.ReasonFiltered
+	keep := !p.dropping() && (p.MaxSize <= 0 || int64(len(j.Body)) <= p.MaxSize)
+	if keep && p.Sampler != nil && !p.Sampler.Keep(j.DSN.ProjectID, "profile", "") {
+		keep, reason = false, envelope.ReasonSampled
+	}
+	if keep {
+		return true, nil
+	}
+	discarded := []envelope.DiscardedEvent{{Reason: reason, Category: "profile", Quantity: 1}}
+	return false, &envelope.Outcomes{Discarded: discarded, Dropped: 1, DroppedBytes: int64(len(j.Body))}
+}
+
+// isEnvelope reports whether j goes to the envelope endpoint, including bodies posted to a custom tunnel
+// route, whose DSN carries no endpoint.
+func isEnvelope(j *Job) bool {
+
+	if j.DSN.Endpoint == sentrydsn.EndpointEnvelope {
+		return true
+	}
+	u, err := url.Parse(j.URL)
+	return len(j.DSN.Endpoint) == 0 && err == nil && strings.HasSuffix(u.Path, "/envelope/")
+}
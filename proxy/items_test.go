@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/sample"
+)
+
+//setup
+
+const testReplayEnvelope = `{"event_id":"36b75d9fa11f45459412a96c41bdf691"}
+{"type":"event"}
+{"message":"hello world"}
+{"type":"replay_event"}
+{"replay_id":"36b75d9fa11f45459412a96c41bdf691","segment_id":0}
+{"type":"replay_recording","length":19}
+{"segment_id":0}
+[]
+`
+
+var testTablePolicies = []struct {
+	policies    map[string]*ItemPolicy
+	description string
+	forwarded   []string //item types reaching upstream, nil when nothing is forwarded
+	filtered    int64
+}{
+	{nil, "no policies", []string{`"type":"event"`, `"type":"replay_event"`, `"type":"replay_recording"`}, 0},
+	{map[string]*ItemPolicy{"replay": {Drop: true}}, "drop replays", []string{`"type":"event"`}, 2},
+	{map[string]*ItemPolicy{"replay": {MaxSize: 40}}, "size cap", []string{`"type":"event"`, `"type":"replay_recording"`}, 1},
+	{map[string]*ItemPolicy{"replay": {Sampler: &sample.Sampler{Rules: []sample.Rule{{Rate: 0}}}}}, "sample out", []string{`"type":"event"`}, 2},
+	{map[string]*ItemPolicy{"replay": {Sampler: &sample.Sampler{Rules: []sample.Rule{{ProjectID: "7", Rate: 0}}}}}, "sample other project", []string{`"type":"replay_recording"`}, 0},
+	{map[string]*ItemPolicy{"replay": {Drop: true}, "error": {Drop: true}}, "drop everything", nil, 3},
+}
+
+const testTraceID = "771a43a4192642f0b136d5159a501700"
+
+// traceEnvelope returns an envelope with one item of itemType in the trace traceID
+func traceEnvelope(traceID string, eventID string, itemType string) string {
+	return `{"event_id":"` + eventID + `","trace":{"trace_id":"` + traceID + `","public_key":"` + testKey + `"}}
+{"type":"` + itemType + `"}
+{}
+`
+}
+
+var testTableTunnelSampler = []struct {
+	rules       []sample.Rule
+	description string
+	forwarded   bool
+}{
+	{nil, "no rules", true},
+	{[]sample.Rule{{Rate: 1}}, "keep all", true},
+	{[]sample.Rule{{Rate: 0}}, "drop all", false},
+	{[]sample.Rule{{ProjectID: "7", Rate: 0}}, "other project", true},
+	{[]sample.Rule{{Category: "transaction", Rate: 0}}, "other category", true},
+	{[]sample.Rule{{ProjectID: "1234", Category: "error", Rate: 0}}, "project and category", false},
+}
+
+//tests
+
+func TestTunnelPolicies(t *testing.T) {
+	for _, test := range testTablePolicies {
+		up := newUpstream(http.StatusOK)
+		stats := &Stats{}
+		tunnel := &Tunnel{Upstream: up.URL, Policies: test.policies, Stats: stats}
+
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", testReplayEnvelope))
+		up.Close()
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expected -- %d -- Got %d", test.description, http.StatusOK, w.Code)
+		}
+		got := up.requests()
+		if test.forwarded == nil && len(got) != 0 {
+			t.Errorf("%s: Expected -- nothing forwarded -- Got %v", test.description, got)
+		}
+		if test.forwarded != nil {
+			if len(got) != 1 {
+				t.Fatalf("%s: Expected -- 1 request -- Got %v", test.description, got)
+			}
+			for _, item := range test.forwarded {
+				if !strings.Contains(got[0].body, item) {
+					t.Errorf("%s: Expected -- %s -- Got %s", test.description, item, got[0].body)
+				}
+			}
+		}
+		if filtered := stats.Snapshot()["1234"].Filtered; filtered != test.filtered {
+			t.Errorf("%s: Expected -- %d -- Got %d", test.description, test.filtered, filtered)
+		}
+	}
+}
+
+func TestTunnelPoliciesSkipsOtherBodies(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Policies: map[string]*ItemPolicy{"replay": {Drop: true}}}
+
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", "not an envelope")
+	tunnel.ServeHTTP(httptest.NewRecorder(), r)
+	r = ingestRequest("https://relay.example.com/api/1234/envelope/", testReplayEnvelope)
+	r.Header.Set("Content-Encoding", "gzip")
+	tunnel.ServeHTTP(httptest.NewRecorder(), r)
+	got := up.requests()
+	if len(got) != 2 || got[0].body != "not an envelope" || got[1].body != testReplayEnvelope {
+		t.Errorf("Expected -- bodies untouched -- Got %v", got)
+	}
+}
+
+func TestTunnelPauseProfiles(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	profiles := &ItemPolicy{}
+	tunnel := &Tunnel{Upstream: up.URL, Policies: map[string]*ItemPolicy{"profile": profiles}}
+	body := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc"}
+{"type":"event"}
+{"message":"hello world"}
+{"type":"profile"}
+{"version":"1"}
+{"type":"profile_chunk"}
+{"version":"2"}
+`
+
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", body))
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/profile/", `{"version":"1"}`))
+	profiles.Pause()
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", body))
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/profile/", `{"version":"1"}`))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+	}
+	profiles.Resume()
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/profile/", `{"version":"1"}`))
+
+	got := up.requests()
+	if len(got) != 4 {
+		t.Fatalf("Expected -- 4 requests -- Got %v", got)
+	}
+	if got[0].body != body || got[1].url != "/api/1234/profile/" || got[3].url != "/api/1234/profile/" {
+		t.Errorf("Expected -- untouched before pause -- Got %v", got)
+	}
+	if strings.Contains(got[2].body, `"type":"profile`) || !strings.Contains(got[2].body, `"type":"event"`) {
+		t.Errorf("Expected -- errors only while paused -- Got %s", got[2].body)
+	}
+}
+
+func TestTunnelShadow(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	stats := &Stats{}
+	guard := &AbuseGuard{Threshold: 1, Block: time.Minute}
+	guard.Fail(netip.MustParseAddr("203.0.113.7"))
+	tunnel := &Tunnel{Upstream: up.URL, Stats: stats, Abuse: guard, Shadow: true,
+		AllowedHosts: sentrydsn.HostAllowlist{"sentry.example.com"},
+		Policies:     map[string]*ItemPolicy{"replay": {Drop: true}}}
+
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", testReplayEnvelope)
+	r.RemoteAddr = "203.0.113.7:4711"
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+	}
+	if got := up.requests(); len(got) != 1 || got[0].body != testReplayEnvelope {
+		t.Errorf("Expected -- the envelope forwarded untouched -- Got %v", got)
+	}
+	var decisions []string
+	for _, o := range stats.Shadowed() {
+		decisions = append(decisions, o.Outcome)
+	}
+	if strings.Join(decisions, " ") != "blocked filtered untrusted_host" {
+		t.Errorf("Expected -- blocked filtered untrusted_host -- Got %v", decisions)
+	}
+	if p := stats.Snapshot()["1234"]; p.Filtered != 0 {
+		t.Errorf("Expected -- nothing filtered -- Got %+v", p)
+	}
+}
+
+func TestTunnelSampler(t *testing.T) {
+	for _, test := range testTableTunnelSampler {
+		up := newUpstream(http.StatusOK)
+		stats := &Stats{}
+		tunnel := &Tunnel{Upstream: up.URL, Sampler: &sample.Sampler{Rules: test.rules}, Stats: stats}
+
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", traceEnvelope(testTraceID, "9ec79c33ec9942ab8353589fcb2e04dc", "event")))
+		up.Close()
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expected -- %d -- Got %d", test.description, http.StatusOK, w.Code)
+		}
+		if got := len(up.requests()) == 1; got != test.forwarded {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.forwarded, got)
+		}
+		if filtered := stats.Snapshot()["1234"].Filtered; (filtered == 0) != test.forwarded {
+			t.Errorf("%s: Expected -- %v -- Got %d filtered", test.description, test.forwarded, filtered)
+		}
+	}
+}
+
+func TestTunnelSamplerKeepsTracesTogether(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Sampler: &sample.Sampler{Rules: []sample.Rule{{Rate: 0.5}}}}
+
+	for i := 0; i < 100; i++ {
+		traceID := fmt.Sprintf("%032x", i)
+		tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", traceEnvelope(traceID, fmt.Sprintf("%032x", i+1), "event")))
+		tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", traceEnvelope(traceID, fmt.Sprintf("%032x", i+2), "transaction")))
+	}
+	forwarded := map[string]int{}
+	for _, r := range up.requests() {
+		forwarded[r.body[strings.Index(r.body, `"trace_id":"`)+12:][:32]]++
+	}
+	for traceID, n := range forwarded {
+		if n != 2 {
+			t.Errorf("%s: Expected -- %d -- Got %d", traceID, 2, n)
+		}
+	}
+	if len(forwarded) == 0 || len(forwarded) == 100 {
+		t.Errorf("Expected -- some traces sampled -- Got %d of 100 kept", len(forwarded))
+	}
+}
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// defaults applied when the RateLimit, Quota and MemoryCounter fields are unset
+const (
+	defaultRateWindow  = time.Second
+	defaultQuotaPeriod = 24 * time.Hour
+	defaultCounterKeys = 100000
+)
+
+// prefixes of the keys RateLimit and Quota count under
+const (
+	rateLimitPrefix = "sentrydsn:rate:"
+	quotaPrefix     = "sentrydsn:quota:"
+)
+
+// Counter counts requests per key for RateLimit and Quota. A Counter kept in the process counts each tunnel
+// instance on its own, so a fleet of N tunnels admits N times the limit; share one between the fleet, e.g. the
+// redis module's Store, to enforce a single limit.
+type Counter interface {
+	// Incr adds one to the count under key, which expires ttl after its first hit, and returns the new count.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// MemoryCounter is a Counter kept in the process. Keys are client supplied, so it holds at most MaxKeys
+// unexpired keys; beyond that the window started longest ago is forgotten to make room, and its key counts
+// from zero again. It is safe for concurrent use.
+type MemoryCounter struct {
+	MaxKeys int             //unexpired keys kept, defaults to 100000
+	Clock   sentrydsn.Clock //tells the time for expiry, the system clock when nil
+
+	mu     sync.Mutex
+	counts map[string]*memoryCount
+	order  []*memoryCount //windows oldest first, including ones since replaced or swept
+	swept  time.Time
+}
+
+type memoryCount struct {
+	key     string
+	n       int64
+	expires time.Time
+}
+
+// Incr implements Counter.
+func (c *MemoryCounter) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+
+	maxKeys := c.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultCounterKeys
+	}
+	now := sentrydsn.Now(c.Clock)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = map[string]*memoryCount{}
+	}
+	e, ok := c.counts[key]
+	if !ok && len(c.counts) >= maxKeys {
+		c.sweep(now)
+		if len(c.counts) >= maxKeys {
+			c.evict()
+		}
+	}
+	if !ok || !now.Before(e.expires) {
+		e = &memoryCount{key: key, expires: now.Add(ttl)}
+		c.counts[key] = e
+		c.order = append(c.order, e)
+		if len(c.order) > 2*len(c.counts) {
+			c.compact()
+		}
+	}
+	e.n++
+	return e.n, nil
+}
+
+// evict forgets the oldest window still counted; c.mu must be held.
+func (c *MemoryCounter) evict() {
+
+	for len(c.order) > 0 {
+		e := c.order[0]
+		c.order[0] = nil
+		c.order = c.order[1:]
+		if c.counts[e.key] == e {
+			delete(c.counts, e.key)
+			return
+		}
+	}
+}
+
+// compact drops replaced and swept windows from c.order; c.mu must be held.
+func (c *MemoryCounter) compact() {
+
+	order := make([]*memoryCount, 0, len(c.counts))
+	for _, e := range c.order {
+		if c.counts[e.key] == e {
+			order = append(order, e)
+		}
+	}
+	c.order = order
+}
+
+// sweep drops expired keys, at most once a second; c.mu must be held.
+func (c *MemoryCounter) sweep(now time.Time) {
+
+	if now.Sub(c.swept) < time.Second {
+		return
+	}
+	c.swept = now
+	for key, e := range c.counts {
+		if !now.Before(e.expires) {
+			delete(c.counts, key)
+		}
+	}
+}
+
+// RateLimit caps the requests each public key may send per Window; the tunnel answers the rest with 429 and a
+// Retry-After until the window ends, so SDKs back off. Windows are fixed and aligned to the clock, so every
+// instance sharing a Counter counts the same windows. A Counter error lets the request through and is passed to
+// OnError, so an unreachable Redis does not stop ingest. A RateLimit is safe for concurrent use.
+type RateLimit struct {
+	Limit   int64           //requests per public key and Window, none when zero
+	Window  time.Duration   //defaults to a second
+	Counter Counter         //where requests are counted, a MemoryCounter when nil
+	OnError func(err error) //called with Counter errors when set
+	Clock   sentrydsn.Clock //tells the time for windows, the system clock when nil
+
+	once  sync.Once
+	local Counter
+}
+
+// allow counts a request for dsn and returns whether it is within the limit, and if not how long until it is.
+func (l *RateLimit) allow(ctx context.Context, dsn *sentrydsn.DSN) (bool, time.Duration) {
+
+	if l == nil || l.Limit <= 0 {
+		return true, 0
+	}
+	l.once.Do(func() {
+		l.local = l.Counter
+		if l.local == nil {
+			l.local = &MemoryCounter{Clock: l.Clock}
+		}
+	})
+	window := l.Window
+	if window <= 0 {
+		window = defaultRateWindow
+	}
+	return count(ctx, l.local, rateLimitPrefix+dsn.PublicKey, l.Limit, window, sentrydsn.Now(l.Clock), l.OnError)
+}
+
+// Quota caps the requests each project may send per Period, e.g. a daily budget, answering the rest with 429
+// and a Retry-After until the period ends. Periods are fixed and aligned to the clock, midnight UTC for the
+// default day. Like RateLimit, a fleet enforces one quota only when it shares a Counter, and Counter errors let
+// requests through. A Quota is safe for concurrent use.
+type Quota struct {
+	Limits  map[string]int64 //requests per Period by project ID
+	Default int64            //for projects not in Limits, none when zero
+	Period  time.Duration    //defaults to a day
+	Counter Counter          //where requests are counted, a MemoryCounter when nil
+	OnError func(err error)  //called with Counter errors when set
+	Clock   sentrydsn.Clock  //tells the time for periods, the system clock when nil
+
+	once  sync.Once
+	local Counter
+}
+
+// allow counts a request for dsn and returns whether it is within its project's quota, and if not how long
+// until it is.
+func (q *Quota) allow(ctx context.Context, dsn *sentrydsn.DSN) (bool, time.Duration) {
+
+	if q == nil {
+		return true, 0
+	}
+	limit, ok := q.Limits[dsn.ProjectID]
+	if !ok {
+		limit = q.Default
+	}
+	if limit <= 0 {
+		return true, 0
+	}
+	q.once.Do(func() {
+		q.local = q.Counter
+		if q.local == nil {
+			q.local = &MemoryCounter{Clock: q.Clock}
+		}
+	})
+	period := q.Period
+	if period <= 0 {
+		period = defaultQuotaPeriod
+	}
+	return count(ctx, q.local, quotaPrefix+dsn.ProjectID, limit, period, sentrydsn.Now(q.Clock), q.OnError)
+}
+
+// count adds a request to key's count in the window of length d around now and returns whether it is within
+// limit, and if not the time left in the window. Counter errors allow the request.
+func count(ctx context.Context, c Counter, key string, limit int64, d time.Duration, now time.Time, onError func(error)) (bool, time.Duration) {
+
+	start := now.Truncate(d)
+	n, err := c.Incr(ctx, key+":"+strconv.FormatInt(start.Unix(), 10), d)
+	if err != nil {
+		if onError != nil {
+			onError(err)
+		}
+		return true, 0
+	}
+	if n <= limit {
+		return true, 0
+	}
+	return false, start.Add(d).Sub(now)
+}
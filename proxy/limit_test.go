@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// failingCounter is a Counter whose store is unreachable
+type failingCounter struct{}
+
+func (failingCounter) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+//tests
+
+func TestRateLimit(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 500*int(time.Millisecond), time.UTC)
+	clock := sentrydsn.ClockFunc(func() time.Time { return now })
+	stats := &Stats{}
+	tunnel := &Tunnel{Upstream: up.URL, RateLimit: &RateLimit{Limit: 2, Window: time.Minute, Clock: clock}, Stats: stats}
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := send(); w.Code != http.StatusOK {
+			t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+		}
+	}
+	w := send()
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusTooManyRequests, w.Code)
+	}
+	//the window started at 10:00:00
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected -- 60 -- Got %v", got)
+	}
+	if got := len(up.requests()); got != 2 {
+		t.Errorf("Expected -- 2 forwarded -- Got %d", got)
+	}
+	outcomes := stats.Outcomes()
+	if len(outcomes) != 2 || outcomes[1].Outcome != outcomeRateLimited || outcomes[1].Count != 1 {
+		t.Errorf("Expected -- one rate_limited outcome -- Got %+v", outcomes)
+	}
+
+	now = now.Add(time.Minute)
+	if w := send(); w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d in the next window -- Got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	clock := sentrydsn.ClockFunc(func() time.Time { return now })
+	counter := &MemoryCounter{Clock: clock}
+	quota := &Quota{Limits: map[string]int64{"1234": 1}, Counter: counter, Clock: clock}
+	//two instances sharing a counter enforce one quota
+	first := &Tunnel{Upstream: up.URL, Quota: quota}
+	second := &Tunnel{Upstream: up.URL, Quota: &Quota{Limits: map[string]int64{"1234": 1}, Counter: counter, Clock: clock}}
+
+	w := httptest.NewRecorder()
+	first.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+	}
+	w = httptest.NewRecorder()
+	second.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusTooManyRequests, w.Code)
+	}
+	//until midnight UTC
+	if got := w.Header().Get("Retry-After"); got != "21600" {
+		t.Errorf("Expected -- 21600 -- Got %v", got)
+	}
+	//projects without a limit or Default are not counted
+	w = httptest.NewRecorder()
+	first.ServeHTTP(w, ingestRequest("https://relay.example.com/api/5678/envelope/", "{}\n"))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestRateLimitCounterError(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	var errs []error
+	tunnel := &Tunnel{Upstream: up.URL, RateLimit: &RateLimit{Limit: 1, Counter: failingCounter{},
+		OnError: func(err error) { errs = append(errs, err) }}}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+		}
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected -- 2 errors -- Got %v", errs)
+	}
+}
+
+func TestRateLimitShadow(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	stats := &Stats{}
+	tunnel := &Tunnel{Upstream: up.URL, RateLimit: &RateLimit{Limit: 1, Window: time.Hour}, Stats: stats, Shadow: true}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+		}
+	}
+	shadowed := stats.Shadowed()
+	if len(shadowed) != 1 || shadowed[0].Outcome != shadowRateLimited || shadowed[0].Count != 1 {
+		t.Errorf("Expected -- one rate_limited decision -- Got %+v", shadowed)
+	}
+}
+
+func TestMemoryCounter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := &MemoryCounter{MaxKeys: 2, Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	ctx := context.Background()
+	c.Incr(ctx, "a", time.Minute)
+	if n, _ := c.Incr(ctx, "a", time.Minute); n != 2 {
+		t.Errorf("Expected -- 2 -- Got %d", n)
+	}
+	c.Incr(ctx, "b", time.Second)
+	//expired keys make room
+	now = now.Add(2 * time.Second)
+	if n, err := c.Incr(ctx, "c", time.Minute); n != 1 || err != nil {
+		t.Errorf("Expected -- 1 <nil> -- Got %d %v", n, err)
+	}
+	if n, _ := c.Incr(ctx, "a", time.Minute); n != 3 {
+		t.Errorf("Expected -- 3 -- Got %d", n)
+	}
+	//otherwise the oldest window goes
+	if n, err := c.Incr(ctx, "d", time.Minute); n != 1 || err != nil {
+		t.Errorf("Expected -- 1 <nil> -- Got %d %v", n, err)
+	}
+	if n, _ := c.Incr(ctx, "c", time.Minute); n != 2 {
+		t.Errorf("Expected -- 2 -- Got %d", n)
+	}
+	if n, _ := c.Incr(ctx, "a", time.Minute); n != 1 {
+		t.Errorf("Expected -- 1 -- Got %d", n)
+	}
+}
+
+func TestRateLimitFullCounter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := sentrydsn.ClockFunc(func() time.Time { return now })
+	l := &RateLimit{Limit: 1, Window: time.Minute, Counter: &MemoryCounter{MaxKeys: 100, Clock: clock}, Clock: clock}
+	ctx := context.Background()
+
+	for i := 0; i < 1000; i++ {
+		l.allow(ctx, &sentrydsn.DSN{PublicKey: fmt.Sprintf("%032x", i)})
+	}
+	//a full counter still counts new keys rather than letting them through
+	dsn := &sentrydsn.DSN{PublicKey: testKey}
+	if ok, _ := l.allow(ctx, dsn); !ok {
+		t.Errorf("%s: Expected -- %v -- Got %v", "first request", true, ok)
+	}
+	if ok, _ := l.allow(ctx, dsn); ok {
+		t.Errorf("%s: Expected -- %v -- Got %v", "over the limit", false, ok)
+	}
+	if c := l.Counter.(*MemoryCounter); len(c.counts) != 100 || len(c.order) > 200 {
+		t.Errorf("Expected -- %d keys -- Got %d keys %d windows", 100, len(c.counts), len(c.order))
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// Metrics is an http.Handler serving the tunnel's counters in the Prometheus text exposition format, so a
+// Prometheus server scrapes the relay without a client library compiled in:
+//
+//	sentrydsn_parses_total, sentrydsn_parse_errors_total{kind}
+//	sentrydsn_requests_total{endpoint, project, outcome}
+//	sentrydsn_inbound_bytes_total{endpoint, project}, sentrydsn_forwarded_bytes_total{endpoint, project}
+//	sentrydsn_warnings_total{code}, sentrydsn_shadow_decisions_total{endpoint, project, decision}
+//	sentrydsn_forward_duration_seconds histogram
+//	sentrydsn_queue_depth, sentrydsn_queue_dropped_total, sentrydsn_spool_entries, sentrydsn_spool_bytes
+//	sentrydsn_cache_hits_total, sentrydsn_cache_misses_total, sentrydsn_cache_hit_ratio, ...
+//
+// Request and latency series need Tunnel.Stats.
+type Metrics struct {
+	Tunnel *Tunnel
+	Cache  *sentrydsn.Cache //reports the DSN cache when set, e.g. the tunnel's extractor
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	if t := m.Tunnel; t != nil {
+		if s := t.Stats; s != nil {
+			parsed, errs := s.Parses()
+			metric(bw, "sentrydsn_parses_total", "counter", "DSN extractions attempted.")
+			writeSample(bw, "sentrydsn_parses_total", nil, float64(parsed))
+			metric(bw, "sentrydsn_parse_errors_total", "counter", "DSN extractions failed, by error kind.")
+			kinds := make([]string, 0, len(errs))
+			for k := range errs {
+				kinds = append(kinds, k)
+			}
+			sort.Strings(kinds)
+			for _, k := range kinds {
+				writeSample(bw, "sentrydsn_parse_errors_total", []string{"kind", k}, float64(errs[k]))
+			}
+
+			metric(bw, "sentrydsn_requests_total", "counter", "Accepted requests by endpoint, project and outcome.")
+			for _, o := range s.Outcomes() {
+				writeSample(bw, "sentrydsn_requests_total", []string{"endpoint", string(o.Endpoint), "project", o.ProjectID, "outcome", o.Outcome}, float64(o.Count))
+			}
+
+			bandwidth := s.Bandwidth()
+			metric(bw, "sentrydsn_inbound_bytes_total", "counter", "Request bodies and headers received from clients, by endpoint and project.")
+			for _, b := range bandwidth {
+				writeSample(bw, "sentrydsn_inbound_bytes_total", []string{"endpoint", string(b.Endpoint), "project", b.ProjectID}, float64(b.Inbound))
+			}
+			metric(bw, "sentrydsn_forwarded_bytes_total", "counter", "Request bodies and headers sent upstream, by endpoint and project.")
+			for _, b := range bandwidth {
+				writeSample(bw, "sentrydsn_forwarded_bytes_total", []string{"endpoint", string(b.Endpoint), "project", b.ProjectID}, float64(b.Forwarded))
+			}
+
+			warnings := s.Warnings()
+			metric(bw, "sentrydsn_warnings_total", "counter", "Deprecation and shadow warnings raised for accepted requests, by code.")
+			codes := make([]string, 0, len(warnings))
+			for c := range warnings {
+				codes = append(codes, c)
+			}
+			sort.Strings(codes)
+			for _, c := range codes {
+				writeSample(bw, "sentrydsn_warnings_total", []string{"code", c}, float64(warnings[c]))
+			}
+			metric(bw, "sentrydsn_shadow_decisions_total", "counter", "Refusals and filtering a tunnel in shadow mode did not act on.")
+			for _, o := range s.Shadowed() {
+				writeSample(bw, "sentrydsn_shadow_decisions_total", []string{"endpoint", string(o.Endpoint), "project", o.ProjectID, "decision", o.Outcome}, float64(o.Count))
+			}
+
+			counts, sum, count := s.latencies()
+			metric(bw, "sentrydsn_forward_duration_seconds", "histogram", "Time taken to forward requests upstream.")
+			var cumulative int64
+			for i, bound := range latencyBuckets {
+				cumulative += counts[i]
+				writeSample(bw, "sentrydsn_forward_duration_seconds_bucket", []string{"le", strconv.FormatFloat(bound, 'g', -1, 64)}, float64(cumulative))
+			}
+			writeSample(bw, "sentrydsn_forward_duration_seconds_bucket", []string{"le", "+Inf"}, float64(count))
+			writeSample(bw, "sentrydsn_forward_duration_seconds_sum", nil, sum)
+			writeSample(bw, "sentrydsn_forward_duration_seconds_count", nil, float64(count))
+		}
+		if t.Queue != nil {
+			metric(bw, "sentrydsn_queue_depth", "gauge", "Requests waiting to be forwarded.")
+			writeSample(bw, "sentrydsn_queue_depth", nil, float64(t.Queue.Len()))
+			metric(bw, "sentrydsn_queue_dropped_total", "counter", "Requests dropped because the queue was full.")
+			writeSample(bw, "sentrydsn_queue_dropped_total", nil, float64(t.Queue.Dropped()))
+		}
+		if t.Spool != nil {
+			entries, bytes := t.Spool.Stats()
+			metric(bw, "sentrydsn_spool_entries", "gauge", "Failed forwards waiting for replay.")
+			writeSample(bw, "sentrydsn_spool_entries", nil, float64(entries))
+			metric(bw, "sentrydsn_spool_bytes", "gauge", "Size of the spooled forwards.")
+			writeSample(bw, "sentrydsn_spool_bytes", nil, float64(bytes))
+		}
+	}
+	if m.Cache != nil {
+		cs := m.Cache.Stats()
+		metric(bw, "sentrydsn_cache_hits_total", "counter", "DSN cache lookups answered in memory.")
+		writeSample(bw, "sentrydsn_cache_hits_total", nil, float64(cs.Hits))
+		metric(bw, "sentrydsn_cache_shared_hits_total", "counter", "DSN cache misses answered by the shared tier.")
+		writeSample(bw, "sentrydsn_cache_shared_hits_total", nil, float64(cs.SharedHits))
+		metric(bw, "sentrydsn_cache_misses_total", "counter", "DSN cache lookups that found nothing.")
+		writeSample(bw, "sentrydsn_cache_misses_total", nil, float64(cs.Misses))
+		metric(bw, "sentrydsn_cache_evictions_total", "counter", "DSN cache entries evicted.")
+		writeSample(bw, "sentrydsn_cache_evictions_total", nil, float64(cs.Evictions))
+		metric(bw, "sentrydsn_cache_entries", "gauge", "DSN cache entries held in memory.")
+		writeSample(bw, "sentrydsn_cache_entries", nil, float64(cs.Entries))
+		ratio := 0.0
+		if lookups := cs.Hits + cs.Misses; lookups > 0 {
+			ratio = float64(cs.Hits) / float64(lookups)
+		}
+		metric(bw, "sentrydsn_cache_hit_ratio", "gauge", "Share of DSN cache lookups answered in memory.")
+		writeSample(bw, "sentrydsn_cache_hit_ratio", nil, ratio)
+	}
+}
+
+// metric writes the HELP and TYPE lines introducing a metric family.
+func metric(w *bufio.Writer, name string, typ string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample writes one sample; labels alternate names and values.
+func writeSample(w *bufio.Writer, name string, labels []string, value float64) {
+
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte('\n')
+}
+
+// label values escape backslashes, quotes and newlines
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
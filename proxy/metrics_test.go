@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func TestMetrics(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	cache := &sentrydsn.Cache{}
+	tunnel := &Tunnel{Upstream: up.URL, Stats: &Stats{}, Extractor: cache.Extractor(sentrydsn.ExtractorFunc(sentrydsn.FromRequest))}
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	tunnel.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/", nil))
+
+	w := httptest.NewRecorder()
+	(&Metrics{Tunnel: tunnel, Cache: cache}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected -- text exposition format -- Got %s", ct)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		"# TYPE sentrydsn_requests_total counter\n",
+		"sentrydsn_parses_total 3\n",
+		`sentrydsn_parse_errors_total{kind="missing_user"} 1` + "\n",
+		`sentrydsn_requests_total{endpoint="envelope",project="1234",outcome="forwarded"} 2` + "\n",
+		"# TYPE sentrydsn_forward_duration_seconds histogram\n",
+		`sentrydsn_forward_duration_seconds_bucket{le="+Inf"} 2` + "\n",
+		"sentrydsn_forward_duration_seconds_count 2\n",
+		"sentrydsn_cache_hits_total 1\n",
+		"sentrydsn_cache_misses_total 2\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected -- %q -- Got %s", expected, body)
+		}
+	}
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	s := &Stats{}
+	s.outcome(&sentrydsn.DSN{ProjectID: "a\"b\\c\nd", Endpoint: sentrydsn.EndpointStore}, outcomeFiltered)
+
+	w := httptest.NewRecorder()
+	(&Metrics{Tunnel: &Tunnel{Stats: s}}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `sentrydsn_requests_total{endpoint="store",project="a\"b\\c\nd",outcome="filtered"} 1`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected -- %s -- Got %s", expected, w.Body)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	s := &Server{Tunnel: http.NotFoundHandler(), Metrics: &Metrics{Tunnel: &Tunnel{Stats: &Stats{}}}, MetricsAddr: "127.0.0.1:0"}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	go s.ServeMetrics(l)
+	defer s.Shutdown(context.Background())
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), "sentrydsn_parses_total 0") {
+		t.Errorf("Expected -- metrics -- Got %d %s", resp.StatusCode, b)
+	}
+}
+
+func TestMetricsShadow(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	parser := &sentrydsn.Parser{AllowedEndpoints: []sentrydsn.EndpointType{sentrydsn.EndpointStore}, Shadow: true}
+	tunnel := &Tunnel{Upstream: up.URL, Stats: &Stats{}, Extractor: parser, AllowedHosts: sentrydsn.HostAllowlist{"sentry.example.com"}, Shadow: true}
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+
+	w := httptest.NewRecorder()
+	(&Metrics{Tunnel: tunnel}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, expected := range []string{
+		`sentrydsn_warnings_total{code="shadow_endpoint_not_allowed"} 1` + "\n",
+		`sentrydsn_shadow_decisions_total{endpoint="envelope",project="1234",decision="untrusted_host"} 1` + "\n",
+		`sentrydsn_requests_total{endpoint="envelope",project="1234",outcome="forwarded"} 1` + "\n",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected -- %q -- Got %s", expected, w.Body)
+		}
+	}
+}
+
+func TestMetricsBandwidth(t *testing.T) {
+	tunnel := &Tunnel{Stats: &Stats{}, DisableForwarding: true}
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n")
+	inbound := headerSize(r.Header) + 3
+	tunnel.ServeHTTP(httptest.NewRecorder(), r)
+
+	w := httptest.NewRecorder()
+	(&Metrics{Tunnel: tunnel}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, expected := range []string{
+		fmt.Sprintf(`sentrydsn_inbound_bytes_total{endpoint="envelope",project="1234"} %d`+"\n", inbound),
+		`sentrydsn_forwarded_bytes_total{endpoint="envelope",project="1234"} 0` + "\n",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected -- %q -- Got %s", expected, w.Body)
+		}
+	}
+}
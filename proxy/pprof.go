@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// longest CPU profile a single request may ask for
+const maxProfileSeconds = 120
+
+// pprofHandler serves runtime profiles under /debug/pprof/ in the formats `go tool pprof` reads.
+// It is written against runtime/pprof rather than importing net/http/pprof, whose init registers
+// handlers on http.DefaultServeMux for every program importing this package.
+//
+//	/debug/pprof/              index of available profiles
+//	/debug/pprof/profile       CPU profile, ?seconds=30
+//	/debug/pprof/<name>        heap, allocs, goroutine, block, mutex, threadcreate; ?debug=1 for text
+func pprofHandler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+		switch name {
+		case "":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			for _, p := range pprof.Profiles() {
+				fmt.Fprintf(w, "%s %d\n", p.Name(), p.Count())
+			}
+			fmt.Fprintln(w, "profile")
+		case "profile":
+			seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+			if err != nil || seconds <= 0 {
+				seconds = 30
+			}
+			if seconds > maxProfileSeconds {
+				seconds = maxProfileSeconds
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			if err := pprof.StartCPUProfile(w); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			select {
+			case <-time.After(time.Duration(seconds) * time.Second):
+			case <-r.Context().Done():
+			}
+			pprof.StopCPUProfile()
+		default:
+			p := pprof.Lookup(name)
+			if p == nil {
+				http.NotFound(w, r)
+				return
+			}
+			debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+			if debug > 0 {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			} else {
+				w.Header().Set("Content-Type", "application/octet-stream")
+			}
+			p.WriteTo(w, debug)
+		}
+	})
+}
@@ -0,0 +1,532 @@
+// Package proxy provides a Sentry tunnel: an http.Handler that derives the client DSN from each incoming
+// request and forwards the request to the upstream ingest host.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/sample"
+	"github.com/sentry-demos/sentrydsn/sink"
+	"github.com/sentry-demos/sentrydsn/spool"
+)
+
+// default largest request body the tunnel will buffer when Tunnel.MaxBodySize is unset
+const defaultMaxBodySize = 40 << 20
+
+var (
+	// ErrBodyTooLarge Thrown if a request body exceeds Tunnel.MaxBodySize
+	ErrBodyTooLarge = sentrydsn.ErrBodyTooLarge
+	// ErrNoUpstream Thrown if a tunnel would forward to the DSN host without AllowedHosts restricting it, so any
+	// client could choose where it forwards to
+	ErrNoUpstream = errors.New("sentry:  no upstream and no allowed hosts")
+)
+
+// headers copied from the client request onto the forwarded request
+var forwardedHeaders = []string{"Content-Type", "Content-Encoding", "X-Sentry-Auth", "User-Agent"}
+
+// Job is a request ready to be forwarded upstream.
+type Job struct {
+	DSN      *sentrydsn.DSN
+	Method   string
+	URL      string
+	Upstream string //upstream picked by Tunnel.Routes or Tunnel.Upstreams, if any
+	Header   http.Header
+	Body     []byte
+	Attempt  int //1 for the first try, 0 counts as 1; spool replays carry on counting from the spooled try
+	// ContentLength is the Content-Length the client announced, -1 if unknown; Received counts the body
+	// bytes read from the client, before Policies rewrote the body. Both are zero for jobs not from a request.
+	ContentLength int64
+	Received      int64
+
+	ring         *UpstreamRing //picked Upstream, told how forwarding went
+	spooled      bool          //the failed forward was spooled for replay
+	acknowledged bool          //the client was answered before forwarding and will not retry
+}
+
+// ForwardResult describes one attempt at forwarding a job upstream.
+type ForwardResult struct {
+	DSN      *sentrydsn.DSN         //nil for spool replays
+	Endpoint sentrydsn.EndpointType //ingest endpoint of the DSN, empty without one
+	Status   int                    //upstream status code, 0 if no response arrived
+	Err      error                  //why no response arrived
+	Latency  time.Duration          //until the upstream response headers arrived
+	Bytes    int                    //request body bytes sent
+	Attempt  int
+	// Integrity is the body digest and byte counts of the forward when Forwarder.Integrity is set,
+	// e.g. to log with the event ID; check Integrity.Truncated.
+	Integrity *Integrity
+}
+
+// Forwarder sends jobs to the upstream ingest host.
+type Forwarder struct {
+	Client *http.Client //http.DefaultClient when nil
+	// OnForwardResult, when set, is called after every forward with its outcome, e.g. for SLO tracking or
+	// alerting without wrapping the transport. It is called from concurrent requests; keep it quick or hand off.
+	OnForwardResult func(r ForwardResult)
+	Clock           sentrydsn.Clock //times forwards for OnForwardResult; the system clock when nil
+	// Integrity computes a SHA-256 of every body and counts the bytes actually sent, reported to
+	// OnForwardResult in ForwardResult.Integrity. It costs a pass over each body.
+	Integrity bool
+}
+
+// Forward sends j upstream and returns the response. The caller closes the response body.
+func (f *Forwarder) Forward(ctx context.Context, j *Job) (*http.Response, error) {
+
+	var integrity *Integrity
+	var counter *countingReader
+	var body io.Reader = bytes.NewReader(j.Body)
+	if f.Integrity && f.OnForwardResult != nil {
+		integrity = newIntegrity(j)
+		if len(j.Body) > 0 {
+			counter = &countingReader{Reader: body}
+			body = counter
+		}
+	}
+	req, err := http.NewRequest(j.Method, j.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if counter != nil {
+		//the transport cannot tell the length of a wrapped reader
+		req.ContentLength = int64(len(j.Body))
+	}
+	req = req.WithContext(ctx)
+	for k, v := range j.Header {
+		req.Header[k] = v
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := sentrydsn.Now(f.Clock)
+	resp, err := client.Do(req)
+	if f.OnForwardResult != nil {
+		r := forwardResult(j, resp, err, sentrydsn.Now(f.Clock).Sub(start))
+		if integrity != nil {
+			if counter != nil {
+				integrity.Sent = counter.n.Load()
+			}
+			r.Integrity = integrity
+		}
+		f.OnForwardResult(r)
+	}
+	return resp, err
+}
+
+// forwardResult collects the outcome of forwarding j.
+func forwardResult(j *Job, resp *http.Response, err error, latency time.Duration) ForwardResult {
+
+	r := ForwardResult{DSN: j.DSN, Err: err, Latency: latency, Bytes: len(j.Body), Attempt: max(j.Attempt, 1)}
+	if j.DSN != nil {
+		r.Endpoint = j.DSN.Endpoint
+	}
+	if resp != nil {
+		r.Status = resp.StatusCode
+	}
+	return r
+}
+
+// Tunnel is an http.Handler forwarding Sentry ingest requests upstream.
+// By default forwarding is synchronous and the upstream response is relayed to the client;
+// with a Queue the client is acknowledged as soon as the job is queued.
+// Like http.Handler implementations generally, a Tunnel serves requests concurrently; configure it before serving.
+type Tunnel struct {
+	Extractor sentrydsn.Extractor //derives the DSN; sentrydsn.FromRequest when nil
+	Upstream  string              //base url requests are forwarded to, e.g. https://o1.ingest.sentry.io. Uses the DSN host when empty, if AllowedHosts is set.
+	Upstreams *UpstreamRing       //picks the upstream per project instead of Upstream when set
+	Routes    *RoutingTable       //picks the upstream by inbound host before Upstreams and Upstream when set
+	// CORSHeaders lists request headers browsers may send besides those of the SDKs and X-Sentry-DSN, e.g. the
+	// header named to sentrydsn.HeaderDSN, so CORS preflights allow them.
+	CORSHeaders []string
+	// AllowedHosts restricts the hosts extracted DSNs may point at, whatever the extractor.
+	// A tunnel using the DSN host as upstream refuses to forward without it, with ErrNoUpstream, since it would
+	// forward to any host a client names.
+	AllowedHosts sentrydsn.HostAllowlist
+	Forwarder    *Forwarder
+	Queue        *Queue       //forward asynchronously when set
+	Spool        *spool.Spool //failed forwards are spooled for replay, and the client told they arrived, when set
+	MaxBodySize  int64        //defaults to 40MB
+	// Timeouts bound reading request bodies and forwarding them per endpoint type, e.g. longer for envelopes
+	// carrying attachments than for store. Endpoints without an entry use the "" entry, if any.
+	Timeouts map[sentrydsn.EndpointType]Timeout
+	Stats    *Stats      //per-project counters, e.g. for Admin, when set
+	Abuse    *AbuseGuard //counts key failures per client and refuses blocked clients when set
+	// RateLimit and Quota cap the requests per public key and per project, answering the rest with 429, when set.
+	// Give every instance of a fleet the same Counter so they enforce one limit rather than one each.
+	RateLimit *RateLimit
+	Quota     *Quota
+	// Authorizer, when set, is asked about every parsed DSN before its body is read, so keys can be revoked or
+	// time-limited centrally, see sentrydsn.HTTPAuthorizer. Refused keys get 403, undecided ones 503.
+	Authorizer sentrydsn.Authorizer
+	// Policies drop, sample or size-cap envelope items by data category, e.g. "replay", before forwarding.
+	Policies map[string]*ItemPolicy
+	// Sampler keeps a share of envelope items by project and data category before forwarding. Decisions are keyed
+	// on the trace_id of the dynamic sampling context in the envelope header, so every envelope of a trace is
+	// kept or dropped together; envelopes outside a trace are decided by their event ID.
+	Sampler *sample.Sampler
+	// ClientReports, when set, reports what the tunnel discards to upstream Sentry as client reports,
+	// see TunnelClientReporter.
+	ClientReports *ClientReporter
+
+	Sinks             []sink.Sink //receive every accepted request before it is forwarded
+	DisableForwarding bool        //only publish to Sinks; sink errors then fail the request
+
+	// Shadow computes the tunnel's own enforcement decisions, AllowedHosts, Abuse blocks, Authorizer, RateLimit,
+	// Quota, Policies and Sampler, without acting on them: what they would have refused or filtered is counted in
+	// Stats.Shadowed and the request is forwarded untouched. Set sentrydsn.Parser.Shadow too to dry-run the
+	// parser's restrictions.
+	Shadow bool
+
+	Clock sentrydsn.Clock //tells the time for records, spool entries, latencies and client reports; the system clock when nil
+}
+
+// authorize asks the Authorizer about dsn, with the client address the AbuseGuard found if any.
+func (t *Tunnel) authorize(r *http.Request, dsn *sentrydsn.DSN, ip netip.Addr) error {
+
+	if t.Authorizer == nil {
+		return nil
+	}
+	meta := sentrydsn.NewRequestMeta(r)
+	if ip.IsValid() {
+		meta.ClientAddr = ip
+	}
+	return t.Authorizer.Authorize(r.Context(), dsn, meta)
+}
+
+// limit counts the request against RateLimit and then Quota, and returns whether both allow it, and if not
+// how long the client should back off.
+func (t *Tunnel) limit(ctx context.Context, dsn *sentrydsn.DSN) (bool, time.Duration) {
+
+	if ok, retry := t.RateLimit.allow(ctx, dsn); !ok {
+		return false, retry
+	}
+	return t.Quota.allow(ctx, dsn)
+}
+
+// ServeHTTP implements http.Handler.
+func (t *Tunnel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	allowOrigin(w, r)
+	//preflights and probes carry no DSN, whatever the extractor
+	if r.Method == http.MethodOptions || r.Method == http.MethodHead {
+		writePreflight(w, r, t.CORSHeaders)
+		return
+	}
+	ip, blocked := t.Abuse.check(r)
+	if blocked != nil && !t.Shadow {
+		WriteError(w, blocked)
+		return
+	}
+	dsn, err := t.extract(r)
+	var untrusted, unauthorized error
+	if err == nil {
+		if untrusted = t.AllowedHosts.Check(dsn.Host); !t.Shadow {
+			err = untrusted
+		}
+	}
+	if err == nil {
+		if unauthorized = t.authorize(r, dsn, ip); !t.Shadow {
+			err = unauthorized
+		}
+	}
+	t.Stats.parse(err)
+	t.Abuse.parsed(ip, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	t.Stats.warn(dsn)
+	if blocked != nil {
+		t.Stats.shadow(dsn, shadowBlocked)
+	}
+	if untrusted != nil {
+		t.Stats.shadow(dsn, shadowUntrustedHost)
+	}
+	if unauthorized != nil {
+		t.Stats.shadow(dsn, shadowUnauthorized)
+	}
+	if ok, retry := t.limit(r.Context(), dsn); !ok {
+		if !t.Shadow {
+			t.Stats.outcome(dsn, outcomeRateLimited)
+			WriteRateLimited(w, retry, nil)
+			return
+		}
+		t.Stats.shadow(dsn, shadowRateLimited)
+	}
+	r = r.WithContext(sentrydsn.ContextWithDSN(r.Context(), dsn))
+	lift := t.readDeadline(w, r, dsn)
+	j, err := t.job(r, dsn)
+	if err != nil {
+		//the deadline stays so the server does not wait for the rest of a stalled body
+		WriteError(w, err)
+		return
+	}
+	lift()
+	t.Stats.transferred(dsn, headerSize(r.Header)+j.Received, 0)
+
+	err = t.publish(r, j)
+	if t.DisableForwarding {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+		return
+	}
+
+	t.Stats.receive(dsn)
+	if !t.filter(j) {
+		t.Stats.outcome(dsn, outcomeFiltered)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+		return
+	}
+	if t.Queue != nil {
+		j.acknowledged = true
+		if err := t.Queue.Enqueue(r.Context(), j); err != nil {
+			//the SDK records the 429 as a discard itself
+			t.Stats.add(dsn.ProjectID, func(p *ProjectStats) { p.Rejected++ })
+			t.Stats.outcome(dsn, outcomeRejected)
+			WriteRateLimited(w, time.Minute, nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+		return
+	}
+
+	resp, err := t.Send(r.Context(), j)
+	if j.spooled {
+		//the spool delivers it; a 5xx would have the SDK retry as well and the event arrive twice
+		if resp != nil {
+			resp.Body.Close()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	t.Abuse.forwarded(ip, resp.StatusCode)
+	for _, k := range []string{"Content-Type", "Retry-After", "X-Sentry-Rate-Limits"} {
+		if v := resp.Header.Get(k); len(v) > 0 {
+			w.Header().Set(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// Send forwards j, spooling it if the upstream cannot be reached or fails with a server error.
+// The endpoint's forward timeout runs until the response body is closed.
+// It is the function Queue workers should run for a Tunnel.
+func (t *Tunnel) Send(ctx context.Context, j *Job) (*http.Response, error) {
+
+	f := t.Forwarder
+	if f == nil {
+		f = &Forwarder{}
+	}
+	start := sentrydsn.Now(t.Clock)
+	var endpoint sentrydsn.EndpointType
+	if j.DSN != nil {
+		endpoint = j.DSN.Endpoint
+	}
+	ctx, cancel := t.forwardContext(ctx, endpoint)
+	resp, err := f.Forward(ctx, j)
+	if err != nil {
+		cancel()
+	} else {
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	}
+	failed := err != nil || resp.StatusCode >= 500
+	if j.ring != nil {
+		j.ring.Report(j.Upstream, failed)
+	}
+	switch {
+	case t.Spool != nil && failed:
+		j.spooled = t.Spool.Put(&spool.Entry{Method: j.Method, URL: j.URL, Header: j.Header, Endpoint: string(endpoint), Attempts: max(j.Attempt, 1),
+			Body: j.Body, Created: sentrydsn.Now(t.Clock)}) == nil
+	case !j.acknowledged || j.DSN == nil:
+		//the client gets the failure and retries
+	case err != nil:
+		t.ClientReports.discard(j, requestDiscards(j, reasonNetworkError))
+	case failed:
+		t.ClientReports.discard(j, requestDiscards(j, reasonSendError))
+	}
+	if j.DSN != nil {
+		t.Stats.forwarded(j.DSN, sentrydsn.Now(t.Clock).Sub(start), failed)
+		if err == nil {
+			t.Stats.transferred(j.DSN, 0, headerSize(j.Header)+int64(len(j.Body)))
+		}
+	}
+	return resp, err
+}
+
+// overflowed accounts for an acknowledged job a full DropOldest queue discarded.
+func (t *Tunnel) overflowed(j *Job) {
+
+	if j.DSN == nil {
+		return
+	}
+	t.Stats.add(j.DSN.ProjectID, func(p *ProjectStats) { p.Overflowed++ })
+	t.Stats.outcome(j.DSN, outcomeOverflowed)
+	t.ClientReports.discard(j, requestDiscards(j, reasonQueueOverflow))
+}
+
+// Replay is a spool replay function re-sending entries through the tunnel's forwarder with their original method.
+// Entries stay spooled when the upstream cannot be reached or answers with a status worth retrying later.
+func (t *Tunnel) Replay(e *spool.Entry) error {
+
+	f := t.Forwarder
+	if f == nil {
+		f = &Forwarder{}
+	}
+	method := e.Method
+	if len(method) == 0 {
+		method = http.MethodPost
+	}
+	j := &Job{Method: method, URL: e.URL, Header: e.Header, Body: e.Body, Attempt: max(e.Attempts, 2)}
+	ctx, cancel := t.forwardContext(context.Background(), sentrydsn.EndpointType(e.Endpoint))
+	defer cancel()
+	resp, err := f.Forward(ctx, j)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if retryLater(resp.StatusCode) {
+		return fmt.Errorf("sentry:  upstream responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// retryLater reports whether a spooled entry answered with status should be kept for a later replay: server
+// errors, rate limits and timeouts may clear, and a 413 may pass once upstream limits are raised.
+func retryLater(status int) bool {
+
+	switch status {
+	case http.StatusRequestTimeout, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= 500
+}
+
+// publish hands the request to every sink, returning the first error.
+func (t *Tunnel) publish(r *http.Request, j *Job) error {
+
+	var first error
+	rec := &sink.Record{DSN: j.DSN, Path: r.URL.Path, Received: sentrydsn.Now(t.Clock), Body: j.Body}
+	for _, s := range t.Sinks {
+		if err := s.Publish(r.Context(), rec); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t *Tunnel) extract(r *http.Request) (*sentrydsn.DSN, error) {
+
+	if t.Extractor == nil {
+		return sentrydsn.FromRequest(r)
+	}
+	return t.Extractor.Extract(r)
+}
+
+// job buffers the request body and builds the upstream request. The method is kept so the GET
+// rendering the feedback dialog reaches upstream as a GET.
+func (t *Tunnel) job(r *http.Request, dsn *sentrydsn.DSN) (*Job, error) {
+
+	upstream, err := t.Routes.route(dsn.Host)
+	if err != nil {
+		return nil, err
+	}
+	max := t.MaxBodySize
+	if max <= 0 {
+		max = defaultMaxBodySize
+	}
+	body, err := sentrydsn.ReadBody(r, max)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, ErrReadTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	for _, k := range forwardedHeaders {
+		if v := r.Header.Get(k); len(v) > 0 {
+			header.Set(k, v)
+		}
+	}
+	j := &Job{DSN: dsn, Method: r.Method, Header: header, Body: body, ContentLength: r.ContentLength, Received: int64(len(body))}
+	switch {
+	case len(upstream) > 0:
+		j.Upstream = upstream
+	case t.Upstreams != nil:
+		j.Upstream, j.ring = t.Upstreams.Pick(dsn.ProjectID), t.Upstreams
+	case len(t.Upstream) == 0 && len(t.AllowedHosts) == 0 && !t.DisableForwarding:
+		//the DSN host is the tunnel itself with FromRequest and anything the client likes with HeaderDSN or BodyDSN
+		return nil, ErrNoUpstream
+	}
+	j.URL = t.upstreamURL(r, dsn, j.Upstream)
+	return j, nil
+}
+
+// upstreamURL keeps the ingest path of requests addressed to /api/..., behind the DSN's path prefix if they
+// carry it, and sends everything else, e.g. bodies posted to a custom tunnel route, to the project's envelope
+// endpoint.
+func (t *Tunnel) upstreamURL(r *http.Request, dsn *sentrydsn.DSN, upstream string) string {
+
+	path := r.URL.Path
+	if len(dsn.PathPrefix) > 0 && strings.HasPrefix(path, dsn.PathPrefix+"/api/") {
+		//derived DSNs carry the prefix the request came in on, which the base adds back when it is the DSN's
+		path = path[len(dsn.PathPrefix):]
+	}
+	if strings.HasPrefix(path, "/api/") {
+		u := t.upstreamBase(dsn, upstream) + path
+		if len(r.URL.RawQuery) > 0 {
+			u += "?" + r.URL.RawQuery
+		}
+		return u
+	}
+	return t.envelopeURL(dsn, upstream)
+}
+
+// envelopeURL is the project's envelope endpoint upstream.
+func (t *Tunnel) envelopeURL(dsn *sentrydsn.DSN, upstream string) string {
+	return fmt.Sprintf("%v/api/%v/envelope/?sentry_key=%v&sentry_version=7", t.upstreamBase(dsn, upstream), dsn.ProjectID, dsn.PublicKey)
+}
+
+// upstreamBase is the base url of upstream, falling back to Tunnel.Upstream and then the DSN's scheme, host,
+// port and path prefix, which job only allows with AllowedHosts set.
+func (t *Tunnel) upstreamBase(dsn *sentrydsn.DSN, upstream string) string {
+
+	if len(upstream) == 0 {
+		upstream = t.Upstream
+	}
+	if len(upstream) > 0 {
+		return strings.TrimSuffix(upstream, "/")
+	}
+	scheme := dsn.Scheme
+	if len(scheme) == 0 {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: dsn.Host, Path: dsn.PathPrefix}).String()
+}
@@ -0,0 +1,462 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/sink"
+	"github.com/sentry-demos/sentrydsn/spool"
+)
+
+//setup
+
+const testKey = "4784fbc50de2473f9977cfce8a9adce5"
+
+type receivedRequest struct {
+	url  string
+	auth string
+	body string
+}
+
+// upstream records requests and answers with status
+type upstream struct {
+	*httptest.Server
+	mu       sync.Mutex
+	received []receivedRequest
+	status   int
+}
+
+func newUpstream(status int) *upstream {
+	u := &upstream{status: status}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		u.mu.Lock()
+		u.received = append(u.received, receivedRequest{r.URL.RequestURI(), r.Header.Get("X-Sentry-Auth"), string(b)})
+		u.mu.Unlock()
+		w.WriteHeader(u.status)
+		io.WriteString(w, `{"id":"9ec79c33ec9942ab8353589fcb2e04dc"}`)
+	}))
+	return u
+}
+
+func (u *upstream) requests() []receivedRequest {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]receivedRequest(nil), u.received...)
+}
+
+func ingestRequest(url string, body string) *http.Request {
+	r := httptest.NewRequest("POST", url, strings.NewReader(body))
+	r.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key="+testKey)
+	return r
+}
+
+//tests
+
+func TestTunnelForwards(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL}
+
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/?sentry_version=7", "{}\n"))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "9ec79c33ec9942ab8353589fcb2e04dc") {
+		t.Errorf("Expected upstream response relayed -- Got %d %s", w.Code, w.Body)
+	}
+	got := up.requests()
+	if len(got) != 1 || got[0].url != "/api/1234/envelope/?sentry_version=7" || got[0].body != "{}\n" || !strings.Contains(got[0].auth, testKey) {
+		t.Errorf("Expected forwarded envelope -- Got %v", got)
+	}
+}
+
+func TestTunnelCustomRoute(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Extractor: sentrydsn.BodyDSN(0)}
+
+	body := `{"dsn":"https://` + testKey + `@o1.ingest.sentry.io/42"}`
+	tunnel.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "https://app.example.com/tunnel", strings.NewReader(body)))
+	got := up.requests()
+	expected := "/api/42/envelope/?sentry_key=" + testKey + "&sentry_version=7"
+	if len(got) != 1 || got[0].url != expected || got[0].body != body {
+		t.Errorf("Expected -- %s -- Got %v", expected, got)
+	}
+}
+
+func TestTunnelErrors(t *testing.T) {
+	tunnel := &Tunnel{Upstream: "http://127.0.0.1:1", MaxBodySize: 4}
+
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusBadRequest, w.Code)
+	}
+	w = httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "too large"))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestTunnelSpoolsFailures(t *testing.T) {
+	s, _ := spool.Open(t.TempDir(), 0, 0)
+	down := newUpstream(http.StatusServiceUnavailable)
+	tunnel := &Tunnel{Upstream: down.URL, Spool: s}
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	down.Close()
+	if entries, _ := s.Stats(); entries != 1 {
+		t.Fatalf("Expected -- 1 spooled entry -- Got %d", entries)
+	}
+	//the SDK must not retry what the spool delivers
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d once spooled -- Got %d", http.StatusOK, w.Code)
+	}
+
+	//the upstream recovers
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel.Upstream = up.URL
+	n, err := s.Replay(func(e *spool.Entry) error {
+		if e.Method != http.MethodPost {
+			t.Errorf("Expected -- %s spooled -- Got %q", http.MethodPost, e.Method)
+		}
+		e.URL = strings.Replace(e.URL, down.URL, up.URL, 1)
+		return tunnel.Replay(e)
+	})
+	if n != 1 || err != nil || len(up.requests()) != 1 {
+		t.Errorf("Expected -- 1 replayed -- Got %d %v", n, err)
+	}
+}
+
+func TestTunnelReplay(t *testing.T) {
+	var method string
+	var status int
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(status)
+	}))
+	tunnel := &Tunnel{}
+
+	var testTableReplay = []struct {
+		method      string
+		status      int
+		description string
+		kept        bool
+		expected    string
+	}{
+		{"", http.StatusOK, "delivered", false, http.MethodPost},
+		{http.MethodGet, http.StatusOK, "method kept", false, http.MethodGet},
+		{http.MethodPost, http.StatusBadRequest, "rejected for good", false, http.MethodPost},
+		{http.MethodPost, http.StatusRequestTimeout, "timed out", true, http.MethodPost},
+		{http.MethodPost, http.StatusRequestEntityTooLarge, "too large", true, http.MethodPost},
+		{http.MethodPost, http.StatusTooManyRequests, "rate limited", true, http.MethodPost},
+		{http.MethodPost, http.StatusServiceUnavailable, "server error", true, http.MethodPost},
+	}
+	for _, test := range testTableReplay {
+		status = test.status
+		err := tunnel.Replay(&spool.Entry{Method: test.method, URL: up.URL + "/api/1234/feedback/", Endpoint: "feedback"})
+		if kept := err != nil; kept != test.kept {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.kept, err)
+		}
+		if method != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, method)
+		}
+	}
+	up.Close()
+	if err := tunnel.Replay(&spool.Entry{URL: up.URL + "/api/1234/envelope/"}); err == nil {
+		t.Errorf("%s: Expected -- %v -- Got %v", "network error", "an error", err)
+	}
+}
+
+// testSink records published records; the tunnel publishes from concurrent requests
+type testSink struct {
+	mu      sync.Mutex
+	records []*sink.Record
+	inCtx   int //records whose DSN was also in the context
+}
+
+func (s *testSink) Publish(ctx context.Context, rec *sink.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	if dsn, ok := sentrydsn.DSNFromContext(ctx); ok && dsn == rec.DSN {
+		s.inCtx++
+	}
+	return nil
+}
+
+func TestTunnelSinks(t *testing.T) {
+	s := &testSink{}
+	tunnel := &Tunnel{Upstream: "http://127.0.0.1:1", Sinks: []sink.Sink{s}, DisableForwarding: true}
+
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, w.Code)
+	}
+	if len(s.records) != 1 || s.records[0].DSN.ProjectID != "1234" || string(s.records[0].Body) != "{}\n" || s.records[0].Path != "/api/1234/envelope/" {
+		t.Errorf("Expected one published record -- Got %v", s.records)
+	}
+	if s.inCtx != 1 {
+		t.Errorf("Expected -- dsn in the request context -- Got %d", s.inCtx)
+	}
+}
+
+func TestTunnelUpstreamURL(t *testing.T) {
+	var testTableUpstreamURL = []struct {
+		dsn         string //parsed with ParseDSN, or derived from the request when empty
+		request     string
+		upstream    string
+		description string
+		expected    string
+	}{
+		{"https://" + testKey + "@o1.ingest.sentry.io/1234", "https://app.example.com/tunnel", "", "dsn host", "https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=" + testKey + "&sentry_version=7"},
+		{"http://" + testKey + "@sentry.example.com:9000/sentry/1234", "https://app.example.com/tunnel", "", "dsn scheme, port and prefix", "http://sentry.example.com:9000/sentry/api/1234/envelope/?sentry_key=" + testKey + "&sentry_version=7"},
+		{"https://" + testKey + "@sentry.example.com/sentry/1234", "https://app.example.com/api/1234/store/", "", "ingest path behind the dsn prefix", "https://sentry.example.com/sentry/api/1234/store/"},
+		{"", "https://relay.example.com:8443/sentry/api/1234/store/?sentry_key=" + testKey, "", "derived prefix not doubled", "https://relay.example.com:8443/sentry/api/1234/store/?sentry_key=" + testKey},
+		{"", "https://relay.example.com/sentry/api/1234/store/?sentry_key=" + testKey, "https://o1.ingest.sentry.io/", "derived prefix left out upstream", "https://o1.ingest.sentry.io/api/1234/store/?sentry_key=" + testKey},
+	}
+	for _, test := range testTableUpstreamURL {
+		r := httptest.NewRequest("POST", test.request, nil)
+		dsn, err := sentrydsn.FromRequest(r)
+		if len(test.dsn) > 0 {
+			dsn, err = sentrydsn.ParseDSN(test.dsn)
+		}
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		tunnel := &Tunnel{Upstream: test.upstream}
+		if got := tunnel.upstreamURL(r, dsn, ""); got != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestTunnelUntrustedHost(t *testing.T) {
+	tunnel := &Tunnel{Extractor: sentrydsn.HeaderDSN(""), AllowedHosts: sentrydsn.HostAllowlist{"*.ingest.sentry.io"}}
+	r := httptest.NewRequest("POST", "https://app.example.com/tunnel", strings.NewReader("{}\n"))
+	r.Header.Set("X-Sentry-DSN", "https://"+testKey+"@attacker.example.com/1234")
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestTunnelConcurrent(t *testing.T) {
+	const n = 2000
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	s := &testSink{}
+	tunnel := &Tunnel{
+		Extractor: &sentrydsn.Parser{AllowedHosts: sentrydsn.HostAllowlist{"relay.example.com"}},
+		Upstream:  up.URL,
+		Stats:     &Stats{},
+		Sinks:     []sink.Sink{s},
+	}
+	tunnel.Queue = TunnelQueue(tunnel, 64, 8, Block)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := "https://relay.example.com/api/1234/envelope/"
+			if i%2 == 1 {
+				url = "https://relay.example.com/api/5678/store/?sentry_key=" + testKey
+			}
+			w := httptest.NewRecorder()
+			tunnel.ServeHTTP(w, ingestRequest(url, "{}\n"))
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected -- %v -- Got %v", http.StatusOK, w.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+	tunnel.Queue.Close()
+
+	snapshot := tunnel.Stats.Snapshot()
+	if got := snapshot["1234"].Forwarded + snapshot["5678"].Forwarded; got != n {
+		t.Errorf("Expected -- %v forwarded -- Got %v", n, got)
+	}
+	if parsed, errs := tunnel.Stats.Parses(); parsed != n || len(errs) != 0 {
+		t.Errorf("Expected -- %v parsed without errors -- Got %v %v", n, parsed, errs)
+	}
+	if len(s.records) != n {
+		t.Errorf("Expected -- %v published -- Got %v", n, len(s.records))
+	}
+}
+
+func TestTunnelPreflight(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Stats: &Stats{}}
+	for _, method := range []string{"OPTIONS", "HEAD"} {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, httptest.NewRequest(method, "https://relay.example.com/api/1234/envelope/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expected -- %d -- Got %d", method, http.StatusOK, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", "")
+	r.Method = "GET"
+	w = httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if parsed, _ := tunnel.Stats.Parses(); parsed != 2 || len(up.requests()) != 1 {
+		t.Errorf("Expected -- 2 parses 1 forward -- Got %d %d", parsed, len(up.requests()))
+	}
+}
+
+func TestTunnelCORS(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL}
+
+	r := httptest.NewRequest("OPTIONS", "https://relay.example.com/api/1234/envelope/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	r.Header.Set("Access-Control-Request-Headers", "content-type")
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		!strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), "POST") ||
+		!strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "Content-Type") {
+		t.Errorf("Expected -- a CORS preflight answer -- Got %d %v", w.Code, w.Header())
+	}
+
+	r = ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n")
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || !strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), "X-Sentry-Rate-Limits") {
+		t.Errorf("Expected -- the response readable cross-origin -- Got %v", w.Header())
+	}
+
+	//extractors other than the parser never see preflights
+	for _, extractor := range []sentrydsn.Extractor{sentrydsn.HeaderDSN(""), sentrydsn.BodyDSN(0)} {
+		tunnel := &Tunnel{Upstream: up.URL, Extractor: extractor, CORSHeaders: []string{"X-Tunnel-DSN"}}
+		r = httptest.NewRequest("OPTIONS", "https://relay.example.com/tunnel", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		w = httptest.NewRecorder()
+		tunnel.ServeHTTP(w, r)
+		if allowed := w.Header().Get("Access-Control-Allow-Headers"); w.Code != http.StatusOK ||
+			!strings.Contains(allowed, "X-Sentry-DSN") || !strings.Contains(allowed, "X-Tunnel-DSN") {
+			t.Errorf("Expected -- a CORS preflight answer allowing the DSN headers -- Got %d %v", w.Code, w.Header())
+		}
+	}
+
+	//without an Origin there is nothing to allow
+	w = httptest.NewRecorder()
+	tunnel.ServeHTTP(w, httptest.NewRequest("HEAD", "https://relay.example.com/api/1234/envelope/", nil))
+	if w.Code != http.StatusOK || len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("Expected -- a bare 200 -- Got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestForwardResult(t *testing.T) {
+	var results []ForwardResult
+	now := time.Unix(1700000000, 0)
+	clock := sentrydsn.ClockFunc(func() time.Time {
+		now = now.Add(20 * time.Millisecond)
+		return now
+	})
+	f := &Forwarder{Clock: clock, OnForwardResult: func(r ForwardResult) { results = append(results, r) }}
+	s, _ := spool.Open(t.TempDir(), 0, 0)
+	down := newUpstream(http.StatusServiceUnavailable)
+	tunnel := &Tunnel{Upstream: down.URL, Forwarder: f, Spool: s}
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	down.Close()
+	s.Replay(tunnel.Replay)
+	s.Replay(tunnel.Replay)
+
+	if len(results) != 3 {
+		t.Fatalf("Expected -- 3 results -- Got %v", results)
+	}
+	first, replay := results[0], results[1]
+	if first.DSN == nil || first.Endpoint != sentrydsn.EndpointEnvelope || first.Status != http.StatusServiceUnavailable ||
+		first.Latency != 20*time.Millisecond || first.Bytes != 3 || first.Attempt != 1 {
+		t.Errorf("Expected -- envelope 503 attempt 1 -- Got %+v", first)
+	}
+	if replay.DSN != nil || replay.Status != 0 || replay.Err == nil || replay.Attempt != 2 {
+		t.Errorf("Expected -- failed replay attempt 2 -- Got %+v", replay)
+	}
+	if results[2].Attempt != 3 {
+		t.Errorf("Expected -- failed replay attempt 3 -- Got %+v", results[2])
+	}
+}
+
+func TestTunnelAuthorizer(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	stats := &Stats{}
+	revoked := sentrydsn.AuthorizerFunc(func(ctx context.Context, dsn *sentrydsn.DSN, meta sentrydsn.RequestMeta) error {
+		if dsn.PublicKey == testKey && meta.Method == "POST" {
+			return sentrydsn.ErrUnauthorized
+		}
+		return nil
+	})
+	tunnel := &Tunnel{Upstream: up.URL, Authorizer: revoked, Stats: stats}
+
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	if w.Code != http.StatusForbidden || len(up.requests()) != 0 {
+		t.Errorf("Expected -- %d and nothing forwarded -- Got %d %v", http.StatusForbidden, w.Code, up.requests())
+	}
+
+	tunnel.Shadow = true
+	w = httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	shadowed := stats.Shadowed()
+	if w.Code != http.StatusOK || len(shadowed) != 1 || shadowed[0].Outcome != "unauthorized" {
+		t.Errorf("Expected -- forwarded with an unauthorized shadow decision -- Got %d %v", w.Code, shadowed)
+	}
+}
+
+func TestTunnelBandwidth(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	stats := &Stats{}
+	tunnel := &Tunnel{Upstream: up.URL, Stats: stats}
+
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n")
+	inbound := headerSize(r.Header) + 3
+	tunnel.ServeHTTP(httptest.NewRecorder(), r)
+	b := stats.Bandwidth()
+	if len(b) != 1 || b[0].ProjectID != "1234" || b[0].Endpoint != sentrydsn.EndpointEnvelope || b[0].Inbound != inbound || b[0].Forwarded <= 3 {
+		t.Errorf("Expected -- %d bytes in, body and headers out -- Got %+v", inbound, b)
+	}
+	forwarded := b[0].Forwarded
+
+	//bytes that never reached upstream are not counted as forwarded
+	tunnel.Upstream = "http://127.0.0.1:1"
+	tunnel.ServeHTTP(httptest.NewRecorder(), ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	p := stats.Snapshot()["1234"]
+	if p.InboundBytes != 2*inbound || p.ForwardedBytes != forwarded {
+		t.Errorf("Expected -- %d in, %d out -- Got %+v", 2*inbound, forwarded, p)
+	}
+}
+
+func TestTunnelNoUpstream(t *testing.T) {
+	tunnel := &Tunnel{Extractor: sentrydsn.HeaderDSN("")}
+	r := httptest.NewRequest("POST", "https://app.example.com/tunnel", strings.NewReader("{}\n"))
+	r.Header.Set("X-Sentry-DSN", "https://"+testKey+"@169.254.169.254/1234")
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueFull Thrown by Queue.Enqueue under the Reject policy when no capacity is left
+var ErrQueueFull = errors.New("sentry:  forward queue full")
+
+// OverflowPolicy decides what Queue.Enqueue does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// Block waits for capacity, applying backpressure to the client, until the request is canceled.
+	Block OverflowPolicy = iota
+	// DropOldest discards the oldest queued job to make room, telling Queue.Overflow about it.
+	DropOldest
+	// Reject fails with ErrQueueFull; the tunnel answers 429 so SDKs back off.
+	Reject
+)
+
+// Queue is a bounded job queue drained by a fixed pool of workers. It is safe for concurrent use.
+type Queue struct {
+	// Overflow, when set, is called with every job DropOldest discards; the client was already told it was
+	// accepted. TunnelQueue reports them to the tunnel's ClientReports and Stats. Set it before the first Enqueue.
+	Overflow func(j *Job)
+
+	jobs    chan *Job
+	policy  OverflowPolicy
+	send    func(ctx context.Context, j *Job)
+	wg      sync.WaitGroup
+	dropped int64
+}
+
+// NewQueue starts workers goroutines running send for each queued job. size bounds the number of waiting jobs.
+func NewQueue(size int, workers int, policy OverflowPolicy, send func(ctx context.Context, j *Job)) *Queue {
+
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	q := &Queue{jobs: make(chan *Job, size), policy: policy, send: send}
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// TunnelQueue is NewQueue with a worker that forwards jobs through t and discards the response, and an
+// Overflow reporting what DropOldest discards as queue_overflow.
+func TunnelQueue(t *Tunnel, size int, workers int, policy OverflowPolicy) *Queue {
+
+	q := NewQueue(size, workers, policy, func(ctx context.Context, j *Job) {
+		if resp, err := t.Send(ctx, j); err == nil {
+			resp.Body.Close()
+		}
+	})
+	q.Overflow = t.overflowed
+	return q
+}
+
+func (q *Queue) work() {
+
+	defer q.wg.Done()
+	for j := range q.jobs {
+		q.send(context.Background(), j)
+	}
+}
+
+// Enqueue adds j according to the overflow policy. Under Block it gives up with ctx's error once ctx is done.
+func (q *Queue) Enqueue(ctx context.Context, j *Job) error {
+
+	switch q.policy {
+	case Reject:
+		select {
+		case q.jobs <- j:
+			return nil
+		default:
+			atomic.AddInt64(&q.dropped, 1)
+			return ErrQueueFull
+		}
+	case DropOldest:
+		for {
+			select {
+			case q.jobs <- j:
+				return nil
+			default:
+			}
+			select {
+			case old := <-q.jobs:
+				atomic.AddInt64(&q.dropped, 1)
+				if q.Overflow != nil {
+					q.Overflow(old)
+				}
+			default:
+			}
+		}
+	}
+	select {
+	case q.jobs <- j:
+		return nil
+	case <-ctx.Done():
+		atomic.AddInt64(&q.dropped, 1)
+		return ctx.Err()
+	}
+}
+
+// Len returns the number of jobs waiting for a worker.
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Dropped returns the number of jobs discarded or rejected because the queue was full.
+func (q *Queue) Dropped() int64 {
+	return atomic.LoadInt64(&q.dropped)
+}
+
+// Close stops accepting jobs and waits for the workers to drain the queue. Enqueue must not be called after Close.
+func (q *Queue) Close() {
+
+	close(q.jobs)
+	q.wg.Wait()
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueuePolicies(t *testing.T) {
+	release := make(chan struct{})
+	var sent []string
+	done := make(chan string, 10)
+	send := func(ctx context.Context, j *Job) {
+		<-release
+		done <- j.URL
+	}
+
+	//one worker blocked on the first job, one slot of queue
+	q := NewQueue(1, 1, Reject, send)
+	q.Enqueue(context.Background(), &Job{URL: "a"})
+	time.Sleep(10 * time.Millisecond)
+	q.Enqueue(context.Background(), &Job{URL: "b"})
+	if err := q.Enqueue(context.Background(), &Job{URL: "c"}); err != ErrQueueFull {
+		t.Errorf("Expected -- %s -- Got %v", ErrQueueFull, err)
+	}
+	close(release)
+	q.Close()
+	close(done)
+	for u := range done {
+		sent = append(sent, u)
+	}
+	if len(sent) != 2 || q.Dropped() != 1 {
+		t.Errorf("Expected -- [a b] 1 dropped -- Got %v %d dropped", sent, q.Dropped())
+	}
+
+	release = make(chan struct{})
+	done = make(chan string, 10)
+	q = NewQueue(1, 1, DropOldest, send)
+	q.Enqueue(context.Background(), &Job{URL: "a"})
+	time.Sleep(10 * time.Millisecond)
+	q.Enqueue(context.Background(), &Job{URL: "b"})
+	if err := q.Enqueue(context.Background(), &Job{URL: "c"}); err != nil {
+		t.Errorf("Expected -- nil -- Got %v", err)
+	}
+	close(release)
+	q.Close()
+	close(done)
+	sent = nil
+	for u := range done {
+		sent = append(sent, u)
+	}
+	if len(sent) != 2 || sent[1] != "c" || q.Dropped() != 1 {
+		t.Errorf("Expected -- [a c] 1 dropped -- Got %v %d dropped", sent, q.Dropped())
+	}
+}
+
+func TestQueueBlockCanceled(t *testing.T) {
+	release := make(chan struct{})
+	q := NewQueue(1, 1, Block, func(ctx context.Context, j *Job) { <-release })
+	defer func() {
+		close(release)
+		q.Close()
+	}()
+
+	q.Enqueue(context.Background(), &Job{URL: "a"})
+	time.Sleep(10 * time.Millisecond)
+	q.Enqueue(context.Background(), &Job{URL: "b"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Enqueue(ctx, &Job{URL: "c"}); err != context.DeadlineExceeded {
+		t.Errorf("Expected -- %s -- Got %v", context.DeadlineExceeded, err)
+	}
+	if q.Dropped() != 1 {
+		t.Errorf("Expected -- %d dropped -- Got %d", 1, q.Dropped())
+	}
+}
+
+func TestTunnelAsync(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL}
+	tunnel.Queue = TunnelQueue(tunnel, 10, 2, Block)
+
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+	if w.Code != http.StatusOK || w.Body.String() != "{}" {
+		t.Errorf("Expected immediate acknowledgement -- Got %d %s", w.Code, w.Body)
+	}
+	tunnel.Queue.Close()
+	if len(up.requests()) != 1 {
+		t.Errorf("Expected -- 1 forwarded -- Got %d", len(up.requests()))
+	}
+}
+
+func TestTunnelRejectsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	tunnel := &Tunnel{Upstream: "http://127.0.0.1:1"}
+	tunnel.Queue = NewQueue(1, 1, Reject, func(ctx context.Context, j *Job) { <-block })
+	defer func() {
+		close(block)
+		tunnel.Queue.Close()
+	}()
+
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		last = httptest.NewRecorder()
+		tunnel.ServeHTTP(last, ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if last.Code != http.StatusTooManyRequests || last.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected -- 429 with Retry-After -- Got %d", last.Code)
+	}
+}
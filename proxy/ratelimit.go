@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteRateLimited answers 429 with the Retry-After and X-Sentry-Rate-Limits headers SDKs back off on.
+// categories are data categories such as "error", "transaction" or "attachment"; none limits every category.
+// retryAfter is rounded up to whole seconds, at least one.
+func WriteRateLimited(w http.ResponseWriter, retryAfter time.Duration, categories []string) {
+
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	s := strconv.FormatInt(seconds, 10)
+	w.Header().Set("Retry-After", s)
+	//retry_after:categories:scope, see https://develop.sentry.dev/sdk/rate-limiting/
+	w.Header().Set("X-Sentry-Rate-Limits", s+":"+strings.Join(categories, ";")+":key")
+	writeDetail(w, http.StatusTooManyRequests, "rate limited")
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testTableRateLimited = []struct {
+	retryAfter  time.Duration
+	categories  []string
+	description string
+	retry       string
+	limits      string
+}{
+	{time.Minute, nil, "all categories", "60", "60::key"},
+	{1500 * time.Millisecond, []string{"error", "transaction"}, "rounded up with categories", "2", "2:error;transaction:key"},
+	{0, []string{"attachment"}, "at least one second", "1", "1:attachment:key"},
+}
+
+func TestWriteRateLimited(t *testing.T) {
+	for _, test := range testTableRateLimited {
+		w := httptest.NewRecorder()
+		WriteRateLimited(w, test.retryAfter, test.categories)
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, http.StatusTooManyRequests, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != test.retry {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.retry, got)
+		}
+		if got := w.Header().Get("X-Sentry-Rate-Limits"); got != test.limits {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.limits, got)
+		}
+	}
+}
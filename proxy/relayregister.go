@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// registration routes official Relays call on their upstream
+const (
+	relayChallengePath = "/api/0/relays/register/challenge/"
+	relayResponsePath  = "/api/0/relays/register/response/"
+)
+
+// default lifetime of a registration challenge token
+const defaultChallengeTTL = time.Minute
+
+// largest registration request body accepted
+const maxRegisterBody = 64 << 10
+
+var errRelayNotAllowed = errors.New("sentry:  relay public key not allowed")
+
+// RelayRegistry implements the Relay registration handshake so downstream official Relays can use this proxy
+// as their upstream. A relay first posts its ID and public key to the challenge route and receives a token,
+// then posts the token back to the response route; both requests are signed with the relay's key.
+// Set it as sentrydsn.Parser.RelayKeys to trust relays as they register; Keys returns a snapshot of them.
+// A RelayRegistry is safe for concurrent use.
+type RelayRegistry struct {
+	// AllowedKeys lists the relay public keys permitted to register. Empty rejects every relay,
+	// since proving possession of a key says nothing about whether it should be trusted.
+	AllowedKeys  []ed25519.PublicKey
+	ChallengeTTL time.Duration   //how long a challenge token stays valid, one minute when unset
+	Clock        sentrydsn.Clock //tells the time for challenge tokens, the system clock when nil
+
+	once   sync.Once
+	secret []byte //signs challenge tokens
+
+	mu     sync.RWMutex
+	relays map[string]ed25519.PublicKey
+}
+
+type relayChallengeRequest struct {
+	RelayID   string `json:"relay_id"`
+	PublicKey string `json:"public_key"`
+	Version   string `json:"version,omitempty"`
+}
+
+type relayChallengeToken struct {
+	RelayID   string    `json:"relay_id"`
+	PublicKey string    `json:"public_key"`
+	Issued    time.Time `json:"issued"`
+}
+
+type relayChallengeResponse struct {
+	RelayID string `json:"relay_id"`
+	Token   string `json:"token"`
+}
+
+// ServeHTTP implements http.Handler for the challenge and response routes.
+func (rr *RelayRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var out interface{}
+	var err error
+	switch strings.TrimSuffix(r.URL.Path, "/") + "/" {
+	case relayChallengePath:
+		out, err = rr.challenge(r)
+	case relayResponsePath:
+		out, err = rr.respond(r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err == errRelayNotAllowed {
+		writeDetail(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeDetail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// Keys returns the public keys of registered relays by relay ID.
+func (rr *RelayRegistry) Keys() map[string]ed25519.PublicKey {
+
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	out := make(map[string]ed25519.PublicKey, len(rr.relays))
+	for id, k := range rr.relays {
+		out[id] = k
+	}
+	return out
+}
+
+// RelayKey implements sentrydsn.RelayKeys, returning the public key a relay registered with.
+func (rr *RelayRegistry) RelayKey(id string) (ed25519.PublicKey, bool) {
+
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	key, ok := rr.relays[id]
+	return key, ok
+}
+
+func (rr *RelayRegistry) challenge(r *http.Request) (interface{}, error) {
+
+	var req relayChallengeRequest
+	body, err := readRegisterBody(r, &req)
+	if err != nil {
+		return nil, err
+	}
+	key, err := sentrydsn.ParseRelayPublicKey(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyRegisterRequest(r, body, req.RelayID, key); err != nil {
+		return nil, err
+	}
+	if !rr.allowed(key) {
+		return nil, errRelayNotAllowed
+	}
+
+	payload, _ := json.Marshal(relayChallengeToken{RelayID: req.RelayID, PublicKey: req.PublicKey, Issued: sentrydsn.Now(rr.Clock).UTC()})
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(rr.sign(payload))
+	return relayChallengeResponse{RelayID: req.RelayID, Token: token}, nil
+}
+
+func (rr *RelayRegistry) respond(r *http.Request) (interface{}, error) {
+
+	var req relayChallengeResponse
+	body, err := readRegisterBody(r, &req)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(req.Token, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("sentry:  malformed challenge token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("sentry:  malformed challenge token")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, rr.sign(payload)) {
+		return nil, errors.New("sentry:  invalid challenge token")
+	}
+	var token relayChallengeToken
+	if err := json.Unmarshal(payload, &token); err != nil || token.RelayID != req.RelayID {
+		return nil, errors.New("sentry:  invalid challenge token")
+	}
+	ttl := rr.ChallengeTTL
+	if ttl <= 0 {
+		ttl = defaultChallengeTTL
+	}
+	if sentrydsn.Now(rr.Clock).Sub(token.Issued) > ttl {
+		return nil, errors.New("sentry:  challenge token expired")
+	}
+	key, err := sentrydsn.ParseRelayPublicKey(token.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyRegisterRequest(r, body, req.RelayID, key); err != nil {
+		return nil, err
+	}
+
+	rr.mu.Lock()
+	if rr.relays == nil {
+		rr.relays = map[string]ed25519.PublicKey{}
+	}
+	rr.relays[req.RelayID] = key
+	rr.mu.Unlock()
+
+	return map[string]string{"relay_id": req.RelayID}, nil
+}
+
+func (rr *RelayRegistry) allowed(key ed25519.PublicKey) bool {
+
+	for _, k := range rr.AllowedKeys {
+		if k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// sign MACs a challenge token payload with a per-registry secret generated on first use.
+func (rr *RelayRegistry) sign(payload []byte) []byte {
+
+	rr.once.Do(func() {
+		rr.secret = make([]byte, 32)
+		rand.Read(rr.secret)
+	})
+	h := hmac.New(sha256.New, rr.secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+func readRegisterBody(r *http.Request, v interface{}) ([]byte, error) {
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRegisterBody))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, errors.New("sentry:  malformed registration request")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// verifyRegisterRequest checks the request is signed by key and sent by the relay it claims to be.
+func verifyRegisterRequest(r *http.Request, body []byte, relayID string, key ed25519.PublicKey) error {
+
+	if len(relayID) == 0 || r.Header.Get("X-Sentry-Relay-Id") != relayID {
+		return sentrydsn.ErrInvalidRelaySignature
+	}
+	_, err := sentrydsn.VerifyRelaySignature(r, key, int64(len(body)))
+	return err
+}
+
+// writeDetail writes an error body in the {"detail": ...} shape Sentry's API uses.
+func writeDetail(w http.ResponseWriter, status int, detail string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+//setup
+
+const testRelayID = "88888888-4444-4444-8444-cccccccccccc"
+
+// registerRequest builds a registration request signed the way Relay signs it
+func registerRequest(path string, key ed25519.PrivateKey, body string) *http.Request {
+	header := []byte(`{"t":"` + time.Now().UTC().Format(time.RFC3339) + `"}`)
+	sig := ed25519.Sign(key, append(append(append([]byte{}, header...), 0), body...))
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("X-Sentry-Relay-Id", testRelayID)
+	r.Header.Set("X-Sentry-Relay-Signature", base64.RawURLEncoding.EncodeToString(sig)+"."+base64.RawURLEncoding.EncodeToString(header))
+	return r
+}
+
+// register runs the challenge step and returns the response code and token
+func register(rr *RelayRegistry, key ed25519.PrivateKey) (int, string) {
+	pub := base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	w := httptest.NewRecorder()
+	rr.ServeHTTP(w, registerRequest(relayChallengePath, key, `{"relay_id":"`+testRelayID+`","public_key":"`+pub+`","version":"24.1.0"}`))
+	var out relayChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return w.Code, out.Token
+}
+
+//tests
+
+func TestRelayRegistry(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	rr := &RelayRegistry{AllowedKeys: []ed25519.PublicKey{pub}}
+
+	if code, _ := register(rr, other); code != http.StatusForbidden {
+		t.Errorf("%s: Expected -- %v -- Got %v", "key not allowed", http.StatusForbidden, code)
+	}
+	code, token := register(rr, priv)
+	if code != http.StatusOK || len(token) == 0 {
+		t.Fatalf("%s: Expected -- %v -- Got %v", "challenge", http.StatusOK, code)
+	}
+
+	var testTableResponse = []struct {
+		key         ed25519.PrivateKey
+		token       string
+		description string
+		expected    int
+	}{
+		{other, token, "signed by another key", http.StatusBadRequest},
+		{priv, token + "x", "tampered token", http.StatusBadRequest},
+		{priv, "garbage", "malformed token", http.StatusBadRequest},
+		{priv, token, "valid response", http.StatusOK},
+	}
+	for _, test := range testTableResponse {
+		w := httptest.NewRecorder()
+		rr.ServeHTTP(w, registerRequest(relayResponsePath, test.key, `{"relay_id":"`+testRelayID+`","token":"`+test.token+`"}`))
+		if w.Code != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, w.Code)
+		}
+	}
+	if k, ok := rr.Keys()[testRelayID]; !ok || !k.Equal(pub) {
+		t.Errorf("%s: Expected -- %v -- Got %v", "registered key", true, ok)
+	}
+}
+
+func TestRelayRegistryExpiredToken(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	rr := &RelayRegistry{AllowedKeys: []ed25519.PublicKey{pub}, Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+
+	_, token := register(rr, priv)
+	now = now.Add(2 * time.Minute)
+	w := httptest.NewRecorder()
+	rr.ServeHTTP(w, registerRequest(relayResponsePath, priv, `{"relay_id":"`+testRelayID+`","token":"`+token+`"}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("%s: Expected -- %v -- Got %v", "expired token", http.StatusBadRequest, w.Code)
+	}
+	if len(rr.Keys()) != 0 {
+		t.Errorf("%s: Expected -- %v -- Got %v", "nothing registered", 0, len(rr.Keys()))
+	}
+}
+
+func TestRelayRegistryParser(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	rr := &RelayRegistry{AllowedKeys: []ed25519.PublicKey{pub}}
+	p := &sentrydsn.Parser{RelayKeys: rr, RequireRelaySignature: true}
+	body := "{}\n{\"type\":\"event\"}\n{}\n"
+	url := "https://sentry.io/api/1234/envelope/?sentry_key=" + testKey
+
+	if _, err := p.FromRequest(registerRequest(url, priv, body)); err != sentrydsn.ErrInvalidRelaySignature {
+		t.Errorf("%s: Expected -- %v -- Got %v", "not yet registered", sentrydsn.ErrInvalidRelaySignature, err)
+	}
+	_, token := register(rr, priv)
+	rr.ServeHTTP(httptest.NewRecorder(), registerRequest(relayResponsePath, priv, `{"relay_id":"`+testRelayID+`","token":"`+token+`"}`))
+	dsn, err := p.FromRequest(registerRequest(url, priv, body))
+	if err != nil || dsn.Relay == nil || dsn.Relay.ID != testRelayID {
+		t.Errorf("%s: Expected -- %v -- Got %v", "registered relay trusted", testRelayID, err)
+	}
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// Route sends requests whose DSN host matches Host to Upstream.
+type Route struct {
+	Host     string //inbound host, exact or a "*.example.com" wildcard, with an optional port
+	Upstream string //base url, e.g. https://o123.ingest.sentry.io, or https://sentry.example.com/sentry for self-hosted under a path
+}
+
+// RoutingTable maps the host requests arrive for onto upstreams, so one tunnel can front several Sentry
+// destinations, e.g. my-relay.example.com to o123.ingest.sentry.io and legacy.example.com to a self-hosted
+// install. Routes apply after parsing, to the DSN host, and the first matching route wins.
+type RoutingTable struct {
+	Routes []Route
+	// Strict refuses requests for hosts no route matches with sentrydsn.ErrUntrustedHost; otherwise they go
+	// to the tunnel's Upstreams or Upstream.
+	Strict bool
+}
+
+// Lookup returns the upstream of the first route matching host.
+func (rt *RoutingTable) Lookup(host string) (string, bool) {
+
+	for _, route := range rt.Routes {
+		if len(route.Host) > 0 && (sentrydsn.HostAllowlist{route.Host}).Allows(host) {
+			return route.Upstream, true
+		}
+	}
+	return "", false
+}
+
+// route returns the routed upstream for host, empty when the table is nil or no route matches.
+func (rt *RoutingTable) route(host string) (string, error) {
+
+	if rt == nil {
+		return "", nil
+	}
+	upstream, ok := rt.Lookup(host)
+	if !ok && rt.Strict {
+		return "", sentrydsn.ErrUntrustedHost
+	}
+	return upstream, nil
+}
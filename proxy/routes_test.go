@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+//setup
+
+var testTableRoutes = []struct {
+	host        string
+	strict      bool
+	description string
+	expected    string //upstream name, empty when refused
+}{
+	{"relay.example.com", false, "exact route", "sentry"},
+	{"RELAY.example.com:443", false, "canonical host with port", "sentry"},
+	{"legacy.example.com", false, "self-hosted route", "selfhosted"},
+	{"eu.legacy.example.com", false, "wildcard route", "selfhosted"},
+	{"other.example.org", false, "unrouted host uses the default upstream", "fallback"},
+	{"other.example.org", true, "unrouted host refused when strict", ""},
+}
+
+//tests
+
+func TestTunnelRoutes(t *testing.T) {
+	upstreams := map[string]*upstream{"sentry": newUpstream(http.StatusOK), "selfhosted": newUpstream(http.StatusOK), "fallback": newUpstream(http.StatusOK)}
+	for _, up := range upstreams {
+		defer up.Close()
+	}
+	routes := []Route{
+		{Host: "relay.example.com", Upstream: upstreams["sentry"].URL},
+		{Host: "legacy.example.com", Upstream: upstreams["selfhosted"].URL + "/sentry"},
+		{Host: "*.legacy.example.com", Upstream: upstreams["selfhosted"].URL + "/sentry"},
+	}
+
+	for _, test := range testTableRoutes {
+		tunnel := &Tunnel{Upstream: upstreams["fallback"].URL, Routes: &RoutingTable{Routes: routes, Strict: test.strict}}
+		counts := map[string]int{}
+		for name, up := range upstreams {
+			counts[name] = len(up.requests())
+		}
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://"+test.host+"/api/1234/envelope/", "{}\n"))
+
+		if len(test.expected) == 0 {
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s: Expected -- %d -- Got %d", test.description, http.StatusForbidden, w.Code)
+			}
+			continue
+		}
+		got := upstreams[test.expected].requests()
+		if len(got) != counts[test.expected]+1 {
+			t.Errorf("%s: Expected -- forwarded to %s -- Got %d %v", test.description, test.expected, w.Code, got)
+			continue
+		}
+		expected := "/api/1234/envelope/"
+		if test.expected == "selfhosted" {
+			expected = "/sentry/api/1234/envelope/"
+		}
+		if url := got[len(got)-1].url; url != expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, expected, url)
+		}
+	}
+}
+
+func TestRoutesBeforeRing(t *testing.T) {
+	ring := &UpstreamRing{Upstreams: []string{"https://a.example.com", "https://b.example.com"}}
+	tunnel := &Tunnel{Upstreams: ring, Routes: &RoutingTable{Routes: []Route{{Host: "relay.example.com", Upstream: "https://o1.ingest.sentry.io"}}}}
+
+	r := ingestRequest("https://relay.example.com/api/1234/envelope/", "{}\n")
+	dsn, _ := sentrydsn.FromRequest(r)
+	j, err := tunnel.job(r, dsn)
+	if err != nil || j.Upstream != "https://o1.ingest.sentry.io" || j.ring != nil {
+		t.Errorf("Expected -- routed upstream outside the ring -- Got %+v %v", j, err)
+	}
+	r = ingestRequest("https://other.example.com/api/1234/envelope/", "{}\n")
+	dsn, _ = sentrydsn.FromRequest(r)
+	j, err = tunnel.job(r, dsn)
+	if err != nil || j.ring != ring {
+		t.Errorf("Expected -- ring upstream -- Got %+v %v", j, err)
+	}
+}
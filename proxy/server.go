@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Server runs a Tunnel as a standalone relay, with an optional admin endpoint next to it and metrics and
+// profiles on a separate listener.
+// It speaks HTTP/1.1 and, when serving TLS, HTTP/2. Deployments behind a load balancer that
+// terminates TLS can opt into cleartext HTTP/2 (h2c) with EnableH2C.
+type Server struct {
+	Addr        string       //TCP listen address, e.g. ":8080"
+	Tunnel      http.Handler //serves every path not claimed below
+	Admin       *Admin       //mounted at /admin when set
+	EnablePprof bool         //serve CPU and runtime profiles under /debug/pprof/ on MetricsAddr, never on the ingest listeners
+	Metrics     *Metrics     //served at /metrics on MetricsAddr, or the ingest listeners with MetricsOnIngest
+	MetricsAddr string       //TCP address Metrics are served on, e.g. "127.0.0.1:9090", keeping scrapes off the ingest port
+	// MetricsOnIngest mounts Metrics at /metrics next to the Tunnel when MetricsAddr is empty, where anyone who
+	// can send events can read them, e.g. for a relay only reachable from inside the network.
+	MetricsOnIngest bool
+
+	TLSConfig *tls.Config //serve TLS with these certificates when set
+	CertFile  string      //alternatively serve TLS from a certificate and key file
+	KeyFile   string
+	EnableH2C bool //accept HTTP/2 without TLS, e.g. from a load balancer speaking h2c
+
+	UnixSocket     string      //also listen on this Unix socket path, e.g. for a sidecar sharing a pod with the app
+	UnixSocketMode os.FileMode //permissions applied to the socket file, 0660 when unset
+
+	// SocketActivation serves the listeners systemd passes in (LISTEN_FDS) instead of opening Addr and UnixSocket,
+	// falling back to them when the process was not socket activated. Lets systemd hold the socket across restarts.
+	SocketActivation bool
+
+	mu         sync.Mutex
+	srv        *http.Server
+	metricsSrv *http.Server
+}
+
+// Handler returns the server's routes.
+func (s *Server) Handler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.Tunnel)
+	if s.Admin != nil {
+		mux.Handle("/admin", s.Admin)
+	}
+	if s.Metrics != nil && len(s.MetricsAddr) == 0 && s.MetricsOnIngest {
+		mux.Handle("/metrics", s.Metrics)
+	}
+	return mux
+}
+
+// MetricsHandler returns the routes served on MetricsAddr: Metrics, and profiles when EnablePprof is set.
+func (s *Server) MetricsHandler() http.Handler {
+
+	mux := http.NewServeMux()
+	if s.Metrics != nil {
+		mux.Handle("/metrics", s.Metrics)
+	}
+	if s.EnablePprof {
+		mux.Handle("/debug/pprof/", pprofHandler())
+	}
+	return mux
+}
+
+// ListenAndServe listens on Addr and/or UnixSocket, and MetricsAddr when Metrics or EnablePprof are set, and
+// serves until Shutdown is called.
+// An empty Addr with no UnixSocket listens on :http like http.ListenAndServe.
+func (s *Server) ListenAndServe() error {
+
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.server()
+	errs := make(chan error, len(listeners)+1)
+	for _, l := range listeners {
+		go func(l net.Listener) { errs <- s.Serve(l) }(l)
+	}
+	n := len(listeners)
+	if (s.Metrics != nil || s.EnablePprof) && len(s.MetricsAddr) > 0 {
+		l, err := net.Listen("tcp", s.MetricsAddr)
+		if err != nil {
+			s.Shutdown(context.Background())
+			return err
+		}
+		n++
+		go func() { errs <- s.ServeMetrics(l) }()
+	}
+	var first error
+	for range n {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+			s.Shutdown(context.Background())
+		}
+	}
+	return first
+}
+
+// listen opens the configured TCP and Unix listeners, or adopts socket activated ones.
+func (s *Server) listen() ([]net.Listener, error) {
+
+	if s.SocketActivation {
+		listeners, err := SystemdListeners()
+		if err != nil || len(listeners) > 0 {
+			return listeners, err
+		}
+	}
+	var listeners []net.Listener
+	if len(s.Addr) > 0 || len(s.UnixSocket) == 0 {
+		addr := s.Addr
+		if len(addr) == 0 {
+			addr = ":http"
+		}
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	if len(s.UnixSocket) > 0 {
+		l, err := listenUnix(s.UnixSocket, s.UnixSocketMode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a Unix socket, replacing a stale socket file left by a previous process.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode == 0 {
+		mode = 0o660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve serves on l until Shutdown is called.
+func (s *Server) Serve(l net.Listener) error {
+
+	srv := s.server()
+	var err error
+	if s.TLSConfig != nil || len(s.CertFile) > 0 {
+		err = srv.ServeTLS(l, s.CertFile, s.KeyFile)
+	} else {
+		err = srv.Serve(l)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ServeMetrics serves MetricsHandler on l until Shutdown is called, for servers with a MetricsAddr.
+func (s *Server) ServeMetrics(l net.Listener) error {
+
+	s.mu.Lock()
+	if s.metricsSrv == nil {
+		s.metricsSrv = &http.Server{Handler: s.MetricsHandler()}
+	}
+	srv := s.metricsSrv
+	s.mu.Unlock()
+
+	if err := srv.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// server returns the underlying http.Server, creating it on first use.
+func (s *Server) server() *http.Server {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv == nil {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(s.EnableH2C)
+		s.srv = &http.Server{Handler: s.Handler(), TLSConfig: s.TLSConfig, Protocols: protocols}
+	}
+	return s.srv
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to finish or ctx to expire.
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	s.mu.Lock()
+	srv, metricsSrv := s.srv, s.metricsSrv
+	s.mu.Unlock()
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerRoutes(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Stats: &Stats{}}
+
+	var testTableRoutes = []struct {
+		server      *Server
+		path        string
+		description string
+		expected    int
+	}{
+		{&Server{Tunnel: tunnel}, "/debug/pprof/", "pprof off by default", http.StatusBadRequest},
+		{&Server{Tunnel: tunnel, EnablePprof: true}, "/debug/pprof/", "pprof never on the ingest port", http.StatusBadRequest},
+		{&Server{Tunnel: tunnel, EnablePprof: true, MetricsAddr: ":9090"}, "/debug/pprof/", "pprof on its own address", http.StatusBadRequest},
+		{&Server{Tunnel: tunnel, Admin: &Admin{Token: "s3cret", Tunnel: tunnel}}, "/admin", "admin mounted", http.StatusUnauthorized},
+		{&Server{Tunnel: tunnel, Metrics: &Metrics{Tunnel: tunnel}}, "/metrics", "metrics off the ingest port by default", http.StatusBadRequest},
+		{&Server{Tunnel: tunnel, Metrics: &Metrics{Tunnel: tunnel}, MetricsOnIngest: true}, "/metrics", "metrics mounted", http.StatusOK},
+		{&Server{Tunnel: tunnel, Metrics: &Metrics{Tunnel: tunnel}, MetricsAddr: ":9090"}, "/metrics", "metrics on their own address", http.StatusBadRequest},
+	}
+	for _, test := range testTableRoutes {
+		srv := httptest.NewServer(test.server.Handler())
+		resp, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expected {
+			t.Errorf("%s: Expected -- %d -- Got %d", test.description, test.expected, resp.StatusCode)
+		}
+		srv.Close()
+	}
+}
+
+func TestServerMetricsRoutes(t *testing.T) {
+	tunnel := &Tunnel{Stats: &Stats{}}
+
+	var testTableMetricsRoutes = []struct {
+		server      *Server
+		path        string
+		description string
+		expected    int
+	}{
+		{&Server{Metrics: &Metrics{Tunnel: tunnel}}, "/metrics", "metrics", http.StatusOK},
+		{&Server{Metrics: &Metrics{Tunnel: tunnel}}, "/debug/pprof/", "pprof off by default", http.StatusNotFound},
+		{&Server{EnablePprof: true}, "/metrics", "pprof without metrics", http.StatusNotFound},
+		{&Server{EnablePprof: true}, "/debug/pprof/", "pprof index", http.StatusOK},
+		{&Server{EnablePprof: true}, "/debug/pprof/goroutine?debug=1", "named profile", http.StatusOK},
+		{&Server{EnablePprof: true}, "/debug/pprof/nope", "unknown profile", http.StatusNotFound},
+	}
+	for _, test := range testTableMetricsRoutes {
+		w := httptest.NewRecorder()
+		test.server.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.expected {
+			t.Errorf("%s: Expected -- %d -- Got %d", test.description, test.expected, w.Code)
+		}
+	}
+}
+
+func TestServerPprofIndex(t *testing.T) {
+	s := &Server{EnablePprof: true}
+	w := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	b, _ := io.ReadAll(w.Body)
+	if !strings.Contains(string(b), "goroutine") || !strings.Contains(string(b), "profile") {
+		t.Errorf("Expected profile index -- Got %s", b)
+	}
+}
+
+// serve starts s on a loopback listener and returns its base url.
+func serve(t *testing.T, s *Server, scheme string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return scheme + "://" + l.Addr().String()
+}
+
+func TestServerHTTP2(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+
+	//reuse httptest's self-signed certificate for the relay
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certSrv.Close()
+	tlsConfig := &tls.Config{Certificates: certSrv.TLS.Certificates}
+
+	var testTableProtocols = []struct {
+		server      *Server
+		scheme      string
+		transport   *http.Transport
+		description string
+	}{
+		{&Server{Tunnel: &Tunnel{Upstream: up.URL}, TLSConfig: tlsConfig}, "https", h2Transport(certSrv), "h2 over TLS"},
+		{&Server{Tunnel: &Tunnel{Upstream: up.URL}, EnableH2C: true}, "http", h2cTransport(), "h2c"},
+	}
+	for _, test := range testTableProtocols {
+		base := serve(t, test.server, test.scheme)
+		r, _ := http.NewRequest("POST", base+"/api/1234/envelope/", strings.NewReader("{}\n"))
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key="+testKey)
+		resp, err := (&http.Client{Transport: test.transport}).Do(r)
+		if err != nil {
+			t.Fatalf("%s: Expected -- nil -- Got %s", test.description, err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: Expected -- HTTP/2 200 -- Got %s %d", test.description, resp.Proto, resp.StatusCode)
+		}
+	}
+	if len(up.requests()) != 2 {
+		t.Errorf("Expected -- 2 forwarded -- Got %d", len(up.requests()))
+	}
+}
+
+func TestServerWithoutH2C(t *testing.T) {
+	base := serve(t, &Server{Tunnel: http.NotFoundHandler()}, "http")
+	if _, err := (&http.Client{Transport: h2cTransport()}).Get(base + "/"); err == nil {
+		t.Errorf("Expected h2c to be refused unless enabled")
+	}
+}
+
+func h2Transport(certSrv *httptest.Server) *http.Transport {
+	tr := certSrv.Client().Transport.(*http.Transport).Clone()
+	tr.ForceAttemptHTTP2 = true
+	return tr
+}
+
+func h2cTransport() *http.Transport {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Transport{Protocols: protocols}
+}
+
+func TestServerUnixSocket(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	path := filepath.Join(t.TempDir(), "relay.sock")
+	s := &Server{Tunnel: &Tunnel{Upstream: up.URL}, Addr: "127.0.0.1:0", UnixSocket: path, UnixSocketMode: 0o600}
+	done := make(chan error)
+	go func() { done <- s.ListenAndServe() }()
+
+	var fi os.FileInfo
+	for i := 0; i < 100; i++ {
+		if fi, _ = os.Stat(path); fi != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fi == nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected socket with mode 0600 -- Got %v", fi)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	r, _ := http.NewRequest("POST", "http://relay/api/1234/envelope/", strings.NewReader("{}\n"))
+	r.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key="+testKey)
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(up.requests()) != 1 {
+		t.Errorf("Expected request over the socket forwarded -- Got %d", resp.StatusCode)
+	}
+
+	s.Shutdown(context.Background())
+	if err := <-done; err != nil {
+		t.Errorf("Expected -- nil -- Got %s", err)
+	}
+}
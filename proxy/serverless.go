@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// TunnelFromEnv configures a Tunnel from the environment, for serverless entrypoints without a config file:
+//
+//	SENTRY_UPSTREAM       base url requests are forwarded to, or a DSN pointing there
+//	SENTRY_ALLOWED_HOSTS  comma separated HostAllowlist entries
+//	SENTRY_MAX_BODY_SIZE  largest request body in bytes
+//	SENTRY_DSN_HEADER     read a full DSN from this header; "body" reads it from the JSON body instead
+//
+// Without SENTRY_UPSTREAM requests go to the host of their DSN, so SENTRY_ALLOWED_HOSTS must then say which
+// hosts those may be; with neither set, or with an unparsable SENTRY_MAX_BODY_SIZE, it returns an error.
+func TunnelFromEnv() (*Tunnel, error) {
+
+	t := &Tunnel{Upstream: os.Getenv("SENTRY_UPSTREAM")}
+	//a DSN pasted as upstream is reduced to its base url; invalid values are left for Check to report
+	if base, err := sentrydsn.ParseUpstream(t.Upstream); err == nil {
+		t.Upstream = base
+	}
+	for _, h := range strings.Split(os.Getenv("SENTRY_ALLOWED_HOSTS"), ",") {
+		if h = strings.TrimSpace(h); len(h) > 0 {
+			t.AllowedHosts = append(t.AllowedHosts, h)
+		}
+	}
+	if len(t.Upstream) == 0 && len(t.AllowedHosts) == 0 {
+		return nil, ErrNoUpstream
+	}
+	if raw := os.Getenv("SENTRY_MAX_BODY_SIZE"); len(raw) > 0 {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("sentry:  invalid SENTRY_MAX_BODY_SIZE %q", raw)
+		}
+		t.MaxBodySize = n
+	}
+	switch h := os.Getenv("SENTRY_DSN_HEADER"); h {
+	case "":
+	case "body":
+		t.Extractor = sentrydsn.BodyDSN(0)
+	default:
+		t.Extractor = sentrydsn.HeaderDSN(h)
+		t.CORSHeaders = []string{h}
+	}
+	return t, nil
+}
+
+// BehindPlatformProxy restores the scheme the client used from X-Forwarded-Proto, for platforms such as
+// Cloud Run, Cloud Functions and Azure Functions that terminate TLS in front of the handler. The Host header
+// already names the service there. X-Forwarded-Host is ignored: these platforms pass a client's value
+// through, which would let any client choose the host DSNs, and without SENTRY_UPSTREAM the upstream, point at.
+func BehindPlatformProxy(h http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if proto := r.Header.Get("X-Forwarded-Proto"); len(proto) > 0 {
+			r.URL.Scheme = strings.TrimSpace(strings.SplitN(proto, ",", 2)[0])
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTunnelFromEnv(t *testing.T) {
+	t.Setenv("SENTRY_UPSTREAM", "https://o1.ingest.sentry.io")
+	t.Setenv("SENTRY_ALLOWED_HOSTS", "*.ingest.sentry.io, sentry.example.com")
+	t.Setenv("SENTRY_MAX_BODY_SIZE", "1024")
+	t.Setenv("SENTRY_DSN_HEADER", "body")
+
+	tunnel, err := TunnelFromEnv()
+	if err != nil || tunnel.Upstream != "https://o1.ingest.sentry.io" || len(tunnel.AllowedHosts) != 2 || tunnel.AllowedHosts[1] != "sentry.example.com" || tunnel.MaxBodySize != 1024 || tunnel.Extractor == nil {
+		t.Errorf("Expected -- tunnel configured from the environment -- Got %+v %v", tunnel, err)
+	}
+}
+
+var testTableTunnelFromEnvErrors = []struct {
+	upstream    string
+	allowed     string
+	maxBody     string
+	description string
+}{
+	{"", "", "", "neither upstream nor allowed hosts"},
+	{"https://o1.ingest.sentry.io", "", "1MB", "unparsable body size"},
+	{"", "*.ingest.sentry.io", "-1", "negative body size"},
+}
+
+func TestTunnelFromEnvErrors(t *testing.T) {
+	for _, test := range testTableTunnelFromEnvErrors {
+		t.Setenv("SENTRY_UPSTREAM", test.upstream)
+		t.Setenv("SENTRY_ALLOWED_HOSTS", test.allowed)
+		t.Setenv("SENTRY_MAX_BODY_SIZE", test.maxBody)
+		if tunnel, err := TunnelFromEnv(); err == nil {
+			t.Errorf("%s: Expected -- an error -- Got %+v", test.description, tunnel)
+		}
+	}
+}
+
+func TestBehindPlatformProxy(t *testing.T) {
+	var host, scheme string
+	h := BehindPlatformProxy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, scheme = r.Host, r.URL.Scheme
+	}))
+	r := httptest.NewRequest("POST", "/api/1234/envelope/", nil)
+	r.Host = "tunnel-abc123-uc.a.run.app"
+	r.Header.Set("X-Forwarded-Host", "attacker.example.com")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if host != "tunnel-abc123-uc.a.run.app" || scheme != "https" {
+		t.Errorf("Expected -- tunnel-abc123-uc.a.run.app https -- Got %v %v", host, scheme)
+	}
+}
+
+func TestTunnelFromEnvDSN(t *testing.T) {
+	t.Setenv("SENTRY_UPSTREAM", "https://4784fbc50de2473f9977cfce8a9adce5@O1.Ingest.Sentry.io/1234")
+
+	if tunnel, err := TunnelFromEnv(); err != nil || tunnel.Upstream != "https://o1.ingest.sentry.io" {
+		t.Errorf("Expected -- https://o1.ingest.sentry.io -- Got %v %v", tunnel, err)
+	}
+}
@@ -0,0 +1,510 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// ProjectStats counts the requests the tunnel handled for one project.
+type ProjectStats struct {
+	Received   int64 `json:"received"`
+	Forwarded  int64 `json:"forwarded"`  //upstream answered below 500
+	Failed     int64 `json:"failed"`     //upstream unreachable or answered 500 and above
+	Rejected   int64 `json:"rejected"`   //refused because the queue was full
+	Overflowed int64 `json:"overflowed"` //acknowledged, then discarded by a full DropOldest queue
+	Deprecated int64 `json:"deprecated"` //authenticated in a deprecated way, see sentrydsn.Warning
+	Filtered   int64 `json:"filtered"`   //envelope items removed by Tunnel.Policies and Tunnel.Sampler
+	// InboundBytes and ForwardedBytes count request bodies plus headers, received from clients and sent
+	// upstream, see Bandwidth.
+	InboundBytes   int64 `json:"inbound_bytes"`
+	ForwardedBytes int64 `json:"forwarded_bytes"`
+}
+
+// Stats holds per-project and parse counters. The zero value is ready to use and safe for concurrent use;
+// set the exported fields before use.
+// Project IDs and public keys are client supplied, so at most MaxProjects projects and MaxLocations key
+// locations are counted on their own; the rest are counted under "other", as are endpoint types only
+// sentrydsn.Parser.AcceptAnyProjectEndpoint accepts.
+type Stats struct {
+	mu          sync.Mutex
+	projects    map[string]*ProjectStats
+	parsed      int64
+	parseErrors map[string]int64 //keyed by sentrydsn.ErrorKind
+	warnings    map[string]int64 //keyed by sentrydsn.Warning code
+	usage       map[usageKey]int64
+	locations   map[KeyLocation]int64 //Received is always zero in the keys
+	outcomes    map[Outcome]int64     //Count is always zero in the keys
+	shadowed    map[Outcome]int64     //decisions Tunnel.Shadow did not act on; Count is always zero in the keys
+	bandwidth   map[bandwidthKey]*Bandwidth
+	latency     latency
+	pruned      int64 //hour usage buckets were last pruned in
+
+	MaxProjects  int             //projects counted on their own, 1000 when unset
+	MaxLocations int             //key locations counted on their own, 10000 when unset
+	Clock        sentrydsn.Clock //tells the time for usage buckets, the system clock when nil
+}
+
+// defaults applied when the Stats fields are unset
+const (
+	defaultStatsProjects  = 1000
+	defaultStatsLocations = 10000
+)
+
+// project ID, endpoint type and public key counts beyond the Stats limits are folded into
+const otherKey = "other"
+
+// endpoint types counted under their own name
+var knownEndpoints = map[sentrydsn.EndpointType]bool{
+	sentrydsn.EndpointStore: true, sentrydsn.EndpointEnvelope: true, sentrydsn.EndpointNEL: true,
+	sentrydsn.EndpointReport: true, sentrydsn.EndpointFeedback: true, sentrydsn.EndpointOTLP: true,
+	sentrydsn.EndpointProfile: true, sentrydsn.EndpointMinidump: true, sentrydsn.EndpointUnreal: true,
+	sentrydsn.EndpointAttachment: true,
+}
+
+// what became of an accepted request
+const (
+	outcomeForwarded  = "forwarded"      //upstream answered below 500
+	outcomeFailed     = "failed"         //upstream unreachable or answered 500 and above
+	outcomeRejected   = "rejected"       //the queue was full
+	outcomeOverflowed = "queue_overflow" //acknowledged, then discarded by a full DropOldest queue
+	outcomeFiltered   = "filtered"       //Tunnel.Policies and Sampler left nothing to forward
+
+	outcomeRateLimited = "rate_limited" //Tunnel.RateLimit or Tunnel.Quota refused it
+)
+
+// decisions a tunnel in Shadow mode made without acting on them
+const (
+	shadowBlocked       = "blocked"        //AbuseGuard would have refused the client
+	shadowUntrustedHost = "untrusted_host" //Tunnel.AllowedHosts would have refused the DSN host
+	shadowFiltered      = "filtered"       //Tunnel.Policies or Sampler would have discarded items
+	shadowUnauthorized  = "unauthorized"   //Tunnel.Authorizer refused the key or could not decide
+	shadowRateLimited   = "rate_limited"   //Tunnel.RateLimit or Tunnel.Quota would have refused the request
+)
+
+// Outcome counts the requests of one project and endpoint that ended the same way:
+// "forwarded", "failed", "rejected", "filtered" or "rate_limited". Stats.Shadowed reuses it for the decisions of
+// a tunnel in Shadow mode: "blocked", "untrusted_host", "unauthorized", "rate_limited" or "filtered".
+type Outcome struct {
+	ProjectID string                 `json:"project_id"`
+	Endpoint  sentrydsn.EndpointType `json:"endpoint"`
+	Outcome   string                 `json:"outcome"`
+	Count     int64                  `json:"count"`
+}
+
+// Bandwidth counts the bytes of one project and endpoint's requests, bodies plus headers: Inbound as received
+// from clients, whether or not they were forwarded, and Forwarded as sent upstream, once per attempt that got
+// a response. Policies shrinking envelopes make Forwarded the smaller; retries make it the larger.
+type Bandwidth struct {
+	ProjectID string                 `json:"project_id"`
+	Endpoint  sentrydsn.EndpointType `json:"endpoint"`
+	Inbound   int64                  `json:"inbound"`
+	Forwarded int64                  `json:"forwarded"`
+}
+
+type bandwidthKey struct {
+	projectID string
+	endpoint  sentrydsn.EndpointType
+}
+
+// upper bounds in seconds of the forward latency histogram buckets, the Prometheus client defaults
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// latency is a histogram of upstream forward durations
+type latency struct {
+	counts []int64 //per bucket, not cumulative; the last counts durations above every bound
+	sum    float64 //seconds
+	count  int64
+}
+
+// usage is bucketed by the hour, so Export ranges are accurate to the hour
+type usageKey struct {
+	hour      int64 //unix seconds of the start of the hour
+	projectID string
+	endpoint  sentrydsn.EndpointType
+}
+
+// how long usage buckets are kept for Export
+const usageRetention = 31 * 24 * time.Hour
+
+// parse counts one DSN extraction, successful when err is nil.
+func (s *Stats) parse(err error) {
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.parsed++
+	if err != nil {
+		if s.parseErrors == nil {
+			s.parseErrors = map[string]int64{}
+		}
+		s.parseErrors[sentrydsn.ErrorKind(err)]++
+	}
+}
+
+// Parses returns the number of DSN extractions attempted and the failures among them by error kind.
+func (s *Stats) Parses() (int64, map[string]int64) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make(map[string]int64, len(s.parseErrors))
+	for k, v := range s.parseErrors {
+		errs[k] = v
+	}
+	return s.parsed, errs
+}
+
+// warn counts the deprecation and shadow warnings raised for an accepted request.
+func (s *Stats) warn(dsn *sentrydsn.DSN) {
+
+	if s == nil || len(dsn.Warnings) == 0 {
+		return
+	}
+	for _, w := range dsn.Warnings {
+		if !w.Shadow() {
+			s.add(dsn.ProjectID, func(p *ProjectStats) { p.Deprecated++ })
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.warnings == nil {
+		s.warnings = map[string]int64{}
+	}
+	for _, w := range dsn.Warnings {
+		s.warnings[w.Code]++
+	}
+}
+
+// Warnings returns the number of deprecation and shadow warnings raised by code.
+func (s *Stats) Warnings() map[string]int64 {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]int64, len(s.warnings))
+	for k, v := range s.warnings {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Stats) add(projectID string, f func(p *ProjectStats)) {
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f(s.projects[s.project(projectID)])
+}
+
+// project returns the ID projectID is counted under, itself or "other" once MaxProjects are counted, and
+// makes sure it has ProjectStats; s.mu must be held.
+func (s *Stats) project(projectID string) string {
+
+	if _, ok := s.projects[projectID]; ok {
+		return projectID
+	}
+	maxProjects := s.MaxProjects
+	if maxProjects <= 0 {
+		maxProjects = defaultStatsProjects
+	}
+	if s.projects == nil {
+		s.projects = map[string]*ProjectStats{}
+	}
+	if len(s.projects) >= maxProjects {
+		projectID = otherKey
+		if _, ok := s.projects[projectID]; ok {
+			return projectID
+		}
+	}
+	s.projects[projectID] = &ProjectStats{}
+	return projectID
+}
+
+// series returns the project ID and endpoint type dsn is counted under; s.mu must be held.
+func (s *Stats) series(dsn *sentrydsn.DSN) (string, sentrydsn.EndpointType) {
+
+	endpoint := dsn.Endpoint
+	if len(endpoint) > 0 && !knownEndpoints[endpoint] {
+		endpoint = otherKey
+	}
+	return s.project(dsn.ProjectID), endpoint
+}
+
+// Snapshot returns a copy of the counters keyed by project ID.
+func (s *Stats) Snapshot() map[string]ProjectStats {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]ProjectStats, len(s.projects))
+	for id, p := range s.projects {
+		out[id] = *p
+	}
+	return out
+}
+
+// receive counts an accepted request in the project's counters and usage buckets.
+func (s *Stats) receive(dsn *sentrydsn.DSN) {
+
+	if s == nil {
+		return
+	}
+	s.add(dsn.ProjectID, func(p *ProjectStats) { p.Received++ })
+
+	hour := sentrydsn.Now(s.Clock).Truncate(time.Hour).Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usage == nil {
+		s.usage = map[usageKey]int64{}
+	}
+	if hour != s.pruned {
+		//the first request of an hour drops the expired buckets
+		s.pruned = hour
+		oldest := hour - int64(usageRetention/time.Second)
+		for k := range s.usage {
+			if k.hour < oldest {
+				delete(s.usage, k)
+			}
+		}
+	}
+	projectID, endpoint := s.series(dsn)
+	s.usage[usageKey{hour, projectID, endpoint}]++
+
+	if dsn.Geo != nil {
+		maxLocations := s.MaxLocations
+		if maxLocations <= 0 {
+			maxLocations = defaultStatsLocations
+		}
+		if s.locations == nil {
+			s.locations = map[KeyLocation]int64{}
+		}
+		l := KeyLocation{PublicKey: dsn.PublicKey, Country: dsn.Geo.Country, ASN: dsn.Geo.ASN}
+		if _, ok := s.locations[l]; !ok && len(s.locations) >= maxLocations {
+			l = KeyLocation{PublicKey: otherKey}
+		}
+		s.locations[l]++
+	}
+}
+
+// outcome counts how an accepted request ended.
+func (s *Stats) outcome(dsn *sentrydsn.DSN, outcome string) {
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.outcomes == nil {
+		s.outcomes = map[Outcome]int64{}
+	}
+	projectID, endpoint := s.series(dsn)
+	s.outcomes[Outcome{ProjectID: projectID, Endpoint: endpoint, Outcome: outcome}]++
+}
+
+// shadow counts a decision Tunnel.Shadow did not act on.
+func (s *Stats) shadow(dsn *sentrydsn.DSN, decision string) {
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shadowed == nil {
+		s.shadowed = map[Outcome]int64{}
+	}
+	projectID, endpoint := s.series(dsn)
+	s.shadowed[Outcome{ProjectID: projectID, Endpoint: endpoint, Outcome: decision}]++
+}
+
+// transferred counts bytes received from a client and forwarded upstream for dsn.
+func (s *Stats) transferred(dsn *sentrydsn.DSN, inbound, forwarded int64) {
+
+	if s == nil {
+		return
+	}
+	s.add(dsn.ProjectID, func(p *ProjectStats) {
+		p.InboundBytes += inbound
+		p.ForwardedBytes += forwarded
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bandwidth == nil {
+		s.bandwidth = map[bandwidthKey]*Bandwidth{}
+	}
+	projectID, endpoint := s.series(dsn)
+	k := bandwidthKey{projectID, endpoint}
+	b, ok := s.bandwidth[k]
+	if !ok {
+		b = &Bandwidth{ProjectID: projectID, Endpoint: endpoint}
+		s.bandwidth[k] = b
+	}
+	b.Inbound += inbound
+	b.Forwarded += forwarded
+}
+
+// Bandwidth returns the bytes received and forwarded by project and endpoint, sorted.
+func (s *Stats) Bandwidth() []Bandwidth {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Bandwidth, 0, len(s.bandwidth))
+	for _, b := range s.bandwidth {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProjectID != out[j].ProjectID {
+			return out[i].ProjectID < out[j].ProjectID
+		}
+		return out[i].Endpoint < out[j].Endpoint
+	})
+	return out
+}
+
+// headerSize approximates the bytes h takes on the wire, "Name: value\r\n" per value.
+func headerSize(h http.Header) int64 {
+
+	var n int64
+	for k, vs := range h {
+		for _, v := range vs {
+			n += int64(len(k) + len(v) + 4)
+		}
+	}
+	return n
+}
+
+// forwarded counts a forward attempt that took d.
+func (s *Stats) forwarded(dsn *sentrydsn.DSN, d time.Duration, failed bool) {
+
+	if s == nil {
+		return
+	}
+	outcome := outcomeForwarded
+	if failed {
+		outcome = outcomeFailed
+	}
+	s.add(dsn.ProjectID, func(p *ProjectStats) {
+		if failed {
+			p.Failed++
+		} else {
+			p.Forwarded++
+		}
+	})
+	s.outcome(dsn, outcome)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latency.counts == nil {
+		s.latency.counts = make([]int64, len(latencyBuckets)+1)
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	s.latency.counts[i]++
+	s.latency.sum += seconds
+	s.latency.count++
+}
+
+// latencies returns the forward latency histogram: per bucket counts, the sum in seconds and the count.
+func (s *Stats) latencies() ([]int64, float64, int64) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make([]int64, len(latencyBuckets)+1)
+	copy(counts, s.latency.counts)
+	return counts, s.latency.sum, s.latency.count
+}
+
+// Outcomes returns how accepted requests ended by project and endpoint, sorted.
+func (s *Stats) Outcomes() []Outcome {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedOutcomes(s.outcomes)
+}
+
+// Shadowed returns the decisions a tunnel in Shadow mode made without acting on them, by project and
+// endpoint, sorted.
+func (s *Stats) Shadowed() []Outcome {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedOutcomes(s.shadowed)
+}
+
+// sortedOutcomes returns counts as Outcomes sorted by project, endpoint and outcome.
+func sortedOutcomes(counts map[Outcome]int64) []Outcome {
+
+	out := make([]Outcome, 0, len(counts))
+	for o, n := range counts {
+		o.Count = n
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProjectID != out[j].ProjectID {
+			return out[i].ProjectID < out[j].ProjectID
+		}
+		if out[i].Endpoint != out[j].Endpoint {
+			return out[i].Endpoint < out[j].Endpoint
+		}
+		return out[i].Outcome < out[j].Outcome
+	})
+	return out
+}
+
+// KeyLocation counts the requests a public key sent from one country and network.
+type KeyLocation struct {
+	PublicKey string `json:"public_key"`
+	Country   string `json:"country,omitempty"`
+	ASN       uint32 `json:"asn,omitempty"`
+	Received  int64  `json:"received"`
+}
+
+// Locations returns where each public key was used from, for requests enriched by sentrydsn.GeoEnricher,
+// sorted by public key then by descending count.
+func (s *Stats) Locations() []KeyLocation {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]KeyLocation, 0, len(s.locations))
+	for l, n := range s.locations {
+		l.Received = n
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].PublicKey != out[j].PublicKey {
+			return out[i].PublicKey < out[j].PublicKey
+		}
+		if out[i].Received != out[j].Received {
+			return out[i].Received > out[j].Received
+		}
+		if out[i].Country != out[j].Country {
+			return out[i].Country < out[j].Country
+		}
+		return out[i].ASN < out[j].ASN
+	})
+	return out
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func TestStatsLimits(t *testing.T) {
+	//setup
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := &Stats{MaxProjects: 2, MaxLocations: 1, Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	for _, projectID := range []string{"1", "2", "3", "4", "1"} {
+		dsn := &sentrydsn.DSN{ProjectID: projectID, PublicKey: "key" + projectID, Endpoint: sentrydsn.EndpointEnvelope, Geo: &sentrydsn.Geo{Country: "DE"}}
+		s.receive(dsn)
+		s.outcome(dsn, outcomeForwarded)
+	}
+	s.outcome(&sentrydsn.DSN{ProjectID: "1", Endpoint: "custom"}, outcomeForwarded)
+
+	//tests
+	snapshot := s.Snapshot()
+	if len(snapshot) != 3 || snapshot["1"].Received != 2 || snapshot["2"].Received != 1 || snapshot[otherKey].Received != 2 {
+		t.Errorf("Expected -- 1, 2 and other -- Got %+v", snapshot)
+	}
+	outcomes := s.Outcomes()
+	expected := []Outcome{{"1", "envelope", "forwarded", 2}, {"1", "other", "forwarded", 1}, {"2", "envelope", "forwarded", 1}, {"other", "envelope", "forwarded", 2}}
+	if len(outcomes) != len(expected) {
+		t.Fatalf("Expected -- %v -- Got %v", expected, outcomes)
+	}
+	for i := range expected {
+		if outcomes[i] != expected[i] {
+			t.Errorf("Expected -- %v -- Got %v", expected[i], outcomes[i])
+		}
+	}
+	locations := s.Locations()
+	if len(locations) != 2 || locations[0].PublicKey != "key1" || locations[1].PublicKey != otherKey || locations[1].Received != 3 {
+		t.Errorf("Expected -- key1 and other -- Got %v", locations)
+	}
+}
+
+func TestStatsUsagePruned(t *testing.T) {
+	//setup
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := &Stats{Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	s.receive(&sentrydsn.DSN{ProjectID: "1234", Endpoint: sentrydsn.EndpointStore})
+
+	//tests
+	now = now.Add(usageRetention + 2*time.Hour)
+	s.receive(&sentrydsn.DSN{ProjectID: "1234", Endpoint: sentrydsn.EndpointStore})
+	if len(s.usage) != 1 {
+		t.Errorf("Expected -- the expired bucket dropped -- Got %v", s.usage)
+	}
+}
+
+func TestStatsWarnings(t *testing.T) {
+	s := &Stats{}
+	s.warn(&sentrydsn.DSN{ProjectID: "1234", Warnings: []sentrydsn.Warning{sentrydsn.ShadowWarning(sentrydsn.ErrUntrustedHost)}})
+	s.warn(&sentrydsn.DSN{ProjectID: "1234", Warnings: []sentrydsn.Warning{sentrydsn.WarnQueryAuth, sentrydsn.WarnSecretKey}})
+	if p := s.Snapshot()["1234"]; p.Deprecated != 1 {
+		t.Errorf("Expected -- 1 deprecated -- Got %+v", p)
+	}
+	if got := s.Warnings(); got["shadow_untrusted_host"] != 1 || got["query_string_auth"] != 1 || got["secret_key"] != 1 {
+		t.Errorf("Expected -- every warning counted by code -- Got %v", got)
+	}
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// SystemdListeners returns the listeners passed in by systemd socket activation (LISTEN_FDS), in order,
+// or nil when the process was not socket activated. The activation variables are unset so child processes
+// do not inherit them. Only the first call returns the listeners.
+func SystemdListeners() ([]net.Listener, error) {
+	return activatedListeners(listenFDsStart)
+}
+
+func activatedListeners(start int) ([]net.Listener, error) {
+
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := start; fd < start+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("sentry:  socket activation fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestActivatedListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	defer l.Close()
+	f, _ := l.(*net.TCPListener).File()
+	defer f.Close()
+
+	//not activated for this process
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	if got, err := activatedListeners(int(f.Fd())); got != nil || err != nil {
+		t.Errorf("Expected -- nil nil -- Got %v %v", got, err)
+	}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	got, err := activatedListeners(int(f.Fd()))
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Expected -- 1 listener -- Got %v %v", got, err)
+	}
+	defer got[0].Close()
+	if got[0].Addr().String() != l.Addr().String() {
+		t.Errorf("Expected -- %s -- Got %s", l.Addr(), got[0].Addr())
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("Expected activation variables to be unset")
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// ErrReadTimeout Thrown if the client does not send its request body within the endpoint's Timeout.Read
+var ErrReadTimeout = errors.New("sentry:  timed out reading request body")
+
+// Timeout bounds the phases of handling a request, see Tunnel.Timeouts. Zero durations do not limit.
+type Timeout struct {
+	Read    time.Duration //receiving the request body from the client
+	Forward time.Duration //forwarding upstream, up to the end of the upstream response
+}
+
+// timeout returns the Timeout for endpoint, falling back to the "" entry of Tunnel.Timeouts.
+func (t *Tunnel) timeout(endpoint sentrydsn.EndpointType) Timeout {
+
+	if to, ok := t.Timeouts[endpoint]; ok {
+		return to
+	}
+	return t.Timeouts[""]
+}
+
+// readDeadline sets the connection read deadline for the request body of dsn's endpoint, or the deadline of
+// the request context if nearer, and returns the function lifting it again.
+// Writers that cannot set deadlines, such as httptest.ResponseRecorder, read without one.
+func (t *Tunnel) readDeadline(w http.ResponseWriter, r *http.Request, dsn *sentrydsn.DSN) func() {
+
+	d := t.timeout(dsn.Endpoint).Read
+	if d <= 0 {
+		return func() {}
+	}
+	deadline := sentrydsn.Now(t.Clock).Add(d)
+	if ctxDeadline, ok := r.Context().Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		return func() {}
+	}
+	return func() { rc.SetReadDeadline(time.Time{}) }
+}
+
+// forwardContext bounds ctx by the forward timeout of endpoint.
+func (t *Tunnel) forwardContext(ctx context.Context, endpoint sentrydsn.EndpointType) (context.Context, context.CancelFunc) {
+
+	if d := t.timeout(endpoint).Forward; d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return ctx, func() {}
+}
+
+// cancelBody releases a forward's context once the caller is done with the upstream response.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
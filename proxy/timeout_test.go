@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/spool"
+)
+
+//setup
+
+// slowUpstream answers 200 after delay
+func slowUpstream(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("{}"))
+	}))
+}
+
+var testTableForwardTimeout = []struct {
+	path        string
+	description string
+	expected    int
+}{
+	{"/api/1234/envelope/", "default timeout", http.StatusGatewayTimeout},
+	{"/api/1234/store/", "endpoint without limit", http.StatusOK},
+}
+
+//tests
+
+func TestTunnelForwardTimeout(t *testing.T) {
+	up := slowUpstream(50 * time.Millisecond)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Timeouts: map[sentrydsn.EndpointType]Timeout{
+		"":                      {Forward: 10 * time.Millisecond},
+		sentrydsn.EndpointStore: {},
+	}}
+	for _, test := range testTableForwardTimeout {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com"+test.path, "{}"))
+		if w.Code != test.expected {
+			t.Errorf("%s: Expected -- %d -- Got %d %s", test.description, test.expected, w.Code, w.Body)
+		}
+	}
+}
+
+func TestTunnelReadTimeout(t *testing.T) {
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Timeouts: map[sentrydsn.EndpointType]Timeout{sentrydsn.EndpointEnvelope: {Read: 20 * time.Millisecond}}}
+	srv := httptest.NewServer(tunnel)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	//announce ten bytes, send two and stall
+	conn.Write([]byte("POST /api/1234/envelope/?sentry_key=" + testKey + " HTTP/1.1\r\nHost: relay.example.com\r\nContent-Length: 10\r\n\r\n{}"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Expected -- a response -- Got %v", err)
+	}
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusRequestTimeout, resp.StatusCode)
+	}
+	if len(up.requests()) != 0 {
+		t.Errorf("Expected -- nothing forwarded -- Got %v", up.requests())
+	}
+}
+
+func TestTunnelReplayTimeout(t *testing.T) {
+	up := slowUpstream(50 * time.Millisecond)
+	defer up.Close()
+	tunnel := &Tunnel{Upstream: up.URL, Timeouts: map[sentrydsn.EndpointType]Timeout{
+		"":                         {Forward: 10 * time.Millisecond},
+		sentrydsn.EndpointEnvelope: {},
+	}}
+	//replays get the timeout of the endpoint they were spooled from
+	if err := tunnel.Replay(&spool.Entry{URL: up.URL + "/api/1234/envelope/", Endpoint: "envelope"}); err != nil {
+		t.Errorf("Expected -- nil -- Got %v", err)
+	}
+	if err := tunnel.Replay(&spool.Entry{URL: up.URL + "/api/1234/store/", Endpoint: "store"}); err == nil {
+		t.Errorf("Expected -- the default timeout -- Got nil")
+	}
+}
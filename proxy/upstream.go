@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// defaults applied when the UpstreamRing fields are unset
+const (
+	defaultRingReplicas     = 100
+	defaultFailureThreshold = 3
+	defaultUpstreamCooldown = 30 * time.Second
+)
+
+// UpstreamRing spreads projects over several upstream ingest hosts, e.g. regional self-hosted clusters, by
+// consistent hashing on the project ID: a project's traffic sticks to one upstream, and adding or removing an
+// upstream only moves the projects hashed to it. An upstream failing FailureThreshold times in a row is
+// skipped for Cooldown, its projects moving to the next upstream on the ring meanwhile. When every upstream
+// is down the project's own is used anyway. Configure it before use; it is safe for concurrent use.
+type UpstreamRing struct {
+	Upstreams        []string        //base urls, e.g. https://sentry-eu.example.com
+	Replicas         int             //points per upstream on the ring, defaults to 100
+	FailureThreshold int             //consecutive failures that take an upstream out, defaults to 3
+	Cooldown         time.Duration   //how long a failed upstream is skipped, defaults to 30s
+	Clock            sentrydsn.Clock //tells the time for cooldowns, the system clock when nil
+
+	once   sync.Once
+	points []ringPoint //sorted by hash
+
+	mu     sync.Mutex
+	health map[string]*upstreamHealth
+}
+
+type ringPoint struct {
+	hash     uint64
+	upstream string
+}
+
+type upstreamHealth struct {
+	failures  int
+	downUntil time.Time
+}
+
+// Pick returns the upstream for projectID.
+func (u *UpstreamRing) Pick(projectID string) string {
+
+	u.once.Do(u.build)
+	if len(u.points) == 0 {
+		return ""
+	}
+	h := ringHash(projectID)
+	i := sort.Search(len(u.points), func(i int) bool { return u.points[i].hash >= h })
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := sentrydsn.Now(u.Clock)
+	for n := 0; n < len(u.points); n++ {
+		p := u.points[(i+n)%len(u.points)]
+		if hs, ok := u.health[p.upstream]; !ok || !now.Before(hs.downUntil) {
+			return p.upstream
+		}
+	}
+	return u.points[i%len(u.points)].upstream
+}
+
+// Report records the outcome of forwarding to upstream.
+func (u *UpstreamRing) Report(upstream string, failed bool) {
+
+	threshold := u.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	cooldown := u.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultUpstreamCooldown
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.health == nil {
+		u.health = map[string]*upstreamHealth{}
+	}
+	hs, ok := u.health[upstream]
+	if !ok {
+		hs = &upstreamHealth{}
+		u.health[upstream] = hs
+	}
+	if !failed {
+		hs.failures = 0
+		return
+	}
+	hs.failures++
+	if hs.failures >= threshold {
+		hs.failures = 0
+		hs.downUntil = sentrydsn.Now(u.Clock).Add(cooldown)
+	}
+}
+
+func (u *UpstreamRing) build() {
+
+	replicas := u.Replicas
+	if replicas <= 0 {
+		replicas = defaultRingReplicas
+	}
+	for _, upstream := range u.Upstreams {
+		upstream = strings.TrimSuffix(upstream, "/")
+		for i := 0; i < replicas; i++ {
+			u.points = append(u.points, ringPoint{ringHash(upstream + "#" + strconv.Itoa(i)), upstream})
+		}
+	}
+	sort.Slice(u.points, func(i, j int) bool { return u.points[i].hash < u.points[j].hash })
+}
+
+func ringHash(s string) uint64 {
+
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	//FNV barely mixes trailing bytes into the high bits, finish with murmur3's fmix64 so replicas spread out
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func TestUpstreamRingSticky(t *testing.T) {
+	ring := &UpstreamRing{Upstreams: []string{"https://a.example.com", "https://b.example.com", "https://c.example.com/"}}
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		project := strconv.Itoa(i)
+		got := ring.Pick(project)
+		if again := ring.Pick(project); again != got {
+			t.Fatalf("%s: Expected -- %s -- Got %s", project, got, again)
+		}
+		counts[got]++
+	}
+	for _, upstream := range []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"} {
+		if counts[upstream] < 600 {
+			t.Errorf("%s: Expected -- about 1000 projects -- Got %d", upstream, counts[upstream])
+		}
+	}
+
+	//removing an upstream only moves its own projects
+	smaller := &UpstreamRing{Upstreams: []string{"https://a.example.com", "https://b.example.com"}}
+	for i := 0; i < 3000; i++ {
+		project := strconv.Itoa(i)
+		if before := ring.Pick(project); before != "https://c.example.com" && smaller.Pick(project) != before {
+			t.Errorf("%s: Expected -- %s -- Got %s", project, before, smaller.Pick(project))
+		}
+	}
+}
+
+func TestUpstreamRingFailover(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ring := &UpstreamRing{Upstreams: []string{"https://a.example.com", "https://b.example.com"}, FailureThreshold: 2, Cooldown: 30 * time.Second,
+		Clock: sentrydsn.ClockFunc(func() time.Time { return now })}
+	primary := ring.Pick("1234")
+
+	ring.Report(primary, true)
+	ring.Report(primary, false)
+	ring.Report(primary, true)
+	if got := ring.Pick("1234"); got != primary {
+		t.Errorf("Expected -- failures reset by a success -- Got %s", got)
+	}
+	ring.Report(primary, true)
+	failover := ring.Pick("1234")
+	if failover == primary || len(failover) == 0 {
+		t.Errorf("Expected -- other upstream -- Got %s", failover)
+	}
+
+	//with every upstream down the project's own is used
+	for i := 0; i < 2; i++ {
+		ring.Report(failover, true)
+	}
+	if got := ring.Pick("1234"); got != primary {
+		t.Errorf("Expected -- %s -- Got %s", primary, got)
+	}
+
+	now = now.Add(31 * time.Second)
+	if got := ring.Pick("1234"); got != primary {
+		t.Errorf("Expected -- %s after cooldown -- Got %s", primary, got)
+	}
+}
+
+func TestTunnelUpstreamRing(t *testing.T) {
+	down := newUpstream(http.StatusServiceUnavailable)
+	defer down.Close()
+	up := newUpstream(http.StatusOK)
+	defer up.Close()
+	ring := &UpstreamRing{Upstreams: []string{down.URL, up.URL}, FailureThreshold: 1, Cooldown: time.Minute}
+	tunnel := &Tunnel{Upstreams: ring}
+
+	//find a project hashed to the failing upstream
+	project := ""
+	for i := 1; len(project) == 0; i++ {
+		if ring.Pick(strconv.Itoa(i)) == down.URL {
+			project = strconv.Itoa(i)
+		}
+	}
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		tunnel.ServeHTTP(w, ingestRequest("https://relay.example.com/api/"+project+"/envelope/", "{}\n"))
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusServiceUnavailable || codes[1] != http.StatusOK || len(up.requests()) != 1 {
+		t.Errorf("Expected -- [503 200] then served by the healthy upstream -- Got %v", codes)
+	}
+}
@@ -0,0 +1,107 @@
+package sentrydsn
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrInvalidToken Thrown if a token cannot be reversed by the tokenizer
+var ErrInvalidToken = errors.New("sentry:  invalid token")
+
+// Tokenizer swaps sensitive strings for reversible tokens. kind names the field ("url", "host", "port",
+// "path_prefix", "public_key", "secret_key") so implementations can keep tokens of different fields apart.
+type Tokenizer interface {
+	Tokenize(kind string, value string) (string, error)
+	Detokenize(kind string, token string) (string, error)
+}
+
+// Pseudonymize returns a copy of the DSN with URL, Host, Port, PathPrefix, PublicKey and SecretKey replaced by
+// tokens, so request metadata can go to systems that must not hold real credentials or installation details.
+// Empty fields stay empty.
+func (d *DSN) Pseudonymize(t Tokenizer) (*DSN, error) {
+	return d.mapStrings(t.Tokenize)
+}
+
+// Reidentify reverses Pseudonymize.
+func (d *DSN) Reidentify(t Tokenizer) (*DSN, error) {
+	return d.mapStrings(t.Detokenize)
+}
+
+func (d *DSN) mapStrings(f func(kind string, s string) (string, error)) (*DSN, error) {
+
+	out := *d
+	for _, field := range []struct {
+		kind string
+		v    *string
+	}{
+		{"url", &out.URL},
+		{"host", &out.Host},
+		{"port", &out.Port},
+		{"path_prefix", &out.PathPrefix},
+		{"public_key", &out.PublicKey},
+		{"secret_key", &out.SecretKey},
+	} {
+		if len(*field.v) == 0 {
+			continue
+		}
+		s, err := f(field.kind, *field.v)
+		if err != nil {
+			return nil, err
+		}
+		*field.v = s
+	}
+	return &out, nil
+}
+
+// cipherTokenizer encrypts values with AES-GCM under a nonce derived from the value, so equal values
+// get equal tokens and pseudonymized data can still be grouped and joined.
+type cipherTokenizer struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// NewCipherTokenizer returns a deterministic Tokenizer keyed with a 16, 24 or 32 byte AES key.
+// Tokens are unpadded base64url and only reverse under the same key and kind.
+func NewCipherTokenizer(key []byte) (Tokenizer, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("sentrydsn nonce"))
+	return &cipherTokenizer{aead: aead, mac: mac.Sum(nil)}, nil
+}
+
+func (c *cipherTokenizer) Tokenize(kind string, value string) (string, error) {
+
+	h := hmac.New(sha256.New, c.mac)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	nonce := h.Sum(nil)[:c.aead.NonceSize()]
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), []byte(kind))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *cipherTokenizer) Detokenize(kind string, token string) (string, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) < c.aead.NonceSize() {
+		return "", ErrInvalidToken
+	}
+	n := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, b[:n], b[n:], []byte(kind))
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,57 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPseudonymize(t *testing.T) {
+	tok, err := NewCipherTokenizer([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	p := &Parser{Tokenizer: tok}
+	r := httptest.NewRequest("POST", "https://sentry.io/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", strings.NewReader("{}"))
+	got, err := p.FromRequest(r)
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	if strings.Contains(got.URL, "4784fbc50de2473f9977cfce8a9adce5") || strings.Contains(got.Host, "sentry.io") || got.PublicKey == "4784fbc50de2473f9977cfce8a9adce5" {
+		t.Errorf("Expected -- no real values -- Got %+v", got)
+	}
+	if got.ProjectID != "1234" || got.Endpoint != EndpointStore {
+		t.Errorf("Expected -- project and endpoint kept -- Got %+v", got)
+	}
+
+	again, _ := p.FromRequest(httptest.NewRequest("POST", "https://sentry.io/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", strings.NewReader("{}")))
+	if again.PublicKey != got.PublicKey {
+		t.Errorf("Expected -- equal values to get equal tokens -- Got %v %v", got.PublicKey, again.PublicKey)
+	}
+
+	real, err := got.Reidentify(tok)
+	if err != nil || real.URL != "https://4784fbc50de2473f9977cfce8a9adce5@sentry.io/1234" || real.Host != "sentry.io" {
+		t.Errorf("Expected -- the original DSN -- Got %+v %v", real, err)
+	}
+
+	//tokens only reverse as the field they were issued for
+	if _, err := tok.Detokenize("host", got.PublicKey); err != ErrInvalidToken {
+		t.Errorf("Expected -- %v -- Got %v", ErrInvalidToken, err)
+	}
+}
+
+func TestPseudonymizePortAndPrefix(t *testing.T) {
+	tok, _ := NewCipherTokenizer([]byte("0123456789abcdef0123456789abcdef"))
+	d, err := ParseDSN("https://4784fbc50de2473f9977cfce8a9adce5@sentry.example.com:9000/sentry/1234")
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	got, err := d.Pseudonymize(tok)
+	if err != nil || got.Port == "9000" || got.PathPrefix == "/sentry" || len(got.Port) == 0 || len(got.PathPrefix) == 0 {
+		t.Errorf("Expected -- port and path prefix tokenized -- Got %+v %v", got, err)
+	}
+	real, err := got.Reidentify(tok)
+	if err != nil || real.Port != "9000" || real.PathPrefix != "/sentry" {
+		t.Errorf("Expected -- the original DSN -- Got %+v %v", real, err)
+	}
+}
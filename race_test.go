@@ -0,0 +1,6 @@
+//go:build race
+
+package sentrydsn
+
+// the race detector allocates on its own, which would trip allocation budgets
+const raceEnabled = true
@@ -0,0 +1,17 @@
+module github.com/sentry-demos/sentrydsn/redisstore
+
+go 1.24
+
+require (
+	github.com/alicebob/miniredis/v2 v2.35.0
+	github.com/redis/go-redis/v9 v9.7.3
+	github.com/sentry-demos/sentrydsn v0.0.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
+
+replace github.com/sentry-demos/sentrydsn => ../
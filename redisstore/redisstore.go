@@ -0,0 +1,58 @@
+// Package redisstore keeps sentrydsn caches and proxy rate limit and quota counts in Redis, so a horizontally
+// scaled fleet of tunnels parses each request shape once and enforces one limit rather than one per instance:
+//
+//	store := redisstore.New(redis.NewClient(&redis.Options{Addr: "redis:6379"}))
+//	cache := &sentrydsn.Cache{Shared: store}
+//	parser := &sentrydsn.Parser{ResolveProject: lookup, ResolveCache: store}
+//	tunnel := &proxy.Tunnel{
+//		RateLimit: &proxy.RateLimit{Limit: 100, Counter: store},
+//		Quota:     &proxy.Quota{Default: 1000000, Counter: store},
+//	}
+//
+// It lives in its own module so sentrydsn itself does not depend on a Redis client.
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrScript adds one to KEYS[1] and starts its expiry of ARGV[1] milliseconds on the first hit, in one round
+// trip and atomically, so a crash between the two cannot leave a count that never expires.
+const incrScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`
+
+// Store is a sentrydsn.SharedCache and a proxy.Counter backed by Redis. Any go-redis client works, including
+// cluster and ring clients; the counter's script touches a single key. A Store is safe for concurrent use.
+type Store struct {
+	client redis.Cmdable
+}
+
+// New returns a Store using client.
+func New(client redis.Cmdable) *Store {
+	return &Store{client: client}
+}
+
+// Get implements sentrydsn.SharedCache.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// Set implements sentrydsn.SharedCache.
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Incr implements proxy.Counter.
+func (s *Store) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return s.client.Eval(ctx, incrScript, []string{key}, max(ttl.Milliseconds(), 1)).Int64()
+}
@@ -0,0 +1,103 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+// interfaces the Store implements
+var (
+	_ sentrydsn.SharedCache = (*Store)(nil)
+	_ proxy.Counter         = (*Store)(nil)
+)
+
+func newStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client), m
+}
+
+//tests
+
+func TestStore(t *testing.T) {
+	//setup
+	s, m := newStore(t)
+	ctx := context.Background()
+
+	//tests
+	if err := s.Set(ctx, "a", []byte("1234"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(ctx, "a"); err != nil || string(v) != "1234" {
+		t.Errorf("Expected -- 1234 -- Got %q %v", v, err)
+	}
+	if v, err := s.Get(ctx, "missing"); err != nil || v != nil {
+		t.Errorf("Expected -- nil for a missing key -- Got %q %v", v, err)
+	}
+	m.FastForward(2 * time.Minute)
+	if v, err := s.Get(ctx, "a"); err != nil || v != nil {
+		t.Errorf("Expected -- nil for an expired key -- Got %q %v", v, err)
+	}
+}
+
+func TestStoreIncr(t *testing.T) {
+	//setup
+	s, m := newStore(t)
+	ctx := context.Background()
+
+	//tests
+	for want := int64(1); want <= 3; want++ {
+		if n, err := s.Incr(ctx, "k", time.Minute); err != nil || n != want {
+			t.Errorf("Expected -- %d -- Got %d %v", want, n, err)
+		}
+	}
+	//the expiry starts with the first hit and is not pushed back by later ones
+	if ttl := m.TTL("k"); ttl != time.Minute {
+		t.Errorf("Expected -- %v -- Got %v", time.Minute, ttl)
+	}
+	m.FastForward(time.Minute)
+	if n, err := s.Incr(ctx, "k", time.Minute); err != nil || n != 1 {
+		t.Errorf("Expected -- 1 after expiry -- Got %d %v", n, err)
+	}
+
+	m.Close()
+	if _, err := s.Incr(ctx, "k", time.Minute); err == nil {
+		t.Errorf("Expected -- an error without Redis -- Got nil")
+	}
+}
+
+func TestStoreSharedRateLimit(t *testing.T) {
+	//setup
+	s, _ := newStore(t)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	//two tunnel instances, each with its own RateLimit, sharing the store
+	tunnels := []*proxy.Tunnel{
+		{Upstream: up.URL, RateLimit: &proxy.RateLimit{Limit: 3, Window: time.Hour, Counter: s}},
+		{Upstream: up.URL, RateLimit: &proxy.RateLimit{Limit: 3, Window: time.Hour, Counter: s}},
+	}
+
+	//tests
+	var accepted int
+	for i := 0; i < 6; i++ {
+		r := httptest.NewRequest("POST", "https://relay.example.com/api/1234/envelope/", nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		w := httptest.NewRecorder()
+		tunnels[i%2].ServeHTTP(w, r)
+		if w.Code == http.StatusOK {
+			accepted++
+		}
+	}
+	if accepted != 3 {
+		t.Errorf("Expected -- 3 accepted across the fleet -- Got %d", accepted)
+	}
+}
@@ -0,0 +1,186 @@
+package sentrydsn
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ExtractorFactory builds an Extractor from its JSON configuration, which is empty when none was given.
+type ExtractorFactory func(config json.RawMessage) (Extractor, error)
+
+// Mapper adjusts the DSNs an Extractor derives by wrapping it, the way GeoEnricher and MetadataEnricher do.
+type Mapper func(e Extractor) Extractor
+
+// MapperFactory builds a Mapper from its JSON configuration, which is empty when none was given.
+type MapperFactory func(config json.RawMessage) (Mapper, error)
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]ExtractorFactory{}
+	mappersMu    sync.RWMutex
+	mappers      = map[string]MapperFactory{}
+)
+
+func init() {
+	RegisterExtractor("request", newRequestExtractor)
+	RegisterExtractor("header", newHeaderExtractor)
+	RegisterExtractor("body", newBodyExtractor)
+	RegisterMapper("metadata", newMetadataMapper)
+}
+
+// RegisterExtractor makes an extractor available to NewExtractor by name, so builds can add their own and
+// select them from configuration, the way database/sql drivers register. It is usually called from init
+// and panics if name is already registered or factory is nil.
+func RegisterExtractor(name string, factory ExtractorFactory) {
+
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	if factory == nil {
+		panic("sentry:  RegisterExtractor factory is nil")
+	}
+	if _, dup := extractors[name]; dup {
+		panic("sentry:  RegisterExtractor called twice for " + name)
+	}
+	extractors[name] = factory
+}
+
+// NewExtractor builds the extractor registered as name with its JSON configuration.
+// Built in are "request" (a Parser), "header" (HeaderDSN) and "body" (BodyDSN).
+func NewExtractor(name string, config json.RawMessage) (Extractor, error) {
+
+	extractorsMu.RLock()
+	factory, ok := extractors[name]
+	extractorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("sentry:  unknown extractor %q", name)
+	}
+	return factory(config)
+}
+
+// Extractors returns the names of the registered extractors, sorted.
+func Extractors() []string {
+
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	names := make([]string, 0, len(extractors))
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterMapper makes a mapper available to NewMapper by name, e.g. one rewriting DSNs onto a new Sentry org,
+// so configuration can chain it behind an extractor. Like RegisterExtractor it panics if name is already
+// registered or factory is nil.
+func RegisterMapper(name string, factory MapperFactory) {
+
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+
+	if factory == nil {
+		panic("sentry:  RegisterMapper factory is nil")
+	}
+	if _, dup := mappers[name]; dup {
+		panic("sentry:  RegisterMapper called twice for " + name)
+	}
+	mappers[name] = factory
+}
+
+// NewMapper builds the mapper registered as name with its JSON configuration.
+// Built in is "metadata" (MetadataEnricher), configured with the ProjectMetadata itself.
+func NewMapper(name string, config json.RawMessage) (Mapper, error) {
+
+	mappersMu.RLock()
+	factory, ok := mappers[name]
+	mappersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("sentry:  unknown mapper %q", name)
+	}
+	return factory(config)
+}
+
+// Mappers returns the names of the registered mappers, sorted.
+func Mappers() []string {
+
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+
+	names := make([]string, 0, len(mappers))
+	for name := range mappers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeConfig unmarshals a component configuration, leaving v untouched when there is none.
+func decodeConfig(config json.RawMessage, v interface{}) error {
+
+	if len(config) == 0 {
+		return nil
+	}
+	return json.Unmarshal(config, v)
+}
+
+func newRequestExtractor(config json.RawMessage) (Extractor, error) {
+
+	var c struct {
+		AllowedHosts             []string `json:"allowed_hosts"`
+		CompatRelay              bool     `json:"compat_relay"`
+		AcceptAnyProjectEndpoint bool     `json:"accept_any_project_endpoint"`
+		StrictContentType        bool     `json:"strict_content_type"`
+		//project ID to metadata such as team or cost center, see MetadataEnricher
+		ProjectMetadata ProjectMetadata `json:"project_metadata"`
+	}
+	if err := decodeConfig(config, &c); err != nil {
+		return nil, err
+	}
+	p := &Parser{
+		AllowedHosts:             c.AllowedHosts,
+		CompatRelay:              c.CompatRelay,
+		AcceptAnyProjectEndpoint: c.AcceptAnyProjectEndpoint,
+		StrictContentType:        c.StrictContentType,
+	}
+	if len(c.ProjectMetadata) > 0 {
+		return MetadataEnricher(p, c.ProjectMetadata), nil
+	}
+	return p, nil
+}
+
+func newHeaderExtractor(config json.RawMessage) (Extractor, error) {
+
+	var c struct {
+		Header string `json:"header"`
+	}
+	if err := decodeConfig(config, &c); err != nil {
+		return nil, err
+	}
+	return HeaderDSN(c.Header), nil
+}
+
+func newBodyExtractor(config json.RawMessage) (Extractor, error) {
+
+	var c struct {
+		Limit int64 `json:"limit"`
+	}
+	if err := decodeConfig(config, &c); err != nil {
+		return nil, err
+	}
+	return BodyDSN(c.Limit), nil
+}
+
+func newMetadataMapper(config json.RawMessage) (Mapper, error) {
+
+	var md ProjectMetadata
+	if err := decodeConfig(config, &md); err != nil {
+		return nil, err
+	}
+	return func(e Extractor) Extractor {
+		return MetadataEnricher(e, md)
+	}, nil
+}
@@ -0,0 +1,83 @@
+package sentrydsn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// registrations outlive a test run, e.g. under -count
+var registerTenant sync.Once
+
+var testTableRegistry = []struct {
+	name        string
+	config      string
+	header      string
+	description string
+	expected    string
+	err         error
+}{
+	{"request", ``, "", "parser without configuration", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", nil},
+	{"request", `{"allowed_hosts":["sentry.example.com"]}`, "", "parser with allowlist", "", ErrUntrustedHost},
+	{"header", `{"header":"X-Tunnel-DSN"}`, "X-Tunnel-DSN", "custom header", "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/42", nil},
+	{"tenant", ``, "", "registered by the build", "https://4784fbc50de2473f9977cfce8a9adce5@tenant.example.com/7", nil},
+}
+
+func TestRegistry(t *testing.T) {
+	registerTenant.Do(func() {
+		RegisterExtractor("tenant", func(config json.RawMessage) (Extractor, error) {
+			return ExtractorFunc(func(r *http.Request) (*DSN, error) {
+				return ParseDSN("https://4784fbc50de2473f9977cfce8a9adce5@tenant.example.com/7")
+			}), nil
+		})
+	})
+	for _, test := range testTableRegistry {
+		e, err := NewExtractor(test.name, json.RawMessage(test.config))
+		if err != nil {
+			t.Errorf("%s: Expected -- nil -- Got %v", test.description, err)
+			continue
+		}
+		r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+		if len(test.header) > 0 {
+			r.Header.Set(test.header, "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/42")
+		}
+		got, err := e.Extract(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+		} else if err == nil && got.URL != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got.URL)
+		}
+	}
+	if _, err := NewExtractor("missing", nil); err == nil {
+		t.Errorf("Expected -- unknown extractor error -- Got nil")
+	}
+	if names := Extractors(); len(names) != 4 || names[0] != "body" || names[3] != "tenant" {
+		t.Errorf("Expected -- [body header request tenant] -- Got %v", names)
+	}
+}
+
+func TestMapperRegistry(t *testing.T) {
+	m, err := NewMapper("metadata", json.RawMessage(`{"1234":{"team":"payments"}}`))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", nil)
+	dsn, err := m(&Parser{}).Extract(r)
+	if err != nil || dsn.Metadata["team"] != "payments" {
+		t.Errorf("Expected -- team payments -- Got %+v %v", dsn, err)
+	}
+	if _, err := NewMapper("metadata", json.RawMessage(`[]`)); err == nil {
+		t.Errorf("Expected -- config error -- Got nil")
+	}
+	if _, err := NewMapper("missing", nil); err == nil {
+		t.Errorf("Expected -- unknown mapper error -- Got nil")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected -- panic on duplicate registration -- Got none")
+		}
+	}()
+	RegisterMapper("metadata", newMetadataMapper)
+}
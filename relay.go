@@ -0,0 +1,117 @@
+package sentrydsn
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const http_x_sentry_relay_id = "X-Sentry-Relay-Id"
+const http_x_sentry_relay_signature = "X-Sentry-Relay-Signature"
+
+// largest body read to verify a relay signature when no limit is given
+const defaultMaxSignedBodySize = 40 << 20
+
+var (
+	// ErrInvalidRelaySignature Thrown if a relay signature is malformed, from an unknown relay or does not match the body
+	ErrInvalidRelaySignature = errors.New("sentry:  invalid relay signature")
+	// ErrMissingRelaySignature Thrown if Parser.RequireRelaySignature is set and the request is not signed
+	ErrMissingRelaySignature = errors.New("sentry:  missing relay signature")
+)
+
+// RelayIdentity identifies the official Relay that signed a request.
+type RelayIdentity struct {
+	ID     string    //X-Sentry-Relay-Id of the signing relay
+	Signed time.Time //timestamp from the signature header
+}
+
+// ParseRelayPublicKey decodes a relay public key as printed by `relay credentials show` (unpadded base64url).
+func ParseRelayPublicKey(s string) (ed25519.PublicKey, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("sentry:  invalid relay public key")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// RelayKeys looks up the public keys of trusted relays by relay ID. Implementations must be safe for
+// concurrent use.
+type RelayKeys interface {
+	RelayKey(id string) (ed25519.PublicKey, bool)
+}
+
+// verifyRelaySignature checks the X-Sentry-Relay-Signature of r against TrustedRelays and RelayKeys.
+// Returns nil, nil for unsigned requests. The body is restored for forwarding.
+func (p *Parser) verifyRelaySignature(r *http.Request) (*RelayIdentity, error) {
+
+	if len(r.Header.Get(http_x_sentry_relay_signature)) == 0 {
+		if p.RequireRelaySignature {
+			return nil, ErrMissingRelaySignature
+		}
+		return nil, nil
+	}
+	relayID := r.Header.Get(http_x_sentry_relay_id)
+	key, ok := p.TrustedRelays[relayID]
+	if !ok && p.RelayKeys != nil {
+		key, ok = p.RelayKeys.RelayKey(relayID)
+	}
+	if !ok {
+		return nil, ErrInvalidRelaySignature
+	}
+	id, err := VerifyRelaySignature(r, key, p.MaxSignedBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if p.MaxSignatureAge > 0 {
+		if age := Now(p.Clock).Sub(id.Signed); age > p.MaxSignatureAge || age < -p.MaxSignatureAge {
+			return nil, ErrStaleAuth
+		}
+	}
+	return id, nil
+}
+
+// VerifyRelaySignature checks that r was signed by the holder of key, the way official Relays sign requests
+// to their upstream: <base64url signature>.<base64url header json> in X-Sentry-Relay-Signature, where the
+// signature covers <header json> 0x00 <body>. At most maxBody bytes of body are read (40MB when <= 0);
+// the body is restored for later reads.
+func VerifyRelaySignature(r *http.Request, key ed25519.PublicKey, maxBody int64) (*RelayIdentity, error) {
+
+	parts := strings.SplitN(r.Header.Get(http_x_sentry_relay_signature), ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidRelaySignature
+	}
+	rawSig, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidRelaySignature
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidRelaySignature
+	}
+
+	if maxBody <= 0 {
+		maxBody = defaultMaxSignedBodySize
+	}
+	body, err := peekBody(r, maxBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	signed := make([]byte, 0, len(header)+1+len(body))
+	signed = append(append(append(signed, header...), 0), body...)
+	if !ed25519.Verify(key, signed, rawSig) {
+		return nil, ErrInvalidRelaySignature
+	}
+
+	var sh struct {
+		T time.Time `json:"t"`
+	}
+	if err := json.Unmarshal(header, &sh); err != nil {
+		return nil, ErrInvalidRelaySignature
+	}
+	return &RelayIdentity{ID: r.Header.Get(http_x_sentry_relay_id), Signed: sh.T}, nil
+}
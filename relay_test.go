@@ -0,0 +1,99 @@
+package sentrydsn
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setup
+
+const testRelayID = "88888888-4444-4444-8444-cccccccccccc"
+
+// signRelay signs a request the way Relay does
+func signRelay(r *http.Request, key ed25519.PrivateKey, body string, signed time.Time) {
+	header := []byte(`{"t":"` + signed.UTC().Format(time.RFC3339) + `"}`)
+	sig := ed25519.Sign(key, append(append(append([]byte{}, header...), 0), body...))
+	r.Header.Set("X-Sentry-Relay-Id", testRelayID)
+	r.Header.Set("X-Sentry-Relay-Signature", base64.RawURLEncoding.EncodeToString(sig)+"."+base64.RawURLEncoding.EncodeToString(header))
+}
+
+func relayRequest(body string) *http.Request {
+	r := httptest.NewRequest("POST", "https://sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", strings.NewReader(body))
+	return r
+}
+
+//tests
+
+func TestRelaySignature(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ParseRelayPublicKey(base64.RawURLEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	p := &Parser{TrustedRelays: map[string]ed25519.PublicKey{testRelayID: key}, MaxSignatureAge: time.Minute}
+	body := "{}\n{\"type\":\"event\"}\n{}\n"
+
+	var testTableRelay = []struct {
+		sign        func(r *http.Request)
+		description string
+		expected    error
+	}{
+		{func(r *http.Request) {}, "unsigned request allowed", nil},
+		{func(r *http.Request) { signRelay(r, priv, body, time.Now()) }, "valid signature", nil},
+		{func(r *http.Request) { signRelay(r, other, body, time.Now()) }, "signed by another key", ErrInvalidRelaySignature},
+		{func(r *http.Request) { signRelay(r, priv, "tampered", time.Now()) }, "body does not match", ErrInvalidRelaySignature},
+		{func(r *http.Request) {
+			signRelay(r, priv, body, time.Now())
+			r.Header.Set("X-Sentry-Relay-Id", "unknown")
+		}, "unknown relay", ErrInvalidRelaySignature},
+		{func(r *http.Request) { signRelay(r, priv, body, time.Now().Add(-time.Hour)) }, "stale signature", ErrStaleAuth},
+		{func(r *http.Request) { r.Header.Set("X-Sentry-Relay-Signature", "garbage") }, "malformed signature", ErrInvalidRelaySignature},
+	}
+	for _, test := range testTableRelay {
+		r := relayRequest(body)
+		test.sign(r)
+		got, err := p.FromRequest(r)
+		if err != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, err)
+			continue
+		}
+		if err == nil && r.Header.Get("X-Sentry-Relay-Signature") != "" && (got.Relay == nil || got.Relay.ID != testRelayID) {
+			t.Errorf("%s: Expected relay identity -- Got %v", test.description, got.Relay)
+		}
+		//the body must still be forwardable
+		if b, _ := io.ReadAll(r.Body); string(b) != body {
+			t.Errorf("%s: Expected body restored -- Got %s", test.description, b)
+		}
+	}
+
+	p.RequireRelaySignature = true
+	if _, err := p.FromRequest(relayRequest(body)); err != ErrMissingRelaySignature {
+		t.Errorf("Expected -- %s -- Got %v", ErrMissingRelaySignature, err)
+	}
+}
+
+func TestRelaySignatureEmbed(t *testing.T) {
+	const embed = "https://sentry.io/api/embed/error-page/?dsn=https%3A%2F%2F4784fbc50de2473f9977cfce8a9adce5%40sentry.io%2F1234"
+	var testTableEmbed = []struct {
+		parser      *Parser
+		description string
+		expected    error
+	}{
+		{&Parser{RequireRelaySignature: true}, "unsigned embed refused", ErrMissingRelaySignature},
+		{&Parser{MaxAuthAge: time.Minute}, "embed without timestamp refused", ErrStaleAuth},
+		{&Parser{RequireRelaySignature: true, Shadow: true}, "shadowed", nil},
+	}
+	for _, test := range testTableEmbed {
+		if _, err := test.parser.FromRequest(httptest.NewRequest("GET", embed, nil)); err != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package sentrydsn
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ErrUnsupportedEndpoint Thrown if DSN.NewRequest cannot address the endpoint type it was given
+var ErrUnsupportedEndpoint = errors.New("sentry:  unsupported endpoint")
+
+// paths NewRequest addresses, after /api/<project_id>/
+var endpointPaths = map[EndpointType]string{
+	EndpointStore:    "store/",
+	EndpointEnvelope: "envelope/",
+	EndpointNEL:      "nel/",
+	EndpointReport:   "security/",
+	EndpointMinidump: "minidump/",
+	EndpointOTLP:     "integration/otlp/v1/traces",
+	EndpointProfile:  "profile/",
+}
+
+// NewRequest builds a request sending body to d's ingest endpoint, the counterpart of FromRequest:
+// the URL is derived from d, including a self-hosted path prefix, X-Sentry-Auth is written by SetAuth
+// with opts and Content-Type is the endpoint's usual type. Unreal requests carry the key in the path and feedback requests the whole DSN
+// in the query string instead. Attachment uploads need an event ID and fail with ErrUnsupportedEndpoint.
+func (d *DSN) NewRequest(endpoint EndpointType, body io.Reader, opts ...AuthOption) (*http.Request, error) {
+
+	scheme := d.Scheme
+	if len(scheme) == 0 {
+		scheme = "https"
+	}
+	base := scheme + "://" + d.Host + d.PathPrefix + "/api/"
+
+	var r *http.Request
+	var err error
+	switch endpoint {
+	case EndpointFeedback:
+		return http.NewRequest(http.MethodGet, base+"embed/error-page/?dsn="+url.QueryEscape(d.URL), nil)
+	case EndpointUnreal:
+		r, err = http.NewRequest(http.MethodPost, base+d.ProjectID+"/unreal/"+d.PublicKey+"/", body)
+	default:
+		path, ok := endpointPaths[endpoint]
+		if !ok {
+			return nil, ErrUnsupportedEndpoint
+		}
+		if r, err = http.NewRequest(http.MethodPost, base+d.ProjectID+"/"+path, body); err != nil {
+			return nil, err
+		}
+		d.SetAuth(r, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if types := endpointContentTypes[endpoint]; len(types) > 0 {
+		r.Header.Set("Content-Type", types[0])
+	}
+	return r, nil
+}
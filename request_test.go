@@ -0,0 +1,107 @@
+package sentrydsn
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+//setup
+
+// randomDSN returns a valid DSN over the schemes, hosts, ports, regions and self-hosted path prefixes SDKs
+// are configured with
+func randomDSN(rnd *rand.Rand, secret bool, prefix bool) string {
+
+	const hexChars = "0123456789abcdef"
+	key := func() string {
+		var b strings.Builder
+		for i := 0; i < 32; i++ {
+			b.WriteByte(hexChars[rnd.IntN(16)])
+		}
+		return b.String()
+	}
+	label := func() string {
+		const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+		var b strings.Builder
+		for i, n := 0, 1+rnd.IntN(12); i < n; i++ {
+			b.WriteByte(chars[rnd.IntN(len(chars))])
+		}
+		return b.String()
+	}
+
+	scheme := []string{"https", "http"}[rnd.IntN(2)]
+	var host string
+	switch rnd.IntN(4) {
+	case 0:
+		host = fmt.Sprintf("o%d.ingest.%ssentry.io", rnd.IntN(1000000), []string{"", "us.", "de."}[rnd.IntN(3)])
+	case 1:
+		host = label() + "-" + label() + "." + label() + ".example.com"
+	case 2:
+		host = fmt.Sprintf("10.%d.%d.%d", rnd.IntN(256), rnd.IntN(256), rnd.IntN(256))
+	case 3:
+		host = fmt.Sprintf("[2001:db8::%x]", 1+rnd.IntN(0xffff))
+	}
+	if rnd.IntN(2) == 0 {
+		host += fmt.Sprintf(":%d", 1+rnd.IntN(65535))
+	}
+	user := key()
+	if secret {
+		user += ":" + key()
+	}
+	var path string
+	for i, n := 0, rnd.IntN(4); prefix && i < n; i++ {
+		//segments that look like part of an ingest path must not confuse the parser
+		path += "/" + []string{label(), "api", "store", fmt.Sprint(rnd.IntN(10000))}[rnd.IntN(4)]
+	}
+	return fmt.Sprintf("%s://%s@%s%s/%d", scheme, user, host, path, 1+rnd.IntN(1000000000))
+}
+
+//tests
+
+// TestRequestRoundTrip checks FromRequest(d.NewRequest(...)) gives back d. Derived DSNs always use https,
+// since a server cannot tell which scheme SDKs were configured with, so only the feedback endpoint, which
+// carries the whole DSN, keeps http. Relay routes are anchored at /api/, so those DSNs have no path prefix.
+func TestRequestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	endpoints := []EndpointType{EndpointStore, EndpointEnvelope, EndpointNEL, EndpointReport, EndpointOTLP, EndpointProfile, EndpointFeedback, EndpointMinidump, EndpointUnreal}
+
+	for i := 0; i < 5000; i++ {
+		endpoint := endpoints[rnd.IntN(len(endpoints))]
+		p := &Parser{}
+		//minidump and unreal are Relay routes, and Relay never keeps the secret key
+		relay := endpoint == EndpointMinidump || endpoint == EndpointUnreal
+		if relay {
+			p.CompatRelay = true
+		}
+		raw := randomDSN(rnd, !relay && rnd.IntN(2) == 0, !relay)
+		d, err := ParseDSN(raw)
+		if err != nil {
+			t.Fatalf("%s: Expected -- valid dsn -- Got %v", raw, err)
+		}
+		r, err := d.NewRequest(endpoint, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%s %s: Expected -- request -- Got %v", raw, endpoint, err)
+		}
+		got, err := p.FromRequest(r)
+		if err != nil {
+			t.Errorf("%s %s: Expected -- nil -- Got %v", raw, endpoint, err)
+			continue
+		}
+		expected := d.URL
+		if endpoint != EndpointFeedback {
+			expected = "https" + strings.TrimPrefix(strings.TrimPrefix(expected, "https"), "http")
+		}
+		if got.URL != expected || got.Host != d.Host || got.Port != d.Port || got.PathPrefix != d.PathPrefix || got.ProjectID != d.ProjectID ||
+			got.PublicKey != d.PublicKey || got.SecretKey != d.SecretKey || got.Endpoint != endpoint {
+			t.Errorf("%s %s: Expected -- %v -- Got %+v", raw, endpoint, expected, got)
+		}
+	}
+}
+
+func TestNewRequestUnsupported(t *testing.T) {
+	d, _ := ParseDSN("https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234")
+	if _, err := d.NewRequest(EndpointAttachment, nil); err != ErrUnsupportedEndpoint {
+		t.Errorf("Expected -- %v -- Got %v", ErrUnsupportedEndpoint, err)
+	}
+}
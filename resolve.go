@@ -0,0 +1,125 @@
+package sentrydsn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// defaults for the times project lookups are remembered
+const (
+	defaultResolveNegativeTTL = 30 * time.Second
+	defaultResolveTTL         = time.Hour
+)
+
+// prefix of the keys resolved project IDs are written to Parser.ResolveCache under
+const resolveCachePrefix = "sentrydsn:project:"
+
+// resolveCall is a lookup in flight; later callers for the same key wait for it
+type resolveCall struct {
+	wg        sync.WaitGroup
+	projectID string
+	err       error
+}
+
+type resolveFailure struct {
+	err     error
+	expires time.Time
+}
+
+// projectResolver guards Parser.ResolveProject so a burst of identical legacy requests makes one lookup,
+// and a key that just failed is not looked up again until ResolveNegativeTTL passes.
+type projectResolver struct {
+	mu     sync.Mutex
+	calls  map[string]*resolveCall
+	failed map[string]resolveFailure
+}
+
+// resolveProject looks up the project ID of a legacy /api/store/ request through Parser.ResolveProject.
+func (p *Parser) resolveProject(publicKey string) (string, error) {
+
+	pr := &p.resolver
+	pr.mu.Lock()
+	if f, ok := pr.failed[publicKey]; ok {
+		if Now(p.Clock).Before(f.expires) {
+			pr.mu.Unlock()
+			return "", f.err
+		}
+		delete(pr.failed, publicKey)
+	}
+	if c, ok := pr.calls[publicKey]; ok {
+		pr.mu.Unlock()
+		c.wg.Wait()
+		return c.projectID, c.err
+	}
+	if pr.calls == nil {
+		pr.calls = map[string]*resolveCall{}
+	}
+	c := &resolveCall{}
+	c.wg.Add(1)
+	pr.calls[publicKey] = c
+	pr.mu.Unlock()
+
+	c.projectID, c.err = p.lookupProject(publicKey)
+	if c.err == nil && !project_re.MatchString(c.projectID) {
+		c.projectID, c.err = "", ErrMissingProjectID
+	}
+	c.wg.Done()
+
+	pr.mu.Lock()
+	delete(pr.calls, publicKey)
+	if c.err != nil {
+		pr.remember(publicKey, c.err, Now(p.Clock), p.ResolveNegativeTTL)
+	}
+	pr.mu.Unlock()
+	return c.projectID, c.err
+}
+
+// lookupProject asks ResolveCache, then ResolveProject, writing what the latter finds to ResolveCache.
+// ResolveCache failures fall back to ResolveProject.
+func (p *Parser) lookupProject(publicKey string) (string, error) {
+
+	if p.ResolveCache == nil {
+		return p.ResolveProject(publicKey)
+	}
+	sum := sha256.Sum256([]byte(publicKey))
+	key := resolveCachePrefix + hex.EncodeToString(sum[:])
+	ctx := context.Background()
+	if b, err := p.ResolveCache.Get(ctx, key); err == nil && project_re.MatchString(string(b)) {
+		return string(b), nil
+	}
+	projectID, err := p.ResolveProject(publicKey)
+	if err == nil && project_re.MatchString(projectID) {
+		ttl := p.ResolveTTL
+		if ttl <= 0 {
+			ttl = defaultResolveTTL
+		}
+		p.ResolveCache.Set(ctx, key, []byte(projectID), ttl)
+	}
+	return projectID, err
+}
+
+// remember records a failed lookup; pr.mu must be held.
+func (pr *projectResolver) remember(publicKey string, err error, now time.Time, ttl time.Duration) {
+
+	if ttl <= 0 {
+		ttl = defaultResolveNegativeTTL
+	}
+	if pr.failed == nil {
+		pr.failed = map[string]resolveFailure{}
+	}
+	//random keys must not grow the cache without bound
+	if len(pr.failed) >= defaultCacheEntries {
+		for k, f := range pr.failed {
+			if now.After(f.expires) {
+				delete(pr.failed, k)
+			}
+		}
+		if len(pr.failed) >= defaultCacheEntries {
+			return
+		}
+	}
+	pr.failed[publicKey] = resolveFailure{err: err, expires: now.Add(ttl)}
+}
@@ -0,0 +1,110 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//setup
+
+func legacyStore(p *Parser, key string) (*DSN, error) {
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/store/?sentry_key="+key, nil)
+	return p.FromRequest(r)
+}
+
+//tests
+
+func TestResolveProject(t *testing.T) {
+	errBackend := errors.New("backend down")
+	var calls atomic.Int64
+	release := make(chan struct{})
+	p := &Parser{ResolveProject: func(publicKey string) (string, error) {
+		calls.Add(1)
+		<-release
+		if publicKey == "4784fbc50de2473f9977cfce8a9adce5" {
+			return "1234", nil
+		}
+		return "", errBackend
+	}}
+
+	//a burst of identical legacy requests makes one lookup
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := legacyStore(p, "4784fbc50de2473f9977cfce8a9adce5")
+			if err != nil || got.URL != "https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234" {
+				t.Errorf("Expected -- resolved dsn -- Got %v %v", got, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n < 1 || n >= 50 {
+		t.Errorf("Expected -- shared lookups -- Got %v", n)
+	}
+
+	//failures are remembered
+	calls.Store(0)
+	for i := 0; i < 3; i++ {
+		if _, err := legacyStore(p, "ffffffffffffffffffffffffffffffff"); err != errBackend {
+			t.Errorf("Expected -- %v -- Got %v", errBackend, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected -- 1 lookup -- Got %v", n)
+	}
+
+	//requests with a project id never look it up
+	calls.Store(0)
+	r := httptest.NewRequest("POST", "https://o1.ingest.sentry.io/api/42/store/?sentry_key=ffffffffffffffffffffffffffffffff", nil)
+	if _, err := p.FromRequest(r); err != nil || calls.Load() != 0 {
+		t.Errorf("Expected -- no lookup -- Got %v %v", calls.Load(), err)
+	}
+}
+
+func TestResolveProjectInvalid(t *testing.T) {
+	p := &Parser{ResolveProject: func(string) (string, error) { return "not-a-project", nil }, ResolveNegativeTTL: time.Nanosecond}
+	if _, err := legacyStore(p, "4784fbc50de2473f9977cfce8a9adce5"); err != ErrMissingProjectID {
+		t.Errorf("Expected -- %v -- Got %v", ErrMissingProjectID, err)
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	shared := &memoryShared{}
+	var calls atomic.Int64
+	resolve := func(publicKey string) (string, error) {
+		calls.Add(1)
+		return "1234", nil
+	}
+	a := &Parser{ResolveProject: resolve, ResolveCache: shared}
+	if _, err := legacyStore(a, "4784fbc50de2473f9977cfce8a9adce5"); err != nil || calls.Load() != 1 {
+		t.Errorf("Expected -- one lookup -- Got %d %v", calls.Load(), err)
+	}
+	for k, ttl := range shared.ttls {
+		if ttl != time.Hour || strings.Contains(k, "4784fbc50de2473f9977cfce8a9adce5") {
+			t.Errorf("Expected -- the key hashed, kept an hour -- Got %s %v", k, ttl)
+		}
+	}
+
+	//a restarted parser answers from the cache
+	b := &Parser{ResolveProject: resolve, ResolveCache: shared}
+	got, err := legacyStore(b, "4784fbc50de2473f9977cfce8a9adce5")
+	if err != nil || got.ProjectID != "1234" || calls.Load() != 1 {
+		t.Errorf("Expected -- 1234 from the cache -- Got %v %v after %d lookups", got, err, calls.Load())
+	}
+
+	//an unavailable cache falls back to the lookup
+	shared.down = true
+	c := &Parser{ResolveProject: resolve, ResolveCache: shared}
+	if got, err := legacyStore(c, "4784fbc50de2473f9977cfce8a9adce5"); err != nil || got.ProjectID != "1234" || calls.Load() != 2 {
+		t.Errorf("Expected -- 1234 looked up -- Got %v %v after %d lookups", got, err, calls.Load())
+	}
+}
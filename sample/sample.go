@@ -0,0 +1,60 @@
+// Package sample makes deterministic keep/drop decisions so a relay can downsample high-volume projects.
+package sample
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+)
+
+// Rule sets the sample rate for a project ID and event category. Empty fields match anything.
+type Rule struct {
+	ProjectID string
+	Category  string  //data category as returned by envelope.Category, e.g. "error" or "transaction"
+	Rate      float64 //fraction of events kept, between 0 and 1
+}
+
+// Sampler holds sample rates by project and category. The first matching rule wins;
+// events matching no rule are always kept, so the zero value keeps everything.
+// A Sampler is safe for concurrent use as long as Rules is not changed while in use.
+type Sampler struct {
+	Rules []Rule
+}
+
+// Rate returns the sample rate applied to events of category for projectID.
+func (s *Sampler) Rate(projectID string, category string) float64 {
+
+	for _, r := range s.Rules {
+		if (len(r.ProjectID) == 0 || r.ProjectID == projectID) && (len(r.Category) == 0 || r.Category == category) {
+			return r.Rate
+		}
+	}
+	return 1
+}
+
+// Keep reports whether an event should be forwarded. The decision is derived from eventID so retries of the same
+// event are always treated alike; events without an ID fall back to a random decision.
+func (s *Sampler) Keep(projectID string, category string, eventID string) bool {
+	return decide(s.Rate(projectID, category), eventID)
+}
+
+func decide(rate float64, id string) bool {
+
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	if len(id) == 0 {
+		return rand.Float64() < rate
+	}
+	return unit(id) < rate
+}
+
+// unit hashes id onto [0, 1).
+func unit(id string) float64 {
+
+	sum := sha256.Sum256([]byte(id))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
@@ -0,0 +1,53 @@
+package sample
+
+import (
+	"fmt"
+	"testing"
+)
+
+var testSampler = &Sampler{Rules: []Rule{
+	{ProjectID: "1234", Category: "transaction", Rate: 0},
+	{ProjectID: "1234", Rate: 0.25},
+	{Category: "transaction", Rate: 0.5},
+}}
+
+var testTableRate = []struct {
+	projectID   string
+	category    string
+	description string
+	expected    float64
+}{
+	{"1234", "transaction", "project and category", 0},
+	{"1234", "error", "project only", 0.25},
+	{"42", "transaction", "category only", 0.5},
+	{"42", "error", "no matching rule", 1},
+}
+
+func TestRate(t *testing.T) {
+	for _, test := range testTableRate {
+		if got := testSampler.Rate(test.projectID, test.category); got != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestKeepDeterministic(t *testing.T) {
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("%032x", i)
+		first := testSampler.Keep("1234", "error", id)
+		if first != testSampler.Keep("1234", "error", id) {
+			t.Fatalf("Expected the same decision for retries of %s", id)
+		}
+		if first {
+			kept++
+		}
+	}
+	//0.25 of 10000 give or take a few percent
+	if kept < 2300 || kept > 2700 {
+		t.Errorf("Expected -- about 2500 kept -- Got %d", kept)
+	}
+	if testSampler.Keep("1234", "transaction", "abc") || !testSampler.Keep("42", "error", "abc") {
+		t.Errorf("Expected rates 0 and 1 to always drop and keep")
+	}
+}
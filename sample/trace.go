@@ -0,0 +1,74 @@
+package sample
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/sentry-demos/sentrydsn/envelope"
+)
+
+var sentry_trace_re = regexp.MustCompile(`^\s*([0-9a-f]{32})-([0-9a-f]{16})(?:-([01]))?\s*$`)
+
+// SentryTrace is a parsed sentry-trace header: <trace_id>-<span_id>[-<sampled>].
+type SentryTrace struct {
+	TraceID string
+	SpanID  string
+	Sampled string //"1", "0" or "" when the upstream made no decision
+}
+
+// ParseSentryTrace parses a sentry-trace header value.
+func ParseSentryTrace(h string) (*SentryTrace, bool) {
+
+	m := sentry_trace_re.FindStringSubmatch(h)
+	if m == nil {
+		return nil, false
+	}
+	return &SentryTrace{TraceID: m[1], SpanID: m[2], Sampled: m[3]}, true
+}
+
+// ParseBaggage returns the sentry- prefixed entries of a W3C baggage header with the prefix removed,
+// e.g. sentry-trace_id=abc becomes trace_id=abc. Other vendors' entries are ignored.
+func ParseBaggage(h string) map[string]string {
+
+	entries := map[string]string{}
+	for _, member := range strings.Split(h, ",") {
+		//properties after ; are not used by sentry
+		member = strings.TrimSpace(strings.SplitN(member, ";", 2)[0])
+		kv := strings.SplitN(member, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "sentry-") {
+			continue
+		}
+		entries[strings.TrimPrefix(kv[0], "sentry-")] = strings.TrimSpace(kv[1])
+	}
+	return entries
+}
+
+// TraceIDFromRequest returns the trace ID carried by the sentry-trace or baggage headers of r, or "".
+func TraceIDFromRequest(r *http.Request) string {
+
+	if st, ok := ParseSentryTrace(r.Header.Get("sentry-trace")); ok {
+		return st.TraceID
+	}
+	return ParseBaggage(strings.Join(r.Header.Values("baggage"), ","))["trace_id"]
+}
+
+// TraceIDFromEnvelope returns the trace ID of the dynamic sampling context in an envelope header, or "".
+func TraceIDFromEnvelope(h *envelope.Header) string {
+
+	if h == nil || h.Trace == nil {
+		return ""
+	}
+	return h.Trace.TraceID
+}
+
+// KeepTrace is Keep keyed on the trace ID: every event of a trace hashes to the same point, so transactions
+// and errors sharing a rate are kept or dropped together. Events outside a trace fall back to eventID.
+// proxy.Tunnel.Sampler decides this way, with the trace ID from TraceIDFromEnvelope.
+func (s *Sampler) KeepTrace(projectID string, category string, traceID string, eventID string) bool {
+
+	if len(traceID) == 0 {
+		return s.Keep(projectID, category, eventID)
+	}
+	return decide(s.Rate(projectID, category), traceID)
+}
@@ -0,0 +1,63 @@
+package sample
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn/envelope"
+)
+
+const testTraceID = "771a43a4192642f0b136d5159a501700"
+
+var testTableTraceHeaders = []struct {
+	sentryTrace string
+	baggage     string
+	description string
+	expected    string
+}{
+	{testTraceID + "-b0e6f15b45c36b12-1", "", "sentry-trace sampled", testTraceID},
+	{testTraceID + "-b0e6f15b45c36b12", "", "sentry-trace without decision", testTraceID},
+	{"", "other=1, sentry-trace_id=" + testTraceID + ";prop=x, sentry-public_key=4784fbc50de2473f9977cfce8a9adce5", "baggage only", testTraceID},
+	{"garbage", "", "malformed sentry-trace", ""},
+	{"", "", "no trace headers", ""},
+}
+
+func TestTraceIDFromRequest(t *testing.T) {
+	for _, test := range testTableTraceHeaders {
+		r := httptest.NewRequest("POST", "https://sentry.io/api/1234/envelope/", nil)
+		if len(test.sentryTrace) > 0 {
+			r.Header.Set("sentry-trace", test.sentryTrace)
+		}
+		if len(test.baggage) > 0 {
+			r.Header.Set("baggage", test.baggage)
+		}
+		if got := TraceIDFromRequest(r); got != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestTraceIDFromEnvelope(t *testing.T) {
+	body := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","trace":{"trace_id":"` + testTraceID + `","public_key":"4784fbc50de2473f9977cfce8a9adce5"}}` + "\n"
+	er, err := envelope.NewReader(strings.NewReader(body), envelope.Limits{})
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if got := TraceIDFromEnvelope(er.Header()); got != testTraceID {
+		t.Errorf("Expected -- %s -- Got %s", testTraceID, got)
+	}
+}
+
+func TestKeepTraceConsistent(t *testing.T) {
+	s := &Sampler{Rules: []Rule{{Rate: 0.5}}}
+	for i := 0; i < 1000; i++ {
+		traceID := fmt.Sprintf("%032x", i)
+		txn := s.KeepTrace("1234", "transaction", traceID, fmt.Sprintf("%032x", i+1))
+		err := s.KeepTrace("1234", "error", traceID, fmt.Sprintf("%032x", i+2))
+		if txn != err {
+			t.Fatalf("Expected transaction and error of trace %s to share a decision", traceID)
+		}
+	}
+}
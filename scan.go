@@ -0,0 +1,43 @@
+package sentrydsn
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// candidate DSNs: a scheme, userinfo and host, then anything up to a quote, whitespace or closing bracket
+var scan_re = regexp.MustCompile("https?://[^\\s\"'`<>@/]+@[^\\s\"'`<>/,;)}]+(?:/[^\\s\"'`<>,;)}\\]]*)?")
+
+// ScanForDSNs finds the DSNs in arbitrary text, such as env files, Kubernetes manifests or JS bundles, e.g. for
+// secret scanning. Candidates are validated with ParseDSN, so only what ParseDSN accepts is returned, in
+// canonical form, in order of first appearance and each DSN once. Slashes escaped as in JSON ("https:\/\/...")
+// are understood. Errors come only from reading r.
+func ScanForDSNs(r io.Reader) ([]*DSN, error) {
+
+	var found []*DSN
+	seen := map[string]bool{}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if strings.Contains(line, "@") {
+			line = strings.ReplaceAll(line, `\/`, "/")
+			for _, candidate := range scan_re.FindAllString(line, -1) {
+				dsn, perr := ParseDSN(strings.TrimRight(candidate, ".:"))
+				if perr != nil || seen[dsn.URL] {
+					continue
+				}
+				seen[dsn.URL] = true
+				found = append(found, dsn)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return found, nil
+		}
+		if err != nil {
+			return found, err
+		}
+	}
+}
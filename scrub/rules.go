@@ -0,0 +1,246 @@
+package scrub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownRule Thrown if an application references a rule that is neither configured nor built in
+var ErrUnknownRule = errors.New("sentry:  unknown scrubbing rule")
+
+// RuleConfig describes a named scrubbing rule, modelled on Relay's PII config.
+type RuleConfig struct {
+	Pattern   string `json:"pattern"`   //regular expression to redact; empty redacts the whole value
+	Redaction string `json:"redaction"` //"replace" (default), "mask" or "remove"
+	Text      string `json:"text"`      //replacement text for "replace", defaults to [Filtered]
+}
+
+// Config maps selectors to the rules applied at them.
+//
+//	{
+//		"rules": {"token": {"pattern": "tok_[a-z0-9]+", "text": "[token]"}},
+//		"applications": {"$string": ["@email"], "extra.**": ["token"], "user.ip_address": ["@remove"]}
+//	}
+//
+// Selectors are dot separated keys where * matches any single key or array index, ** matches any depth,
+// and $string matches every string value. Built in rules are @email, @ip, @creditcard, @mask and @remove;
+// @creditcard only redacts numbers passing the Luhn check. Applications run in the order of their selectors
+// sorted as strings, so the result does not depend on how the config was written.
+type Config struct {
+	Rules        map[string]RuleConfig `json:"rules"`
+	Applications map[string][]string   `json:"applications"`
+}
+
+var builtinRules = map[string]RuleConfig{
+	"@email":      {Pattern: email_re.String(), Text: "[email]"},
+	"@ip":         {Pattern: ipv4_re.String(), Text: "[ip]"},
+	"@creditcard": {Pattern: card_re.String(), Text: "[creditcard]"},
+	"@mask":       {Redaction: "mask"},
+	"@remove":     {Redaction: "remove"},
+}
+
+// checks confirming a match of a built in rule before it is redacted
+var builtinChecks = map[string]func(string) bool{
+	"@creditcard": luhn,
+}
+
+type rule struct {
+	re        *regexp.Regexp
+	check     func(string) bool //matches failing the check are left alone
+	redaction string
+	text      string
+}
+
+type application struct {
+	selector []string
+	rules    []*rule
+}
+
+// Rules is a compiled Config. It implements Scrubber and is safe for concurrent use.
+type Rules struct {
+	applications []application
+}
+
+// LoadRules reads a JSON Config, e.g. the scrubbing section of a relay config file, and compiles it.
+func LoadRules(r io.Reader) (*Rules, error) {
+
+	var c Config
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	return c.Compile()
+}
+
+// Compile validates the configured patterns and rule references.
+func (c *Config) Compile() (*Rules, error) {
+
+	compiled := map[string]*rule{}
+	lookup := func(name string) (*rule, error) {
+		if r, ok := compiled[name]; ok {
+			return r, nil
+		}
+		var check func(string) bool
+		rc, ok := c.Rules[name]
+		if !ok {
+			if rc, ok = builtinRules[name]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownRule, name)
+			}
+			check = builtinChecks[name]
+		}
+		r := &rule{check: check, redaction: rc.Redaction, text: rc.Text}
+		if len(r.redaction) == 0 {
+			r.redaction = "replace"
+		}
+		if len(r.text) == 0 {
+			r.text = Filtered
+		}
+		if r.redaction != "replace" && r.redaction != "mask" && r.redaction != "remove" {
+			return nil, fmt.Errorf("sentry:  rule %s: unknown redaction %q", name, r.redaction)
+		}
+		if len(rc.Pattern) > 0 {
+			re, err := regexp.Compile(rc.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("sentry:  rule %s: %w", name, err)
+			}
+			r.re = re
+		}
+		compiled[name] = r
+		return r, nil
+	}
+
+	selectors := make([]string, 0, len(c.Applications))
+	for selector := range c.Applications {
+		selectors = append(selectors, selector)
+	}
+	sort.Strings(selectors)
+
+	rules := &Rules{}
+	for _, selector := range selectors {
+		app := application{selector: strings.Split(selector, ".")}
+		for _, name := range c.Applications[selector] {
+			r, err := lookup(name)
+			if err != nil {
+				return nil, err
+			}
+			app.rules = append(app.rules, r)
+		}
+		rules.applications = append(rules.applications, app)
+	}
+	return rules, nil
+}
+
+// Scrub applies every matching rule to the event.
+func (rs *Rules) Scrub(event map[string]interface{}) {
+	rs.walk(event, nil)
+}
+
+// walk scrubs v found at path and returns its replacement; keep is false when v should be removed entirely.
+func (rs *Rules) walk(v interface{}, path []string) (interface{}, bool) {
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if nv, keep := rs.walk(child, append(path, k)); keep {
+				t[k] = nv
+			} else {
+				delete(t, k)
+			}
+		}
+		return t, rs.keep(path, t)
+	case []interface{}:
+		kept := t[:0]
+		for i, child := range t {
+			if nv, keep := rs.walk(child, append(path, strconv.Itoa(i))); keep {
+				kept = append(kept, nv)
+			}
+		}
+		return kept, rs.keep(path, kept)
+	}
+
+	for _, app := range rs.applications {
+		_, isString := v.(string)
+		if !(isString && len(app.selector) == 1 && app.selector[0] == "$string") && !matchSelector(app.selector, path) {
+			continue
+		}
+		for _, r := range app.rules {
+			var keep bool
+			if v, keep = r.apply(v); !keep {
+				return nil, false
+			}
+		}
+	}
+	return v, true
+}
+
+// keep reports whether a container at path survives whole-value removal rules.
+func (rs *Rules) keep(path []string, v interface{}) bool {
+
+	for _, app := range rs.applications {
+		if !matchSelector(app.selector, path) {
+			continue
+		}
+		for _, r := range app.rules {
+			if r.re == nil && r.redaction == "remove" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *rule) apply(v interface{}) (interface{}, bool) {
+
+	if r.re == nil {
+		switch r.redaction {
+		case "remove":
+			return nil, false
+		case "mask":
+			if s, ok := v.(string); ok {
+				return strings.Repeat("*", len(s)), true
+			}
+		}
+		return r.text, true
+	}
+	s, ok := v.(string)
+	if !ok {
+		return v, true
+	}
+	return r.re.ReplaceAllStringFunc(s, func(m string) string {
+		if r.check != nil && !r.check(m) {
+			return m
+		}
+		switch r.redaction {
+		case "remove":
+			return ""
+		case "mask":
+			return strings.Repeat("*", len(m))
+		}
+		return r.text
+	}), true
+}
+
+// matchSelector matches a dot separated selector against a value path. * matches one segment and ** any number.
+func matchSelector(selector []string, path []string) bool {
+
+	if len(selector) == 0 {
+		return len(path) == 0
+	}
+	switch selector[0] {
+	case "**":
+		for i := 0; i <= len(path); i++ {
+			if matchSelector(selector[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(path) > 0 && matchSelector(selector[1:], path[1:])
+	}
+	return len(path) > 0 && selector[0] == path[0] && matchSelector(selector[1:], path[1:])
+}
@@ -0,0 +1,113 @@
+package scrub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testRulesConfig = `{
+	"rules": {
+		"token": {"pattern": "tok_[a-z0-9]+", "text": "[token]"},
+		"digits": {"pattern": "[0-9]", "redaction": "mask"}
+	},
+	"applications": {
+		"$string": ["@email"],
+		"extra.**": ["token"],
+		"contexts.*.card": ["digits"],
+		"user.ip_address": ["@remove"],
+		"breadcrumbs.values.*.data": ["@remove"]
+	}
+}`
+
+const testNestedEvent = `{
+	"message": "contact jane@example.com",
+	"user": {"id": "42", "ip_address": "10.1.2.3"},
+	"extra": {"deep": {"deeper": ["tok_abc123", {"again": "use tok_zz9 now"}]}},
+	"contexts": {"payment": {"card": "4111-1111", "brand": "visa 4"}},
+	"breadcrumbs": {"values": [{"message": "click", "data": {"secret": "x"}}]}
+}`
+
+var testTableRules = []struct {
+	path        []string
+	description string
+	expected    interface{}
+}{
+	{[]string{"message"}, "$string applies everywhere", "contact [email]"},
+	{[]string{"user", "ip_address"}, "exact selector removes", nil},
+	{[]string{"user", "id"}, "siblings untouched", "42"},
+	{[]string{"contexts", "payment", "card"}, "single wildcard masks", "****-****"},
+	{[]string{"contexts", "payment", "brand"}, "wildcard does not leak to siblings", "visa 4"},
+}
+
+func TestRules(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(testRulesConfig))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	b, err := Payload(rules, []byte(testNestedEvent))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	event := decode(t, b)
+	for _, test := range testTableRules {
+		if got := lookup(event, test.path); got != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got)
+		}
+	}
+
+	//recursive selector reaches into arrays and nested objects
+	deeper := lookup(event, []string{"extra", "deep", "deeper"}).([]interface{})
+	if deeper[0] != "[token]" || deeper[1].(map[string]interface{})["again"] != "use [token] now" {
+		t.Errorf("Expected -- [[token] map[again:use [token] now]] -- Got %v", deeper)
+	}
+	crumb := lookup(event, []string{"breadcrumbs", "values"}).([]interface{})[0].(map[string]interface{})
+	if _, ok := crumb["data"]; ok || crumb["message"] != "click" {
+		t.Errorf("Expected -- map[message:click] -- Got %v", crumb)
+	}
+}
+
+func TestRulesConfigErrors(t *testing.T) {
+	for _, config := range []string{
+		`{"applications": {"$string": ["missing"]}}`,
+		`{"rules": {"bad": {"pattern": "("}}, "applications": {"$string": ["bad"]}}`,
+		`{"rules": {"bad": {"redaction": "shred"}}, "applications": {"$string": ["bad"]}}`,
+	} {
+		if _, err := LoadRules(strings.NewReader(config)); err == nil {
+			t.Errorf("Expected error for -- %s -- Got nil", config)
+		}
+	}
+	_, err := LoadRules(strings.NewReader(`{"applications": {"$string": ["missing"]}}`))
+	if !errors.Is(err, ErrUnknownRule) {
+		t.Errorf("Expected -- %s -- Got %v", ErrUnknownRule, err)
+	}
+}
+
+func TestRulesCreditCard(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(`{"applications": {"$string": ["@creditcard"]}}`))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	event := map[string]interface{}{"card": "paid with 4111 1111 1111 1111", "order": "order 4111 1111 1111 1112"}
+	rules.Scrub(event)
+	if event["card"] != "paid with [creditcard]" || event["order"] != "order 4111 1111 1111 1112" {
+		t.Errorf("Expected -- only the Luhn valid number redacted -- Got %v", event)
+	}
+}
+
+func TestRulesOrder(t *testing.T) {
+	c := &Config{Applications: map[string][]string{"user.*": {"@mask"}, "$string": {"@email"}, "extra.**": {"@ip"}, "message": {"@remove"}}}
+	for i := 0; i < 10; i++ {
+		rules, err := c.Compile()
+		if err != nil {
+			t.Fatalf("Expected -- nil -- Got %s", err)
+		}
+		var got []string
+		for _, app := range rules.applications {
+			got = append(got, strings.Join(app.selector, "."))
+		}
+		if strings.Join(got, " ") != "$string extra.** message user.*" {
+			t.Fatalf("Expected -- selectors in sorted order -- Got %v", got)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package scrub removes personal data from Sentry payloads before they are forwarded,
+// so a relay can enforce data-minimization before anything leaves the network.
+package scrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/sentry-demos/sentrydsn/envelope"
+)
+
+// Scrubber removes sensitive data from a decoded event payload in place.
+type Scrubber interface {
+	Scrub(event map[string]interface{})
+}
+
+// ScrubberFunc adapts an ordinary function to the Scrubber interface.
+type ScrubberFunc func(event map[string]interface{})
+
+// Scrub calls f(event).
+func (f ScrubberFunc) Scrub(event map[string]interface{}) {
+	f(event)
+}
+
+// Payload decodes a JSON event payload (a store request body or an envelope event item), scrubs it and re-encodes it.
+func Payload(s Scrubber, b []byte) ([]byte, error) {
+
+	event := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return nil, err
+	}
+	s.Scrub(event)
+	return json.Marshal(event)
+}
+
+// scrubbed item types carry event-shaped JSON; everything else (attachments, replays, sessions) is passed through
+var scrubbedItems = map[string]bool{
+	"event":       true,
+	"transaction": true,
+	"feedback":    true,
+}
+
+// Envelope copies the envelope read from src to dst, scrubbing every event-shaped item.
+// Scrubbed items are buffered so their length can be rewritten; limits bound what is read.
+func Envelope(s Scrubber, dst io.Writer, src io.Reader, limits envelope.Limits) error {
+
+	er, err := envelope.NewReader(src, limits)
+	if err != nil {
+		return err
+	}
+	ew, err := envelope.NewWriter(dst, er.Header())
+	if err != nil {
+		return err
+	}
+	for {
+		ih, payload, err := er.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !scrubbedItems[ih.Type] {
+			if err := ew.WriteItem(ih, payload); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := io.ReadAll(payload)
+		if err != nil {
+			return err
+		}
+		if b, err = Payload(s, b); err != nil {
+			return err
+		}
+		if ih, err = ih.WithLength(int64(len(b))); err != nil {
+			return err
+		}
+		if err := ew.WriteItem(ih, bytes.NewReader(b)); err != nil {
+			return err
+		}
+	}
+}
+
+// Filtered replaces values removed by pattern.
+const Filtered = "[Filtered]"
+
+// keys whose values are dropped wherever they appear, compared lowercased
+var sensitiveKeys = map[string]bool{
+	"ip_address":          true,
+	"remote_addr":         true,
+	"x-forwarded-for":     true,
+	"x-real-ip":           true,
+	"cookie":              true,
+	"cookies":             true,
+	"set-cookie":          true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-sentry-auth":       true,
+	"password":            true,
+	"passwd":              true,
+	"secret":              true,
+	"api_key":             true,
+}
+
+var email_re = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+var ipv4_re = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+var card_re = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// Default is the built-in Scrubber. It removes IP addresses, cookies, auth headers and credential-looking keys,
+// and masks email addresses, IPv4 addresses and Luhn-valid card numbers found inside any string.
+var Default Scrubber = ScrubberFunc(scrubDefault)
+
+func scrubDefault(event map[string]interface{}) {
+	scrubValue(event)
+}
+
+func scrubValue(v interface{}) interface{} {
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if sensitiveKeys[strings.ToLower(k)] {
+				delete(t, k)
+				continue
+			}
+			t[k] = scrubValue(child)
+		}
+		return t
+	case []interface{}:
+		kept := t[:0]
+		for _, child := range t {
+			//headers may be sent as a list of [name, value] pairs
+			if pair, ok := child.([]interface{}); ok && len(pair) == 2 {
+				if name, ok := pair[0].(string); ok && sensitiveKeys[strings.ToLower(name)] {
+					continue
+				}
+			}
+			kept = append(kept, scrubValue(child))
+		}
+		return kept
+	case string:
+		return scrubString(t)
+	}
+	return v
+}
+
+func scrubString(s string) string {
+
+	s = email_re.ReplaceAllString(s, "[email]")
+	s = ipv4_re.ReplaceAllString(s, "[ip]")
+	return card_re.ReplaceAllStringFunc(s, func(m string) string {
+		if luhn(m) {
+			return "[creditcard]"
+		}
+		return m
+	})
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum used by payment card numbers.
+func luhn(s string) bool {
+
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
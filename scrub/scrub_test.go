@@ -0,0 +1,107 @@
+package scrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn/envelope"
+)
+
+//setup
+
+const testEvent = `{
+	"message": "payment for jane@example.com from 10.1.2.3 with 4111 1111 1111 1111 failed (order 1234567890123)",
+	"user": {"id": "42", "ip_address": "10.1.2.3", "email": "jane@example.com"},
+	"request": {
+		"url": "https://shop.example.com/pay",
+		"cookies": "session=abc",
+		"headers": [["Authorization", "Bearer xyz"], ["Accept", "*/*"], ["Cookie", "session=abc"]],
+		"env": {"REMOTE_ADDR": "10.1.2.3"}
+	},
+	"extra": {"nested": {"password": "hunter2", "count": 3}}
+}`
+
+var testTableDefault = []struct {
+	path        []string
+	description string
+	expected    interface{}
+}{
+	{[]string{"message"}, "strings are masked", "payment for [email] from [ip] with [creditcard] failed (order 1234567890123)"},
+	{[]string{"user", "ip_address"}, "ip address removed", nil},
+	{[]string{"user", "email"}, "email masked", "[email]"},
+	{[]string{"user", "id"}, "id kept", "42"},
+	{[]string{"request", "cookies"}, "cookies removed", nil},
+	{[]string{"request", "env", "REMOTE_ADDR"}, "remote addr removed", nil},
+	{[]string{"extra", "nested", "password"}, "nested password removed", nil},
+	{[]string{"extra", "nested", "count"}, "numbers kept", json.Number("3")},
+}
+
+func lookup(event map[string]interface{}, path []string) interface{} {
+	var v interface{} = event
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+func decode(t *testing.T, b []byte) map[string]interface{} {
+	event := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	return event
+}
+
+//tests
+
+func TestDefaultScrubber(t *testing.T) {
+	b, err := Payload(Default, []byte(testEvent))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	event := decode(t, b)
+	for _, test := range testTableDefault {
+		if got := lookup(event, test.path); got != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got)
+		}
+	}
+	headers := lookup(event, []string{"request", "headers"}).([]interface{})
+	if len(headers) != 1 || headers[0].([]interface{})[0] != "Accept" {
+		t.Errorf("Expected -- [[Accept */*]] -- Got %v", headers)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	compact := &bytes.Buffer{}
+	json.Compact(compact, []byte(testEvent))
+	src := "{}\n{\"type\":\"event\",\"length\":" + strconv.Itoa(compact.Len()) + "}\n" + compact.String() + "\n{\"type\":\"attachment\",\"length\":16}\njane@example.com\n"
+
+	var out bytes.Buffer
+	if err := Envelope(Default, &out, strings.NewReader(src), envelope.Limits{}); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	er, _ := envelope.NewReader(&out, envelope.Limits{})
+	ih, payload, err := er.Next()
+	if err != nil || ih.Type != "event" {
+		t.Fatalf("Expected -- event -- Got %v %v", ih, err)
+	}
+	b, _ := io.ReadAll(payload)
+	if int64(len(b)) != ih.Length || lookup(decode(t, b), []string{"user", "email"}) != "[email]" {
+		t.Errorf("Expected scrubbed event of length %d -- Got %s", ih.Length, b)
+	}
+	//attachments are not event-shaped and pass through untouched
+	_, payload, _ = er.Next()
+	if b, _ := io.ReadAll(payload); string(b) != "jane@example.com" {
+		t.Errorf("Expected -- jane@example.com -- Got %s", b)
+	}
+}
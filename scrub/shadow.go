@@ -0,0 +1,86 @@
+package scrub
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Shadow returns a Scrubber that runs s on a copy of each event and reports the paths of the values s would
+// change or remove, e.g. "user.email" or "request.headers.0", leaving the event itself untouched, so new rules
+// can be dry-run against production traffic before they are enforced. report is only called when something
+// would change and may be called concurrently. Bodies pass through unscrubbed, so do not shadow the scrubber
+// that keeps personal data from leaving the network.
+func Shadow(s Scrubber, report func(paths []string)) Scrubber {
+
+	return ScrubberFunc(func(event map[string]interface{}) {
+		scrubbed := copyValue(event).(map[string]interface{})
+		s.Scrub(scrubbed)
+		var paths []string
+		diff(event, scrubbed, nil, &paths)
+		if len(paths) > 0 {
+			sort.Strings(paths)
+			report(paths)
+		}
+	})
+}
+
+// copyValue deep copies a decoded JSON value.
+func copyValue(v interface{}) interface{} {
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			m[k] = copyValue(child)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, child := range t {
+			l[i] = copyValue(child)
+		}
+		return l
+	}
+	return v
+}
+
+// diff appends the dotted paths under which scrubbed differs from original. Lists that changed length
+// are reported as a whole, since positions no longer line up.
+func diff(original interface{}, scrubbed interface{}, path []string, paths *[]string) {
+
+	switch o := original.(type) {
+	case map[string]interface{}:
+		s, ok := scrubbed.(map[string]interface{})
+		if !ok {
+			*paths = append(*paths, strings.Join(path, "."))
+			return
+		}
+		for k, child := range o {
+			sc, kept := s[k]
+			if !kept {
+				*paths = append(*paths, strings.Join(append(path, k), "."))
+				continue
+			}
+			diff(child, sc, append(path, k), paths)
+		}
+	case []interface{}:
+		s, ok := scrubbed.([]interface{})
+		if !ok || len(s) != len(o) {
+			*paths = append(*paths, strings.Join(path, "."))
+			return
+		}
+		for i := range o {
+			diff(o[i], s[i], append(path, strconv.Itoa(i)), paths)
+		}
+	default:
+		switch scrubbed.(type) {
+		case map[string]interface{}, []interface{}:
+			*paths = append(*paths, strings.Join(path, "."))
+		default:
+			if original != scrubbed {
+				*paths = append(*paths, strings.Join(path, "."))
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package scrub
+
+import (
+	"strings"
+	"testing"
+)
+
+//tests
+
+func TestShadow(t *testing.T) {
+	var reported []string
+	s := Shadow(Default, func(paths []string) { reported = paths })
+	event := decode(t, []byte(testEvent))
+	s.Scrub(event)
+
+	//the event is untouched
+	if got := lookup(event, []string{"user", "email"}); got != "jane@example.com" {
+		t.Errorf("Expected -- jane@example.com -- Got %v", got)
+	}
+	expected := "extra.nested.password message request.cookies request.env.REMOTE_ADDR request.headers user.email user.ip_address"
+	if got := strings.Join(reported, " "); got != expected {
+		t.Errorf("Expected -- %s -- Got %s", expected, got)
+	}
+
+	reported = nil
+	s.Scrub(map[string]interface{}{"message": "nothing to scrub", "tags": []interface{}{"a", "b"}})
+	if reported != nil {
+		t.Errorf("Expected -- no report -- Got %v", reported)
+	}
+}
@@ -0,0 +1,55 @@
+package sentrydsn
+
+import (
+	"errors"
+	"net/url"
+)
+
+// ErrMissingSecret Thrown under RequireSecret if the request does not carry sentry_secret
+var ErrMissingSecret = errors.New("sentry:  missing secret key")
+
+// SecretPolicy decides what happens to the secret key sent by older SDKs.
+type SecretPolicy int
+
+const (
+	// KeepSecret puts the secret key in the DSN when the client sent one.
+	KeepSecret SecretPolicy = iota
+	// DropSecret never puts the secret key in the DSN; Sentry stopped requiring it in 9.0.
+	DropSecret
+	// RequireSecret fails with ErrMissingSecret unless the client sent one, for targets older than Sentry 9.
+	RequireSecret
+)
+
+// applySecretPolicy clears or demands the user's secret key.
+func (p *Parser) applySecretPolicy(user *User) error {
+
+	switch p.SecretPolicy {
+	case DropSecret:
+		user.SecretKey = ""
+	case RequireSecret:
+		if len(user.SecretKey) == 0 {
+			return ErrMissingSecret
+		}
+	}
+	return nil
+}
+
+// applySecretPolicyDSN is applySecretPolicy for a DSN parsed whole, rewriting its URL.
+func (p *Parser) applySecretPolicyDSN(dsn *DSN) error {
+
+	user := &User{PublicKey: dsn.PublicKey, SecretKey: dsn.SecretKey}
+	if err := p.applySecretPolicy(user); err != nil {
+		return err
+	}
+	if user.SecretKey == dsn.SecretKey {
+		return nil
+	}
+	u, err := url.Parse(dsn.URL)
+	if err != nil {
+		return ErrInvalidDSN
+	}
+	u.User = url.User(user.PublicKey)
+	dsn.URL = u.String()
+	dsn.SecretKey = ""
+	return nil
+}
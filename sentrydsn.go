@@ -3,11 +3,13 @@ package sentrydsn
 
 import (
 	"errors"
-	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const http_x_sentry_auth = "X-Sentry-Auth"
@@ -16,19 +18,43 @@ var (
 	// ErrMissing User Thrown if we are missing the public key that comprises {PROTOCOL}://{PUBLIC_KEY}:{SECRET_KEY}@{HOST}{PATH}/{PROJECT_ID}
 	ErrMissingUser      = errors.New("sentry:  missing public key")
 	ErrMissingProjectID = errors.New("sentry:  Failed attempt to parse project ID from path --")
+	// ErrInvalidDSN Thrown when a full client DSN string does not match {PROTOCOL}://{PUBLIC_KEY}@{HOST}{PATH}/{PROJECT_ID}
+	ErrInvalidDSN = errors.New("sentry:  invalid dsn")
+	// ErrAuthHeaderTooLarge Thrown if X-Sentry-Auth, or Authorization under Parser.CompatRelay, is longer than Parser.MaxAuthHeaderSize
+	ErrAuthHeaderTooLarge = errors.New("sentry:  auth header too large")
+	// ErrMissingHost Thrown if neither the request URL nor the Host header names the host a DSN should point at
+	ErrMissingHost = errors.New("sentry:  missing host")
+	// ErrInvalidHost Thrown if the host a DSN would point at is not a hostname or IP literal with an optional port
+	ErrInvalidHost = errors.New("sentry:  invalid host")
 )
-var pk_re = regexp.MustCompile(`sentry_key=([a-f0-9]{32})`)
-var sk_re = regexp.MustCompile(`sentry_secret=([a-f0-9]{32})`)
-var path_re = regexp.MustCompile(`\/api\/\d+\/store\/`)
-var legacy_re = regexp.MustCompile(`\/api\/store\/`)
-var envelope_re = regexp.MustCompile(`\/api\/\d+\/envelope\/`)
+var ts_re = regexp.MustCompile(`sentry_timestamp=([^,\s]+)`)
+var path_re = regexp.MustCompile(`^\/api\/\d+\/store\/`)
+var legacy_re = regexp.MustCompile(`^\/api\/store\/`)
+var envelope_re = regexp.MustCompile(`^\/api\/\d+\/envelope\/`)
+var nel_re = regexp.MustCompile(`^\/api\/\d+\/nel\/`)
+var report_re = regexp.MustCompile(`^\/api\/\d+\/security\/`)
+var otlp_re = regexp.MustCompile(`^\/api\/\d+\/integration\/otlp\/v1\/(traces|logs)\/?$`)
+var profile_re = regexp.MustCompile(`^\/api\/\d+\/profile\/`)
+var embed_re = regexp.MustCompile(`\/api\/embed\/error-page\/`)
+var any_endpoint_re = regexp.MustCompile(`^\/api\/(\d+)\/(\w+)\/`)
+var project_re = regexp.MustCompile(`^\d+$`)
 
 type DSN struct {
-	URL       string //original dsn for incoming request
-	Host      string
-	ProjectID string
-	PublicKey string
-	SecretKey string
+	URL         string //original dsn for incoming request
+	Scheme      string //https for DSNs derived from requests
+	Host        string //host and port, if any
+	Port        string //port from Host, empty when Host has none; an explicit default port such as :443 is kept
+	PathPrefix  string //path before the project ID on self-hosted installs, e.g. /sentry; before /api/ for derived DSNs
+	ProjectID   string
+	PublicKey   string
+	SecretKey   string
+	Endpoint    EndpointType      //ingest endpoint the request was addressed to, empty for parsed DSN strings
+	Timestamp   time.Time         //sentry_timestamp from the X-Sentry-Auth header, zero if not sent
+	Relay       *RelayIdentity    //verified official Relay that forwarded the request, nil if unsigned
+	Warnings    []Warning         //deprecated authentication the request used
+	ContentType string            //media type of the request body without parameters, e.g. application/x-sentry-envelope
+	Geo         *Geo              //client location, set by GeoEnricher
+	Metadata    map[string]string //project metadata, e.g. team or cost center, set by MetadataEnricher
 }
 type User struct {
 	PublicKey string //public key for DSN
@@ -41,47 +67,213 @@ type User struct {
 // You will never use both to fill each of these values.
 // We parse headers first to find User info. This will return pk, sk, both or err if no pk is found.
 // If we err using headers we proceed to the QS. An Err here throws for the entire FromRequest operation.
+// FromRequest accepts any host; use a Parser to restrict them.
 func FromRequest(r *http.Request) (*DSN, error) {
 
+	var p Parser
+	return p.FromRequest(r)
+}
+
+// FromRequest is the package level FromRequest with the parser's restrictions applied.
+func (p *Parser) FromRequest(r *http.Request) (*DSN, error) {
+
+	if p.BeforeParse != nil {
+		p.BeforeParse(r)
+	}
+	dsn, err := p.fromRequest(r)
+	if p.AfterParse != nil {
+		dsn, err = p.AfterParse(r, dsn, err)
+	}
+	p.countOutcome(err)
+	return dsn, err
+}
+
+func (p *Parser) fromRequest(r *http.Request) (*DSN, error) {
+
 	var user *User
 	u := r.URL //represents a fully parsed url
 	h := r.Header.Get(http_x_sentry_auth)
 
-	host := u.Hostname()
-	if len(host) == 0 {
-		host = r.Host
+	if preflight(r) {
+		return nil, ErrPreflight
+	}
+	//the feedback dialog carries the whole DSN in its query string
+	if embed_re.MatchString(u.Path) {
+		return p.fromEmbed(r)
+	}
+	if err := p.checkAuthHeaderSize(r); err != nil {
+		return nil, err
 	}
-	//some routers/proxies may strip the host from http.Request.URL so http.Request.Host is useful.
 
-	usingHeader, err := parseHeaders(h)
+	host, err := p.requestHost(r)
 	if err != nil {
+		return nil, err
+	}
+	//the port is kept so self-hosted instances on non-default ports get a working DSN.
+	host = CanonicalHost(host)
+	if len(host) == 0 {
+		return nil, ErrMissingHost
+	}
+	//the host flows into DSN.URL, a crafted Host or X-Forwarded-Host must not add userinfo, a path or headers
+	if !validHost(host) {
+		return nil, ErrInvalidHost
+	}
+	var warnings []Warning
+	if err := p.enforce(p.AllowedHosts.Check(host), &warnings); err != nil {
+		return nil, err
+	}
+
+	kf := p.KeyFormat
+	if kf == nil {
+		kf = Hex32
+	}
+	if p.CompatRelay {
+		var relayWarnings []Warning
+		if user, relayWarnings, err = relayAuth(r, kf, p.DuplicateParams); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, relayWarnings...)
+	} else if usingHeader, err := parseHeaders(h, kf); err != nil {
 
-		usingQs, qerr := parseQueryString(u)
+		usingQs, qwarnings, qerr := parseQueryString(u, kf, p.DuplicateParams)
 
-		if qerr != nil {
+		if qerr == ErrConflictingKeys {
+			return nil, qerr
+		} else if qerr != nil {
 			return nil, ErrMissingUser
 		} else {
 			user = usingQs
+			warnings = append(append(warnings, WarnQueryAuth), qwarnings...)
 		}
 	} else {
 		user = usingHeader
 	}
+	if len(user.SecretKey) > 0 {
+		warnings = append(warnings, WarnSecretKey)
+	}
+	if p.CompatRelay {
+		//Relay never forwards the secret key
+		user.SecretKey = ""
+	} else if err := p.applySecretPolicy(user); err != nil {
+		return nil, err
+	}
 	// parse project
-	p, err := checkPath(u)
+	prefix, projectID, endpoint, err := checkPath(u)
+	if p.CompatRelay {
+		projectID, endpoint, err = relayCheckPath(u)
+	}
+	if err == ErrMissingProjectID && p.AcceptAnyProjectEndpoint {
+		prefix, projectID, endpoint, err = anyEndpoint(u)
+	}
+	if err == ErrMissingProjectID {
+		p.unknownEndpoint(u.Path)
+	}
 	if err != nil {
 		return nil, err
 	}
-	// complete DSN
-	dsn := createDSN(user, host, p)
-
+	if err := p.enforce(p.checkEndpoint(endpoint), &warnings); err != nil {
+		return nil, err
+	}
+	if err := p.enforce(p.checkMethod(endpoint, r.Method), &warnings); err != nil {
+		return nil, err
+	}
+	ct := mediaType(r)
+	if err := p.enforce(p.checkContentType(endpoint, ct), &warnings); err != nil {
+		return nil, err
+	}
+	if len(projectID) == 0 && p.ResolveProject != nil {
+		if projectID, err = p.resolveProject(user.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	if endpoint == EndpointNEL || endpoint == EndpointReport {
+		warnings = dropWarning(warnings, WarnQueryAuth)
+	}
+	// freshness of the auth header, if asked for
+	ts := parseTimestamp(h)
+	if err := p.enforce(p.checkFreshness(ts), &warnings); err != nil {
+		return nil, err
+	}
+	// relay signature, if any
+	relay, err := p.verifyRelaySignature(r)
+	if err = p.enforce(err, &warnings); err != nil {
+		return nil, err
+	}
+	// complete DSN, from keys a custom KeyFormat may have let anything into
+	if !urlSafeKey(user.PublicKey) || !urlSafeKey(user.SecretKey) {
+		return nil, ErrMissingUser
+	}
+	dsn := createDSN(user, host, prefix, projectID)
+	dsn.Endpoint = endpoint
+	dsn.Timestamp = ts
+	dsn.Relay = relay
+	dsn.Warnings = warnings
+	dsn.ContentType = ct
+
+	if p.Tokenizer != nil {
+		return dsn.Pseudonymize(p.Tokenizer)
+	}
 	return dsn, nil
 
 }
 
-// parseHeaders parses values from the X-Sentry-Auth header. Searches for both pk and sk values.
+// fromEmbed parses the full DSN sent to /api/embed/error-page/?dsn=<dsn>&eventId=<event_id>.
+// The allowlist is checked against the DSN host since that is where feedback is sent. Freshness and relay
+// signatures are checked as for every other request, so MaxAuthAge and RequireRelaySignature refuse the
+// unauthenticated GETs browsers send here.
+func (p *Parser) fromEmbed(r *http.Request) (*DSN, error) {
+
+	u, method := r.URL, r.Method
+	var warnings []Warning
+	if err := p.enforce(p.checkEndpoint(EndpointFeedback), &warnings); err != nil {
+		return nil, err
+	}
+	if err := p.enforce(p.checkMethod(EndpointFeedback, method), &warnings); err != nil {
+		return nil, err
+	}
+	raw := u.Query().Get("dsn")
+	if len(raw) == 0 {
+		return nil, ErrMissingUser
+	}
+	kf := p.KeyFormat
+	if kf == nil {
+		kf = Hex32
+	}
+	dsn, err := parseDSN(raw, kf)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.enforce(p.AllowedHosts.Check(dsn.Host), &warnings); err != nil {
+		return nil, err
+	}
+	ts := parseTimestamp(r.Header.Get(http_x_sentry_auth))
+	if err := p.enforce(p.checkFreshness(ts), &warnings); err != nil {
+		return nil, err
+	}
+	relay, err := p.verifyRelaySignature(r)
+	if err = p.enforce(err, &warnings); err != nil {
+		return nil, err
+	}
+	dsn.Timestamp = ts
+	dsn.Relay = relay
+	dsn.Warnings = warnings
+	if len(dsn.SecretKey) > 0 {
+		dsn.Warnings = append(dsn.Warnings, WarnSecretKey)
+	}
+	if err := p.applySecretPolicyDSN(dsn); err != nil {
+		return nil, err
+	}
+	dsn.Endpoint = EndpointFeedback
+	if p.Tokenizer != nil {
+		return dsn.Pseudonymize(p.Tokenizer)
+	}
+	return dsn, nil
+}
+
+// parseHeaders parses values from the X-Sentry-Auth header. Searches for both pk and sk values in the key format.
 // It throws an error if nothing is found for pk as this is critical
 // Returns user struct with appropriate values or empty strings.
-func parseHeaders(h string) (*User, error) {
+func parseHeaders(h string, kf KeyFormat) (*User, error) {
 
 	var sentryPublic string
 	var sentrySecret string
@@ -90,18 +282,26 @@ func parseHeaders(h string) (*User, error) {
 		return nil, ErrMissingUser
 	}
 
-	toArray := strings.Split(strings.SplitN(h, " ", 2)[1], ",")
+	_, rest, found := strings.Cut(h, " ")
 	//Anticipates header: Sentry <start-header-values,...>
+	if !found {
+		return nil, ErrMissingUser
+	}
 
-	for _, v := range toArray {
+	for len(rest) > 0 {
 
-		foundPublic := pk_re.MatchString(v)
-		foundPrivate := sk_re.MatchString(v)
-		if foundPublic {
-			sentryPublic = strings.Split(v, "=")[1]
+		var v string
+		v, rest, _ = strings.Cut(rest, ",")
+		v = strings.TrimSpace(v)
+		if val, ok := strings.CutPrefix(v, "sentry_key="); ok {
+			if k, ok := headerKey(kf, val); ok {
+				sentryPublic = k
+			}
 		}
-		if foundPrivate {
-			sentrySecret = strings.Split(v, "=")[1]
+		if val, ok := strings.CutPrefix(v, "sentry_secret="); ok {
+			if k, ok := headerKey(kf, val); ok {
+				sentrySecret = k
+			}
 		}
 	}
 	if len(sentryPublic) == 0 {
@@ -112,40 +312,93 @@ func parseHeaders(h string) (*User, error) {
 
 }
 
+// parseTimestamp reads sentry_timestamp from the X-Sentry-Auth header.
+// SDKs send unix seconds with optional fractions (1614144877.269); a few send RFC 3339 instead.
+// Returns the zero time if the value is missing or unreadable.
+func parseTimestamp(h string) time.Time {
+
+	m := ts_re.FindStringSubmatch(h)
+	if m == nil {
+		return time.Time{}
+	}
+	if secs, err := strconv.ParseFloat(m[1], 64); err == nil {
+		whole := math.Floor(secs)
+		return time.Unix(int64(whole), int64((secs-whole)*1e9)).UTC()
+	}
+	if t, err := time.Parse(time.RFC3339Nano, m[1]); err == nil {
+		return t.UTC()
+	}
+	return time.Time{}
+}
+
 // createDSN concatenates our DSN components into a client DSN key.
 // In the case where we encounter the legacy /api/store/ the returned DSN struct will have url == ""
 // This allows for optional checks in case the other parts of the struct (publicKey) are used for projectID lookups
-func createDSN(d *User, host string, projectID string) *DSN {
+// The path prefix, everything before /api/ in the request path, is kept between host and project ID.
+func createDSN(d *User, host string, pathPrefix string, projectID string) *DSN {
 
-	var url string
+	var dsnURL string
 	prefix := "https://"
+	var path string
+	if len(pathPrefix) > 0 {
+		path = (&url.URL{Path: pathPrefix}).EscapedPath()
+	}
 	if len(projectID) == 0 {
-		url = ""
+		dsnURL = ""
 	} else if len(d.PublicKey) > 0 && len(d.SecretKey) == 0 {
-		url = fmt.Sprintf("%v%v@%v/%v", prefix, d.PublicKey, host, projectID)
+		dsnURL = prefix + d.PublicKey + "@" + host + path + "/" + projectID
 	} else if len(d.PublicKey) > 0 && len(d.SecretKey) > 0 {
-		url = fmt.Sprintf("%v%v:%v@%v/%v", prefix, d.PublicKey, d.SecretKey, host, projectID)
+		dsnURL = prefix + d.PublicKey + ":" + d.SecretKey + "@" + host + path + "/" + projectID
 	}
 
-	return &DSN{URL: url, ProjectID: projectID, Host: host, PublicKey: d.PublicKey, SecretKey: d.SecretKey}
+	return &DSN{URL: dsnURL, Scheme: "https", ProjectID: projectID, Host: host, Port: hostPort(host), PathPrefix: pathPrefix,
+		PublicKey: d.PublicKey, SecretKey: d.SecretKey}
 }
 
 // parseQueryString parses sentry public and secret keys from the query string where available.
-// Function throws if we are missing pk as this is critical.
+// Function throws if we are missing pk, or it is not in the key format, as this is critical.
 // Returns User struct with parsed values or empty strings if value was not available.
-func parseQueryString(u *url.URL) (*User, error) {
+func parseQueryString(u *url.URL, kf KeyFormat, dp DuplicatePolicy) (*User, []Warning, error) {
 
-	pk := u.Query().Get("sentry_key")
-	if len(pk) == 0 {
-		return nil, ErrMissingUser
+	q := u.Query()
+	key, keyConflict, err := queryValue(q, "sentry_key", dp)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, ok := canonicalKey(kf, key)
+	if !ok {
+		return nil, nil, ErrMissingUser
+	}
+	secret, secretConflict, err := queryValue(q, "sentry_secret", dp)
+	if err != nil {
+		return nil, nil, err
+	}
+	sk, _ := canonicalKey(kf, secret)
+
+	var warnings []Warning
+	if keyConflict || secretConflict {
+		warnings = append(warnings, WarnDuplicateKey)
 	}
-	sk := u.Query().Get("sentry_secret")
+	return &User{PublicKey: pk, SecretKey: sk}, warnings, nil
 
-	return &User{PublicKey: pk, SecretKey: sk}, nil
+}
 
+// ingest endpoints addressed by project, in the order they are checked
+var endpoints = []struct {
+	re  *regexp.Regexp
+	typ EndpointType
+}{
+	{path_re, EndpointStore},
+	{envelope_re, EndpointEnvelope},
+	{nel_re, EndpointNEL},
+	{report_re, EndpointReport},
+	{otlp_re, EndpointOTLP},
+	{profile_re, EndpointProfile},
 }
 
-// checkPath validates anticipated path structure /api/<project_id>/store/ OR /api/store/ OR /api/<project_id>/envelope/ and returns a projectID.
+// checkPath validates anticipated path structure /api/<project_id>/store/ OR /api/store/ OR /api/<project_id>/envelope/
+// OR /api/<project_id>/nel/ OR /api/<project_id>/security/ OR /api/<project_id>/profile/ and returns a projectID and the endpoint type.
+// Browsers post Network Error Logging and Reporting API reports with sentry_key in the query string.
 // The legacy /api/store/ endpoint does not include project id.
 // This edge case is usually where a public key could be used to lookup project meta data
 // in Relay. As we are not in relay this is not an option.
@@ -159,22 +412,97 @@ func parseQueryString(u *url.URL) (*User, error) {
 // All of these clients utilize the  /api/<project_id>/store/  endpoint.
 // Given the test we have a higher degree of certainty that we will not encounter the legacy api
 // and all incoming requests will have a project id in path.
-func checkPath(u *url.URL) (string, error) {
+//
+// The /api/ segment may follow a path prefix, e.g. /sentry/api/1234/envelope/ on a self-hosted install under a
+// sub-path, which is returned first. The last /api/ segment addressing an endpoint counts, since the prefix
+// may itself look like an ingest path.
+func checkPath(u *url.URL) (string, string, EndpointType, error) {
+
+	path := u.Path
+	for start := lastAPI(path, len(path)); start >= 0; start = lastAPI(path, start) {
+		rest := path[start:]
+		for _, e := range endpoints {
+			if e.re.MatchString(rest) {
+				//the project id is the second segment of /api/<project_id>/...
+				projectID := strings.TrimPrefix(rest, "/")
+				_, projectID, _ = strings.Cut(projectID, "/")
+				projectID, _, _ = strings.Cut(projectID, "/")
+				return path[:start], projectID, e.typ, nil
+			}
+		}
+	}
+	for start := lastAPI(path, len(path)); start >= 0; start = lastAPI(path, start) {
+		if legacy_re.MatchString(path[start:]) {
+			return path[:start], "", EndpointStore, nil
+		}
+	}
+	return "", "", "", ErrMissingProjectID
+
+}
+
+// anyEndpoint accepts any /api/<project_id>/<endpoint>/ path, recording the endpoint name as its type.
+// Like checkPath it returns the path prefix first.
+func anyEndpoint(u *url.URL) (string, string, EndpointType, error) {
 
 	path := u.Path
-	isValid := path_re.MatchString(path)
-	isValidLegacy := legacy_re.MatchString(path)
-	isValidEnvelope := envelope_re.MatchString(path)
+	for start := lastAPI(path, len(path)); start >= 0; start = lastAPI(path, start) {
+		if m := any_endpoint_re.FindStringSubmatch(path[start:]); m != nil {
+			return path[:start], m[1], EndpointType(m[2]), nil
+		}
+	}
+	return "", "", "", ErrMissingProjectID
+}
+
+// lastAPI returns the index of the last /api/ in path starting before end, or -1.
+func lastAPI(path string, end int) int {
+	return strings.LastIndex(path[:min(end+len("/api/")-1, len(path))], "/api/")
+}
 
-	if !isValid && !isValidEnvelope {
-		if isValidLegacy {
-			return "", nil
+// ParseDSN parses a full client DSN string such as https://<public_key>@o1.ingest.sentry.io/1234.
+// Used where the DSN arrives whole (tunnel headers, configuration) instead of being derived from path and auth.
+// The secret key is optional; a path prefix before the project ID is preserved in the returned URL.
+func ParseDSN(raw string) (*DSN, error) {
+	return parseDSN(raw, Hex32)
+}
+
+func parseDSN(raw string, kf KeyFormat) (*DSN, error) {
+
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, ErrInvalidDSN
+	}
+	if u.User == nil || len(u.User.Username()) == 0 {
+		return nil, ErrMissingUser
+	}
+	pk, ok := canonicalKey(kf, u.User.Username())
+	if !ok {
+		return nil, ErrInvalidDSN
+	}
+	sk, hasSecret := u.User.Password()
+	if hasSecret && len(sk) > 0 {
+		if sk, ok = canonicalKey(kf, sk); !ok {
+			return nil, ErrInvalidDSN
 		}
-		return "", ErrMissingProjectID
+		u.User = url.UserPassword(pk, sk)
+	} else {
+		u.User = url.User(pk)
 	}
-	pathItems := strings.Split(path, "/")
 
-	//with leading + trailing splits array has deterministic length of 5
-	return pathItems[2], nil
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	projectID := path[i+1:]
+	if !project_re.MatchString(projectID) {
+		return nil, ErrMissingProjectID
+	}
+
+	u.Host = CanonicalHost(u.Host)
+	if !validHost(u.Host) {
+		return nil, ErrInvalidDSN
+	}
+	u.Path = path
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
 
+	return &DSN{URL: u.String(), Scheme: u.Scheme, Host: u.Host, Port: hostPort(u.Host), PathPrefix: path[:i], ProjectID: projectID, PublicKey: pk, SecretKey: sk}, nil
 }
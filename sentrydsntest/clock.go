@@ -0,0 +1,48 @@
+package sentrydsntest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a sentrydsn.Clock that only moves when told to, for deterministic tests of TTLs, windows and
+// freshness checks, or for replaying captured requests at the time they were captured:
+//
+//	clock := sentrydsntest.NewClock(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+//	cache := &sentrydsn.Cache{TTL: time.Minute, Clock: clock}
+//	clock.Advance(2 * time.Minute) //every entry has expired
+//
+// It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock stopped at t.
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now implements sentrydsn.Clock.
+func (c *Clock) Now() time.Time {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to t, backwards if need be.
+func (c *Clock) Set(t time.Time) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
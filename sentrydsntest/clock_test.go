@@ -0,0 +1,39 @@
+package sentrydsntest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	clock.Advance(time.Minute)
+	if !clock.Now().Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected -- %v -- Got %v", start.Add(time.Minute), clock.Now())
+	}
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("Expected -- %v -- Got %v", start, clock.Now())
+	}
+}
+
+func TestServerClock(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	clock := NewClock(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	srv.Clock = clock
+
+	srv.RateLimit(time.Minute, "error")
+	if resp := send(t, srv, "/api/1234/store/", true, []byte("{}"), ""); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	clock.Advance(time.Minute)
+	if resp := send(t, srv, "/api/1234/store/", true, []byte("{}"), ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusOK, resp.StatusCode)
+	}
+	if events := srv.Events(); len(events) != 1 || !events[0].Received.Equal(clock.Now()) {
+		t.Errorf("Expected -- received at %v -- Got %v", clock.Now(), events)
+	}
+}
@@ -0,0 +1,130 @@
+package sentrydsntest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// OtherPublicKey is the second key ConflictingKeys sends next to PublicKey.
+const OtherPublicKey = "0123456789abcdef0123456789abcdef"
+
+// the well-formed request the generators break one thing of
+const (
+	malformedPath = "/api/1234/envelope/"
+	malformedAuth = "Sentry sentry_version=7, sentry_client=sentry.go/0.27.0, sentry_key=" + PublicKey
+)
+
+// Malformed is a request a misbehaving client or attacker could send, for asserting an application's error
+// handling without hand-crafting each case:
+//
+//	for _, m := range sentrydsntest.MalformedRequests("https://relay.example.com") {
+//		w := httptest.NewRecorder()
+//		handler.ServeHTTP(w, m.Request)
+//		//assert on w.Code, counting m.Err as what sentrydsn.FromRequest would say
+//	}
+//
+// Requests are server-side requests as from httptest.NewRequest, for calling handlers directly, and are good
+// for one use; call the generator again for fresh ones.
+type Malformed struct {
+	Name    string //what is wrong, e.g. "truncated_key"
+	Request *http.Request
+	// Err is the error sentrydsn.FromRequest fails with, nil where it accepts the request anyway: it picks one
+	// of conflicting keys and does not read bodies. Stricter parsers may differ, e.g. CompatRelay refuses
+	// header and query string keys together with ErrMultipleAuth.
+	Err error
+}
+
+// MalformedRequests returns every request the generators below produce against target, the scheme and host
+// of the ingest endpoint, e.g. "https://relay.example.com", with a 41MB body for HugeBody.
+func MalformedRequests(target string) []Malformed {
+
+	var all []Malformed
+	all = append(all, TruncatedHeaders(target)...)
+	all = append(all, WrongSeparators(target)...)
+	all = append(all, MissingSlashes(target)...)
+	all = append(all, ConflictingKeys(target)...)
+	return append(all, HugeBody(target, 41<<20))
+}
+
+// TruncatedHeaders returns requests whose X-Sentry-Auth header was cut short: inside the key, inside a
+// parameter name, after the = and after the scheme.
+func TruncatedHeaders(target string) []Malformed {
+
+	return []Malformed{
+		malformed("truncated_key", target, malformedPath, malformedAuth[:len(malformedAuth)-16], sentrydsn.ErrMissingUser),
+		malformed("truncated_name", target, malformedPath, malformedAuth[:strings.LastIndex(malformedAuth, "_key")+3], sentrydsn.ErrMissingUser),
+		malformed("truncated_value", target, malformedPath, malformedAuth[:strings.LastIndex(malformedAuth, "=")+1], sentrydsn.ErrMissingUser),
+		malformed("truncated_scheme_only", target, malformedPath, "Sentry ", sentrydsn.ErrMissingUser),
+	}
+}
+
+// WrongSeparators returns requests whose X-Sentry-Auth header separates parameters or values with
+// something other than ", " and "=".
+func WrongSeparators(target string) []Malformed {
+
+	return []Malformed{
+		malformed("semicolon_separated", target, malformedPath, strings.ReplaceAll(malformedAuth, ", ", "; "), sentrydsn.ErrMissingUser),
+		malformed("ampersand_separated", target, malformedPath, strings.ReplaceAll(malformedAuth, ", ", "&"), sentrydsn.ErrMissingUser),
+		malformed("colon_values", target, malformedPath, strings.ReplaceAll(malformedAuth, "=", ":"), sentrydsn.ErrMissingUser),
+	}
+}
+
+// MissingSlashes returns requests to /api/1234/envelope/ with one slash dropped or doubled.
+func MissingSlashes(target string) []Malformed {
+
+	return []Malformed{
+		malformed("missing_slash_after_api", target, "/api1234/envelope/", malformedAuth, sentrydsn.ErrMissingProjectID),
+		malformed("missing_slash_after_project", target, "/api/1234envelope/", malformedAuth, sentrydsn.ErrMissingProjectID),
+		malformed("missing_trailing_slash", target, "/api/1234/envelope", malformedAuth, sentrydsn.ErrMissingProjectID),
+		malformed("doubled_slashes", target, "//api//1234//envelope/", malformedAuth, sentrydsn.ErrMissingProjectID),
+	}
+}
+
+// ConflictingKeys returns requests naming PublicKey and OtherPublicKey at once: in the header and the query
+// string, twice in the query string and twice in the header.
+func ConflictingKeys(target string) []Malformed {
+
+	return []Malformed{
+		malformed("header_and_query_keys", target, malformedPath+"?sentry_key="+OtherPublicKey, malformedAuth, nil),
+		malformed("repeated_query_keys", target, malformedPath+"?sentry_key="+PublicKey+"&sentry_key="+OtherPublicKey, "", nil),
+		malformed("repeated_header_keys", target, malformedPath, malformedAuth+", sentry_key="+OtherPublicKey, nil),
+	}
+}
+
+// HugeBody returns a well-formed envelope request with a body of size bytes, produced as it is read rather
+// than held in memory, for asserting body limits such as proxy.Tunnel.MaxBodySize.
+func HugeBody(target string, size int64) Malformed {
+
+	m := malformed("huge_body", target, malformedPath, malformedAuth, nil)
+	m.Request.Body = io.NopCloser(io.LimitReader(filler{}, size))
+	m.Request.ContentLength = size
+	return m
+}
+
+// filler reads as an endless run of spaces
+type filler struct{}
+
+func (filler) Read(p []byte) (int, error) {
+
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+func malformed(name, target, path, auth string, err error) Malformed {
+
+	r := httptest.NewRequest(http.MethodPost, target+"/", strings.NewReader("{}\n"))
+	//set the path afterwards, since URLs like target + "//api//" do not parse as intended
+	r.URL.Path, r.URL.RawQuery, _ = strings.Cut(path, "?")
+	r.RequestURI = r.URL.RequestURI()
+	r.Header.Set("Content-Type", "application/x-sentry-envelope")
+	if len(auth) > 0 {
+		r.Header.Set("X-Sentry-Auth", auth)
+	}
+	return Malformed{Name: name, Request: r, Err: err}
+}
@@ -0,0 +1,49 @@
+package sentrydsntest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+func TestMalformedRequests(t *testing.T) {
+	names := map[string]bool{}
+	for _, m := range MalformedRequests("https://relay.example.com") {
+		if names[m.Name] {
+			t.Errorf("%s: Expected -- unique names -- Got a duplicate", m.Name)
+		}
+		names[m.Name] = true
+		_, err := sentrydsn.FromRequest(m.Request)
+		if !errors.Is(err, m.Err) || (m.Err == nil) != (err == nil) {
+			t.Errorf("%s: Expected -- %v -- Got %v", m.Name, m.Err, err)
+		}
+	}
+}
+
+func TestMalformedCompatRelay(t *testing.T) {
+	p := &sentrydsn.Parser{CompatRelay: true}
+	m := ConflictingKeys("https://relay.example.com")[0]
+	if _, err := p.FromRequest(m.Request); !errors.Is(err, sentrydsn.ErrMultipleAuth) {
+		t.Errorf("%s: Expected -- %v -- Got %v", m.Name, sentrydsn.ErrMultipleAuth, err)
+	}
+}
+
+func TestHugeBody(t *testing.T) {
+	m := HugeBody("https://relay.example.com", 5<<20)
+	n, _ := io.Copy(io.Discard, m.Request.Body)
+	if n != 5<<20 || m.Request.ContentLength != 5<<20 {
+		t.Errorf("Expected -- %d bytes -- Got %d, Content-Length %d", 5<<20, n, m.Request.ContentLength)
+	}
+
+	tunnel := &proxy.Tunnel{Upstream: "http://127.0.0.1:1", MaxBodySize: 1 << 20}
+	w := httptest.NewRecorder()
+	tunnel.ServeHTTP(w, HugeBody("https://relay.example.com", 2<<20).Request)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected -- %d -- Got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
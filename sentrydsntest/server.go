@@ -0,0 +1,174 @@
+// Package sentrydsntest provides a fake Sentry ingest server for testing an application's Sentry integration.
+//
+//	srv := sentrydsntest.NewServer()
+//	defer srv.Close()
+//	sentry.Init(sentry.ClientOptions{Dsn: srv.DSN("1234")})
+//	//exercise the application, flush the SDK
+//	events := srv.Events()
+package sentrydsntest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+	"github.com/sentry-demos/sentrydsn/proxy"
+)
+
+// PublicKey is the key in DSNs returned by Server.DSN.
+const PublicKey = "4784fbc50de2473f9977cfce8a9adce5"
+
+// largest request body the server accepts, as Sentry ingest does
+const maxBodySize = 40 << 20
+
+// Event is a request the server accepted.
+type Event struct {
+	DSN      *sentrydsn.DSN
+	Endpoint sentrydsn.EndpointType
+	Header   http.Header
+	Body     []byte //decompressed if the SDK sent it gzip or deflate encoded
+	Received time.Time
+}
+
+// Server is a fake ingest host accepting store, envelope and minidump requests. Every request is validated
+// with Parser and answered the way ingest would, so SDKs see real responses. A Server is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	Parser *sentrydsn.Parser //validates requests; a Relay compatible parser when created by NewServer
+	Clock  sentrydsn.Clock   //tells the time for rate limits and Event.Received, the system clock when nil
+
+	mu           sync.Mutex
+	events       []Event
+	limitedUntil time.Time
+	categories   []string
+	down         bool
+}
+
+// NewServer starts a Server. Callers should Close it when finished.
+func NewServer() *Server {
+
+	s := &Server{Parser: &sentrydsn.Parser{
+		CompatRelay:      true,
+		AllowedEndpoints: []sentrydsn.EndpointType{sentrydsn.EndpointStore, sentrydsn.EndpointEnvelope, sentrydsn.EndpointMinidump},
+	}}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// DSN returns a DSN for projectID that sends events to the server.
+func (s *Server) DSN(projectID string) string {
+	return "http://" + PublicKey + "@" + strings.TrimPrefix(s.URL, "http://") + "/" + projectID
+}
+
+// Events returns the requests accepted so far.
+func (s *Server) Events() []Event {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// Reset forgets accepted requests and ends simulated rate limits and outages.
+func (s *Server) Reset() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events, s.limitedUntil, s.categories, s.down = nil, time.Time{}, nil, false
+}
+
+// RateLimit answers every request with 429 and rate limit headers for categories until retryAfter passes
+// or Reset is called. Zero ends a simulated rate limit.
+func (s *Server) RateLimit(retryAfter time.Duration, categories ...string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limitedUntil, s.categories = sentrydsn.Now(s.Clock).Add(retryAfter), categories
+}
+
+// Outage makes the server answer 503, as during an ingest outage, while down is true.
+func (s *Server) Outage(down bool) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	down, retryAfter, categories := s.down, s.limitedUntil.Sub(sentrydsn.Now(s.Clock)), s.categories
+	s.mu.Unlock()
+	if down {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if retryAfter > 0 {
+		proxy.WriteRateLimited(w, retryAfter, categories)
+		return
+	}
+
+	dsn, err := s.Parser.FromRequest(r)
+	if err != nil {
+		proxy.WriteError(w, err)
+		return
+	}
+	body, err := readBody(r)
+	if err != nil {
+		proxy.WriteError(w, err)
+		return
+	}
+	s.mu.Lock()
+	s.events = append(s.events, Event{DSN: dsn, Endpoint: dsn.Endpoint, Header: r.Header.Clone(), Body: body, Received: sentrydsn.Now(s.Clock)})
+	s.mu.Unlock()
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"id":"`+hex.EncodeToString(id)+`"}`)
+}
+
+// readBody reads and, if needed, decompresses a request body.
+func readBody(r *http.Request) ([]byte, error) {
+
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxBodySize {
+		return nil, proxy.ErrBodyTooLarge
+	}
+	var zr io.ReadCloser
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		if zr, err = gzip.NewReader(bytes.NewReader(b)); err != nil {
+			return nil, errors.New("sentry:  invalid gzip body")
+		}
+	case "deflate":
+		//HTTP deflate is the zlib format, not raw DEFLATE
+		if zr, err = zlib.NewReader(bytes.NewReader(b)); err != nil {
+			return nil, errors.New("sentry:  invalid deflate body")
+		}
+	default:
+		return b, nil
+	}
+	defer zr.Close()
+	b, err = io.ReadAll(io.LimitReader(zr, maxBodySize+1))
+	if err != nil {
+		return nil, errors.New("sentry:  invalid compressed body")
+	}
+	if len(b) > maxBodySize {
+		return nil, proxy.ErrBodyTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,106 @@
+package sentrydsntest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setup
+
+func send(t *testing.T, srv *Server, path string, auth bool, body []byte, encoding string) *http.Response {
+	req, _ := http.NewRequest("POST", srv.URL+path, bytes.NewReader(body))
+	if auth {
+		req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key="+PublicKey)
+	}
+	if len(encoding) > 0 {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func gzipped(s string) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(s))
+	zw.Close()
+	return b.Bytes()
+}
+
+func deflated(s string) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write([]byte(s))
+	zw.Close()
+	return b.Bytes()
+}
+
+var testTableServer = []struct {
+	path        string
+	auth        bool
+	body        []byte
+	encoding    string
+	description string
+	expected    int
+}{
+	{"/api/1234/envelope/", true, []byte("{}\n{\"type\":\"event\"}\n{}\n"), "", "envelope", http.StatusOK},
+	{"/api/1234/store/", true, gzipped(`{"message":"hello"}`), "gzip", "gzipped store", http.StatusOK},
+	{"/api/1234/store/", true, deflated(`{"message":"hello"}`), "deflate", "deflated store", http.StatusOK},
+	{"/api/1234/minidump/?sentry_key=" + PublicKey, false, []byte("MDMP"), "", "minidump", http.StatusOK},
+	{"/api/1234/envelope/", false, []byte("{}\n"), "", "missing key", http.StatusBadRequest},
+	{"/api/1234/security/?sentry_key=" + PublicKey, false, []byte("{}"), "", "endpoint not accepted", http.StatusForbidden},
+}
+
+//tests
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	for _, test := range testTableServer {
+		if resp := send(t, srv, test.path, test.auth, test.body, test.encoding); resp.StatusCode != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, resp.StatusCode)
+		}
+	}
+	events := srv.Events()
+	if len(events) != 4 {
+		t.Fatalf("Expected -- 4 events -- Got %v", len(events))
+	}
+	for _, e := range events[1:3] {
+		if e.Endpoint != "store" || string(e.Body) != `{"message":"hello"}` || e.DSN.ProjectID != "1234" {
+			t.Errorf("Expected -- decompressed store event -- Got %v %s", e.Endpoint, e.Body)
+		}
+	}
+	if !strings.HasPrefix(srv.DSN("1234"), "http://"+PublicKey+"@127.0.0.1:") {
+		t.Errorf("Expected -- local dsn -- Got %v", srv.DSN("1234"))
+	}
+}
+
+func TestServerFailures(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.RateLimit(time.Minute, "error")
+	resp := send(t, srv, "/api/1234/envelope/", true, []byte("{}\n"), "")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("X-Sentry-Rate-Limits") != "60:error:key" {
+		t.Errorf("Expected -- 429 -- Got %v %v", resp.StatusCode, resp.Header)
+	}
+	srv.Reset()
+	srv.Outage(true)
+	if resp := send(t, srv, "/api/1234/envelope/", true, []byte("{}\n"), ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected -- 503 -- Got %v", resp.StatusCode)
+	}
+	srv.Outage(false)
+	if resp := send(t, srv, "/api/1234/envelope/", true, []byte("{}\n"), ""); resp.StatusCode != http.StatusOK || len(srv.Events()) != 1 {
+		t.Errorf("Expected -- recovered -- Got %v %v", resp.StatusCode, len(srv.Events()))
+	}
+}
@@ -0,0 +1,43 @@
+package sentrydsn
+
+import (
+	"errors"
+	"strings"
+)
+
+// errors Parser.Shadow turns into warnings: restrictions an operator chose, not requests that cannot be parsed
+var shadowable = []error{
+	ErrUntrustedHost,
+	ErrEndpointNotAllowed,
+	ErrMethodNotAllowed,
+	ErrContentType,
+	ErrStaleAuth,
+	ErrMissingRelaySignature,
+	ErrInvalidRelaySignature,
+}
+
+// ShadowWarning is the warning Parser.Shadow raises instead of failing with err. Its code is "shadow_"
+// followed by ErrorKind(err), e.g. shadow_untrusted_host.
+func ShadowWarning(err error) Warning {
+	return Warning{Code: "shadow_" + ErrorKind(err), Message: "would be refused: " + err.Error()}
+}
+
+// Shadow reports whether w is a ShadowWarning rather than a deprecation.
+func (w Warning) Shadow() bool {
+	return strings.HasPrefix(w.Code, "shadow_")
+}
+
+// enforce returns err, or adds its ShadowWarning to warnings and returns nil when the parser is in shadow mode.
+func (p *Parser) enforce(err error, warnings *[]Warning) error {
+
+	if err == nil || !p.Shadow {
+		return err
+	}
+	for _, e := range shadowable {
+		if errors.Is(err, e) {
+			*warnings = append(*warnings, ShadowWarning(err))
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//setup
+
+var testTableShadow = []struct {
+	parser      *Parser
+	method      string
+	url         string
+	description string
+	expected    string //warning code, empty for none
+	err         error  //error with Shadow set
+}{
+	{&Parser{AllowedHosts: HostAllowlist{"sentry.example.com"}}, "POST", "https://o1.ingest.sentry.io/api/1234/envelope/", "untrusted host", "shadow_untrusted_host", nil},
+	{&Parser{AllowedEndpoints: []EndpointType{EndpointStore}}, "POST", "https://o1.ingest.sentry.io/api/1234/envelope/", "endpoint not allowed", "shadow_endpoint_not_allowed", nil},
+	{&Parser{}, "GET", "https://o1.ingest.sentry.io/api/1234/envelope/", "method not allowed", "shadow_method_not_allowed", nil},
+	{&Parser{MaxAuthAge: time.Minute}, "POST", "https://o1.ingest.sentry.io/api/1234/envelope/", "stale auth", "shadow_stale_auth", nil},
+	{&Parser{RequireRelaySignature: true}, "POST", "https://o1.ingest.sentry.io/api/1234/envelope/", "unsigned", "shadow_missing_relay_signature", nil},
+	{&Parser{AllowedEndpoints: []EndpointType{EndpointStore}}, "GET", "https://o1.ingest.sentry.io/api/embed/error-page/?dsn=https://4784fbc50de2473f9977cfce8a9adce5@o1.ingest.sentry.io/1234", "feedback dialog", "shadow_endpoint_not_allowed", nil},
+	{&Parser{}, "POST", "https://o1.ingest.sentry.io/api/1234/unknown/", "unparsable request still fails", "", ErrMissingProjectID},
+	{&Parser{}, "POST", "https://o1.ingest.sentry.io/api/1234/envelope/", "nothing to shadow", "", nil},
+}
+
+//tests
+
+func TestParserShadow(t *testing.T) {
+	for _, test := range testTableShadow {
+		r := httptest.NewRequest(test.method, test.url, nil)
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5")
+		p := test.parser
+		if _, err := p.FromRequest(r); len(test.expected) > 0 && err == nil {
+			t.Errorf("%s: Expected -- an error without Shadow -- Got nil", test.description)
+		}
+		p.Shadow = true
+		dsn, err := p.FromRequest(r)
+		if err != test.err {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := ""
+		for _, w := range dsn.Warnings {
+			got = w.Code
+		}
+		if got != test.expected {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, dsn.Warnings)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package sink
+
+import (
+	"context"
+)
+
+// AMQPMessage is the message handed to an AMQPPublisher.
+type AMQPMessage struct {
+	ContentType string
+	Headers     map[string]interface{}
+	Body        []byte
+}
+
+// AMQPPublisher is the subset of an AMQP 0.9.1 channel the sink needs,
+// e.g. a thin wrapper around amqp091-go's Channel.PublishWithContext.
+type AMQPPublisher interface {
+	Publish(ctx context.Context, exchange string, routingKey string, msg AMQPMessage) error
+}
+
+// AMQP publishes each record to Exchange. RoutingKey may contain {project_id} and {public_key}, the key's
+// first sentrydsn.DefaultKeyPrefix characters.
+type AMQP struct {
+	Publisher  AMQPPublisher
+	Exchange   string
+	RoutingKey string
+}
+
+// Publish implements Sink.
+func (a *AMQP) Publish(ctx context.Context, rec *Record) error {
+
+	return a.Publisher.Publish(ctx, a.Exchange, expand(a.RoutingKey, rec), AMQPMessage{
+		ContentType: "application/x-sentry-envelope",
+		Headers:     map[string]interface{}{MetadataHeader: string(Metadata(rec))},
+		Body:        rec.Body,
+	})
+}
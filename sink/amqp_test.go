@@ -0,0 +1,29 @@
+package sink
+
+import (
+	"context"
+	"testing"
+)
+
+type testChannel struct {
+	exchange   string
+	routingKey string
+	msg        AMQPMessage
+}
+
+func (c *testChannel) Publish(ctx context.Context, exchange string, routingKey string, msg AMQPMessage) error {
+	c.exchange, c.routingKey, c.msg = exchange, routingKey, msg
+	return nil
+}
+
+func TestAMQP(t *testing.T) {
+	c := &testChannel{}
+	a := &AMQP{Publisher: c, Exchange: "sentry", RoutingKey: "ingest.{project_id}.{public_key}"}
+	if err := a.Publish(context.Background(), testRecord); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	expected := "ingest.1234.4784fbc5"
+	if c.exchange != "sentry" || c.routingKey != expected || string(c.msg.Body) != "{}\n" || c.msg.Headers[MetadataHeader] == nil {
+		t.Errorf("Expected -- sentry %s -- Got %s %s %v", expected, c.exchange, c.routingKey, c.msg)
+	}
+}
@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// default object key layout when Archiver.KeyLayout is unset
+const defaultKeyLayout = "{project_id}/{yyyy}/{mm}/{dd}/{hh}/{id}"
+
+// ObjectPutter is the subset of an S3-compatible client the archiver needs,
+// e.g. a thin wrapper around the AWS SDK's PutObject or minio-go's PutObject.
+type ObjectPutter interface {
+	PutObject(ctx context.Context, key string, body []byte, contentType string, contentEncoding string) error
+}
+
+// Archiver writes every record to object storage for retention and audit independent of Sentry's own.
+// Each record becomes two objects sharing a key: <key>.envelope (or .envelope.gz) holding the raw body
+// and <key>.json holding the DSN metadata.
+//
+// KeyLayout may use {project_id}, {public_key} (the key's first sentrydsn.DefaultKeyPrefix characters),
+// {yyyy}, {mm}, {dd}, {hh} (UTC receive time) and {id}, a random identifier unique to the record.
+type Archiver struct {
+	Store     ObjectPutter
+	KeyLayout string //defaults to {project_id}/{yyyy}/{mm}/{dd}/{hh}/{id}
+	Gzip      bool   //compress bodies with gzip
+}
+
+// Publish implements Sink.
+func (a *Archiver) Publish(ctx context.Context, rec *Record) error {
+
+	key := a.key(rec)
+	body, encoding, ext := rec.Body, "", ".envelope"
+	if a.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(rec.Body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body, encoding, ext = buf.Bytes(), "gzip", ".envelope.gz"
+	}
+	if err := a.Store.PutObject(ctx, key+ext, body, "application/x-sentry-envelope", encoding); err != nil {
+		return err
+	}
+	return a.Store.PutObject(ctx, key+".json", Metadata(rec), "application/json", "")
+}
+
+func (a *Archiver) key(rec *Record) string {
+
+	layout := a.KeyLayout
+	if len(layout) == 0 {
+		layout = defaultKeyLayout
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	t := rec.Received.UTC()
+	return strings.NewReplacer(
+		"{yyyy}", t.Format("2006"),
+		"{mm}", t.Format("01"),
+		"{dd}", t.Format("02"),
+		"{hh}", t.Format("15"),
+		"{id}", hex.EncodeToString(id),
+	).Replace(expand(layout, rec))
+}
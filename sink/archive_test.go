@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+type testObject struct {
+	body            []byte
+	contentType     string
+	contentEncoding string
+}
+
+type testBucket map[string]testObject
+
+func (b testBucket) PutObject(ctx context.Context, key string, body []byte, contentType string, contentEncoding string) error {
+	b[key] = testObject{body, contentType, contentEncoding}
+	return nil
+}
+
+func TestArchiver(t *testing.T) {
+	bucket := testBucket{}
+	a := &Archiver{Store: bucket, Gzip: true}
+	if err := a.Publish(context.Background(), testRecord); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if len(bucket) != 2 {
+		t.Fatalf("Expected -- 2 objects -- Got %d", len(bucket))
+	}
+	for key, obj := range bucket {
+		if !strings.HasPrefix(key, "1234/2021/02/24/05/") {
+			t.Errorf("Expected key under 1234/2021/02/24/05/ -- Got %s", key)
+		}
+		switch {
+		case strings.HasSuffix(key, ".envelope.gz"):
+			zr, err := gzip.NewReader(bytes.NewReader(obj.body))
+			if err != nil {
+				t.Fatalf("Expected -- nil -- Got %s", err)
+			}
+			b, _ := io.ReadAll(zr)
+			if string(b) != "{}\n" || obj.contentEncoding != "gzip" {
+				t.Errorf("Expected gzipped envelope -- Got %s %s", b, obj.contentEncoding)
+			}
+		case strings.HasSuffix(key, ".json"):
+			if !bytes.Contains(obj.body, []byte(`"project_id":"1234"`)) {
+				t.Errorf("Expected metadata -- Got %s", obj.body)
+			}
+		default:
+			t.Errorf("Unexpected object %s", key)
+		}
+	}
+}
+
+func TestArchiverKeyLayout(t *testing.T) {
+	bucket := testBucket{}
+	a := &Archiver{Store: bucket, KeyLayout: "audit/{public_key}/{yyyy}-{mm}-{dd}/{id}"}
+	a.Publish(context.Background(), testRecord)
+	for key := range bucket {
+		if !strings.HasPrefix(key, "audit/4784fbc5/2021-02-24/") {
+			t.Errorf("Expected custom layout -- Got %s", key)
+		}
+	}
+}
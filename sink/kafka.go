@@ -0,0 +1,26 @@
+package sink
+
+import (
+	"context"
+)
+
+// MetadataHeader carries Metadata on published messages.
+const MetadataHeader = "sentry-dsn-metadata"
+
+// KafkaProducer is the subset of a Kafka client the sink needs. Adapt sarama, franz-go or
+// segmentio/kafka-go producers to it so this module does not pin a client library.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key []byte, value []byte, headers map[string][]byte) error
+}
+
+// Kafka publishes each record to Topic. The message key is the project ID, keeping a project's traffic
+// on one partition; the value is the raw body and the DSN metadata travels in the sentry-dsn-metadata header.
+type Kafka struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+// Publish implements Sink.
+func (k *Kafka) Publish(ctx context.Context, rec *Record) error {
+	return k.Producer.Produce(ctx, k.Topic, []byte(rec.DSN.ProjectID), rec.Body, map[string][]byte{MetadataHeader: Metadata(rec)})
+}
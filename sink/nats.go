@@ -0,0 +1,24 @@
+package sink
+
+import (
+	"context"
+)
+
+// JetStreamPublisher is the subset of a NATS JetStream context the sink needs,
+// e.g. a thin wrapper around nats.go's jetstream.JetStream.PublishMsg.
+type JetStreamPublisher interface {
+	PublishMsg(ctx context.Context, subject string, data []byte, header map[string][]string) error
+}
+
+// NATS publishes each record to a JetStream subject. Subject may contain {project_id} and {public_key}, the
+// key's first sentrydsn.DefaultKeyPrefix characters, e.g. sentry.ingest.{project_id}, so consumers can
+// subscribe per project.
+type NATS struct {
+	Publisher JetStreamPublisher
+	Subject   string
+}
+
+// Publish implements Sink.
+func (n *NATS) Publish(ctx context.Context, rec *Record) error {
+	return n.Publisher.PublishMsg(ctx, expand(n.Subject, rec), rec.Body, map[string][]string{MetadataHeader: {string(Metadata(rec))}})
+}
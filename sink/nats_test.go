@@ -0,0 +1,29 @@
+package sink
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type testJetStream struct {
+	subject string
+	data    string
+	header  map[string][]string
+}
+
+func (js *testJetStream) PublishMsg(ctx context.Context, subject string, data []byte, header map[string][]string) error {
+	js.subject, js.data, js.header = subject, string(data), header
+	return nil
+}
+
+func TestNATS(t *testing.T) {
+	js := &testJetStream{}
+	n := &NATS{Publisher: js, Subject: "sentry.ingest.{project_id}"}
+	if err := n.Publish(context.Background(), testRecord); err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	if js.subject != "sentry.ingest.1234" || js.data != "{}\n" || !strings.Contains(js.header[MetadataHeader][0], `"project_id":"1234"`) {
+		t.Errorf("Expected -- sentry.ingest.1234 -- Got %s %s %v", js.subject, js.data, js.header)
+	}
+}
@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory builds a Sink from its JSON configuration, which is empty when none was given.
+type Factory func(config json.RawMessage) (Sink, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a sink available to New by name. The sinks in this package need a client library
+// connection, so builds register factories that create one, e.g. "kafka" returning a Kafka over their
+// producer, and select them from configuration. It is usually called from init and panics if name is
+// already registered or factory is nil.
+func Register(name string, factory Factory) {
+
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("sentry:  sink Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("sentry:  sink Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// New builds the sink registered as name with its JSON configuration.
+func New(name string, config json.RawMessage) (Sink, error) {
+
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("sentry:  unknown sink %q", name)
+	}
+	return factory(config)
+}
+
+// Names returns the names of the registered sinks, sorted.
+func Names() []string {
+
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,55 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// registrations outlive a test run, e.g. under -count
+var registerTestKafka sync.Once
+
+var registryProducer = &testProducer{}
+
+func TestRegistry(t *testing.T) {
+	registerTestKafka.Do(func() {
+		Register("test-kafka", func(config json.RawMessage) (Sink, error) {
+			var c struct {
+				Topic string `json:"topic"`
+			}
+			if err := json.Unmarshal(config, &c); err != nil {
+				return nil, err
+			}
+			return &Kafka{Producer: registryProducer, Topic: c.Topic}, nil
+		})
+	})
+	producer := registryProducer
+	producer.messages = nil
+
+	s, err := New("test-kafka", json.RawMessage(`{"topic":"ingest"}`))
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	s.Publish(context.Background(), testRecord)
+	if len(producer.messages) != 1 || producer.messages[0].topic != "ingest" {
+		t.Errorf("Expected -- one message on ingest -- Got %v", producer.messages)
+	}
+	if _, err := New("missing", nil); err == nil {
+		t.Errorf("Expected -- unknown sink error -- Got nil")
+	}
+	found := false
+	for _, name := range Names() {
+		found = found || name == "test-kafka"
+	}
+	if !found {
+		t.Errorf("Expected -- test-kafka registered -- Got %v", Names())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected -- panic on duplicate registration -- Got none")
+		}
+	}()
+	Register("test-kafka", func(json.RawMessage) (Sink, error) { return nil, nil })
+}
@@ -0,0 +1,64 @@
+// Package sink publishes ingest traffic seen by the tunnel to other systems alongside, or instead of, forwarding it.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// Record is a single ingest request: the derived DSN and the raw body (usually an envelope) as received.
+type Record struct {
+	DSN      *sentrydsn.DSN
+	Path     string //ingest path the client used, e.g. /api/1234/envelope/
+	Received time.Time
+	Body     []byte
+}
+
+// Sink receives records from the tunnel. Publish is called from concurrent requests and must be safe for concurrent use.
+type Sink interface {
+	Publish(ctx context.Context, rec *Record) error
+}
+
+// metadata is the DSN metadata published next to the body. Secret keys are never published and public keys
+// only masked, the way logs and the admin API show them.
+type metadata struct {
+	ProjectID string    `json:"project_id"`
+	KeyPrefix string    `json:"key_prefix"` //public key masked past sentrydsn.DefaultKeyPrefix
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Received  time.Time `json:"received"`
+	Country   string    `json:"country,omitempty"` //client location when the DSN was enriched by sentrydsn.GeoEnricher
+	ASN       uint32    `json:"asn,omitempty"`
+	//project metadata when the DSN was enriched by sentrydsn.MetadataEnricher
+	Project map[string]string `json:"project_metadata,omitempty"`
+}
+
+// Metadata returns the JSON encoded DSN metadata of rec.
+func Metadata(rec *Record) []byte {
+
+	m := metadata{
+		ProjectID: rec.DSN.ProjectID,
+		KeyPrefix: rec.DSN.KeyPrefix(sentrydsn.DefaultKeyPrefix),
+		Host:      rec.DSN.Host,
+		Path:      rec.Path,
+		Received:  rec.Received.UTC(),
+		Project:   rec.DSN.Metadata,
+	}
+	if geo := rec.DSN.Geo; geo != nil {
+		m.Country, m.ASN = geo.Country, geo.ASN
+	}
+	b, _ := json.Marshal(m)
+	return b
+}
+
+// expand replaces {project_id} and {public_key} in a subject or routing key template. Public keys are masked
+// like Metadata's key_prefix, without the trailing "*", which NATS subjects and AMQP bindings read as a wildcard.
+func expand(template string, rec *Record) string {
+
+	key := strings.TrimRight(rec.DSN.KeyPrefix(sentrydsn.DefaultKeyPrefix), "*")
+	return strings.NewReplacer("{project_id}", rec.DSN.ProjectID, "{public_key}", key).Replace(template)
+}
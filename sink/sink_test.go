@@ -0,0 +1,71 @@
+package sink
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+var testTableExpand = []struct {
+	key         string
+	description string
+	expected    string
+}{
+	{"4784fbc50de2473f9977cfce8a9adce5", "masked key", "sentry.1234.4784fbc5"},
+	{"4784", "short key", "sentry.1234.4784"},
+	{"", "no key", "sentry.1234."},
+}
+
+func TestExpand(t *testing.T) {
+	for _, test := range testTableExpand {
+		rec := &Record{DSN: &sentrydsn.DSN{ProjectID: "1234", PublicKey: test.key}}
+		if got := expand("sentry.{project_id}.{public_key}", rec); got != test.expected {
+			t.Errorf("%s: Expected -- %s -- Got %s", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestMetadataGeo(t *testing.T) {
+	rec := *testRecord
+	dsn := *rec.DSN
+	dsn.Geo = &sentrydsn.Geo{Country: "DE", ASN: 3320}
+	rec.DSN = &dsn
+
+	meta := map[string]interface{}{}
+	json.Unmarshal(Metadata(&rec), &meta)
+	if meta["country"] != "DE" || meta["asn"] != float64(3320) {
+		t.Errorf("Expected -- DE 3320 -- Got %v", meta)
+	}
+	meta = map[string]interface{}{}
+	json.Unmarshal(Metadata(testRecord), &meta)
+	if _, ok := meta["country"]; ok {
+		t.Errorf("Expected -- no country -- Got %v", meta)
+	}
+}
+
+func TestMetadataProject(t *testing.T) {
+	rec := *testRecord
+	dsn := *rec.DSN
+	dsn.Metadata = map[string]string{"team": "payments"}
+	rec.DSN = &dsn
+
+	var meta struct {
+		Project map[string]string `json:"project_metadata"`
+	}
+	json.Unmarshal(Metadata(&rec), &meta)
+	if meta.Project["team"] != "payments" {
+		t.Errorf("Expected -- payments -- Got %v", meta.Project)
+	}
+}
+
+func TestMetadataKeyPrefix(t *testing.T) {
+	meta := map[string]interface{}{}
+	json.Unmarshal(Metadata(testRecord), &meta)
+	if meta["key_prefix"] != "4784fbc5************************" {
+		t.Errorf("Expected -- 4784fbc5************************ -- Got %v", meta)
+	}
+	if _, ok := meta["public_key"]; ok {
+		t.Errorf("Expected public key to be withheld -- Got %v", meta)
+	}
+}
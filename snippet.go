@@ -0,0 +1,55 @@
+package sentrydsn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minimal SDK initialization per language; %s is the quoted DSN
+var snippets = map[string]string{
+	"javascript": "import * as Sentry from \"@sentry/browser\";\n\nSentry.init({\n  dsn: %s,\n});\n",
+	"node":       "const Sentry = require(\"@sentry/node\");\n\nSentry.init({\n  dsn: %s,\n});\n",
+	"python":     "import sentry_sdk\n\nsentry_sdk.init(\n    dsn=%s,\n)\n",
+	"go":         "err := sentry.Init(sentry.ClientOptions{\n\tDsn: %s,\n})\n",
+	"ruby":       "Sentry.init do |config|\n  config.dsn = %s\nend\n",
+	"php":        "\\Sentry\\init(['dsn' => %s]);\n",
+	"java":       "Sentry.init(options -> {\n  options.setDsn(%s);\n});\n",
+	"dotnet":     "SentrySdk.Init(options =>\n{\n    options.Dsn = %s;\n});\n",
+}
+
+// SnippetLanguages lists the languages Snippet knows, sorted.
+var SnippetLanguages = []string{"dotnet", "go", "java", "javascript", "node", "php", "python", "ruby"}
+
+// Snippet returns a minimal SDK initialization for lang, one of SnippetLanguages, configured with d, e.g. for a
+// developer portal showing teams how to point their apps at a relay. Secret keys are left out: current SDKs
+// do not use them and snippets end up in client code.
+func (d *DSN) Snippet(lang string) (string, error) {
+
+	format, ok := snippets[strings.ToLower(lang)]
+	if !ok {
+		return "", fmt.Errorf("sentry:  unknown snippet language %q", lang)
+	}
+	dsn, err := d.ClientDSN()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(format, strconv.Quote(dsn)), nil
+}
+
+// ClientDSN returns the DSN string an SDK is configured with, without the secret key, e.g. for envelope
+// headers or tooling handing relay DSNs to services.
+func (d *DSN) ClientDSN() (string, error) {
+
+	if len(d.PublicKey) == 0 {
+		return "", ErrMissingUser
+	}
+	if len(d.ProjectID) == 0 {
+		return "", ErrMissingProjectID
+	}
+	scheme := d.Scheme
+	if len(scheme) == 0 {
+		scheme = "https"
+	}
+	return scheme + "://" + d.PublicKey + "@" + d.Host + d.PathPrefix + "/" + d.ProjectID, nil
+}
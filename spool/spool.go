@@ -0,0 +1,260 @@
+// Package spool persists requests to disk while the upstream is unreachable and replays them once it recovers.
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+const spoolExt = ".spool"
+
+// ErrEntryTooLarge Thrown if a single entry could never fit in the spool
+var ErrEntryTooLarge = errors.New("sentry:  entry exceeds spool size")
+
+// Entry is a request that failed to forward.
+type Entry struct {
+	Method   string      `json:"method,omitempty"`   //method of the request, POST when empty
+	URL      string      `json:"url"`                //upstream url the request was addressed to
+	Header   http.Header `json:"header"`             //headers to resend, e.g. X-Sentry-Auth and Content-Type
+	Endpoint string      `json:"endpoint,omitempty"` //ingest endpoint type of the request, e.g. envelope
+	Attempts int         `json:"attempts,omitempty"` //forwards tried, including the one that spooled it; 0 counts as 1
+	Created  time.Time   `json:"created"`
+	Body     []byte      `json:"-"`
+}
+
+// Spool is a size-bounded FIFO of entries on disk. Entries older than MaxAge, then the oldest entries
+// while over MaxBytes, are evicted when new entries are added. Safe for concurrent use.
+type Spool struct {
+	Clock sentrydsn.Clock //tells the time for entry ages and creation, the system clock when nil; set before use
+
+	dir      string
+	maxBytes int64         //0 means unbounded
+	maxAge   time.Duration //0 means entries never expire
+
+	mu       sync.Mutex //guards the directory listing and seq
+	seq      uint64
+	replayMu sync.Mutex //serializes Replay so entries are never sent twice
+}
+
+// Open creates dir if necessary and returns a spool over it. Entries left by a previous process are kept.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Spool{dir: dir, maxBytes: maxBytes, maxAge: maxAge}, nil
+}
+
+// Put writes e to disk, evicting expired and then oldest entries to stay within the size bound.
+func (s *Spool) Put(e *Entry) error {
+
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	size := int64(len(meta)) + 1 + int64(len(e.Body))
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return ErrEntryTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	now := sentrydsn.Now(s.Clock)
+	for len(files) > 0 && ((s.maxAge > 0 && now.Sub(files[0].created) > s.maxAge) || (s.maxBytes > 0 && total+size > s.maxBytes)) {
+		os.Remove(files[0].path)
+		total -= files[0].size
+		files = files[1:]
+	}
+
+	created := e.Created
+	if created.IsZero() {
+		created = now
+	}
+	s.seq++
+	name := fmt.Sprintf("%020d-%010d%s", created.UnixNano(), s.seq, spoolExt)
+	return s.write(filepath.Join(s.dir, name), meta, e.Body)
+}
+
+// write stores an entry at path through a temporary file, so readers never see it half written.
+func (s *Spool) write(path string, meta []byte, body []byte) error {
+
+	tmp, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	w.Write(meta)
+	w.WriteByte('\n')
+	w.Write(body)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Replay hands entries to fn oldest first, removing each one fn accepts.
+// It stops at the first error, which usually means the upstream is still down, and returns the number replayed.
+// Expired entries are discarded without being replayed.
+// Each replay counts as an attempt: fn sees Attempts including the one it makes, and an entry fn rejects is
+// kept with that count. Put is not blocked while fn runs.
+func (s *Spool) Replay(fn func(e *Entry) error) (int, error) {
+
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	files, err := s.files()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, f := range files {
+		if s.maxAge > 0 && sentrydsn.Now(s.Clock).Sub(f.created) > s.maxAge {
+			os.Remove(f.path)
+			continue
+		}
+		e, err := readEntry(f.path)
+		if err != nil {
+			//unreadable entries would block the queue forever
+			os.Remove(f.path)
+			continue
+		}
+		e.Attempts = max(e.Attempts, 1) + 1
+		if err := fn(e); err != nil {
+			s.retried(f.path, e)
+			return replayed, err
+		}
+		os.Remove(f.path)
+		replayed++
+	}
+	return replayed, nil
+}
+
+// retried stores the attempt count of an entry fn rejected, unless Put evicted it in the meantime.
+func (s *Spool) retried(path string, e *Entry) {
+
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	s.write(path, meta, e.Body)
+}
+
+// Run calls Replay every interval until ctx is done.
+func (s *Spool) Run(ctx context.Context, interval time.Duration, fn func(e *Entry) error) {
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.Replay(fn)
+		}
+	}
+}
+
+// Stats returns the number of spooled entries and their size on disk.
+func (s *Spool) Stats() (entries int, bytes int64) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, _ := s.files()
+	for _, f := range files {
+		bytes += f.size
+	}
+	return len(files), bytes
+}
+
+type spoolFile struct {
+	path    string
+	size    int64
+	created time.Time
+}
+
+// files lists spooled entries oldest first. Callers hold s.mu.
+func (s *Spool) files() ([]spoolFile, error) {
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []spoolFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		var nanos, seq int64
+		if _, err := fmt.Sscanf(name, "%020d-%010d", &nanos, &seq); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			//removed since the directory was read
+			continue
+		}
+		files = append(files, spoolFile{path: filepath.Join(s.dir, name), size: info.Size(), created: time.Unix(0, nanos)})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+func readEntry(path string) (*Entry, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	meta, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(meta, e); err != nil {
+		return nil, err
+	}
+	if e.Body, err = io.ReadAll(r); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,131 @@
+package spool
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+func testEntry(body string) *Entry {
+	return &Entry{
+		URL:    "https://sentry.io/api/1234/envelope/",
+		Header: http.Header{"X-Sentry-Auth": []string{"Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5"}},
+		Body:   []byte(body),
+	}
+}
+
+func TestPutReplayFIFO(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	for _, body := range []string{"first", "second", "third"} {
+		if err := s.Put(testEntry(body)); err != nil {
+			t.Fatalf("Expected -- nil -- Got %s", err)
+		}
+	}
+
+	//upstream still down after the first entry
+	var got []string
+	down := errors.New("down")
+	n, err := s.Replay(func(e *Entry) error {
+		if len(got) == 1 {
+			return down
+		}
+		got = append(got, string(e.Body))
+		return nil
+	})
+	if n != 1 || err != down {
+		t.Errorf("Expected -- 1 down -- Got %d %v", n, err)
+	}
+	if entries, _ := s.Stats(); entries != 2 {
+		t.Errorf("Expected -- 2 entries left -- Got %d", entries)
+	}
+
+	n, _ = s.Replay(func(e *Entry) error {
+		if e.Header.Get("X-Sentry-Auth") == "" || e.URL == "" {
+			t.Errorf("Expected metadata to survive the round trip -- Got %v", e)
+		}
+		got = append(got, string(e.Body))
+		return nil
+	})
+	if n != 2 || len(got) != 3 || got[0] != "first" || got[1] != "second" || got[2] != "third" {
+		t.Errorf("Expected -- [first second third] -- Got %v", got)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir, 400, time.Hour)
+
+	old := testEntry("expired")
+	old.Created = time.Now().Add(-2 * time.Hour)
+	s.Put(old)
+	for _, body := range []string{"a", "b", "c", "d"} {
+		s.Put(testEntry(body))
+	}
+	if _, bytes := s.Stats(); bytes > 400 {
+		t.Errorf("Expected -- at most 400 bytes -- Got %d", bytes)
+	}
+	var got []string
+	s.Replay(func(e *Entry) error {
+		got = append(got, string(e.Body))
+		return nil
+	})
+	if len(got) == 0 || got[0] == "expired" || got[len(got)-1] != "d" {
+		t.Errorf("Expected oldest entries evicted first -- Got %v", got)
+	}
+
+	if err := s.Put(testEntry(string(make([]byte, 500)))); err != ErrEntryTooLarge {
+		t.Errorf("Expected -- %s -- Got %v", ErrEntryTooLarge, err)
+	}
+}
+
+func TestReplayAttempts(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %s", err)
+	}
+	s.Put(testEntry("first"))
+
+	var attempts []int
+	down := errors.New("down")
+	for i := 0; i < 3; i++ {
+		s.Replay(func(e *Entry) error {
+			attempts = append(attempts, e.Attempts)
+			if len(attempts) < 3 {
+				return down
+			}
+			return nil
+		})
+	}
+	if len(attempts) != 3 || attempts[0] != 2 || attempts[1] != 3 || attempts[2] != 4 {
+		t.Errorf("Expected -- [2 3 4] -- Got %v", attempts)
+	}
+	if entries, _ := s.Stats(); entries != 0 {
+		t.Errorf("Expected -- 0 entries left -- Got %d", entries)
+	}
+}
+
+func TestSpoolClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s, _ := Open(t.TempDir(), 0, time.Hour)
+	s.Clock = sentrydsn.ClockFunc(func() time.Time { return now })
+
+	s.Put(testEntry("first"))
+	now = now.Add(30 * time.Minute)
+	s.Put(testEntry("second"))
+	now = now.Add(45 * time.Minute)
+	var got []string
+	s.Replay(func(e *Entry) error {
+		got = append(got, string(e.Body))
+		return nil
+	})
+	if len(got) != 1 || got[0] != "second" {
+		t.Errorf("Expected -- [second] -- Got %v", got)
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/sentry-demos/sentrydsn/traefik
+
+go 1.24
+
+require github.com/sentry-demos/sentrydsn v0.0.0
+
+replace github.com/sentry-demos/sentrydsn => ../
@@ -0,0 +1,87 @@
+// Package traefik is a Traefik middleware plugin running the DSN parser at the edge.
+// Requests whose DSN cannot be derived, or points at a host or project that is not allowed, are rejected;
+// accepted requests carry the parsed project in headers so services and later middlewares can route on it.
+//
+// Traefik loads plugins from source with Yaegi, which ignores go.mod and so the replace directive pointing at
+// the parent module. See the README for running the plugin locally and for vendoring it before a release.
+package traefik
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+// ErrProjectNotAllowed Thrown if a request's project is not listed in Config.AllowedProjects
+var ErrProjectNotAllowed = errors.New("sentry:  project not allowed")
+
+// headers set on accepted requests
+const (
+	headerProjectID = "X-Sentry-Project-Id"
+	headerPublicKey = "X-Sentry-Public-Key"
+	headerEndpoint  = "X-Sentry-Endpoint"
+)
+
+// Config is the plugin configuration.
+type Config struct {
+	AllowedHosts    []string `json:"allowedHosts,omitempty"`    //hosts DSNs may point at, see sentrydsn.HostAllowlist
+	AllowedProjects []string `json:"allowedProjects,omitempty"` //project IDs accepted; empty accepts every project
+	DSNHeader       string   `json:"dsnHeader,omitempty"`       //read a full DSN from this header instead of path and auth
+}
+
+// CreateConfig returns the default plugin configuration.
+func CreateConfig() *Config {
+	return &Config{}
+}
+
+// Middleware validates Sentry ingest requests before passing them on.
+type Middleware struct {
+	next      http.Handler
+	name      string
+	extractor sentrydsn.Extractor
+	hosts     sentrydsn.HostAllowlist
+	projects  map[string]bool
+}
+
+// New creates the middleware.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+
+	m := &Middleware{next: next, name: name, hosts: sentrydsn.HostAllowlist(config.AllowedHosts)}
+	m.extractor = &sentrydsn.Parser{AllowedHosts: m.hosts}
+	if len(config.DSNHeader) > 0 {
+		m.extractor = sentrydsn.HeaderDSN(config.DSNHeader)
+	}
+	if len(config.AllowedProjects) > 0 {
+		m.projects = map[string]bool{}
+		for _, id := range config.AllowedProjects {
+			m.projects[id] = true
+		}
+	}
+	return m, nil
+}
+
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	dsn, err := m.extractor.Extract(r)
+	if err == nil {
+		err = m.hosts.Check(dsn.Host)
+	}
+	if err == nil && m.projects != nil && !m.projects[dsn.ProjectID] {
+		err = ErrProjectNotAllowed
+	}
+	if err == sentrydsn.ErrUntrustedHost || err == ErrProjectNotAllowed {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Header.Set(headerProjectID, dsn.ProjectID)
+	r.Header.Set(headerPublicKey, dsn.PublicKey)
+	r.Header.Set(headerEndpoint, string(dsn.Endpoint))
+	m.next.ServeHTTP(w, r.WithContext(sentrydsn.ContextWithDSN(r.Context(), dsn)))
+}
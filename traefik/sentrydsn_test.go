@@ -0,0 +1,53 @@
+package traefik
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sentry-demos/sentrydsn"
+)
+
+var testTableMiddleware = []struct {
+	url         string
+	description string
+	expected    int
+	project     string
+	err         error
+}{
+	{"https://o1.ingest.sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "allowed project", http.StatusOK, "1234", nil},
+	{"https://o1.ingest.sentry.io/api/5678/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "project not allowed", http.StatusForbidden, "", ErrProjectNotAllowed},
+	{"https://attacker.example.com/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "host not allowed", http.StatusForbidden, "", sentrydsn.ErrUntrustedHost},
+	{"https://o1.ingest.sentry.io/api/1234/envelope/", "missing key", http.StatusBadRequest, "", sentrydsn.ErrMissingUser},
+}
+
+func TestMiddleware(t *testing.T) {
+	config := CreateConfig()
+	config.AllowedHosts = []string{"*.ingest.sentry.io"}
+	config.AllowedProjects = []string{"1234"}
+
+	var project string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project = r.Header.Get("X-Sentry-Project-Id")
+		if dsn, err := sentrydsn.DSNFromContextErr(r.Context()); err != nil || dsn.ProjectID != project {
+			t.Errorf("Expected -- dsn for %s in context -- Got %v %v", project, dsn, err)
+		}
+	})
+	h, err := New(context.Background(), next, config, "sentrydsn")
+	if err != nil {
+		t.Fatalf("Expected -- nil -- Got %v", err)
+	}
+	for _, test := range testTableMiddleware {
+		project = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", test.url, strings.NewReader("{}\n")))
+		if w.Code != test.expected || project != test.project {
+			t.Errorf("%s: Expected -- %v %v -- Got %v %v", test.description, test.expected, test.project, w.Code, project)
+		}
+		if test.err != nil && !strings.Contains(w.Body.String(), test.err.Error()) {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.err, w.Body.String())
+		}
+	}
+}
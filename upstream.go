@@ -0,0 +1,77 @@
+package sentrydsn
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseUpstream validates an upstream from configuration, e.g. a tunnel's upstream, and returns it as a base URL:
+// scheme, canonical host and any path prefix, without a trailing slash. A full client DSN is accepted too, since
+// that is what operators usually have at hand; it is checked with ParseDSN and its keys and project are dropped.
+// Errors say what is wrong with the value and wrap ErrInvalidDSN, ErrInvalidHost, ErrMissingHost or ParseDSN's.
+func ParseUpstream(raw string) (string, error) {
+
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	switch {
+	case len(raw) == 0:
+		return "", fmt.Errorf("sentry:  invalid upstream: empty: %w", ErrMissingHost)
+	case err != nil:
+		return "", fmt.Errorf("sentry:  invalid upstream %q: not a URL: %w", raw, ErrInvalidDSN)
+	case !strings.Contains(raw, "://"):
+		return "", fmt.Errorf("sentry:  invalid upstream %q: no scheme, e.g. https://%s: %w", raw, raw, ErrInvalidDSN)
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "", fmt.Errorf("sentry:  invalid upstream %q: scheme %q is not http or https: %w", u.Redacted(), u.Scheme, ErrInvalidDSN)
+	case len(u.Host) == 0:
+		return "", fmt.Errorf("sentry:  invalid upstream %q: no host: %w", u.Redacted(), ErrMissingHost)
+	case len(u.RawQuery) > 0 || len(u.Fragment) > 0:
+		return "", fmt.Errorf("sentry:  invalid upstream %q: unexpected query or fragment: %w", u.Redacted(), ErrInvalidDSN)
+	}
+	if u.User != nil {
+		dsn, err := ParseDSN(raw)
+		if err != nil {
+			return "", fmt.Errorf("sentry:  invalid upstream %q: %s: %w", u.Redacted(), dsnProblem(err), err)
+		}
+		return dsn.Scheme + "://" + dsn.Host + dsn.PathPrefix, nil
+	}
+	host, err := ParseHost(u.Host)
+	if err != nil {
+		return "", fmt.Errorf("sentry:  invalid upstream %q: %w", raw, err)
+	}
+	return u.Scheme + "://" + host + strings.TrimSuffix(u.EscapedPath(), "/"), nil
+}
+
+// ParseHost validates a host from configuration, e.g. Parser.IngestHost, and returns it in CanonicalHost form.
+// Errors say what is wrong, e.g. a URL given where a host was expected, and wrap ErrInvalidHost or ErrMissingHost.
+func ParseHost(raw string) (string, error) {
+
+	raw = strings.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", fmt.Errorf("sentry:  invalid host: empty: %w", ErrMissingHost)
+	}
+	if u, err := url.Parse(raw); err == nil && len(u.Scheme) > 0 && len(u.Host) > 0 {
+		return "", fmt.Errorf("sentry:  invalid host %q: a URL, not a host; use %q: %w", u.Redacted(), CanonicalHost(u.Host), ErrInvalidHost)
+	}
+	if strings.Contains(raw, "/") {
+		return "", fmt.Errorf("sentry:  invalid host %q: hosts have no path: %w", raw, ErrInvalidHost)
+	}
+	host := CanonicalHost(raw)
+	if !validHost(host) {
+		return "", fmt.Errorf("sentry:  invalid host %q: not a hostname or IP with an optional port: %w", raw, ErrInvalidHost)
+	}
+	return host, nil
+}
+
+// dsnProblem explains a ParseDSN error for configuration messages.
+func dsnProblem(err error) string {
+
+	switch {
+	case errors.Is(err, ErrMissingUser):
+		return "dsn without public key"
+	case errors.Is(err, ErrMissingProjectID):
+		return "dsn without project ID, it should end in /<project_id>"
+	}
+	return "dsn keys are not 32 hex characters, or its host is malformed"
+}
@@ -0,0 +1,32 @@
+package sentrydsn
+
+// Warning flags a deprecated way of authenticating that was still accepted, so platform teams can find
+// and upgrade the SDKs still using it, or with Parser.Shadow a restriction that was not enforced, see
+// ShadowWarning.
+type Warning struct {
+	Code    string `json:"code"` //stable label for metrics
+	Message string `json:"message"`
+}
+
+var (
+	// WarnSecretKey is raised when the client sent sentry_secret, which Sentry has ignored since 9.0.
+	WarnSecretKey = Warning{Code: "secret_key", Message: "sentry_secret is deprecated; remove the secret from the client DSN"}
+	// WarnQueryAuth is raised when keys came from the query string of a store or envelope request instead of X-Sentry-Auth.
+	// Browser reports (NEL, Reporting API) can only authenticate this way and are not flagged.
+	WarnQueryAuth = Warning{Code: "query_string_auth", Message: "keys in the query string are deprecated; send them in X-Sentry-Auth"}
+	// WarnDuplicateKey is raised when sentry_key or sentry_secret was repeated in the query string with different
+	// values, see DuplicatePolicy.
+	WarnDuplicateKey = Warning{Code: "duplicate_key", Message: "sentry_key or sentry_secret was sent several times with different values"}
+)
+
+// dropWarning returns warnings without w.
+func dropWarning(warnings []Warning, w Warning) []Warning {
+
+	kept := warnings[:0]
+	for _, v := range warnings {
+		if v != w {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
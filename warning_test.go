@@ -0,0 +1,36 @@
+package sentrydsn
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testTableWarnings = []struct {
+	url         string
+	header      string
+	description string
+	expected    []Warning
+}{
+	{"https://sentry.io/api/1234/envelope/", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5", "header auth", nil},
+	{"https://sentry.io/api/1234/envelope/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "", "query string auth", []Warning{WarnQueryAuth}},
+	{"https://sentry.io/api/1234/store/", "Sentry sentry_key=4784fbc50de2473f9977cfce8a9adce5, sentry_secret=4784fbc50de2473f9977cfce8a9adce5", "secret key", []Warning{WarnSecretKey}},
+	{"https://sentry.io/api/1234/store/?sentry_key=4784fbc50de2473f9977cfce8a9adce5&sentry_secret=4784fbc50de2473f9977cfce8a9adce5", "", "both", []Warning{WarnQueryAuth, WarnSecretKey}},
+	{"https://sentry.io/api/1234/nel/?sentry_key=4784fbc50de2473f9977cfce8a9adce5", "", "browser reports are exempt", []Warning{}},
+}
+
+func TestWarnings(t *testing.T) {
+	for _, test := range testTableWarnings {
+		r := httptest.NewRequest("POST", test.url, strings.NewReader("{}"))
+		if len(test.header) > 0 {
+			r.Header.Set("X-Sentry-Auth", test.header)
+		}
+		got, err := FromRequest(r)
+		if err != nil {
+			t.Errorf("%s: Expected -- nil -- Got %v", test.description, err)
+		} else if len(got.Warnings) != len(test.expected) || (len(test.expected) > 0 && !reflect.DeepEqual(got.Warnings, test.expected)) {
+			t.Errorf("%s: Expected -- %v -- Got %v", test.description, test.expected, got.Warnings)
+		}
+	}
+}